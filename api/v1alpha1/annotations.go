@@ -0,0 +1,32 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// Annotations set by the controller on the CertificateRequests and
+// CertificateSigningRequests that failed to be signed, so that their retry
+// backoff survives a restart of the controller. They are removed once the
+// request is signed.
+const (
+	// SigningAttemptsAnnotationKey is the number of failed signing attempts.
+	SigningAttemptsAnnotationKey = "cfmtls.cert.manager.io/signing-attempts"
+	// LastSigningErrorAnnotationKey is the reason of the last failed
+	// signing attempt, one of the Reason* constants.
+	LastSigningErrorAnnotationKey = "cfmtls.cert.manager.io/last-signing-error"
+	// LastSigningAttemptAnnotationKey is the time of the last failed signing
+	// attempt, in RFC 3339 format.
+	LastSigningAttemptAnnotationKey = "cfmtls.cert.manager.io/last-signing-attempt"
+)
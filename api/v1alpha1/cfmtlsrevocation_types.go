@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Revoked",type="string",JSONPath=".status.conditions[?(@.type==\"Revoked\")].status"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Revoked\")].reason"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Revoked\")].message",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CFMTLSRevocation requests the revocation of certificates issued by
+// Cloudflare. Certificates are selected either by their Cloudflare ID or by
+// the cert-manager Certificate they were issued for. A CFMTLSRevocation is
+// processed once; delete and recreate it to revoke again.
+type CFMTLSRevocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CFMTLSRevocationSpec   `json:"spec,omitempty"`
+	Status CFMTLSRevocationStatus `json:"status,omitempty"`
+}
+
+// CFMTLSRevocationSpec selects the certificates to revoke.
+// +kubebuilder:validation:XValidation:rule="has(self.certificateID) != has(self.certificateRef)",message="exactly one of certificateID and certificateRef must be set"
+type CFMTLSRevocationSpec struct {
+	// IssuerRef references the issuer whose Cloudflare credentials are used
+	// to revoke the certificates. A CFMTLSIssuer must be in the same namespace
+	// as the CFMTLSRevocation.
+	IssuerRef IssuerReference `json:"issuerRef"`
+
+	// CertificateID is the Cloudflare ID of the certificate to revoke. The
+	// certificate must be tracked by a CloudflareOriginCertificate in the same
+	// namespace, unless the CFMTLSRevocation is created in the cluster
+	// resource namespace.
+	// +optional
+	CertificateID string `json:"certificateID,omitempty"`
+
+	// CertificateRef references a cert-manager Certificate in the same
+	// namespace. All tracked certificates issued for it are revoked.
+	// +optional
+	CertificateRef *LocalObjectReference `json:"certificateRef,omitempty"`
+
+	// Reason is a free-form explanation of the revocation, kept for audit.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// LocalObjectReference references an object in the same namespace.
+type LocalObjectReference struct {
+	// Name of the object.
+	Name string `json:"name"`
+}
+
+// CFMTLSRevocationStatus reports the outcome of a revocation.
+type CFMTLSRevocationStatus struct {
+	// Conditions contains the Revoked condition.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// RevokedCertificateIDs lists the Cloudflare IDs of the certificates that
+	// were revoked.
+	// +optional
+	// +listType=set
+	RevokedCertificateIDs []string `json:"revokedCertificateIDs,omitempty"`
+
+	// RevocationTime is the time at which the last certificate was revoked.
+	// +optional
+	RevocationTime *metav1.Time `json:"revocationTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CFMTLSRevocationList contains a list of CFMTLSRevocation.
+type CFMTLSRevocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CFMTLSRevocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CFMTLSRevocation{}, &CFMTLSRevocationList{})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CertificateNameLabelKey is set on CloudflareOriginCertificates to the name
+// of the cert-manager Certificate that the request was created for, if any.
+const CertificateNameLabelKey = "cfmtls.cert.manager.io/certificate-name"
+
+// TenantLabelKey is set on CloudflareOriginCertificates to the tenant of the
+// request, which is the value of the --tenant-label of its namespace.
+const TenantLabelKey = "cfmtls.cert.manager.io/tenant"
+
+// RevokeOnDeleteFinalizer is set on CloudflareOriginCertificates issued by
+// issuers with revocationPolicy OnDelete. It is removed once the certificate
+// has been revoked at Cloudflare.
+const RevokeOnDeleteFinalizer = "cfmtls.cert.manager.io/revoke-on-delete"
+
+// SupersededAtAnnotationKey is set on CloudflareOriginCertificates, in RFC
+// 3339 format, when a renewal of their Certificate issued a new certificate
+// for the same hostnames, if the issuer sets revokeSupersededAfter.
+const SupersededAtAnnotationKey = "cfmtls.cert.manager.io/superseded-at"
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=cfcert
+// +kubebuilder:printcolumn:name="Certificate ID",type="string",JSONPath=".spec.certificateID"
+// +kubebuilder:printcolumn:name="Request",type="string",JSONPath=".spec.certificateRequestRef.name"
+// +kubebuilder:printcolumn:name="Expires",type="date",JSONPath=".spec.notAfter"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CloudflareOriginCertificate records a certificate that was issued by
+// Cloudflare through a CFMTLSIssuer or CFMTLSClusterIssuer. It is created by
+// the controller when a request is signed and is the source of truth for
+// revocation and garbage collection of the certificate at Cloudflare.
+type CloudflareOriginCertificate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CloudflareOriginCertificateSpec `json:"spec,omitempty"`
+}
+
+// CloudflareOriginCertificateSpec describes an issued certificate.
+type CloudflareOriginCertificateSpec struct {
+	// CertificateID is the ID of the certificate at Cloudflare.
+	CertificateID string `json:"certificateID"`
+
+	// ZoneID is the ID of the Cloudflare zone the certificate was issued for.
+	ZoneID string `json:"zoneID"`
+
+	// SerialNumber is the hex encoded serial number of the certificate.
+	// +optional
+	SerialNumber string `json:"serialNumber,omitempty"`
+
+	// Hostnames are the DNS names of the certificate.
+	// +optional
+	// +listType=atomic
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// NotAfter is the time at which the certificate expires.
+	// +optional
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+
+	// IssuerRef references the issuer that signed the certificate.
+	IssuerRef IssuerReference `json:"issuerRef"`
+
+	// CertificateRequestRef references the request the certificate was
+	// issued for.
+	CertificateRequestRef RequestReference `json:"certificateRequestRef"`
+}
+
+// IssuerReference references a CFMTLSIssuer or CFMTLSClusterIssuer.
+type IssuerReference struct {
+	// Kind of the issuer, either CFMTLSIssuer or CFMTLSClusterIssuer.
+	Kind string `json:"kind"`
+	// Name of the issuer.
+	Name string `json:"name"`
+}
+
+// RequestReference references a cert-manager CertificateRequest or a
+// Kubernetes CertificateSigningRequest.
+type RequestReference struct {
+	// Kind of the request, either CertificateRequest or
+	// CertificateSigningRequest.
+	Kind string `json:"kind"`
+	// Namespace of the request. Empty for CertificateSigningRequests.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the request.
+	Name string `json:"name"`
+	// UID of the request.
+	// +optional
+	UID string `json:"uid,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CloudflareOriginCertificateList contains a list of CloudflareOriginCertificate.
+type CloudflareOriginCertificateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudflareOriginCertificate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CloudflareOriginCertificate{}, &CloudflareOriginCertificateList{})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+const (
+	// IssuerConditionCloudflareReady is set on CFMTLSIssuers and
+	// CFMTLSClusterIssuers next to the Ready condition managed by issuer-lib.
+	// Its reason is one of the Reason* constants below.
+	IssuerConditionCloudflareReady = "CloudflareReady"
+
+	// CertificateRequestConditionCloudflareIssued is set on
+	// CertificateRequests that failed to be signed by Cloudflare. Its reason
+	// is one of the Reason* constants below.
+	CertificateRequestConditionCloudflareIssued = "CloudflareIssued"
+
+	// RevocationConditionRevoked is set on CFMTLSRevocations once the
+	// referenced certificates have been revoked at Cloudflare, or with status
+	// False and one of the Reason* constants below if revocation failed.
+	RevocationConditionRevoked = "Revoked"
+)
+
+// Condition reasons set by the controller. They describe the class of
+// failure, so that automation can react to them without parsing messages.
+const (
+	// ReasonChecked means that the issuer passed its health check.
+	ReasonChecked = "Checked"
+	// ReasonInvalidConfiguration means that the issuer spec cannot be used.
+	ReasonInvalidConfiguration = "InvalidConfiguration"
+	// ReasonSecretNotFound means that the auth Secret does not exist.
+	ReasonSecretNotFound = "SecretNotFound"
+	// ReasonSecretInvalid means that the auth Secret lacks required keys.
+	ReasonSecretInvalid = "SecretInvalid"
+	// ReasonTokenInvalid means that Cloudflare rejected the API token.
+	ReasonTokenInvalid = "TokenInvalid"
+	// ReasonTokenTooBroad means that the API token grants access beyond the
+	// zone of the issuer and its TokenScopeCheck is "Enforce".
+	ReasonTokenTooBroad = "TokenTooBroad"
+	// ReasonZoneNotFound means that Cloudflare does not know the zone.
+	ReasonZoneNotFound = "ZoneNotFound"
+	// ReasonQuotaExceeded means that Cloudflare rate limited the request.
+	ReasonQuotaExceeded = "QuotaExceeded"
+	// ReasonAPIUnreachable means that the Cloudflare API could not be reached
+	// or returned a server error.
+	ReasonAPIUnreachable = "APIUnreachable"
+	// ReasonUpstreamUnavailable means that the request was not sent, as the
+	// Cloudflare API failed repeatedly and is given time to recover.
+	ReasonUpstreamUnavailable = "UpstreamUnavailable"
+	// ReasonIssuanceDeferred means that the request was not sent, as the
+	// weekly issuance budget of the zone is nearly used up and the request
+	// is not urgent.
+	ReasonIssuanceDeferred = "IssuanceDeferred"
+	// ReasonOutsideMaintenanceWindow means that the request was not sent,
+	// as it is a renewal that is not urgent and none of the maintenance
+	// windows of the issuer is open.
+	ReasonOutsideMaintenanceWindow = "OutsideMaintenanceWindow"
+	// ReasonTLSPinMismatch means that the TLS connection to the Cloudflare
+	// API did not match the pinned digests of the issuer, e.g. because it
+	// was intercepted.
+	ReasonTLSPinMismatch = "TLSPinMismatch"
+	// ReasonAPIError means that the Cloudflare API returned an unexpected
+	// response.
+	ReasonAPIError = "APIError"
+	// ReasonInvalidRequest means that the CertificateRequest cannot be
+	// signed by Cloudflare.
+	ReasonInvalidRequest = "InvalidRequest"
+	// ReasonPolicyViolation means that the CertificateRequest is not allowed
+	// by the policy of the issuer.
+	ReasonPolicyViolation = "PolicyViolation"
+	// ReasonHostnameConflict means that the request is not signed, as a
+	// certificate for one of its DNS names was issued to another namespace.
+	ReasonHostnameConflict = "HostnameConflict"
+	// ReasonApprovalPending means that the request is not signed until it
+	// is approved.
+	ReasonApprovalPending = "ApprovalPending"
+	// ReasonDenied means that the request was denied.
+	ReasonDenied = "Denied"
+	// ReasonPaused means that the issuer is paused.
+	ReasonPaused = "Paused"
+	// ReasonRevoked means that the certificates were revoked at Cloudflare.
+	ReasonRevoked = "Revoked"
+	// ReasonCertificateNotFound means that no issued certificate matches the
+	// revocation request, or that Cloudflare does not know the certificate.
+	ReasonCertificateNotFound = "CertificateNotFound"
+	// ReasonInternalError is used for errors that fit no other reason.
+	ReasonInternalError = "InternalError"
+)
@@ -0,0 +1,26 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// v1alpha1 is the storage version and the version reconciled by the
+// controller, so it acts as the conversion hub for all other versions.
+
+// Hub marks this type as a conversion hub.
+func (*CFMTLSIssuer) Hub() {}
+
+// Hub marks this type as a conversion hub.
+func (*CFMTLSClusterIssuer) Hub() {}
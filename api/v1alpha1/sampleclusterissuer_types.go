@@ -23,13 +23,18 @@ import (
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Zone",type="string",JSONPath=".status.zoneID"
+// +kubebuilder:printcolumn:name="Mode",type="string",JSONPath=".status.mode"
 // +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
 // +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message"
 // +kubebuilder:printcolumn:name="LastTransition",type="string",type="date",JSONPath=".status.conditions[?(@.type==\"Ready\")].lastTransitionTime"
 // +kubebuilder:printcolumn:name="ObservedGeneration",type="integer",JSONPath=".status.conditions[?(@.type==\"Ready\")].observedGeneration"
 // +kubebuilder:printcolumn:name="Generation",type="integer",JSONPath=".metadata.generation"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused",priority=1
+// +kubebuilder:printcolumn:name="LastError",type="string",JSONPath=".status.lastError",priority=0
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // CFMTLSClusterIssuer is the Schema for the CFMTLSClusterIssuers API.
@@ -37,12 +42,12 @@ type CFMTLSClusterIssuer struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   IssuerSpec            `json:"spec,omitempty"`
-	Status v1alpha1.IssuerStatus `json:"status,omitempty"`
+	Spec   IssuerSpec   `json:"spec,omitempty"`
+	Status IssuerStatus `json:"status,omitempty"`
 }
 
 func (vi *CFMTLSClusterIssuer) GetStatus() *v1alpha1.IssuerStatus {
-	return &vi.Status
+	return &vi.Status.IssuerStatus
 }
 
 // GetIssuerTypeIdentifier returns a string that uniquely identifies the
@@ -54,10 +59,20 @@ func (vi *CFMTLSClusterIssuer) GetStatus() *v1alpha1.IssuerStatus {
 // "simpleclusterissuers.issuer.cert-manager.io" will match all CSRs
 // with an issuerName set to eg. "simpleclusterissuers.issuer.cert-manager.io/issuer1".
 func (vi *CFMTLSClusterIssuer) GetIssuerTypeIdentifier() string {
-	// ACTION REQUIRED: Change this to a unique string that identifies your cluster issuer
-	return "CFMTLSClusterIssuers.cfmtls.cert.manager.io"
+	return ClusterIssuerTypeIdentifier
 }
 
+// DefaultClusterIssuerTypeIdentifier is the default issuer type identifier
+// of CFMTLSClusterIssuers.
+const DefaultClusterIssuerTypeIdentifier = "CFMTLSClusterIssuers.cfmtls.cert.manager.io"
+
+// ClusterIssuerTypeIdentifier is the issuer type identifier of
+// CFMTLSClusterIssuers, and thereby the signerName prefix of the Kubernetes
+// CertificateSigningRequests they sign. It may be changed before the
+// controllers are set up, so that several instances of the controller in a
+// cluster do not sign each other's requests.
+var ClusterIssuerTypeIdentifier = DefaultClusterIssuerTypeIdentifier
+
 // issuer-lib requires that we implement the Issuer interface
 // so that it can interact with our Issuer resource.
 var _ v1alpha1.Issuer = &CFMTLSClusterIssuer{}
@@ -0,0 +1,680 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+// +kubebuilder:printcolumn:name="Zone",type="string",JSONPath=".status.zoneID"
+// +kubebuilder:printcolumn:name="Mode",type="string",JSONPath=".status.mode"
+// +kubebuilder:printcolumn:name="Reason",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].reason"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message"
+// +kubebuilder:printcolumn:name="LastTransition",type="string",type="date",JSONPath=".status.conditions[?(@.type==\"Ready\")].lastTransitionTime"
+// +kubebuilder:printcolumn:name="ObservedGeneration",type="integer",JSONPath=".status.conditions[?(@.type==\"Ready\")].observedGeneration"
+// +kubebuilder:printcolumn:name="Generation",type="integer",JSONPath=".metadata.generation"
+// +kubebuilder:printcolumn:name="Paused",type="boolean",JSONPath=".spec.paused",priority=1
+// +kubebuilder:printcolumn:name="LastError",type="string",JSONPath=".status.lastError",priority=0
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CFMTLSIssuer is the Schema for the CFMTLSIssuers API.
+type CFMTLSIssuer struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IssuerSpec   `json:"spec,omitempty"`
+	Status IssuerStatus `json:"status,omitempty"`
+}
+
+// IssuerSpec defines the desired state of CFMTLSIssuer
+type IssuerSpec struct {
+	// ZoneID is the ID of the Cloudflare zone that certificates are issued
+	// for. If empty, the zone ID is read from the auth Secret.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{32}$`
+	ZoneID string `json:"zoneID,omitempty"`
+
+	// Auth configures the credentials used to talk to the Cloudflare API.
+	// A CFMTLSClusterIssuer may omit it to use the default credentials
+	// configured in the controller environment.
+	// +optional
+	Auth IssuerAuth `json:"auth,omitempty"`
+
+	// Paused stops the controller from signing certificates through this
+	// issuer. CertificateRequests are kept pending until the issuer is
+	// resumed. This is useful during Cloudflare incidents or credential
+	// rotation.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// MaxRetryDuration is how long a CertificateRequest is retried after a
+	// transient Cloudflare error before it is marked as failed. cert-manager
+	// only creates a new request for a failed one after its own backoff of an
+	// hour or more, so this should outlast short Cloudflare outages.
+	// Defaults to the controller's --max-retry-duration, 15 minutes unless
+	// configured.
+	// +optional
+	MaxRetryDuration *metav1.Duration `json:"maxRetryDuration,omitempty"`
+
+	// InitialBackoff is the delay before the first retry of a failed signing
+	// attempt. Defaults to 5 seconds.
+	// +optional
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+
+	// BackoffMultiplier is the factor the retry delay is multiplied by after
+	// each failed signing attempt, between 1 and 10, e.g. "1.5". Defaults to
+	// 2.
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="quantity(string(self)).compareTo(quantity('1')) >= 0 && quantity(string(self)).compareTo(quantity('10')) <= 0",message="must be between 1 and 10"
+	BackoffMultiplier *resource.Quantity `json:"backoffMultiplier,omitempty"`
+
+	// RequestTimeout is the timeout of requests to the Cloudflare API made
+	// on behalf of this issuer. Defaults to 10 seconds.
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// Proxy configures an egress proxy for requests to the Cloudflare API.
+	// +optional
+	Proxy *ProxyConfig `json:"proxy,omitempty"`
+
+	// PinnedCertSHA256 pins the TLS connections to the Cloudflare API to the
+	// given hex encoded SHA-256 digests. A connection is only used if one of
+	// the certificates of its verified chain, or its public key
+	// (SubjectPublicKeyInfo), has one of the digests, so that TLS
+	// interception of the issuance channel is detected, even by a proxy
+	// whose CA is trusted. If empty, the connections are not pinned.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:items:Pattern=`^[0-9a-fA-F]{64}$`
+	PinnedCertSHA256 []string `json:"pinnedCertSHA256,omitempty"`
+
+	// AllowedDomains restricts the DNS names and common name of certificates
+	// signed by this issuer to the given domains and their subdomains. An
+	// entry of the form "*.example.com" only matches subdomains. If empty,
+	// all domains are allowed.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:items:MaxLength=253
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+
+	// DeniedDomains lists domains, in the same format as AllowedDomains, that
+	// this issuer must never sign certificates for. It takes precedence over
+	// AllowedDomains.
+	// +optional
+	// +listType=set
+	// +kubebuilder:validation:items:MaxLength=253
+	DeniedDomains []string `json:"deniedDomains,omitempty"`
+
+	// NamespaceSelector restricts the namespaces whose CertificateRequests a
+	// CFMTLSClusterIssuer signs to those matching the selector. It is only
+	// honoured for CFMTLSClusterIssuers. If unset, all namespaces may use
+	// the issuer.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// SubjectPatterns is a list of regular expressions that the common name
+	// and every subject alternative name of a request must match. Each name
+	// must fully match at least one pattern. If empty, all names are allowed.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:items:MaxLength=1024
+	SubjectPatterns []string `json:"subjectPatterns,omitempty"`
+
+	// DefaultValidityDays is the validity, in days, of certificates whose
+	// CertificateRequest does not specify a duration. Defaults to 90 days,
+	// the cert-manager default duration.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=3650
+	DefaultValidityDays int32 `json:"defaultValidityDays,omitempty"`
+
+	// Mode is the issuance mode of the issuer. With "OriginCA", the only
+	// mode, requests are signed by Cloudflare for the names in their CSR.
+	// Defaults to "OriginCA".
+	// +optional
+	Mode IssuerMode `json:"mode,omitempty"`
+
+	// ConfigMapRef references a ConfigMap holding non-secret configuration,
+	// so that only the API token has to live in the auth Secret. The
+	// ConfigMap is read from the same namespace as the auth Secret and may
+	// contain the keys "zone-id", "api-base-url" and "proxy-url". Fields set
+	// on the issuer take precedence over the ConfigMap.
+	// +optional
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
+	// CheckInterval is the interval at which the health check of the issuer
+	// is re-run, so that a revoked token or deleted zone is noticed without
+	// waiting for the issuer to change. Must be at least 1 minute. Unset
+	// disables periodic checks.
+	// +optional
+	CheckInterval *metav1.Duration `json:"checkInterval,omitempty"`
+
+	// TokenScopeCheck compares the policies of the API token with the zone
+	// of the issuer during its health check. With "Warn" a token that
+	// grants access to other zones or accounts is reported in
+	// status.tokenScopeWarning, with "Enforce" the issuer is not ready.
+	// Reading the policies requires the "API Tokens Read" permission. Unset
+	// disables the check.
+	// +optional
+	TokenScopeCheck TokenScopeCheckMode `json:"tokenScopeCheck,omitempty"`
+
+	// TokenRotation rolls the API token in the auth Secret before it
+	// expires and writes the new value back to the Secret. Only supported
+	// with Secret credentials and for tokens created with an expiry. The
+	// token needs the "API Tokens Edit" permission.
+	// +optional
+	TokenRotation *TokenRotation `json:"tokenRotation,omitempty"`
+
+	// RateLimit limits the requests sent to the Cloudflare API for the
+	// zone of the issuer, so that a renewal storm does not exhaust the API
+	// rate limit of Cloudflare. The limit is shared by all issuers of the
+	// zone. Defaults to the limit the controller is configured with.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	// RevocationPolicy selects what happens to the certificates issued at
+	// Cloudflare when they are no longer used. With "OnDelete" deleting the
+	// cert-manager Certificate, or the CloudflareOriginCertificate tracking
+	// an issued certificate, revokes the certificate at Cloudflare before
+	// the tracking object is removed. Defaults to "Never".
+	// +optional
+	RevocationPolicy RevocationPolicy `json:"revocationPolicy,omitempty"`
+
+	// RevokeSupersededAfter revokes the previous certificate of a
+	// cert-manager Certificate once a renewal issued a new certificate for
+	// the same hostnames, after this grace period, so that certificates no
+	// longer in use do not pile up in the zone. The grace period should
+	// cover the time workloads take to pick up the renewed certificate.
+	// Unset keeps superseded certificates until they expire.
+	// +optional
+	RevokeSupersededAfter *metav1.Duration `json:"revokeSupersededAfter,omitempty"`
+
+	// MaintenanceWindows are the recurring windows in which renewals are
+	// issued, e.g. to comply with change freezes. Renewals requested outside
+	// of them are kept pending until the next window opens, unless the
+	// certificate being renewed expires within 7 days. New certificates and
+	// CertificateSigningRequests are issued at any time. Unset issues at any
+	// time.
+	// +optional
+	// +listType=atomic
+	MaintenanceWindows []MaintenanceWindow `json:"maintenanceWindows,omitempty"`
+}
+
+// IssuerAuth configures the credentials used to talk to the Cloudflare API.
+// +kubebuilder:validation:XValidation:rule="[has(self.secretRef), has(self.file), has(self.vault), has(self.secretManager)].filter(x, x).size() <= 1",message="at most one of secretRef, file, vault and secretManager may be set"
+type IssuerAuth struct {
+	// SecretRef references the Secret holding the Cloudflare credentials.
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+
+	// File reads the credentials from files mounted into the controller,
+	// for example by the Secrets Store CSI driver, instead of from a Secret.
+	// The files are re-read on every use, so they can be rotated in place.
+	// Only supported on CFMTLSClusterIssuers and mutually exclusive with
+	// SecretRef.
+	// +optional
+	File *AuthFileSource `json:"file,omitempty"`
+
+	// Vault reads the credentials from a HashiCorp Vault KV version 2 secret
+	// at Check and Sign time, so the API token never has to be stored in a
+	// Kubernetes Secret. Mutually exclusive with SecretRef and File.
+	// +optional
+	Vault *VaultAuth `json:"vault,omitempty"`
+
+	// SecretManager reads the credentials from a cloud secret manager using
+	// the workload identity of the controller. Only supported on
+	// CFMTLSClusterIssuers and mutually exclusive with SecretRef, File and
+	// Vault.
+	// +optional
+	SecretManager *SecretManagerAuth `json:"secretManager,omitempty"`
+}
+
+// SecretReference references a Secret holding Cloudflare credentials.
+// +kubebuilder:validation:XValidation:rule="!has(self.apiTokenKey) || !has(self.zoneIDKey) || self.apiTokenKey != self.zoneIDKey",message="apiTokenKey and zoneIDKey must reference different keys"
+type SecretReference struct {
+	// Name of the Secret. For a CFMTLSIssuer the Secret is read from the
+	// namespace of the issuer. For a CFMTLSClusterIssuer it is read from the
+	// configured 'cluster resource namespace', unless Namespace is set.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	Name string `json:"name"`
+
+	// Namespace of the Secret. Only honoured for CFMTLSClusterIssuers, and
+	// must be listed in the controller's --cluster-issuer-secret-namespaces flag.
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Namespace string `json:"namespace,omitempty"`
+
+	// APITokenKey is the key holding the Cloudflare API token.
+	// Defaults to "cloudflare-api-key".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	APITokenKey string `json:"apiTokenKey,omitempty"`
+
+	// ZoneIDKey is the key holding the Cloudflare zone ID. It is only read
+	// when ZoneID is not set on the issuer. Defaults to "cloudflare-zone-id".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	ZoneIDKey string `json:"zoneIDKey,omitempty"`
+
+	// SecondaryAPITokenKey is the key holding a secondary Cloudflare API
+	// token. It is used when Cloudflare rejects the primary token, so that
+	// tokens can be rotated without downtime. Defaults to
+	// "cloudflare-api-key-secondary".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	SecondaryAPITokenKey string `json:"secondaryAPITokenKey,omitempty"`
+
+	// AccessClientIDKey is the key holding the client ID of a Cloudflare
+	// Access service token. If it and AccessClientSecretKey are present in
+	// the Secret, they are sent as CF-Access-Client-Id and
+	// CF-Access-Client-Secret headers on every Cloudflare API request.
+	// Defaults to "cf-access-client-id".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	AccessClientIDKey string `json:"accessClientIDKey,omitempty"`
+
+	// AccessClientSecretKey is the key holding the client secret of a
+	// Cloudflare Access service token. Defaults to "cf-access-client-secret".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	AccessClientSecretKey string `json:"accessClientSecretKey,omitempty"`
+}
+
+// AuthFileSource references files holding Cloudflare credentials. Paths are
+// relative to the directory configured with the controller's
+// --credentials-dir flag.
+type AuthFileSource struct {
+	// APITokenPath is the path of the file holding the Cloudflare API token.
+	// +kubebuilder:validation:MinLength=1
+	APITokenPath string `json:"apiTokenPath"`
+
+	// ZoneIDPath is the path of the file holding the Cloudflare zone ID. It
+	// is only read when the zone ID is not configured on the issuer.
+	// +optional
+	ZoneIDPath string `json:"zoneIDPath,omitempty"`
+}
+
+// VaultAuth configures reading credentials from HashiCorp Vault using the
+// Kubernetes auth method.
+type VaultAuth struct {
+	// Server is the URL of the Vault server, e.g.
+	// "https://vault.example.com:8200".
+	// +kubebuilder:validation:MinLength=1
+	Server string `json:"server"`
+
+	// Path of the KV version 2 secret in the form "<mount>/<path>", e.g.
+	// "secret/cloudflare".
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// Role is the Vault role to log in as.
+	// +kubebuilder:validation:MinLength=1
+	Role string `json:"role"`
+
+	// AuthMountPath is the mount path of the Kubernetes auth method.
+	// Defaults to "kubernetes".
+	// +optional
+	AuthMountPath string `json:"authMountPath,omitempty"`
+
+	// ServiceAccountRef references the ServiceAccount whose token is used to
+	// log in to Vault. It is read from the same namespace as the auth Secret.
+	ServiceAccountRef ServiceAccountReference `json:"serviceAccountRef"`
+
+	// Namespace is the Vault Enterprise namespace to use.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// APITokenKey is the key of the Vault secret holding the Cloudflare API
+	// token. Defaults to "cloudflare-api-key".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	APITokenKey string `json:"apiTokenKey,omitempty"`
+
+	// ZoneIDKey is the key of the Vault secret holding the Cloudflare zone
+	// ID. It is only read when ZoneID is not set on the issuer. Defaults to
+	// "cloudflare-zone-id".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	ZoneIDKey string `json:"zoneIDKey,omitempty"`
+
+	// CABundleSecretRef references a Secret holding PEM encoded CA
+	// certificates that are trusted in addition to the system roots when
+	// connecting to Vault. The Secret is read from the same namespace as the
+	// auth Secret.
+	// +optional
+	CABundleSecretRef *SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+}
+
+// SecretManagerAuth selects the cloud secret manager holding the Cloudflare
+// credentials. The secret value is either the API token itself or a JSON
+// object with the keys APITokenKey and ZoneIDKey.
+// +kubebuilder:validation:XValidation:rule="[has(self.aws), has(self.gcp), has(self.azure)].filter(x, x).size() == 1",message="exactly one of aws, gcp and azure must be set"
+type SecretManagerAuth struct {
+	// AWS reads the secret from AWS Secrets Manager, authenticating with
+	// IAM roles for service accounts.
+	// +optional
+	AWS *AWSSecretsManager `json:"aws,omitempty"`
+
+	// GCP reads the secret from Google Cloud Secret Manager, authenticating
+	// with GKE workload identity.
+	// +optional
+	GCP *GCPSecretManager `json:"gcp,omitempty"`
+
+	// Azure reads the secret from Azure Key Vault, authenticating with
+	// Microsoft Entra workload identity.
+	// +optional
+	Azure *AzureKeyVault `json:"azure,omitempty"`
+
+	// APITokenKey is the key of a JSON secret value holding the Cloudflare
+	// API token. Defaults to "cloudflare-api-key".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	APITokenKey string `json:"apiTokenKey,omitempty"`
+
+	// ZoneIDKey is the key of a JSON secret value holding the Cloudflare
+	// zone ID. Defaults to "cloudflare-zone-id".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	ZoneIDKey string `json:"zoneIDKey,omitempty"`
+}
+
+// AWSSecretsManager references a secret in AWS Secrets Manager.
+type AWSSecretsManager struct {
+	// Region of the secret, e.g. "eu-west-1".
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[a-z0-9-]+$`
+	Region string `json:"region"`
+
+	// SecretID is the name or ARN of the secret.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=2048
+	SecretID string `json:"secretID"`
+
+	// VersionStage of the secret to read. Defaults to "AWSCURRENT".
+	// +optional
+	VersionStage string `json:"versionStage,omitempty"`
+}
+
+// GCPSecretManager references a secret in Google Cloud Secret Manager.
+type GCPSecretManager struct {
+	// Project is the ID of the project holding the secret.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[a-z][-a-z0-9]*$`
+	Project string `json:"project"`
+
+	// Secret is the name of the secret.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[-_a-zA-Z0-9]+$`
+	Secret string `json:"secret"`
+
+	// Version of the secret to read. Defaults to "latest".
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([0-9]+|latest)$`
+	Version string `json:"version,omitempty"`
+}
+
+// AzureKeyVault references a secret in Azure Key Vault.
+type AzureKeyVault struct {
+	// VaultURL is the URL of the key vault, e.g.
+	// "https://example.vault.azure.net".
+	// +kubebuilder:validation:MinLength=1
+	VaultURL string `json:"vaultURL"`
+
+	// SecretName is the name of the secret.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9]+$`
+	SecretName string `json:"secretName"`
+
+	// Version of the secret to read. Defaults to the current version.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]*$`
+	Version string `json:"version,omitempty"`
+}
+
+// ServiceAccountReference references a ServiceAccount by name.
+type ServiceAccountReference struct {
+	// Name of the ServiceAccount.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+}
+
+// ConfigMapReference references a ConfigMap by name.
+type ConfigMapReference struct {
+	// Name of the ConfigMap.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+}
+
+// ProxyConfig configures an egress proxy for requests to the Cloudflare API.
+type ProxyConfig struct {
+	// URL of the proxy, e.g. "http://proxy.example.com:3128" or
+	// "socks5://bastion.example.com:1080".
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// AuthSecretName is the name of a Secret of type
+	// kubernetes.io/basic-auth whose username and password authenticate to
+	// the proxy, e.g. a SOCKS5 bastion. The Secret is read from the same
+	// namespace as the auth Secret.
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	AuthSecretName string `json:"authSecretName,omitempty"`
+
+	// CABundleSecretRef references a Secret holding PEM encoded CA
+	// certificates that are trusted in addition to the system roots. This is
+	// needed for proxies that intercept TLS. The Secret is read from the same
+	// namespace as the auth Secret.
+	// +optional
+	CABundleSecretRef *SecretKeySelector `json:"caBundleSecretRef,omitempty"`
+}
+
+// SecretKeySelector selects a key of a Secret.
+type SecretKeySelector struct {
+	// Name of the Secret.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	Name string `json:"name"`
+
+	// Key of the Secret. Defaults to "ca.crt".
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	Key string `json:"key,omitempty"`
+}
+
+// IssuerStatus defines the observed state of CFMTLSIssuer
+type IssuerStatus struct {
+	v1alpha1.IssuerStatus `json:",inline"`
+
+	// ZoneID is the Cloudflare zone ID that was resolved during the last
+	// health check of the issuer.
+	// +optional
+	ZoneID string `json:"zoneID,omitempty"`
+
+	// LastError is the error returned by the last health check of the
+	// issuer. It is cleared once the issuer is healthy again.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// ZoneName is the human-readable name of the Cloudflare zone, resolved
+	// when the issuer signs a certificate.
+	// +optional
+	ZoneName string `json:"zoneName,omitempty"`
+
+	// LastIssuanceTime is the time at which the issuer last signed a
+	// certificate.
+	// +optional
+	LastIssuanceTime *metav1.Time `json:"lastIssuanceTime,omitempty"`
+
+	// IssuedCount is the number of certificates the issuer has signed since
+	// the controller was last started.
+	// +optional
+	IssuedCount int64 `json:"issuedCount,omitempty"`
+
+	// Mode is the issuance mode of the issuer.
+	// +optional
+	Mode IssuerMode `json:"mode,omitempty"`
+
+	// SecondaryTokenInUse is set when Cloudflare rejected the primary API
+	// token and the secondary token was used instead. The primary token
+	// should be replaced.
+	// +optional
+	SecondaryTokenInUse bool `json:"secondaryTokenInUse,omitempty"`
+
+	// CredentialHash is a SHA-256 fingerprint of the credentials used by the
+	// last health check. It changes whenever the credentials are rotated, so
+	// it tells which credential generation the issuer is using.
+	// +optional
+	CredentialHash string `json:"credentialHash,omitempty"`
+
+	// TokenScopeWarning describes the permissions of the API token beyond
+	// the zone of the issuer, if TokenScopeCheck is "Warn".
+	// +optional
+	TokenScopeWarning string `json:"tokenScopeWarning,omitempty"`
+
+	// TokenExpirationTime is the expiry of the API token, as last seen by
+	// the token rotation.
+	// +optional
+	TokenExpirationTime *metav1.Time `json:"tokenExpirationTime,omitempty"`
+
+	// LastTokenRotationTime is the time at which the API token was last
+	// rotated.
+	// +optional
+	LastTokenRotationTime *metav1.Time `json:"lastTokenRotationTime,omitempty"`
+
+	// RecentErrors are the last errors of the issuer, newest first, from
+	// its health checks and the certificates it failed to sign. Consecutive
+	// identical errors share a single entry.
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=10
+	RecentErrors []RecentError `json:"recentErrors,omitempty"`
+}
+
+// RecentError summarizes an error of an issuer.
+type RecentError struct {
+	// Time is when the error last occurred.
+	Time metav1.Time `json:"time"`
+
+	// Reason is the machine-readable reason of the error.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message describes the error.
+	Message string `json:"message"`
+
+	// Count is the number of consecutive times the error occurred.
+	// +optional
+	Count int32 `json:"count,omitempty"`
+}
+
+// TokenScopeCheckMode selects how a too broad API token is handled.
+// +kubebuilder:validation:Enum=Warn;Enforce
+type TokenScopeCheckMode string
+
+// TokenRotation configures the automatic rotation of the API token.
+type TokenRotation struct {
+	// RenewBefore is how long before its expiry the token is rotated.
+	// Defaults to 7 days.
+	// +optional
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+
+	// Validity is the lifetime given to the token when it is rotated.
+	// Defaults to 90 days.
+	// +optional
+	Validity *metav1.Duration `json:"validity,omitempty"`
+}
+
+// RateLimit is a token bucket limiting the requests sent to the Cloudflare
+// API.
+type RateLimit struct {
+	// RequestsPerMinute is the sustained rate of requests.
+	// +kubebuilder:validation:Minimum=1
+	RequestsPerMinute int32 `json:"requestsPerMinute"`
+
+	// Burst is the number of requests that may be sent at once after a
+	// quiet period. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// MaintenanceWindow is a window that opens at the same time on the given
+// days of every week.
+type MaintenanceWindow struct {
+	// Days are the days of the week the window opens on. Empty opens it
+	// every day.
+	// +optional
+	// +listType=set
+	Days []Weekday `json:"days,omitempty"`
+
+	// Start is the time of day the window opens at, as HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start"`
+
+	// Duration is how long the window stays open, at most 7 days.
+	Duration metav1.Duration `json:"duration"`
+
+	// TimeZone is the IANA time zone of Start, e.g. "Europe/Berlin".
+	// Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Monday;Tuesday;Wednesday;Thursday;Friday;Saturday;Sunday
+type Weekday string
+
+// RevocationPolicy selects when issued certificates are revoked.
+// +kubebuilder:validation:Enum=OnDelete;Never
+type RevocationPolicy string
+
+// IssuerMode is the issuance mode of an issuer.
+// +kubebuilder:validation:Enum=OriginCA
+type IssuerMode string
+
+// +kubebuilder:object:root=true
+
+// CFMTLSIssuerList contains a list of CFMTLSIssuer.
+type CFMTLSIssuerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CFMTLSIssuer `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CFMTLSIssuer{}, &CFMTLSIssuerList{})
+}
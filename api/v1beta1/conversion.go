@@ -0,0 +1,379 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	CFMTLSIssuerv1alpha1 "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+var _ conversion.Convertible = &CFMTLSIssuer{}
+var _ conversion.Convertible = &CFMTLSClusterIssuer{}
+
+// authSecretAnnotationKey holds the Secret namespace and keys of a v1alpha1
+// issuer without a Secret name, which v1beta1 has no place for, so that
+// they survive a round trip through v1beta1.
+const authSecretAnnotationKey = "cfmtls.cert.manager.io/v1alpha1-auth-secret"
+
+// savedAuthSecret is the value of the authSecretAnnotationKey annotation.
+type savedAuthSecret struct {
+	Namespace string                              `json:"namespace,omitempty"`
+	Keys      CFMTLSIssuerv1alpha1.AuthSecretKeys `json:"keys"`
+}
+
+// ConvertTo converts this CFMTLSIssuer to the Hub version (v1alpha1).
+func (src *CFMTLSIssuer) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*CFMTLSIssuerv1alpha1.CFMTLSIssuer)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", dstRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertSpecToHub(&src.Spec, &dst.Spec)
+	convertStatusToHub(&src.Status, &dst.Status)
+
+	return restoreAuthSecret(&dst.ObjectMeta, &dst.Spec)
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *CFMTLSIssuer) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*CFMTLSIssuerv1alpha1.CFMTLSIssuer)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", srcRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertSpecFromHub(&src.Spec, &dst.Spec)
+	convertStatusFromHub(&src.Status, &dst.Status)
+
+	return saveAuthSecret(&src.Spec, &dst.ObjectMeta)
+}
+
+// ConvertTo converts this CFMTLSClusterIssuer to the Hub version (v1alpha1).
+func (src *CFMTLSClusterIssuer) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*CFMTLSIssuerv1alpha1.CFMTLSClusterIssuer)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", dstRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertSpecToHub(&src.Spec, &dst.Spec)
+	convertStatusToHub(&src.Status, &dst.Status)
+
+	return restoreAuthSecret(&dst.ObjectMeta, &dst.Spec)
+}
+
+// ConvertFrom converts from the Hub version (v1alpha1) to this version.
+func (dst *CFMTLSClusterIssuer) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*CFMTLSIssuerv1alpha1.CFMTLSClusterIssuer)
+	if !ok {
+		return fmt.Errorf("unexpected hub type %T", srcRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertSpecFromHub(&src.Spec, &dst.Spec)
+	convertStatusFromHub(&src.Status, &dst.Status)
+
+	return saveAuthSecret(&src.Spec, &dst.ObjectMeta)
+}
+
+func convertSpecToHub(src *IssuerSpec, dst *CFMTLSIssuerv1alpha1.IssuerSpec) {
+	if ref := src.Auth.SecretRef; ref != nil {
+		dst.AuthSecretName = ref.Name
+		dst.AuthSecretNamespace = ref.Namespace
+		dst.AuthSecretKeys = CFMTLSIssuerv1alpha1.AuthSecretKeys{
+			APIToken:           ref.APITokenKey,
+			ZoneID:             ref.ZoneIDKey,
+			SecondaryAPIToken:  ref.SecondaryAPITokenKey,
+			AccessClientID:     ref.AccessClientIDKey,
+			AccessClientSecret: ref.AccessClientSecretKey,
+		}
+	}
+	dst.ZoneID = src.ZoneID
+	dst.Paused = src.Paused
+	dst.MaxRetryDuration = src.MaxRetryDuration.DeepCopy()
+	dst.InitialBackoff = src.InitialBackoff.DeepCopy()
+	if src.BackoffMultiplier != nil {
+		multiplier := src.BackoffMultiplier.DeepCopy()
+		dst.BackoffMultiplier = &multiplier
+	}
+	dst.RequestTimeout = src.RequestTimeout.DeepCopy()
+	if src.Proxy != nil {
+		dst.Proxy = &CFMTLSIssuerv1alpha1.ProxyConfig{URL: src.Proxy.URL, AuthSecretName: src.Proxy.AuthSecretName}
+		if ref := src.Proxy.CABundleSecretRef; ref != nil {
+			dst.Proxy.CABundleSecretRef = &CFMTLSIssuerv1alpha1.SecretKeySelector{Name: ref.Name, Key: ref.Key}
+		}
+	}
+	dst.PinnedCertSHA256 = append([]string(nil), src.PinnedCertSHA256...)
+	dst.AllowedDomains = append([]string(nil), src.AllowedDomains...)
+	dst.DeniedDomains = append([]string(nil), src.DeniedDomains...)
+	dst.NamespaceSelector = src.NamespaceSelector.DeepCopy()
+	dst.SubjectPatterns = append([]string(nil), src.SubjectPatterns...)
+	dst.DefaultValidityDays = src.DefaultValidityDays
+	dst.Mode = CFMTLSIssuerv1alpha1.IssuerMode(src.Mode)
+	if src.ConfigMapRef != nil {
+		dst.ConfigMapRef = &CFMTLSIssuerv1alpha1.ConfigMapReference{Name: src.ConfigMapRef.Name}
+	}
+	dst.CheckInterval = src.CheckInterval.DeepCopy()
+	dst.TokenScopeCheck = CFMTLSIssuerv1alpha1.TokenScopeCheckMode(src.TokenScopeCheck)
+	if src.TokenRotation != nil {
+		dst.TokenRotation = &CFMTLSIssuerv1alpha1.TokenRotation{RenewBefore: src.TokenRotation.RenewBefore.DeepCopy(), Validity: src.TokenRotation.Validity.DeepCopy()}
+	}
+	if src.RateLimit != nil {
+		dst.RateLimit = &CFMTLSIssuerv1alpha1.RateLimit{RequestsPerMinute: src.RateLimit.RequestsPerMinute, Burst: src.RateLimit.Burst}
+	}
+	dst.RevocationPolicy = CFMTLSIssuerv1alpha1.RevocationPolicy(src.RevocationPolicy)
+	dst.RevokeSupersededAfter = src.RevokeSupersededAfter.DeepCopy()
+	dst.MaintenanceWindows = nil
+	for _, w := range src.MaintenanceWindows {
+		window := CFMTLSIssuerv1alpha1.MaintenanceWindow{Start: w.Start, Duration: w.Duration, TimeZone: w.TimeZone}
+		for _, day := range w.Days {
+			window.Days = append(window.Days, CFMTLSIssuerv1alpha1.Weekday(day))
+		}
+		dst.MaintenanceWindows = append(dst.MaintenanceWindows, window)
+	}
+	if src.Auth.File != nil {
+		dst.AuthFile = &CFMTLSIssuerv1alpha1.AuthFileSource{APITokenPath: src.Auth.File.APITokenPath, ZoneIDPath: src.Auth.File.ZoneIDPath}
+	}
+	if v := src.Auth.Vault; v != nil {
+		dst.Vault = &CFMTLSIssuerv1alpha1.VaultAuth{
+			Server:            v.Server,
+			Path:              v.Path,
+			Role:              v.Role,
+			AuthMountPath:     v.AuthMountPath,
+			ServiceAccountRef: CFMTLSIssuerv1alpha1.ServiceAccountReference{Name: v.ServiceAccountRef.Name},
+			Namespace:         v.Namespace,
+		}
+		if ref := v.CABundleSecretRef; ref != nil {
+			dst.Vault.CABundleSecretRef = &CFMTLSIssuerv1alpha1.SecretKeySelector{Name: ref.Name, Key: ref.Key}
+		}
+		// The keys of the Vault secret live in AuthSecretKeys on the hub.
+		if src.Auth.SecretRef == nil {
+			dst.AuthSecretKeys = CFMTLSIssuerv1alpha1.AuthSecretKeys{APIToken: v.APITokenKey, ZoneID: v.ZoneIDKey}
+		}
+	}
+	if m := src.Auth.SecretManager; m != nil {
+		dst.SecretManager = &CFMTLSIssuerv1alpha1.SecretManagerAuth{}
+		if m.AWS != nil {
+			dst.SecretManager.AWS = &CFMTLSIssuerv1alpha1.AWSSecretsManager{Region: m.AWS.Region, SecretID: m.AWS.SecretID, VersionStage: m.AWS.VersionStage}
+		}
+		if m.GCP != nil {
+			dst.SecretManager.GCP = &CFMTLSIssuerv1alpha1.GCPSecretManager{Project: m.GCP.Project, Secret: m.GCP.Secret, Version: m.GCP.Version}
+		}
+		if m.Azure != nil {
+			dst.SecretManager.Azure = &CFMTLSIssuerv1alpha1.AzureKeyVault{VaultURL: m.Azure.VaultURL, SecretName: m.Azure.SecretName, Version: m.Azure.Version}
+		}
+		if src.Auth.SecretRef == nil {
+			dst.AuthSecretKeys = CFMTLSIssuerv1alpha1.AuthSecretKeys{APIToken: m.APITokenKey, ZoneID: m.ZoneIDKey}
+		}
+	}
+}
+
+func convertSpecFromHub(src *CFMTLSIssuerv1alpha1.IssuerSpec, dst *IssuerSpec) {
+	// Without a Secret name the default credentials are used, which makes
+	// the other Secret fields meaningless.
+	if src.AuthSecretName != "" {
+		dst.Auth.SecretRef = &SecretReference{
+			Name:                  src.AuthSecretName,
+			Namespace:             src.AuthSecretNamespace,
+			APITokenKey:           src.AuthSecretKeys.APIToken,
+			ZoneIDKey:             src.AuthSecretKeys.ZoneID,
+			SecondaryAPITokenKey:  src.AuthSecretKeys.SecondaryAPIToken,
+			AccessClientIDKey:     src.AuthSecretKeys.AccessClientID,
+			AccessClientSecretKey: src.AuthSecretKeys.AccessClientSecret,
+		}
+	}
+	dst.ZoneID = src.ZoneID
+	dst.Paused = src.Paused
+	dst.MaxRetryDuration = src.MaxRetryDuration.DeepCopy()
+	dst.InitialBackoff = src.InitialBackoff.DeepCopy()
+	if src.BackoffMultiplier != nil {
+		multiplier := src.BackoffMultiplier.DeepCopy()
+		dst.BackoffMultiplier = &multiplier
+	}
+	dst.RequestTimeout = src.RequestTimeout.DeepCopy()
+	if src.Proxy != nil {
+		dst.Proxy = &ProxyConfig{URL: src.Proxy.URL, AuthSecretName: src.Proxy.AuthSecretName}
+		if ref := src.Proxy.CABundleSecretRef; ref != nil {
+			dst.Proxy.CABundleSecretRef = &SecretKeySelector{Name: ref.Name, Key: ref.Key}
+		}
+	}
+	dst.PinnedCertSHA256 = append([]string(nil), src.PinnedCertSHA256...)
+	dst.AllowedDomains = append([]string(nil), src.AllowedDomains...)
+	dst.DeniedDomains = append([]string(nil), src.DeniedDomains...)
+	dst.NamespaceSelector = src.NamespaceSelector.DeepCopy()
+	dst.SubjectPatterns = append([]string(nil), src.SubjectPatterns...)
+	dst.DefaultValidityDays = src.DefaultValidityDays
+	dst.Mode = IssuerMode(src.Mode)
+	if src.ConfigMapRef != nil {
+		dst.ConfigMapRef = &ConfigMapReference{Name: src.ConfigMapRef.Name}
+	}
+	dst.CheckInterval = src.CheckInterval.DeepCopy()
+	dst.TokenScopeCheck = TokenScopeCheckMode(src.TokenScopeCheck)
+	if src.TokenRotation != nil {
+		dst.TokenRotation = &TokenRotation{RenewBefore: src.TokenRotation.RenewBefore.DeepCopy(), Validity: src.TokenRotation.Validity.DeepCopy()}
+	}
+	if src.RateLimit != nil {
+		dst.RateLimit = &RateLimit{RequestsPerMinute: src.RateLimit.RequestsPerMinute, Burst: src.RateLimit.Burst}
+	}
+	dst.RevocationPolicy = RevocationPolicy(src.RevocationPolicy)
+	dst.RevokeSupersededAfter = src.RevokeSupersededAfter.DeepCopy()
+	dst.MaintenanceWindows = nil
+	for _, w := range src.MaintenanceWindows {
+		window := MaintenanceWindow{Start: w.Start, Duration: w.Duration, TimeZone: w.TimeZone}
+		for _, day := range w.Days {
+			window.Days = append(window.Days, Weekday(day))
+		}
+		dst.MaintenanceWindows = append(dst.MaintenanceWindows, window)
+	}
+	if src.AuthFile != nil {
+		dst.Auth.File = &AuthFileSource{APITokenPath: src.AuthFile.APITokenPath, ZoneIDPath: src.AuthFile.ZoneIDPath}
+	}
+	if v := src.Vault; v != nil {
+		dst.Auth.Vault = &VaultAuth{
+			Server:            v.Server,
+			Path:              v.Path,
+			Role:              v.Role,
+			AuthMountPath:     v.AuthMountPath,
+			ServiceAccountRef: ServiceAccountReference{Name: v.ServiceAccountRef.Name},
+			Namespace:         v.Namespace,
+		}
+		if ref := v.CABundleSecretRef; ref != nil {
+			dst.Auth.Vault.CABundleSecretRef = &SecretKeySelector{Name: ref.Name, Key: ref.Key}
+		}
+		if src.AuthSecretName == "" {
+			dst.Auth.Vault.APITokenKey = src.AuthSecretKeys.APIToken
+			dst.Auth.Vault.ZoneIDKey = src.AuthSecretKeys.ZoneID
+		}
+	}
+	if m := src.SecretManager; m != nil {
+		dst.Auth.SecretManager = &SecretManagerAuth{}
+		if m.AWS != nil {
+			dst.Auth.SecretManager.AWS = &AWSSecretsManager{Region: m.AWS.Region, SecretID: m.AWS.SecretID, VersionStage: m.AWS.VersionStage}
+		}
+		if m.GCP != nil {
+			dst.Auth.SecretManager.GCP = &GCPSecretManager{Project: m.GCP.Project, Secret: m.GCP.Secret, Version: m.GCP.Version}
+		}
+		if m.Azure != nil {
+			dst.Auth.SecretManager.Azure = &AzureKeyVault{VaultURL: m.Azure.VaultURL, SecretName: m.Azure.SecretName, Version: m.Azure.Version}
+		}
+		if src.AuthSecretName == "" {
+			dst.Auth.SecretManager.APITokenKey = src.AuthSecretKeys.APIToken
+			dst.Auth.SecretManager.ZoneIDKey = src.AuthSecretKeys.ZoneID
+		}
+	}
+}
+
+// saveAuthSecret saves the Secret namespace and keys of src in an
+// annotation on obj if they are lost in the conversion to v1beta1. Without
+// a Secret name, only the API token and zone ID keys are kept, and only by
+// the Vault and secret manager sources.
+func saveAuthSecret(src *CFMTLSIssuerv1alpha1.IssuerSpec, obj *metav1.ObjectMeta) error {
+	if src.AuthSecretName != "" {
+		return nil
+	}
+	var kept CFMTLSIssuerv1alpha1.AuthSecretKeys
+	if src.Vault != nil || src.SecretManager != nil {
+		kept = CFMTLSIssuerv1alpha1.AuthSecretKeys{APIToken: src.AuthSecretKeys.APIToken, ZoneID: src.AuthSecretKeys.ZoneID}
+	}
+	if src.AuthSecretNamespace == "" && src.AuthSecretKeys == kept {
+		return nil
+	}
+
+	data, err := json.Marshal(savedAuthSecret{Namespace: src.AuthSecretNamespace, Keys: src.AuthSecretKeys})
+	if err != nil {
+		return fmt.Errorf("failed to encode the auth Secret: %w", err)
+	}
+	if obj.Annotations == nil {
+		obj.Annotations = map[string]string{}
+	}
+	obj.Annotations[authSecretAnnotationKey] = string(data)
+	return nil
+}
+
+// restoreAuthSecret restores the Secret namespace and keys saved by
+// saveAuthSecret and removes the annotation from obj. The keys of the Vault
+// and secret manager sources take precedence, as they may have been changed
+// in v1beta1, and a Secret set since replaces the saved fields.
+func restoreAuthSecret(obj *metav1.ObjectMeta, dst *CFMTLSIssuerv1alpha1.IssuerSpec) error {
+	data, ok := obj.Annotations[authSecretAnnotationKey]
+	if !ok {
+		return nil
+	}
+	delete(obj.Annotations, authSecretAnnotationKey)
+	if len(obj.Annotations) == 0 {
+		obj.Annotations = nil
+	}
+	if dst.AuthSecretName != "" {
+		return nil
+	}
+
+	var saved savedAuthSecret
+	if err := json.Unmarshal([]byte(data), &saved); err != nil {
+		return fmt.Errorf("failed to decode annotation %s: %w", authSecretAnnotationKey, err)
+	}
+	dst.AuthSecretNamespace = saved.Namespace
+	if dst.Vault != nil || dst.SecretManager != nil {
+		saved.Keys.APIToken = dst.AuthSecretKeys.APIToken
+		saved.Keys.ZoneID = dst.AuthSecretKeys.ZoneID
+	}
+	dst.AuthSecretKeys = saved.Keys
+	return nil
+}
+
+func convertStatusToHub(src *IssuerStatus, dst *CFMTLSIssuerv1alpha1.IssuerStatus) {
+	src.IssuerStatus.DeepCopyInto(&dst.IssuerStatus)
+	dst.ZoneID = src.ZoneID
+	dst.LastError = src.LastError
+	dst.ZoneName = src.ZoneName
+	dst.LastIssuanceTime = src.LastIssuanceTime.DeepCopy()
+	dst.IssuedCount = src.IssuedCount
+	dst.Mode = CFMTLSIssuerv1alpha1.IssuerMode(src.Mode)
+	dst.SecondaryTokenInUse = src.SecondaryTokenInUse
+	dst.CredentialHash = src.CredentialHash
+	dst.TokenScopeWarning = src.TokenScopeWarning
+	dst.TokenExpirationTime = src.TokenExpirationTime.DeepCopy()
+	dst.LastTokenRotationTime = src.LastTokenRotationTime.DeepCopy()
+	dst.RecentErrors = nil
+	for _, e := range src.RecentErrors {
+		dst.RecentErrors = append(dst.RecentErrors, CFMTLSIssuerv1alpha1.RecentError{Time: e.Time, Reason: e.Reason, Message: e.Message, Count: e.Count})
+	}
+}
+
+func convertStatusFromHub(src *CFMTLSIssuerv1alpha1.IssuerStatus, dst *IssuerStatus) {
+	src.IssuerStatus.DeepCopyInto(&dst.IssuerStatus)
+	dst.ZoneID = src.ZoneID
+	dst.LastError = src.LastError
+	dst.ZoneName = src.ZoneName
+	dst.LastIssuanceTime = src.LastIssuanceTime.DeepCopy()
+	dst.IssuedCount = src.IssuedCount
+	dst.Mode = IssuerMode(src.Mode)
+	dst.SecondaryTokenInUse = src.SecondaryTokenInUse
+	dst.CredentialHash = src.CredentialHash
+	dst.TokenScopeWarning = src.TokenScopeWarning
+	dst.TokenExpirationTime = src.TokenExpirationTime.DeepCopy()
+	dst.LastTokenRotationTime = src.LastTokenRotationTime.DeepCopy()
+	dst.RecentErrors = nil
+	for _, e := range src.RecentErrors {
+		dst.RecentErrors = append(dst.RecentErrors, RecentError{Time: e.Time, Reason: e.Reason, Message: e.Message, Count: e.Count})
+	}
+}
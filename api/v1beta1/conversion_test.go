@@ -0,0 +1,169 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/diff"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	CFMTLSIssuerv1alpha1 "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// roundTrips is the number of random objects converted by each test.
+const roundTrips = 200
+
+// newFuzzer returns a fuzzer filling issuers with random objects. The
+// credential sources of v1beta1 issuers are kept mutually exclusive, as
+// the API server enforces, while all fields of v1alpha1 issuers are set.
+func newFuzzer() *fuzz.Fuzzer {
+	return fuzz.New().NilChance(0.3).Funcs(
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewMilliQuantity(c.Int63n(10000), resource.DecimalSI)
+		},
+		func(spec *IssuerSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(spec)
+			// The credential sources are mutually exclusive.
+			auth := spec.Auth
+			spec.Auth = IssuerAuth{}
+			switch c.Intn(5) {
+			case 1:
+				spec.Auth.SecretRef = auth.SecretRef
+				// The name of the Secret is required.
+				if spec.Auth.SecretRef != nil && spec.Auth.SecretRef.Name == "" {
+					spec.Auth.SecretRef.Name = "cloudflare"
+				}
+			case 2:
+				spec.Auth.File = auth.File
+			case 3:
+				spec.Auth.Vault = auth.Vault
+			case 4:
+				spec.Auth.SecretManager = auth.SecretManager
+			}
+		},
+		func(spec *CFMTLSIssuerv1alpha1.IssuerSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(spec)
+			// Without a Secret name, v1beta1 keeps the Secret namespace and
+			// keys in an annotation, which needs to be covered as well.
+			if c.RandBool() {
+				spec.AuthSecretName = ""
+			}
+		},
+	)
+}
+
+func TestSpokeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		spoke func() conversion.Convertible
+		hub   func() conversion.Hub
+	}{
+		{
+			name:  "CFMTLSIssuer",
+			spoke: func() conversion.Convertible { return &CFMTLSIssuer{} },
+			hub:   func() conversion.Hub { return &CFMTLSIssuerv1alpha1.CFMTLSIssuer{} },
+		},
+		{
+			name:  "CFMTLSClusterIssuer",
+			spoke: func() conversion.Convertible { return &CFMTLSClusterIssuer{} },
+			hub:   func() conversion.Hub { return &CFMTLSIssuerv1alpha1.CFMTLSClusterIssuer{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFuzzer()
+			for i := 0; i < roundTrips; i++ {
+				original := tt.spoke()
+				f.Fuzz(original)
+				clearTypeMeta(original)
+
+				hub := tt.hub()
+				if err := original.ConvertTo(hub); err != nil {
+					t.Fatalf("ConvertTo() error = %v", err)
+				}
+				got := tt.spoke()
+				if err := got.ConvertFrom(hub); err != nil {
+					t.Fatalf("ConvertFrom() error = %v", err)
+				}
+				if !equality.Semantic.DeepEqual(original, got) {
+					t.Fatalf("%s changed in a round trip through v1alpha1:\n%s", tt.name, diff.ObjectReflectDiff(original, got))
+				}
+			}
+		})
+	}
+}
+
+func TestHubRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		spoke func() conversion.Convertible
+		hub   func() conversion.Hub
+	}{
+		{
+			name:  "CFMTLSIssuer",
+			spoke: func() conversion.Convertible { return &CFMTLSIssuer{} },
+			hub:   func() conversion.Hub { return &CFMTLSIssuerv1alpha1.CFMTLSIssuer{} },
+		},
+		{
+			name:  "CFMTLSClusterIssuer",
+			spoke: func() conversion.Convertible { return &CFMTLSClusterIssuer{} },
+			hub:   func() conversion.Hub { return &CFMTLSIssuerv1alpha1.CFMTLSClusterIssuer{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFuzzer()
+			for i := 0; i < roundTrips; i++ {
+				original := tt.hub()
+				f.Fuzz(original)
+				clearTypeMeta(original)
+
+				spoke := tt.spoke()
+				if err := spoke.ConvertFrom(original); err != nil {
+					t.Fatalf("ConvertFrom() error = %v", err)
+				}
+				got := tt.hub()
+				if err := spoke.ConvertTo(got); err != nil {
+					t.Fatalf("ConvertTo() error = %v", err)
+				}
+				if !equality.Semantic.DeepEqual(original, got) {
+					t.Fatalf("%s changed in a round trip through v1beta1:\n%s", tt.name, diff.ObjectReflectDiff(original, got))
+				}
+			}
+		})
+	}
+}
+
+func TestConvertWrongHub(t *testing.T) {
+	if err := (&CFMTLSIssuer{}).ConvertTo(&CFMTLSIssuerv1alpha1.CFMTLSClusterIssuer{}); err == nil {
+		t.Error("CFMTLSIssuer.ConvertTo(CFMTLSClusterIssuer) succeeded, want error")
+	}
+	if err := (&CFMTLSClusterIssuer{}).ConvertFrom(&CFMTLSIssuerv1alpha1.CFMTLSIssuer{}); err == nil {
+		t.Error("CFMTLSClusterIssuer.ConvertFrom(CFMTLSIssuer) succeeded, want error")
+	}
+}
+
+// clearTypeMeta clears the type of obj, which conversion leaves to the
+// API server.
+func clearTypeMeta(obj interface{ GetObjectKind() schema.ObjectKind }) {
+	obj.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+}
@@ -43,6 +43,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/krisek/cfmtls-issuer/internal/controllers"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
 	"github.com/krisek/cfmtls-issuer/internal/version"
 
 	CFMTLSIssuerv1alpha1 "github.com/krisek/cfmtls-issuer/api/v1alpha1"
@@ -66,6 +68,13 @@ func init() {
 
 // nolint:gocyclo
 func main() {
+	// "version" prints the version like --version, without starting the
+	// controller.
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Println(version.String())
+		return
+	}
+
 	var clusterResourceNamespace string
 	var printVersion bool
 	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "",
@@ -103,15 +112,19 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	logr := zap.New(zap.UseFlagOptions(&opts))
+	// Credentials are redacted from all log lines, including the HTTP
+	// request dumps of the debug levels.
+	logr := redact.Logger(zap.New(zap.UseFlagOptions(&opts)))
 	klog.SetLogger(logr)
 	ctrl.SetLogger(logr)
 
-	logr.Info("Version", "version", version.Version)
+	logr.Info("Version", "version", version.Version, "commit", version.Commit, "date", version.Date, "goVersion", version.GoVersion)
 
 	if printVersion {
+		fmt.Println(version.String())
 		return
 	}
+	metrics.RecordBuildInfo()
 
 	if err := getInClusterNamespace(&clusterResourceNamespace); err != nil {
 		if errors.Is(err, errNotInCluster) {
@@ -24,34 +24,71 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
+	"github.com/krisek/cfmtls-issuer/internal/audit"
+	"github.com/krisek/cfmtls-issuer/internal/config"
 	"github.com/krisek/cfmtls-issuer/internal/controllers"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+	"github.com/krisek/cfmtls-issuer/internal/fips"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
 	"github.com/krisek/cfmtls-issuer/internal/signer"
+	"github.com/krisek/cfmtls-issuer/internal/tracing"
 	"github.com/krisek/cfmtls-issuer/internal/version"
+	webhookv1alpha1 "github.com/krisek/cfmtls-issuer/internal/webhook/v1alpha1"
 
 	CFMTLSIssuerv1alpha1 "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	CFMTLSIssuerv1beta1 "github.com/krisek/cfmtls-issuer/api/v1beta1"
 	// +kubebuilder:scaffold:imports
 )
 
 const inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 
+// Environment variables configuring the cluster resource namespace. The
+// --cluster-resource-namespace flag takes precedence over both.
+const (
+	// clusterResourceNamespaceEnvVar sets the default of
+	// --cluster-resource-namespace.
+	clusterResourceNamespaceEnvVar = "CLUSTER_RESOURCE_NAMESPACE"
+	// podNamespaceEnvVar holds the namespace of the controller pod, usually
+	// set through the downward API. It is used when neither the flag nor
+	// clusterResourceNamespaceEnvVar is set.
+	podNamespaceEnvVar = "POD_NAMESPACE"
+	// watchNamespaceEnvVar sets the default of --namespaces.
+	watchNamespaceEnvVar = "WATCH_NAMESPACE"
+	// podNameEnvVar holds the name of the controller pod, whose StatefulSet
+	// ordinal is the default of --shard-index.
+	podNameEnvVar = "POD_NAME"
+)
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -62,31 +99,219 @@ func init() {
 	utilruntime.Must(cmapi.AddToScheme(scheme))
 
 	utilruntime.Must(CFMTLSIssuerv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(CFMTLSIssuerv1beta1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 // nolint:gocyclo
 func main() {
+	// "version" prints the version like --version, without starting the
+	// controller.
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Println(version.String())
+		return
+	}
+	// "gc" runs the orphan garbage collector once, e.g. from a CronJob,
+	// without starting the controller.
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		os.Exit(runGC(os.Args[2:]))
+	}
+
 	var clusterResourceNamespace string
+	var clusterIssuerSecretNamespaces string
+	var credentialsDir string
+	var secretLabelSelector string
+	var trustBundleSource, trustBundleConfigMap, trustBundleNamespaceSelector string
+	var maxRetryDuration time.Duration
+	var maxConcurrentReconciles int
+	var cloudflareRateLimit, cloudflareRateLimitBurst int
+	var credentialCacheTTL time.Duration
+	var cleanupTTL time.Duration
+	var orphanGCInterval time.Duration
+	var orphanGCDryRun bool
+	var maxConcurrentSignings int
+	var issuanceBudget int
+	var warmUpConcurrency int
+	var attemptTimeout time.Duration
+	var gracefulShutdownTimeout time.Duration
+	var readinessCheckURL string
+	var fieldOwner string
+	var shardCount, shardIndex int
+	var signerNamePrefix string
+	var readinessRequireReadyIssuer bool
+	var certificateEvents bool
+	var requireApproval bool
+	var tenantLabel string
+	var watchNamespaces string
+	var configFile string
+	featureGate := features.NewFeatureGate()
 	var printVersion bool
-	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "",
-		"The namespace for secrets in which cluster-scoped resources are found.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", os.Getenv(clusterResourceNamespaceEnvVar),
+		"The namespace for secrets in which cluster-scoped resources are found. "+
+			"Defaults to $"+clusterResourceNamespaceEnvVar+", then to the namespace of the controller pod, "+
+			"or of the current kubeconfig context when running out-of-cluster.")
+	flag.StringVar(&clusterIssuerSecretNamespaces, "cluster-issuer-secret-namespaces", "",
+		"Comma separated list of additional namespaces that CFMTLSClusterIssuers may reference "+
+			"auth secrets in via spec.authSecretNamespace.")
+	flag.StringVar(&credentialsDir, "credentials-dir", "",
+		"Directory that spec.authFile paths of CFMTLSClusterIssuers are resolved against, "+
+			"e.g. the mount point of a Secrets Store CSI volume. If empty, authFile is not supported.")
+	flag.StringVar(&secretLabelSelector, "secret-label-selector", "",
+		"Label selector limiting the Secrets cached by the controller, e.g. 'cfmtls.cert.manager.io/credentials=true'. "+
+			"Auth and CA bundle Secrets not matching it are not found. If empty, all Secrets are cached.")
+	flag.StringVar(&trustBundleSource, "trust-bundle-source", "cfmtls-ca-roots",
+		"Name of the ConfigMap in the cluster resource namespace holding the Cloudflare Origin and client CA roots "+
+			"under the key 'ca.crt', which the TrustBundle feature publishes.")
+	flag.StringVar(&trustBundleConfigMap, "trust-bundle-configmap", "cfmtls-ca-bundle",
+		"Name of the ConfigMaps the TrustBundle feature publishes the CA roots in, or of the trust-manager Bundle if trust-manager is installed.")
+	flag.StringVar(&trustBundleNamespaceSelector, "trust-bundle-namespace-selector", "cfmtls.cert.manager.io/trust-bundle=enabled",
+		"Label selector of the namespaces the TrustBundle feature publishes the CA roots to.")
+	flag.DurationVar(&maxRetryDuration, "max-retry-duration", CFMTLSIssuerv1alpha1.DefaultMaxRetryDuration,
+		"How long a CertificateRequest is retried after a transient Cloudflare error before it is marked as failed, "+
+			"for issuers that do not set spec.maxRetryDuration. cert-manager only retries failed requests after an hour or more.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Number of CertificateRequests and CertificateSigningRequests that are signed in parallel.")
+	flag.IntVar(&maxConcurrentSignings, "max-concurrent-signings", 0,
+		"Number of signing requests sent to the Cloudflare API at once, independently of --max-concurrent-reconciles. "+
+			"Requests beyond it wait briefly for a free slot and are requeued otherwise. 0 does not limit them.")
+	flag.IntVar(&issuanceBudget, "issuance-budget", 0,
+		"Number of certificates issued per Cloudflare zone over a sliding week. Once 80% of it is used, renewals of "+
+			"certificates that are valid for more than a week are deferred, with events, to leave the rest to urgent requests. "+
+			"0 does not limit issuance.")
+	flag.IntVar(&warmUpConcurrency, "warm-up-concurrency", 10,
+		"Number of issuers checked in parallel, most notably when the controller becomes the leader. "+
+			"The controller is not ready until all issuers were checked, so that it does not serve stale issuer state.")
+	flag.DurationVar(&attemptTimeout, "attempt-timeout", 45*time.Second,
+		"Deadline of an attempt to sign a request or to check an issuer, shared by all its Cloudflare API requests "+
+			"and their retries. Each request is bounded by the spec.requestTimeout of the issuer as well. 0 disables the deadline.")
+	flag.IntVar(&cloudflareRateLimit, "cloudflare-rate-limit", 200,
+		"Number of requests per minute sent to the Cloudflare API for a zone, for issuers that do not set spec.rateLimit. "+
+			"The requests of a renewal storm wait for their turn instead of tripping the Cloudflare API rate limit. 0 disables the limit.")
+	flag.IntVar(&cloudflareRateLimitBurst, "cloudflare-rate-limit-burst", 10,
+		"Number of requests that may be sent to the Cloudflare API for a zone at once, for issuers that do not set spec.rateLimit.")
+	flag.DurationVar(&credentialCacheTTL, "credential-cache-ttl", 30*time.Second,
+		"How long the credentials of an issuer that were read and checked successfully are reused by its signings, "+
+			"so that a burst of requests does not read the credentials for each of them. 0 disables the cache.")
+	flag.DurationVar(&cleanupTTL, "cleanup-ttl", 30*24*time.Hour,
+		"How long the retry annotations of finished requests, and the CloudflareOriginCertificates of certificates that "+
+			"expired after their request was deleted or that were superseded by a renewal, are kept before they are removed. "+
+			"0 keeps them forever.")
+	flag.DurationVar(&orphanGCInterval, "orphan-gc-interval", 0,
+		"How often active Cloudflare certificates that were issued for the hostnames of an issuer, but are no longer "+
+			"tracked by a CloudflareOriginCertificate, are looked for. Requires the Revocation feature. 0 disables the orphan garbage collector.")
+	flag.BoolVar(&orphanGCDryRun, "orphan-gc-dry-run", true,
+		"Only report the orphaned certificates found by the orphan garbage collector in the logs, in events on their issuers "+
+			"and in metrics, instead of revoking them.")
+	flag.DurationVar(&gracefulShutdownTimeout, "graceful-shutdown-timeout", 30*time.Second,
+		"How long the controller waits on shutdown for in-flight Cloudflare signings to complete and their statuses "+
+			"to be patched, so that they are not issued again by the next replica. Must be less than the "+
+			"terminationGracePeriodSeconds of the pod.")
+	flag.StringVar(&readinessCheckURL, "readiness-check-url", CFMTLSIssuerv1alpha1.DefaultAPIBaseURL,
+		"URL of the Cloudflare API that must be reachable for /readyz to succeed. If empty, reachability is not checked.")
+	flag.BoolVar(&readinessRequireReadyIssuer, "readiness-require-ready-issuer", false,
+		"If set, /readyz only succeeds once at least one issuer served by the controller is Ready.")
+	flag.StringVar(&fieldOwner, "field-owner", controllers.DefaultFieldOwner,
+		"The server-side apply field manager of the status patches. Multiple instances of the controller in a cluster "+
+			"should use different field owners.")
+	flag.StringVar(&signerNamePrefix, "signer-name-prefix", CFMTLSIssuerv1alpha1.DefaultClusterIssuerTypeIdentifier,
+		"The signerName prefix of the Kubernetes CertificateSigningRequests signed by CFMTLSClusterIssuers, "+
+			"i.e. CSRs with signerName '<prefix>/<issuer name>' are signed. Multiple instances of the controller "+
+			"in a cluster should use different prefixes.")
+	flag.IntVar(&shardCount, "shard-count", 1,
+		"Number of active replicas that the issuers are partitioned across, by a hash of their namespace and name. "+
+			"Each replica serves the issuers of its shard and their requests. Requires --leader-elect=false. "+
+			"If 1, a single replica serves all issuers.")
+	flag.IntVar(&shardIndex, "shard-index", -1,
+		"Shard served by this replica, from 0 to --shard-count - 1. "+
+			"Defaults to the ordinal of the StatefulSet pod in $"+podNameEnvVar+", e.g. 2 for 'cfmtls-issuer-2'.")
+	flag.BoolVar(&certificateEvents, "certificate-events", false,
+		"If set, the event with the Cloudflare certificate ID and expiry of an issuance is also recorded on the "+
+			"Certificate owning the CertificateRequest.")
+	flag.BoolVar(&requireApproval, "require-approval", false,
+		"If set, requests are only signed once they have the Approved condition, and denied requests fail, "+
+			"so that approval is enforced by the issuer too, e.g. with approver-policy. "+
+			"Unapproved requests are kept pending with an ApprovalPending event.")
+	flag.StringVar(&tenantLabel, "tenant-label", "",
+		"Key of the namespace label naming the team that owns a namespace, e.g. 'team'. Its value is added as the tenant "+
+			"to the issuance metrics, the audit records and the CloudflareOriginCertificates of the requests of the namespace. "+
+			"Tenants are disabled if empty.")
+	flag.StringVar(&watchNamespaces, "namespaces", os.Getenv(watchNamespaceEnvVar),
+		"Comma separated list of namespaces that the controller is restricted to, so that it can run with namespace scoped RBAC. "+
+			"CFMTLSClusterIssuers and CertificateSigningRequests are not served then. "+
+			"Defaults to $"+watchNamespaceEnvVar+". If empty, all namespaces are served.")
+	flag.Var(featureGate, "feature-gates",
+		"Comma separated list of key=value pairs enabling or disabling features, e.g. 'Revocation=false'. "+
+			"Options are:\n"+strings.Join(featureGate.KnownFeatures(), "\n"))
+	flag.StringVar(&configFile, "config", "",
+		"Path of a "+config.Kind+" YAML file holding the controller settings. "+
+			"Flags set on the command line take precedence over the file.")
 	flag.BoolVar(&printVersion, "version", false, "Print version to stdout and exit")
 
 	var metricsAddr string
 	var metricsCertPath, metricsCertName, metricsCertKey string
 	var webhookCertPath, webhookCertName, webhookCertKey string
 	var enableLeaderElection bool
+	var leaderElectionNamespace string
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
 	var probeAddr string
+	var enablePprof bool
+	var pprofAddr string
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var auditLogPath string
+	var debugHTTP, debugHTTPBodies bool
+	var faultInjection string
+	var dnsServer, hostOverrides string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var fipsMode bool
+	var enableWebhooks bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address to which the metrics endpoint binds. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address to which the probe endpoint binds.")
+	flag.BoolVar(&enablePprof, "enable-pprof", false,
+		"If set, the net/http/pprof profiling endpoints are served on --pprof-bind-address.")
+	flag.StringVar(&pprofAddr, "pprof-bind-address", "127.0.0.1:6060",
+		"The address to which the pprof endpoint binds if --enable-pprof is set. "+
+			"It is bound to localhost by default, use kubectl port-forward to reach it.")
+	flag.StringVar(&auditLogPath, "audit-log", "",
+		"The file to append a JSON audit record of every issuance and failed signing to, or \"-\" for stdout. "+
+			"The audit log is disabled if empty.")
+	flag.BoolVar(&debugHTTP, "debug-http", false,
+		"If set, the method, URL, status, duration and cf-ray ID of every Cloudflare API request are logged.")
+	flag.BoolVar(&debugHTTPBodies, "debug-http-bodies", false,
+		"If set, the headers and bodies of the Cloudflare API requests and responses are logged as well, "+
+			"with the credentials redacted. Implies --debug-http.")
+	flag.StringVar(&dnsServer, "dns-server", "",
+		"The <ip>[:<port>] of the DNS server resolving the Cloudflare API and the proxies of the issuers, "+
+			"e.g. in air-gapped or split-horizon networks. If empty, the resolver of the host is used.")
+	flag.StringVar(&hostOverrides, "host-overrides", "",
+		"Comma separated static <host>=<ip> mappings dialed instead of resolving the hosts, "+
+			"e.g. 'api.cloudflare.com=104.19.192.29'. They apply to the Cloudflare API and the proxies of the issuers.")
+	flag.StringVar(&faultInjection, "fault-injection", "",
+		"For development and CI only: faults injected into the Cloudflare API requests to exercise the retries and backoff, "+
+			"e.g. 'error=0.1,throttle=0.05,reset=0.01,latency=500ms'. The rates are the fractions of the requests answered "+
+			"with 503, answered with 429, or failed without a response. No faults are injected if empty.")
+	flag.StringVar(&tracingEndpoint, "tracing-endpoint", "",
+		"The host:port of the OTLP gRPC collector to export OpenTelemetry traces of the signings to. "+
+			"The exporter is further configured by the OTEL_EXPORTER_OTLP_* environment variables. Tracing is disabled if empty.")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"If set, traces are exported to --tracing-endpoint without TLS.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"The namespace in which the leader election lease is created. Defaults to the namespace of the controller pod, "+
+			"or to the cluster resource namespace when running out-of-cluster.")
+	flag.DurationVar(&leaseDuration, "leader-election-lease-duration", 15*time.Second,
+		"The duration that non-leader candidates will wait after observing a leadership renewal "+
+			"before attempting to acquire leadership.")
+	flag.DurationVar(&renewDeadline, "leader-election-renew-deadline", 10*time.Second,
+		"The duration that the acting leader will retry refreshing leadership before giving up. "+
+			"Must be less than the lease duration.")
+	flag.DurationVar(&retryPeriod, "leader-election-retry-period", 2*time.Second,
+		"The duration the leader election clients should wait between tries of actions.")
 	flag.BoolVar(&secureMetrics, "metrics-secure", true,
 		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
 	flag.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
@@ -98,28 +323,93 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers.")
+	flag.BoolVar(&fipsMode, "fips", false,
+		"If set, only FIPS 140 approved algorithms are used: TLS is restricted to approved cipher suites and curves, "+
+			"and CSRs with keys or signatures that are not approved are refused. Always enabled in BoringCrypto builds.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"If set, the defaulting, validating and conversion webhooks for CFMTLSIssuer and CFMTLSClusterIssuer are served. "+
+			"Requires a serving certificate, see --webhook-cert-path.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
-	logr := zap.New(zap.UseFlagOptions(&opts))
+	// The configuration file may set the --zap-* logging flags, so it is
+	// applied before the logger is built. Errors are logged once it is.
+	var configErr error
+	if configFile != "" {
+		configErr = config.Apply(flag.CommandLine, configFile)
+	}
+
+	// Credentials are redacted from all log lines, including the HTTP
+	// request dumps of the debug levels.
+	logr := redact.Logger(zap.New(zap.UseFlagOptions(&opts)))
 	klog.SetLogger(logr)
 	ctrl.SetLogger(logr)
 
-	logr.Info("Version", "version", version.Version)
+	logr.Info("Version", "version", version.Version, "commit", version.Commit, "date", version.Date, "goVersion", version.GoVersion)
 
 	if printVersion {
+		fmt.Println(version.String())
 		return
 	}
+	metrics.RecordBuildInfo()
+
+	if configErr != nil {
+		setupLog.Error(configErr, "unable to load configuration file")
+		os.Exit(1)
+	}
+
+	// Before any TLS configuration is created.
+	if fipsMode {
+		fips.Enable()
+	}
+
+	if err := resolveShard(shardCount, &shardIndex, enableLeaderElection); err != nil {
+		setupLog.Error(err, "invalid sharding configuration")
+		os.Exit(1)
+	}
+
+	dnsServer, err := controllers.ParseDNSServer(dnsServer)
+	if err != nil {
+		setupLog.Error(err, "invalid --dns-server")
+		os.Exit(1)
+	}
+	hosts, err := controllers.ParseHostOverrides(hostOverrides)
+	if err != nil {
+		setupLog.Error(err, "invalid --host-overrides")
+		os.Exit(1)
+	}
+
+	faults, err := controllers.ParseFaultInjection(faultInjection)
+	if err != nil {
+		setupLog.Error(err, "invalid --fault-injection")
+		os.Exit(1)
+	}
+	if faults != nil {
+		setupLog.Info("WARNING: injecting faults into the Cloudflare API requests, do not use in production", "fault-injection", faultInjection)
+	}
+
+	if strings.Contains(signerNamePrefix, "/") {
+		setupLog.Error(fmt.Errorf("invalid --signer-name-prefix %q", signerNamePrefix), "the signer name prefix must not contain '/'")
+		os.Exit(1)
+	}
 
-	if err := getInClusterNamespace(&clusterResourceNamespace); err != nil {
-		if errors.Is(err, errNotInCluster) {
-			setupLog.Error(err, "please supply --cluster-resource-namespace")
-		} else {
-			setupLog.Error(err, "unexpected error while getting in-cluster Namespace")
+	if err := getInClusterNamespace(&clusterResourceNamespace); errors.Is(err, errNotInCluster) {
+		// Running from the host of a developer, e.g. with --kubeconfig.
+		namespace, err := getKubeconfigNamespace()
+		if err != nil {
+			setupLog.Error(err, "unable to get the namespace of the kubeconfig context, please supply --cluster-resource-namespace")
+			os.Exit(1)
 		}
+		setupLog.Info("running out-of-cluster, using the namespace of the kubeconfig context", "namespace", namespace)
+		clusterResourceNamespace = namespace
+		if leaderElectionNamespace == "" {
+			leaderElectionNamespace = namespace
+		}
+	} else if err != nil {
+		setupLog.Error(err, "unexpected error while getting in-cluster Namespace")
 		os.Exit(1)
 	}
 
@@ -137,6 +427,9 @@ func main() {
 	if !enableHTTP2 {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
+	if fips.Enabled() {
+		tlsOpts = append(tlsOpts, fips.ConfigureTLS)
+	}
 
 	// Create watchers for metrics and webhooks certificates
 	var metricsCertWatcher, webhookCertWatcher *certwatcher.CertWatcher
@@ -212,21 +505,125 @@ func main() {
 		})
 	}
 
+	// Secrets are read from the informer cache of the manager. Restricting it
+	// to labelled Secrets keeps its memory bounded in large clusters.
+	cacheOptions := cache.Options{DefaultTransform: cache.TransformStripManagedFields()}
+	var secretSelector labels.Selector
+	if secretLabelSelector != "" {
+		var err error
+		secretSelector, err = labels.Parse(secretLabelSelector)
+		if err != nil {
+			setupLog.Error(err, "invalid --secret-label-selector")
+			os.Exit(1)
+		}
+		cacheOptions.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Secret{}: {Label: secretSelector},
+		}
+	}
+
+	trustBundleSelector, err := labels.Parse(trustBundleNamespaceSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid --trust-bundle-namespace-selector")
+		os.Exit(1)
+	}
+	if tenantLabel != "" {
+		if errs := validation.IsQualifiedName(tenantLabel); len(errs) > 0 {
+			setupLog.Error(errors.New(strings.Join(errs, ", ")), "invalid --tenant-label")
+			os.Exit(1)
+		}
+	}
+
+	namespaces := splitList(watchNamespaces)
+	if len(namespaces) > 0 {
+		cacheOptions.DefaultNamespaces = map[string]cache.Config{}
+		for _, namespace := range namespaces {
+			cacheOptions.DefaultNamespaces[namespace] = cache.Config{}
+		}
+	}
+
 	setupLog.Info(
 		"starting",
 		"version", version.Version,
 		"enable-leader-election", enableLeaderElection,
+		"leader-election-namespace", leaderElectionNamespace,
 		"metrics-addr", metricsAddr,
+		"enable-pprof", enablePprof,
+		"tracing-endpoint", tracingEndpoint,
+		"audit-log", auditLogPath,
+		"debug-http", debugHTTP,
+		"debug-http-bodies", debugHTTPBodies,
+		"dns-server", dnsServer,
+		"host-overrides", hostOverrides,
+		"enable-webhooks", enableWebhooks,
+		"fips", fips.Enabled(),
+		"boring-crypto", fips.BoringCrypto(),
 		"cluster-resource-namespace", clusterResourceNamespace,
+		"cluster-issuer-secret-namespaces", clusterIssuerSecretNamespaces,
+		"credentials-dir", credentialsDir,
+		"secret-label-selector", secretLabelSelector,
+		"trust-bundle-source", trustBundleSource,
+		"trust-bundle-configmap", trustBundleConfigMap,
+		"trust-bundle-namespace-selector", trustBundleNamespaceSelector,
+		"max-retry-duration", maxRetryDuration,
+		"max-concurrent-reconciles", maxConcurrentReconciles,
+		"max-concurrent-signings", maxConcurrentSignings,
+		"issuance-budget", issuanceBudget,
+		"warm-up-concurrency", warmUpConcurrency,
+		"attempt-timeout", attemptTimeout,
+		"cloudflare-rate-limit", cloudflareRateLimit,
+		"cloudflare-rate-limit-burst", cloudflareRateLimitBurst,
+		"credential-cache-ttl", credentialCacheTTL,
+		"cleanup-ttl", cleanupTTL,
+		"orphan-gc-interval", orphanGCInterval,
+		"orphan-gc-dry-run", orphanGCDryRun,
+		"graceful-shutdown-timeout", gracefulShutdownTimeout,
+		"readiness-check-url", readinessCheckURL,
+		"field-owner", fieldOwner,
+		"signer-name-prefix", signerNamePrefix,
+		"shard-count", shardCount,
+		"shard-index", shardIndex,
+		"readiness-require-ready-issuer", readinessRequireReadyIssuer,
+		"certificate-events", certificateEvents,
+		"require-approval", requireApproval,
+		"tenant-label", tenantLabel,
+		"namespaces", watchNamespaces,
+		"config", configFile,
+		"feature-gates", featureGate.String(),
 	)
 
+	if !enablePprof {
+		pprofAddr = ""
+	}
+
+	if tracingEndpoint != "" {
+		shutdownTracing, err := tracing.Setup(context.Background(), tracingEndpoint, tracingInsecure)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer flushCancel()
+			if err := shutdownTracing(flushCtx); err != nil {
+				setupLog.Error(err, "unable to flush traces")
+			}
+		}()
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsServerOptions,
-		WebhookServer:          webhookServer,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "54c549fd.example.com",
+		Scheme:                  scheme,
+		Cache:                   cacheOptions,
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		PprofBindAddress:        pprofAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "54c549fd.example.com",
+		LeaderElectionNamespace: leaderElectionNamespace,
+		LeaseDuration:           &leaseDuration,
+		RenewDeadline:           &renewDeadline,
+		RetryPeriod:             &retryPeriod,
+		GracefulShutdownTimeout: &gracefulShutdownTimeout,
 		// LeaderElectionReleaseOnCancel defines whether the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this speeds up
@@ -253,18 +650,76 @@ func main() {
 	// 	 setupLog.Info("customController set up successfully")
 	//}
 
-	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+	CFMTLSIssuerv1alpha1.ClusterIssuerTypeIdentifier = signerNamePrefix
+
+	// The manager is only stopped once the in-flight signings are drained,
+	// see below.
+	signalCtx := ctrl.SetupSignalHandler()
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err = (&controllers.Issuer{
+	var auditLog *audit.Logger
+	if auditLogPath != "" {
+		auditLog, err = audit.Open(auditLogPath)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit log", "path", auditLogPath)
+			os.Exit(1)
+		}
+	}
+
+	issuer := &controllers.Issuer{
 		HealthCheckerBuilder:     signer.ExampleHealthCheckerFromIssuerAndSecretData,
 		SignerBuilder:            signer.ExampleSignerFromIssuerAndSecretData,
 		ClusterResourceNamespace: clusterResourceNamespace,
-	}).SetupWithManager(ctx, mgr); err != nil {
+		AllowedSecretNamespaces:  splitList(clusterIssuerSecretNamespaces),
+		CredentialsDir:           credentialsDir,
+		SecretSelector:           secretSelector,
+		TrustBundleSource:        types.NamespacedName{Namespace: clusterResourceNamespace, Name: trustBundleSource},
+		TrustBundleConfigMap:     trustBundleConfigMap,
+		TrustBundleNamespaces:    trustBundleSelector,
+		MaxRetryDuration:         maxRetryDuration,
+		MaxConcurrentReconciles:  maxConcurrentReconciles,
+		MaxConcurrentSignings:    maxConcurrentSignings,
+		IssuanceBudget:           issuanceBudget,
+		WarmUpConcurrency:        warmUpConcurrency,
+		AttemptTimeout:           attemptTimeout,
+		Namespaces:               namespaces,
+		FeatureGate:              featureGate,
+		FieldOwner:               fieldOwner,
+		ShardCount:               shardCount,
+		ShardIndex:               shardIndex,
+		AuditLog:                 auditLog,
+		CertificateEvents:        certificateEvents,
+		RequireApproval:          requireApproval,
+		TenantLabel:              tenantLabel,
+		DebugHTTP:                debugHTTP,
+		DebugHTTPBodies:          debugHTTPBodies,
+		DNSServer:                dnsServer,
+		HostOverrides:            hosts,
+		FaultInjection:           faults,
+		CloudflareRateLimit:      cloudflareRateLimit,
+		CloudflareRateLimitBurst: cloudflareRateLimitBurst,
+		CredentialCacheTTL:       credentialCacheTTL,
+		CleanupTTL:               cleanupTTL,
+		OrphanGCInterval:         orphanGCInterval,
+		OrphanGCDryRun:           orphanGCDryRun,
+	}
+	if err = issuer.SetupWithManager(ctx, mgr); err != nil {
 		setupLog.Error(err, "unable to create Signer controllers")
 		os.Exit(1)
 	}
 
+	if enableWebhooks {
+		if err := webhookv1alpha1.SetupCFMTLSIssuerWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CFMTLSIssuer")
+			os.Exit(1)
+		}
+		if err := webhookv1alpha1.SetupCFMTLSClusterIssuerWebhookWithManager(mgr, clusterResourceNamespace); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CFMTLSClusterIssuer")
+			os.Exit(1)
+		}
+	}
+
 	// +kubebuilder:scaffold:builder
 
 	if metricsCertWatcher != nil {
@@ -291,6 +746,23 @@ func main() {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
+	if readinessCheckURL != "" || readinessRequireReadyIssuer {
+		if err := mgr.AddReadyzCheck("cloudflare", issuer.ReadinessCheck(readinessCheckURL, readinessRequireReadyIssuer)); err != nil {
+			setupLog.Error(err, "unable to set up Cloudflare ready check")
+			os.Exit(1)
+		}
+	}
+
+	go func() {
+		<-signalCtx.Done()
+		setupLog.Info("shutting down, waiting for in-flight signings", "timeout", gracefulShutdownTimeout)
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), gracefulShutdownTimeout)
+		defer drainCancel()
+		if err := issuer.Drain(drainCtx); err != nil {
+			setupLog.Error(err, "in-flight signings did not complete before the graceful shutdown timeout")
+		}
+		cancel()
+	}()
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -299,14 +771,103 @@ func main() {
 	}
 }
 
+// runGC runs the orphan garbage collector once with the given arguments and
+// returns the exit code. It uses the credentials of the issuers like the
+// controller does, so it needs the same RBAC permissions.
+func runGC(args []string) int {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	var zones string
+	var dryRun bool
+	var clusterResourceNamespace string
+	var clusterIssuerSecretNamespaces string
+	var credentialsDir string
+	var fipsMode bool
+	featureGate := features.NewFeatureGate()
+	fs.StringVar(&zones, "zone", "",
+		"Comma separated list of the IDs of the Cloudflare zones to collect. If empty, all zones with tracked certificates are collected.")
+	fs.BoolVar(&dryRun, "dry-run", true,
+		"Only report the orphaned certificates in the logs instead of revoking them.")
+	fs.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", os.Getenv(clusterResourceNamespaceEnvVar),
+		"The namespace for secrets in which cluster-scoped resources are found, as for the controller.")
+	fs.StringVar(&clusterIssuerSecretNamespaces, "cluster-issuer-secret-namespaces", "",
+		"Comma separated list of additional namespaces that CFMTLSClusterIssuers may reference auth secrets in, as for the controller.")
+	fs.StringVar(&credentialsDir, "credentials-dir", "",
+		"Directory that spec.authFile paths of CFMTLSClusterIssuers are resolved against, as for the controller.")
+	fs.Var(featureGate, "feature-gates",
+		"Comma separated list of feature=true|false pairs, as for the controller. "+
+			"With CertificateIndex, orphans are found in the certificate index.")
+	fs.BoolVar(&fipsMode, "fips", false,
+		"Use only FIPS 140 approved algorithms, as for the controller.")
+	if f := flag.Lookup(ctrlconfig.KubeconfigFlagName); f != nil {
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(fs)
+	_ = fs.Parse(args)
+	if fipsMode {
+		fips.Enable()
+	}
+
+	logr := redact.Logger(zap.New(zap.UseFlagOptions(&opts)))
+	klog.SetLogger(logr)
+	ctrl.SetLogger(logr)
+
+	if err := getInClusterNamespace(&clusterResourceNamespace); errors.Is(err, errNotInCluster) {
+		namespace, err := getKubeconfigNamespace()
+		if err != nil {
+			setupLog.Error(err, "unable to get the namespace of the kubeconfig context, please supply --cluster-resource-namespace")
+			return 1
+		}
+		clusterResourceNamespace = namespace
+	} else if err != nil {
+		setupLog.Error(err, "unexpected error while getting in-cluster Namespace")
+		return 1
+	}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		setupLog.Error(err, "unable to get kubeconfig")
+		return 1
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client")
+		return 1
+	}
+
+	issuer := &controllers.Issuer{
+		HealthCheckerBuilder:     signer.ExampleHealthCheckerFromIssuerAndSecretData,
+		ClusterResourceNamespace: clusterResourceNamespace,
+		AllowedSecretNamespaces:  splitList(clusterIssuerSecretNamespaces),
+		CredentialsDir:           credentialsDir,
+		FeatureGate:              featureGate,
+		OrphanGCDryRun:           dryRun,
+	}
+	setupLog.Info("collecting orphaned certificates", "zone", zones, "dry-run", dryRun, "cluster-resource-namespace", clusterResourceNamespace)
+	if err := issuer.CollectOrphans(ctrl.SetupSignalHandler(), c, splitList(zones)); err != nil {
+		setupLog.Error(err, "orphan garbage collection failed")
+		return 1
+	}
+	return 0
+}
+
 var errNotInCluster = errors.New("not running in-cluster")
 
+// getInClusterNamespace defaults clusterResourceNamespace to the namespace of
+// the controller pod, from podNamespaceEnvVar or the service account mount.
 // Copied from controller-runtime/pkg/leaderelection
 func getInClusterNamespace(clusterResourceNamespace *string) error {
 	if *clusterResourceNamespace != "" {
 		return nil
 	}
 
+	if namespace := os.Getenv(podNamespaceEnvVar); namespace != "" {
+		*clusterResourceNamespace = namespace
+		return nil
+	}
+
 	// Check whether the namespace file exists.
 	// If not, we are not running in cluster so can't guess the namespace.
 	_, err := os.Stat(inClusterNamespacePath)
@@ -321,7 +882,56 @@ func getInClusterNamespace(clusterResourceNamespace *string) error {
 	if err != nil {
 		return fmt.Errorf("error reading namespace file: %w", err)
 	}
-	*clusterResourceNamespace = string(namespace)
+	*clusterResourceNamespace = strings.TrimSpace(string(namespace))
+
+	return nil
+}
+
+// getKubeconfigNamespace returns the namespace of the current context of the
+// kubeconfig that the controller connects with when it runs out-of-cluster,
+// or "default" if the context does not set one. The kubeconfig is looked up
+// like controller-runtime does: --kubeconfig, then $KUBECONFIG, then
+// ~/.kube/config.
+func getKubeconfigNamespace() (string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if f := flag.Lookup(ctrlconfig.KubeconfigFlagName); f != nil {
+		rules.ExplicitPath = f.Value.String()
+	}
+	namespace, _, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).Namespace()
+	return namespace, err
+}
 
+// resolveShard validates the sharding flags, defaulting shardIndex to the
+// StatefulSet ordinal of the controller pod.
+func resolveShard(shardCount int, shardIndex *int, leaderElection bool) error {
+	if shardCount <= 1 {
+		return nil
+	}
+	if leaderElection {
+		return errors.New("--shard-count requires --leader-elect=false, as all replicas are active")
+	}
+	if *shardIndex < 0 {
+		podName := os.Getenv(podNameEnvVar)
+		i := strings.LastIndex(podName, "-")
+		ordinal, err := strconv.Atoi(podName[i+1:])
+		if i < 0 || err != nil {
+			return fmt.Errorf("--shard-index is not set and $%s %q does not end with a StatefulSet ordinal", podNameEnvVar, podName)
+		}
+		*shardIndex = ordinal
+	}
+	if *shardIndex >= shardCount {
+		return fmt.Errorf("--shard-index %d is out of range for --shard-count %d", *shardIndex, shardCount)
+	}
 	return nil
 }
+
+// splitList splits a comma separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
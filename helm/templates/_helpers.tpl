@@ -60,3 +60,13 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Whether the metrics endpoint is served with a certificate issued by
+cert-manager. Empty if not.
+*/}}
+{{- define "cfmtls-issuer.metricsCerts" -}}
+{{- with .Values.metrics }}
+{{- if and .enabled .secure .certManager.enabled }}true{{ end }}
+{{- end }}
+{{- end }}
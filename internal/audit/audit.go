@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit writes the audit log of the certificates issued by the
+// controller, as one JSON object per line.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Outcomes of a signing.
+const (
+	OutcomeIssued = "Issued"
+	OutcomeFailed = "Failed"
+)
+
+// Record is the audit record of a signing attempt.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Outcome string    `json:"outcome"`
+	// Reason and Error describe why the signing failed.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Request   Object `json:"request"`
+	Requester string `json:"requester,omitempty"`
+	Issuer    Object `json:"issuer"`
+	// Tenant is the team owning the namespace of the request, if tenants
+	// are enabled.
+	Tenant string `json:"tenant,omitempty"`
+	// Hostnames are the hostnames of the issued certificate, or the
+	// requested ones if the signing failed.
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	ZoneID        string     `json:"zoneID,omitempty"`
+	CertificateID string     `json:"certificateID,omitempty"`
+	SerialNumber  string     `json:"serialNumber,omitempty"`
+	NotBefore     *time.Time `json:"notBefore,omitempty"`
+	NotAfter      *time.Time `json:"notAfter,omitempty"`
+}
+
+// Object identifies a Kubernetes object in a record.
+type Object struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	UID       string `json:"uid,omitempty"`
+}
+
+// Logger appends records to a writer. It is safe for concurrent use.
+type Logger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogger returns a Logger writing to out.
+func NewLogger(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+// Open returns a Logger appending to the file at path, which is created if
+// it does not exist. "-" is stdout.
+func Open(path string) (*Logger, error) {
+	if path == "-" {
+		return NewLogger(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return NewLogger(f), nil
+}
+
+// Log appends the given record. Each record is written with a single write,
+// so that records of concurrent signings do not interleave.
+func (l *Logger) Log(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(data)
+	return err
+}
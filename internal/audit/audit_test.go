@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoggerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []Record{
+		{
+			Time:          time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Outcome:       OutcomeIssued,
+			Request:       Object{Kind: "CertificateRequest", Namespace: "default", Name: "web-1"},
+			Requester:     "system:serviceaccount:cert-manager:cert-manager",
+			Issuer:        Object{Kind: "CFMTLSIssuer", Namespace: "default", Name: "issuer"},
+			Hostnames:     []string{"example.com"},
+			CertificateID: "id",
+			SerialNumber:  "1f",
+			NotAfter:      &notAfter,
+		},
+		{
+			Time:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			Outcome: OutcomeFailed,
+			Reason:  "TokenInvalid",
+			Error:   "Cloudflare API responded with status: 403",
+			Request: Object{Kind: "CertificateRequest", Namespace: "default", Name: "web-2"},
+			Issuer:  Object{Kind: "CFMTLSIssuer", Namespace: "default", Name: "issuer"},
+		},
+	}
+
+	// Every record is written by a new Logger, as after a restart.
+	for _, record := range records {
+		logger, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := logger.Log(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %q is not a record: %v", scanner.Text(), err)
+		}
+		got = append(got, record)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("audit log = %+v, want %+v", got, records)
+	}
+}
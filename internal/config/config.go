@@ -0,0 +1,363 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the configuration file of the controller. Every
+// setting of the file corresponds to a command line flag, which takes
+// precedence over the file when it is set as well.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the apiVersion of the configuration file.
+	APIVersion = "cfmtls.cert.manager.io/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "ControllerConfiguration"
+)
+
+// ControllerConfiguration is the content of the configuration file. Unset
+// fields leave the corresponding flags at their defaults.
+type ControllerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// ClusterResourceNamespace sets --cluster-resource-namespace.
+	ClusterResourceNamespace *string `json:"clusterResourceNamespace,omitempty"`
+	// ClusterIssuerSecretNamespaces sets --cluster-issuer-secret-namespaces.
+	ClusterIssuerSecretNamespaces []string `json:"clusterIssuerSecretNamespaces,omitempty"`
+	// Namespaces sets --namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// CredentialsDir sets --credentials-dir.
+	CredentialsDir *string `json:"credentialsDir,omitempty"`
+	// SecretLabelSelector sets --secret-label-selector.
+	SecretLabelSelector *string `json:"secretLabelSelector,omitempty"`
+	// TrustBundleSource sets --trust-bundle-source.
+	TrustBundleSource *string `json:"trustBundleSource,omitempty"`
+	// TrustBundleConfigMap sets --trust-bundle-configmap.
+	TrustBundleConfigMap *string `json:"trustBundleConfigMap,omitempty"`
+	// TrustBundleNamespaceSelector sets --trust-bundle-namespace-selector.
+	TrustBundleNamespaceSelector *string `json:"trustBundleNamespaceSelector,omitempty"`
+	// MaxRetryDuration sets --max-retry-duration.
+	MaxRetryDuration *metav1.Duration `json:"maxRetryDuration,omitempty"`
+	// MaxConcurrentReconciles sets --max-concurrent-reconciles.
+	MaxConcurrentReconciles *int32 `json:"maxConcurrentReconciles,omitempty"`
+	// MaxConcurrentSignings sets --max-concurrent-signings.
+	MaxConcurrentSignings *int32 `json:"maxConcurrentSignings,omitempty"`
+	// IssuanceBudget sets --issuance-budget.
+	IssuanceBudget *int32 `json:"issuanceBudget,omitempty"`
+	// WarmUpConcurrency sets --warm-up-concurrency.
+	WarmUpConcurrency *int32 `json:"warmUpConcurrency,omitempty"`
+	// AttemptTimeout sets --attempt-timeout.
+	AttemptTimeout *metav1.Duration `json:"attemptTimeout,omitempty"`
+	// CloudflareRateLimit sets --cloudflare-rate-limit.
+	CloudflareRateLimit *int32 `json:"cloudflareRateLimit,omitempty"`
+	// CloudflareRateLimitBurst sets --cloudflare-rate-limit-burst.
+	CloudflareRateLimitBurst *int32 `json:"cloudflareRateLimitBurst,omitempty"`
+	// CredentialCacheTTL sets --credential-cache-ttl.
+	CredentialCacheTTL *metav1.Duration `json:"credentialCacheTTL,omitempty"`
+	// CleanupTTL sets --cleanup-ttl.
+	CleanupTTL *metav1.Duration `json:"cleanupTTL,omitempty"`
+	// OrphanGCInterval sets --orphan-gc-interval.
+	OrphanGCInterval *metav1.Duration `json:"orphanGCInterval,omitempty"`
+	// OrphanGCDryRun sets --orphan-gc-dry-run.
+	OrphanGCDryRun *bool `json:"orphanGCDryRun,omitempty"`
+	// GracefulShutdownTimeout sets --graceful-shutdown-timeout.
+	GracefulShutdownTimeout *metav1.Duration `json:"gracefulShutdownTimeout,omitempty"`
+	// ReadinessCheckURL sets --readiness-check-url.
+	ReadinessCheckURL *string `json:"readinessCheckURL,omitempty"`
+	// ReadinessRequireReadyIssuer sets --readiness-require-ready-issuer.
+	ReadinessRequireReadyIssuer *bool `json:"readinessRequireReadyIssuer,omitempty"`
+	// CertificateEvents sets --certificate-events.
+	CertificateEvents *bool `json:"certificateEvents,omitempty"`
+	// RequireApproval sets --require-approval.
+	RequireApproval *bool `json:"requireApproval,omitempty"`
+	// TenantLabel sets --tenant-label.
+	TenantLabel *string `json:"tenantLabel,omitempty"`
+	// HealthProbeBindAddress sets --health-probe-bind-address.
+	HealthProbeBindAddress *string `json:"healthProbeBindAddress,omitempty"`
+	// EnablePprof sets --enable-pprof.
+	EnablePprof *bool `json:"enablePprof,omitempty"`
+	// PprofBindAddress sets --pprof-bind-address.
+	PprofBindAddress *string `json:"pprofBindAddress,omitempty"`
+	// TracingEndpoint sets --tracing-endpoint.
+	TracingEndpoint *string `json:"tracingEndpoint,omitempty"`
+	// TracingInsecure sets --tracing-insecure.
+	TracingInsecure *bool `json:"tracingInsecure,omitempty"`
+	// AuditLog sets --audit-log.
+	AuditLog *string `json:"auditLog,omitempty"`
+	// DebugHTTP sets --debug-http.
+	DebugHTTP *bool `json:"debugHTTP,omitempty"`
+	// DebugHTTPBodies sets --debug-http-bodies.
+	DebugHTTPBodies *bool `json:"debugHTTPBodies,omitempty"`
+	// DNSServer sets --dns-server.
+	DNSServer *string `json:"dnsServer,omitempty"`
+	// HostOverrides sets --host-overrides.
+	HostOverrides map[string]string `json:"hostOverrides,omitempty"`
+	// FaultInjection sets --fault-injection.
+	FaultInjection *string `json:"faultInjection,omitempty"`
+	// EnableHTTP2 sets --enable-http2.
+	EnableHTTP2 *bool `json:"enableHTTP2,omitempty"`
+	// FIPS sets --fips.
+	FIPS *bool `json:"fips,omitempty"`
+	// FieldOwner sets --field-owner.
+	FieldOwner *string `json:"fieldOwner,omitempty"`
+	// SignerNamePrefix sets --signer-name-prefix.
+	SignerNamePrefix *string `json:"signerNamePrefix,omitempty"`
+	// ShardCount sets --shard-count.
+	ShardCount *int32 `json:"shardCount,omitempty"`
+	// FeatureGates sets --feature-gates.
+	FeatureGates map[string]bool `json:"featureGates,omitempty"`
+
+	// Metrics configures the metrics endpoint.
+	Metrics MetricsConfiguration `json:"metrics,omitempty"`
+	// Webhook configures the admission and conversion webhooks.
+	Webhook WebhookConfiguration `json:"webhook,omitempty"`
+	// LeaderElection configures leader election between replicas.
+	LeaderElection LeaderElectionConfiguration `json:"leaderElection,omitempty"`
+	// Logging configures the logger.
+	Logging LoggingConfiguration `json:"logging,omitempty"`
+}
+
+// MetricsConfiguration configures the metrics endpoint.
+type MetricsConfiguration struct {
+	// BindAddress sets --metrics-bind-address.
+	BindAddress *string `json:"bindAddress,omitempty"`
+	// Secure sets --metrics-secure.
+	Secure *bool `json:"secure,omitempty"`
+	// CertPath sets --metrics-cert-path.
+	CertPath *string `json:"certPath,omitempty"`
+	// CertName sets --metrics-cert-name.
+	CertName *string `json:"certName,omitempty"`
+	// CertKey sets --metrics-cert-key.
+	CertKey *string `json:"certKey,omitempty"`
+}
+
+// WebhookConfiguration configures the admission and conversion webhooks.
+type WebhookConfiguration struct {
+	// Enabled sets --enable-webhooks.
+	Enabled *bool `json:"enabled,omitempty"`
+	// CertPath sets --webhook-cert-path.
+	CertPath *string `json:"certPath,omitempty"`
+	// CertName sets --webhook-cert-name.
+	CertName *string `json:"certName,omitempty"`
+	// CertKey sets --webhook-cert-key.
+	CertKey *string `json:"certKey,omitempty"`
+}
+
+// LeaderElectionConfiguration configures leader election between replicas.
+type LeaderElectionConfiguration struct {
+	// Enabled sets --leader-elect.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Namespace sets --leader-election-namespace.
+	Namespace *string `json:"namespace,omitempty"`
+	// LeaseDuration sets --leader-election-lease-duration.
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewDeadline sets --leader-election-renew-deadline.
+	RenewDeadline *metav1.Duration `json:"renewDeadline,omitempty"`
+	// RetryPeriod sets --leader-election-retry-period.
+	RetryPeriod *metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// LoggingConfiguration configures the logger.
+type LoggingConfiguration struct {
+	// Development sets --zap-devel.
+	Development *bool `json:"development,omitempty"`
+	// Encoder sets --zap-encoder, either "json" or "console".
+	Encoder *string `json:"encoder,omitempty"`
+	// Level sets --zap-log-level, e.g. "info", "debug" or an integer
+	// verbosity.
+	Level *string `json:"level,omitempty"`
+	// StacktraceLevel sets --zap-stacktrace-level.
+	StacktraceLevel *string `json:"stacktraceLevel,omitempty"`
+	// TimeEncoding sets --zap-time-encoding.
+	TimeEncoding *string `json:"timeEncoding,omitempty"`
+}
+
+// Load reads the configuration file at path. Unknown fields are rejected, so
+// that misspelled settings are not silently ignored.
+func Load(path string) (*ControllerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	var config ControllerConfiguration
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	if config.APIVersion != "" && config.APIVersion != APIVersion {
+		return nil, fmt.Errorf("unsupported apiVersion %q in configuration file %s, expected %q", config.APIVersion, path, APIVersion)
+	}
+	if config.Kind != "" && config.Kind != Kind {
+		return nil, fmt.Errorf("unsupported kind %q in configuration file %s, expected %q", config.Kind, path, Kind)
+	}
+	return &config, nil
+}
+
+// Flags returns the values of the flags that are set by the configuration,
+// keyed by flag name.
+func (c *ControllerConfiguration) Flags() map[string]string {
+	values := map[string]string{}
+	setString := func(name string, value *string) {
+		if value != nil {
+			values[name] = *value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+	setDuration := func(name string, value *metav1.Duration) {
+		if value != nil {
+			values[name] = value.Duration.String()
+		}
+	}
+	setList := func(name string, value []string) {
+		if value != nil {
+			values[name] = strings.Join(value, ",")
+		}
+	}
+
+	setString("cluster-resource-namespace", c.ClusterResourceNamespace)
+	setList("cluster-issuer-secret-namespaces", c.ClusterIssuerSecretNamespaces)
+	setList("namespaces", c.Namespaces)
+	setString("credentials-dir", c.CredentialsDir)
+	setString("secret-label-selector", c.SecretLabelSelector)
+	setString("trust-bundle-source", c.TrustBundleSource)
+	setString("trust-bundle-configmap", c.TrustBundleConfigMap)
+	setString("trust-bundle-namespace-selector", c.TrustBundleNamespaceSelector)
+	setDuration("max-retry-duration", c.MaxRetryDuration)
+	if c.MaxConcurrentReconciles != nil {
+		values["max-concurrent-reconciles"] = strconv.Itoa(int(*c.MaxConcurrentReconciles))
+	}
+	if c.MaxConcurrentSignings != nil {
+		values["max-concurrent-signings"] = strconv.Itoa(int(*c.MaxConcurrentSignings))
+	}
+	if c.IssuanceBudget != nil {
+		values["issuance-budget"] = strconv.Itoa(int(*c.IssuanceBudget))
+	}
+	if c.WarmUpConcurrency != nil {
+		values["warm-up-concurrency"] = strconv.Itoa(int(*c.WarmUpConcurrency))
+	}
+	setDuration("attempt-timeout", c.AttemptTimeout)
+	if c.CloudflareRateLimit != nil {
+		values["cloudflare-rate-limit"] = strconv.Itoa(int(*c.CloudflareRateLimit))
+	}
+	if c.CloudflareRateLimitBurst != nil {
+		values["cloudflare-rate-limit-burst"] = strconv.Itoa(int(*c.CloudflareRateLimitBurst))
+	}
+	setDuration("credential-cache-ttl", c.CredentialCacheTTL)
+	setDuration("cleanup-ttl", c.CleanupTTL)
+	setDuration("orphan-gc-interval", c.OrphanGCInterval)
+	setBool("orphan-gc-dry-run", c.OrphanGCDryRun)
+	setDuration("graceful-shutdown-timeout", c.GracefulShutdownTimeout)
+	setString("readiness-check-url", c.ReadinessCheckURL)
+	setBool("readiness-require-ready-issuer", c.ReadinessRequireReadyIssuer)
+	setBool("certificate-events", c.CertificateEvents)
+	setBool("require-approval", c.RequireApproval)
+	setString("tenant-label", c.TenantLabel)
+	setString("health-probe-bind-address", c.HealthProbeBindAddress)
+	setBool("enable-pprof", c.EnablePprof)
+	setString("pprof-bind-address", c.PprofBindAddress)
+	setString("tracing-endpoint", c.TracingEndpoint)
+	setBool("tracing-insecure", c.TracingInsecure)
+	setString("audit-log", c.AuditLog)
+	setBool("debug-http", c.DebugHTTP)
+	setBool("debug-http-bodies", c.DebugHTTPBodies)
+	setString("dns-server", c.DNSServer)
+	if len(c.HostOverrides) > 0 {
+		var overrides []string
+		for host, ip := range c.HostOverrides {
+			overrides = append(overrides, host+"="+ip)
+		}
+		sort.Strings(overrides)
+		values["host-overrides"] = strings.Join(overrides, ",")
+	}
+	setString("fault-injection", c.FaultInjection)
+	setBool("enable-http2", c.EnableHTTP2)
+	setBool("fips", c.FIPS)
+	if c.ShardCount != nil {
+		values["shard-count"] = strconv.Itoa(int(*c.ShardCount))
+	}
+	setString("field-owner", c.FieldOwner)
+	setString("signer-name-prefix", c.SignerNamePrefix)
+	if len(c.FeatureGates) > 0 {
+		var gates []string
+		for name, enabled := range c.FeatureGates {
+			gates = append(gates, name+"="+strconv.FormatBool(enabled))
+		}
+		sort.Strings(gates)
+		values["feature-gates"] = strings.Join(gates, ",")
+	}
+
+	setString("metrics-bind-address", c.Metrics.BindAddress)
+	setBool("metrics-secure", c.Metrics.Secure)
+	setString("metrics-cert-path", c.Metrics.CertPath)
+	setString("metrics-cert-name", c.Metrics.CertName)
+	setString("metrics-cert-key", c.Metrics.CertKey)
+
+	setBool("enable-webhooks", c.Webhook.Enabled)
+	setString("webhook-cert-path", c.Webhook.CertPath)
+	setString("webhook-cert-name", c.Webhook.CertName)
+	setString("webhook-cert-key", c.Webhook.CertKey)
+
+	setBool("leader-elect", c.LeaderElection.Enabled)
+	setString("leader-election-namespace", c.LeaderElection.Namespace)
+	setDuration("leader-election-lease-duration", c.LeaderElection.LeaseDuration)
+	setDuration("leader-election-renew-deadline", c.LeaderElection.RenewDeadline)
+	setDuration("leader-election-retry-period", c.LeaderElection.RetryPeriod)
+
+	setBool("zap-devel", c.Logging.Development)
+	setString("zap-encoder", c.Logging.Encoder)
+	setString("zap-log-level", c.Logging.Level)
+	setString("zap-stacktrace-level", c.Logging.StacktraceLevel)
+	setString("zap-time-encoding", c.Logging.TimeEncoding)
+
+	return values
+}
+
+// Apply sets the flags of fs from the configuration file at path, except for
+// those that were set on the command line. It must be called after fs has
+// been parsed.
+func Apply(fs *flag.FlagSet, path string) error {
+	config, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for name, value := range config.Flags() {
+		if set[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in configuration file %s: %w", value, name, path, err)
+		}
+	}
+	return nil
+}
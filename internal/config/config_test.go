@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "settings from the file",
+			file: `
+apiVersion: cfmtls.cert.manager.io/v1alpha1
+kind: ControllerConfiguration
+namespaces: [team-a, team-b]
+maxRetryDuration: 30m
+maxConcurrentReconciles: 4
+leaderElection:
+  enabled: true
+featureGates:
+  TokenRotation: false
+  Revocation: true
+logging:
+  level: debug
+`,
+			want: map[string]string{
+				"namespaces":                "team-a,team-b",
+				"max-retry-duration":        "30m0s",
+				"max-concurrent-reconciles": "4",
+				"leader-elect":              "true",
+				"metrics-bind-address":      "0",
+				"feature-gates":             "Revocation=true,TokenRotation=false",
+				"zap-log-level":             "debug",
+			},
+		},
+		{
+			name: "flags take precedence",
+			file: `
+maxConcurrentReconciles: 4
+metrics:
+  bindAddress: ":8443"
+`,
+			args: []string{"--max-concurrent-reconciles=8"},
+			want: map[string]string{
+				"max-concurrent-reconciles": "8",
+				"metrics-bind-address":      ":8443",
+			},
+		},
+		{
+			name:    "unknown field",
+			file:    "maxConcurrentReconcile: 4\n",
+			wantErr: true,
+		},
+		{
+			name:    "wrong kind",
+			file:    "kind: Configuration\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.String("namespaces", "", "")
+			fs.Duration("max-retry-duration", 15*time.Minute, "")
+			fs.Int("max-concurrent-reconciles", 1, "")
+			fs.Bool("leader-elect", false, "")
+			fs.String("metrics-bind-address", "0", "")
+			fs.String("feature-gates", "", "")
+			fs.String("zap-log-level", "", "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Apply(fs, path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Apply() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			for name, want := range tt.want {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("--%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// checkApproval refuses to sign requests that lack the Approved condition,
+// or that were denied, if RequireApproval is set. issuer-lib does not pass
+// such requests to Sign in the first place, so this only enforces approval
+// in depth, e.g. for clusters running approver-policy. Requests awaiting
+// approval are kept pending, with an event telling why that is recorded
+// once rather than on every attempt.
+func (o *Issuer) checkApproval(cr signer.CertificateRequestObject) error {
+	if !o.RequireApproval {
+		return nil
+	}
+	approved, denied := requestApproval(cr)
+	if denied {
+		return withReason(CFMTLSIssuerapi.ReasonDenied, signer.PermanentError{Err: errors.New("request was denied")})
+	}
+	if approved {
+		return nil
+	}
+
+	err := withReason(CFMTLSIssuerapi.ReasonApprovalPending, errors.New("request has not been approved yet"))
+	if o.recorder != nil && !approvalPendingRecorded(cr) {
+		if object := requestObject(cr); object != nil {
+			o.recorder.Event(object, corev1.EventTypeNormal, EventReasonApprovalPending, "Waiting for the request to be approved before signing it")
+		}
+	}
+	return signer.PendingError{Err: err}
+}
+
+// approvalPendingRecorded reports whether a previous attempt already kept
+// the request pending for approval, and so recorded the event.
+func approvalPendingRecorded(cr signer.CertificateRequestObject) bool {
+	for _, condition := range cr.GetConditions() {
+		if condition.Type == CFMTLSIssuerapi.CertificateRequestConditionCloudflareIssued && condition.Reason == CFMTLSIssuerapi.ReasonApprovalPending {
+			return true
+		}
+	}
+	return false
+}
+
+// requestApproval reports whether the given request has the Approved or the
+// Denied condition.
+func requestApproval(cr signer.CertificateRequestObject) (approved, denied bool) {
+	switch r := requestObject(cr).(type) {
+	case *cmapi.CertificateRequest:
+		for _, condition := range r.Status.Conditions {
+			if condition.Status != cmmeta.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case cmapi.CertificateRequestConditionApproved:
+				approved = true
+			case cmapi.CertificateRequestConditionDenied:
+				denied = true
+			}
+		}
+	case *certificatesv1.CertificateSigningRequest:
+		for _, condition := range r.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case certificatesv1.CertificateApproved:
+				approved = true
+			case certificatesv1.CertificateDenied:
+				denied = true
+			}
+		}
+	}
+	return approved, denied
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestCheckApproval(t *testing.T) {
+	certificateRequest := func(conditions ...cmapi.CertificateRequestCondition) signer.CertificateRequestObject {
+		return signer.CertificateRequestObjectFromCertificateRequest(&cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1"},
+			Status:     cmapi.CertificateRequestStatus{Conditions: conditions},
+		})
+	}
+	approved := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionApproved, Status: cmmeta.ConditionTrue}
+	denied := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionDenied, Status: cmmeta.ConditionTrue}
+
+	tests := []struct {
+		name            string
+		requireApproval bool
+		cr              signer.CertificateRequestObject
+		wantReason      string
+		wantPending     bool
+		wantPermanent   bool
+		wantEvent       bool
+	}{
+		{
+			name: "approval not required",
+			cr:   certificateRequest(),
+		},
+		{
+			name:            "approved",
+			requireApproval: true,
+			cr:              certificateRequest(approved),
+		},
+		{
+			name:            "not approved",
+			requireApproval: true,
+			cr:              certificateRequest(),
+			wantReason:      CFMTLSIssuerapi.ReasonApprovalPending,
+			wantPending:     true,
+			wantEvent:       true,
+		},
+		{
+			name:            "approval not true",
+			requireApproval: true,
+			cr:              certificateRequest(cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionApproved, Status: cmmeta.ConditionFalse}),
+			wantReason:      CFMTLSIssuerapi.ReasonApprovalPending,
+			wantPending:     true,
+			wantEvent:       true,
+		},
+		{
+			name:            "denied",
+			requireApproval: true,
+			cr:              certificateRequest(denied),
+			wantReason:      CFMTLSIssuerapi.ReasonDenied,
+			wantPermanent:   true,
+		},
+		{
+			name:            "approved and denied",
+			requireApproval: true,
+			cr:              certificateRequest(approved, denied),
+			wantReason:      CFMTLSIssuerapi.ReasonDenied,
+			wantPermanent:   true,
+		},
+		{
+			name:            "approved CertificateSigningRequest",
+			requireApproval: true,
+			cr: signer.CertificateRequestObjectFromCertificateSigningRequest(&certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1"},
+				Status: certificatesv1.CertificateSigningRequestStatus{Conditions: []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue},
+				}},
+			}),
+		},
+		{
+			name:            "pending CertificateSigningRequest",
+			requireApproval: true,
+			cr: signer.CertificateRequestObjectFromCertificateSigningRequest(&certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1"},
+			}),
+			wantReason:  CFMTLSIssuerapi.ReasonApprovalPending,
+			wantPending: true,
+			wantEvent:   true,
+		},
+		{
+			name:            "still not approved",
+			requireApproval: true,
+			cr: certificateRequest(cmapi.CertificateRequestCondition{
+				Type:   CFMTLSIssuerapi.CertificateRequestConditionCloudflareIssued,
+				Status: cmmeta.ConditionFalse,
+				Reason: CFMTLSIssuerapi.ReasonApprovalPending,
+			}),
+			wantReason:  CFMTLSIssuerapi.ReasonApprovalPending,
+			wantPending: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			o := &Issuer{recorder: recorder, RequireApproval: tt.requireApproval}
+			err := o.checkApproval(tt.cr)
+			close(recorder.Events)
+
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("checkApproval() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkApproval() = nil, want error")
+			}
+			if got := errorReason(err); got != tt.wantReason {
+				t.Errorf("reason = %q, want %q", got, tt.wantReason)
+			}
+			if got := errors.As(err, &signer.PendingError{}); got != tt.wantPending {
+				t.Errorf("pending = %v, want %v", got, tt.wantPending)
+			}
+			if got := errors.As(err, &signer.PermanentError{}); got != tt.wantPermanent {
+				t.Errorf("permanent = %v, want %v", got, tt.wantPermanent)
+			}
+
+			want := ""
+			if tt.wantEvent {
+				want = "Normal " + EventReasonApprovalPending + " Waiting for the request to be approved before signing it"
+			}
+			if got := <-recorder.Events; got != want {
+				t.Errorf("event = %q, want %q", got, want)
+			}
+		})
+	}
+}
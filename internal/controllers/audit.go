@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/krisek/cfmtls-issuer/internal/audit"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+)
+
+// auditSignResult appends the outcome of a signing attempt to the audit
+// log. Requests kept pending, e.g. while the issuer is paused, are recorded
+// once they are signed or fail.
+func (o *Issuer) auditSignResult(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer, tenant, zoneID, certID string, certPEM []byte, err error) {
+	if o.AuditLog == nil || errors.As(err, &signer.PendingError{}) {
+		return
+	}
+
+	ref, issuerRef := requestReference(cr), issuerReference(issuerObject)
+	record := audit.Record{
+		Time:          time.Now().UTC(),
+		Outcome:       audit.OutcomeIssued,
+		Request:       audit.Object{Kind: ref.Kind, Namespace: ref.Namespace, Name: ref.Name, UID: ref.UID},
+		Requester:     requester(cr),
+		Tenant:        tenant,
+		Issuer:        audit.Object{Kind: issuerRef.Kind, Namespace: issuerObject.GetNamespace(), Name: issuerRef.Name},
+		ZoneID:        zoneID,
+		CertificateID: certID,
+	}
+	if err != nil {
+		record.Outcome = audit.OutcomeFailed
+		record.Reason = errorReason(err)
+		record.Error = redact.String(err.Error())
+		if template, _, _, err := cr.GetRequest(); err == nil {
+			record.Hostnames = template.DNSNames
+		}
+	} else if cert, err := pki.DecodeX509CertificateBytes(certPEM); err == nil {
+		record.Hostnames = cert.DNSNames
+		record.SerialNumber = fmt.Sprintf("%x", cert.SerialNumber)
+		record.NotBefore = &cert.NotBefore
+		record.NotAfter = &cert.NotAfter
+	}
+
+	if err := o.AuditLog.Log(record); err != nil {
+		log.FromContext(ctx).Error(err, "failed to write audit record", "outcome", record.Outcome, "certificateID", certID)
+	}
+}
+
+// requester returns the user that created the given request, as recorded
+// by the API server.
+func requester(cr signer.CertificateRequestObject) string {
+	switch r := cr.(type) {
+	case interface {
+		DeepCopy() *cmapi.CertificateRequest
+	}:
+		return r.DeepCopy().Spec.Username
+	case interface {
+		DeepCopy() *certificatesv1.CertificateSigningRequest
+	}:
+		return r.DeepCopy().Spec.Username
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// circuitFailureThreshold is the number of consecutive failed requests
+	// to the Cloudflare API after which the circuit breaker opens.
+	circuitFailureThreshold = 5
+	// circuitOpenDuration is how long the circuit breaker stays open before
+	// a probe request is let through.
+	circuitOpenDuration = 30 * time.Second
+)
+
+// errCircuitOpen is returned for the requests that the circuit breaker
+// rejects.
+var errCircuitOpen = errors.New("Cloudflare API unavailable: circuit breaker is open after consecutive failures")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops sending requests to the Cloudflare API after
+// circuitFailureThreshold consecutive failures, so that an outage fails the
+// signings fast instead of piling up timeouts in the work queue. Once
+// circuitOpenDuration has passed, a single probe request is let through: the
+// breaker closes if it succeeds, and opens again if it fails.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+	// now returns the current time. nil uses time.Now.
+	now func() time.Time
+}
+
+func (b *circuitBreaker) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+// allow reports whether a request may be sent. In the half-open state only
+// the probe request is allowed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.clock().Sub(b.openedAt) < circuitOpenDuration {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	}
+	return true
+}
+
+// done records the outcome of an allowed request and returns the new state
+// if it changed.
+func (b *circuitBreaker) done(failed bool) (circuitState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	previous := b.state
+	switch {
+	case !failed:
+		b.state = circuitClosed
+		b.failures = 0
+	case b.state == circuitHalfOpen:
+		b.state = circuitOpen
+		b.openedAt = b.clock()
+	default:
+		b.failures++
+		if b.failures >= circuitFailureThreshold {
+			b.state = circuitOpen
+			b.openedAt = b.clock()
+		}
+	}
+	return b.state, b.state != previous
+}
+
+// release gives up an allowed request that was canceled by its caller. A
+// canceled probe lets the next request probe instead.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+// circuitBreakers holds a circuit breaker per egress configuration, keyed
+// like the transports, so that a broken proxy of one issuer does not stop
+// the requests of the others.
+type circuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: map[string]*circuitBreaker{}}
+}
+
+// get returns the circuit breaker with the given key. A nil set returns
+// nil, which does not break.
+func (c *circuitBreakers) get(key string) *circuitBreaker {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker, ok := c.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{}
+		c.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// circuitBreakerTransport sends the requests through the circuit breaker.
+// Network errors and server errors count as failures, after the retries of
+// the request, while throttling and client errors show that the API is up.
+type circuitBreakerTransport struct {
+	breaker *circuitBreaker
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !t.breaker.allow() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errCircuitOpen
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil && req.Context().Err() != nil {
+		// A request canceled by the caller says nothing about the API.
+		t.breaker.release()
+		return resp, err
+	}
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	if state, changed := t.breaker.done(failed); changed {
+		logger := log.FromContext(req.Context())
+		switch state {
+		case circuitOpen:
+			logger.Info("Cloudflare API is failing, rejecting requests", "for", circuitOpenDuration)
+		case circuitClosed:
+			logger.Info("Cloudflare API recovered, sending requests again")
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	now := time.Unix(0, 0)
+	breaker := &circuitBreaker{now: func() time.Time { return now }}
+	client := &http.Client{Transport: &circuitBreakerTransport{breaker: breaker}}
+	send := func() error {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Server errors are returned as they are until the breaker opens.
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if err := send(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := send(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("request after %d failures: error = %v, want %v", circuitFailureThreshold, err, errCircuitOpen)
+	}
+	if requests != circuitFailureThreshold {
+		t.Errorf("server received %d requests, want %d", requests, circuitFailureThreshold)
+	}
+
+	// A failed probe opens the breaker again.
+	now = now.Add(circuitOpenDuration)
+	if err := send(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := send(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("request after failed probe: error = %v, want %v", err, errCircuitOpen)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(circuitOpenDuration)
+	status = http.StatusOK
+	for i := 0; i < 2; i++ {
+		if err := send(); err != nil {
+			t.Fatalf("request %d after recovery: %v", i, err)
+		}
+	}
+	if requests != circuitFailureThreshold+3 {
+		t.Errorf("server received %d requests, want %d", requests, circuitFailureThreshold+3)
+	}
+}
+
+func TestCircuitBreakerCountsConsecutiveFailures(t *testing.T) {
+	breaker := &circuitBreaker{}
+	for i := 0; i < 2*circuitFailureThreshold; i++ {
+		if !breaker.allow() {
+			t.Fatalf("request %d rejected", i)
+		}
+		// Every other request succeeds, which resets the count.
+		breaker.done(i%2 == 0)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason string
+	}{
+		{
+			name:       "network error",
+			err:        errors.New("connection refused"),
+			wantReason: CFMTLSIssuerapi.ReasonAPIUnreachable,
+		},
+		{
+			name:       "circuit open",
+			err:        fmt.Errorf("Post \"https://api.cloudflare.com\": %w", errCircuitOpen),
+			wantReason: CFMTLSIssuerapi.ReasonUpstreamUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := errorReason(requestError(tt.err)); reason != tt.wantReason {
+				t.Errorf("errorReason() = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
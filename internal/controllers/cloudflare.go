@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// cfRayHeader identifies a request to Cloudflare, for its support.
+const cfRayHeader = "Cf-Ray"
+
+// maxErrorBodySize bounds the body of a failed response that is read for
+// its error messages.
+const maxErrorBodySize = 64 << 10
+
+// signingRequest is the body of a request to sign a CSR.
+type signingRequest struct {
+	CSR          string `json:"csr"`
+	ValidityDays int64  `json:"validity_days"`
+}
+
+// signingResponse is the body of a successful signing response. Only the
+// fields used by the controller are decoded.
+type signingResponse struct {
+	Result *struct {
+		ID          string `json:"id"`
+		Certificate string `json:"certificate"`
+	} `json:"result"`
+}
+
+// bufferPool recycles the buffers holding the bodies of Cloudflare API
+// responses while they are logged or reported in an error. The bodies of
+// requests are not pooled, as the transport may still read them after the
+// response arrived.
+var bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns buf to the pool, unless an unusually large body grew it.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > 4*maxErrorBodySize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// withCFRay appends the cf-ray ID of the given response to err, so that a
+// failed request can be looked up by Cloudflare support.
+func withCFRay(err error, resp *http.Response) error {
+	ray := resp.Header.Get(cfRayHeader)
+	if err == nil || ray == "" {
+		return err
+	}
+	return fmt.Errorf("%w (cf-ray %s)", err, ray)
+}
+
+// cloudflareDo sends a request with an optional JSON body to the Cloudflare
+// API and decodes the JSON response into result, if not nil.
+func cloudflareDo(ctx context.Context, apiKey, method, url string, body interface{}, client *http.Client, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return withReason(reasonForStatusCode(resp.StatusCode), withCFRay(fmt.Errorf("Cloudflare API responded with status: %d", resp.StatusCode), resp))
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonAPIError, withCFRay(fmt.Errorf("failed to parse Cloudflare response: %w", err), resp))
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testSigningResponse is a signing response of the size Cloudflare returns.
+var testSigningResponse = []byte(`{"success":true,"errors":[],"messages":[],"result":{` +
+	`"id":"b2134436-2555-4acf-be5b-26c48136575e",` +
+	`"certificate":"-----BEGIN CERTIFICATE-----\n` + strings.Repeat("MIIDmDCCAoCgAwIBAgIUKTOAZNjcXVZRj4oQt0SHsl1c1vMwDQYJKoZIhvcNAQELBQAw\\n", 20) + `-----END CERTIFICATE-----\n",` +
+	`"csr":"-----BEGIN CERTIFICATE REQUEST-----\n` + strings.Repeat("MIICfTCCAWUCAQAwODEbMBkGA1UECwwSU2VjdXJpdHkgRW5naW5lZXJpbmcxGTAX\\n", 14) + `-----END CERTIFICATE REQUEST-----\n",` +
+	`"ski":"8b2a1bd7d2a9b9d2e0e94e5b8f4cd16d4ba8e6c6",` +
+	`"serial_number":"2c8c4b8f6d0c7d3a1e4f5b9a8c7d6e5f4a3b2c1d",` +
+	`"signature":"SHA256WithRSA",` +
+	`"common_name":"O=Cloudflare, OU=Cloudflare Managed CA for account",` +
+	`"organization":"Cloudflare, Inc.",` +
+	`"country":"US","state":"California","location":"San Francisco",` +
+	`"expires_on":"2033-02-20T23:18:00Z","issued_on":"2023-02-23T23:18:00Z",` +
+	`"fingerprint_sha256":"1d1a9c4e2a3f8e7c6b5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f",` +
+	`"validity_days":3650,"status":"active",` +
+	`"certificate_authority":{"id":"568b6b74-7b0c-4755-8840-4e3b8c24adeb","name":"Cloudflare Managed CA for account"}}}`)
+
+func TestCloudflareSignerSign(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCert string
+		wantID   string
+		wantErr  string
+	}{
+		{
+			name:     "issued",
+			status:   http.StatusOK,
+			body:     `{"success":true,"result":{"id":"id","certificate":"cert","status":"active"}}`,
+			wantCert: "cert",
+			wantID:   "id",
+		},
+		{
+			name:    "missing result",
+			status:  http.StatusOK,
+			body:    `{"success":true}`,
+			wantErr: "invalid response format: missing 'result' field",
+		},
+		{
+			name:    "missing certificate",
+			status:  http.StatusOK,
+			body:    `{"success":true,"result":{"id":"id"}}`,
+			wantErr: "invalid certificate response from Cloudflare API",
+		},
+		{
+			name:    "malformed",
+			status:  http.StatusOK,
+			body:    `{"result":`,
+			wantErr: "failed to parse Cloudflare response",
+		},
+		{
+			name:    "rejected",
+			status:  http.StatusBadRequest,
+			body:    `{"success":false,"errors":[{"code":1002,"message":"Invalid CSR"}]}`,
+			wantErr: "1002: Invalid CSR",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				var body signingRequest
+				if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.CSR != "csr" || body.ValidityDays != 90 {
+					t.Errorf("request body = %+v, %v", body, err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			s := &CloudflareSigner{APIKey: "token", ZoneID: "zone", BaseURL: server.URL, HTTPClient: server.Client()}
+			cert, id, err := s.Sign(context.Background(), []byte("csr"), 90)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Sign() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if string(cert) != tt.wantCert || id != tt.wantID {
+				t.Errorf("Sign() = %q, %q, want %q, %q", cert, id, tt.wantCert, tt.wantID)
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeSigningResponse compares decoding a signing response into
+// a generic map, as the signer used to, with decoding it into its struct.
+func BenchmarkDecodeSigningResponse(b *testing.B) {
+	b.Run("map", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body := new(bytes.Buffer)
+			_, _ = body.ReadFrom(bytes.NewReader(testSigningResponse))
+			var result map[string]interface{}
+			if err := json.NewDecoder(body).Decode(&result); err != nil {
+				b.Fatal(err)
+			}
+			resultData, _ := result["result"].(map[string]interface{})
+			if _, ok := resultData["certificate"].(string); !ok {
+				b.Fatal("missing certificate")
+			}
+		}
+	})
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var result signingResponse
+			if err := json.NewDecoder(bytes.NewReader(testSigningResponse)).Decode(&result); err != nil {
+				b.Fatal(err)
+			}
+			if result.Result == nil || result.Result.Certificate == "" {
+				b.Fatal("missing certificate")
+			}
+		}
+	})
+}
+
+// BenchmarkCloudflareSignerSign measures a signing round trip, under
+// concurrent issuance.
+func BenchmarkCloudflareSignerSign(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(testSigningResponse)
+	}))
+	defer server.Close()
+
+	s := &CloudflareSigner{APIKey: "token", ZoneID: "zone", BaseURL: server.URL, HTTPClient: server.Client()}
+	csr := []byte(strings.Repeat("MIICfTCCAWUCAQAwODEbMBkGA1UECwwSU2VjdXJpdHkgRW5naW5lZXJpbmcxGTAX\n", 14))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, _, err := s.Sign(context.Background(), csr, 90); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	"github.com/krisek/cfmtls-issuer/internal/features"
+)
+
+// setupConcurrency lets the request controllers sign up to
+// MaxConcurrentReconciles requests in parallel and, with the
+// ExpiryPriorityQueue feature, prefer the requests of the Certificates that
+// expire first. The issuer controllers check up to WarmUpConcurrency
+// issuers in parallel, so that all issuers are checked quickly on startup.
+func (o *Issuer) setupConcurrency(ctx context.Context, gvk schema.GroupVersionKind, mgr ctrl.Manager, b *builder.Builder) error {
+	var options controller.Options
+	switch gvk.Kind {
+	case "CFMTLSIssuer", "CFMTLSClusterIssuer":
+		if o.WarmUpConcurrency > 0 {
+			b.WithOptions(controller.Options{MaxConcurrentReconciles: o.WarmUpConcurrency})
+		}
+		return nil
+	case "CertificateRequest":
+		if o.featureEnabled(features.ExpiryPriorityQueue) {
+			// The queue reads Certificates from the cache while it is
+			// locked, so their informer must be running before the
+			// controller starts.
+			if _, err := mgr.GetCache().GetInformer(ctx, &cmapi.Certificate{}); err != nil {
+				return err
+			}
+			options.NewQueue = o.newExpiryQueue
+		}
+	case "CertificateSigningRequest":
+	default:
+		return nil
+	}
+
+	if o.MaxConcurrentReconciles > 0 {
+		options.MaxConcurrentReconciles = o.MaxConcurrentReconciles
+	}
+	// WithOptions replaces the options, so they are only set once.
+	b.WithOptions(options)
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// issuerConfig is the non-secret configuration of an issuer, merged from
+// its spec and the ConfigMap referenced by ConfigMapRef.
+type issuerConfig struct {
+	zoneID   string
+	baseURL  string
+	proxyURL string
+}
+
+// getIssuerConfig resolves the non-secret configuration of an issuer.
+// namespace is the namespace of the auth Secret, which is also used for
+// the ConfigMap.
+func (o *Issuer) getIssuerConfig(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (issuerConfig, error) {
+	var data map[string]string
+	if ref := issuerSpec.ConfigMapRef; ref != nil {
+		configMapName := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+		var configMap corev1.ConfigMap
+		if err := o.client.Get(ctx, configMapName, &configMap); err != nil {
+			wrapped := fmt.Errorf("failed to get ConfigMap %s: %v", configMapName, err)
+			if apierrors.IsNotFound(err) {
+				return issuerConfig{}, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, wrapped)
+			}
+			return issuerConfig{}, wrapped
+		}
+		data = configMap.Data
+	}
+
+	config := issuerConfig{
+		zoneID:   firstNonEmpty(issuerSpec.ZoneID, data[CFMTLSIssuerapi.ConfigMapZoneIDKey]),
+		baseURL:  firstNonEmpty(data[CFMTLSIssuerapi.ConfigMapAPIBaseURLKey], CFMTLSIssuerapi.DefaultAPIBaseURL),
+		proxyURL: data[CFMTLSIssuerapi.ConfigMapProxyURLKey],
+	}
+	if issuerSpec.Proxy != nil {
+		config.proxyURL = issuerSpec.Proxy.URL
+	}
+	config.baseURL = strings.TrimSuffix(config.baseURL, "/")
+
+	return config, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"golang.org/x/sync/singleflight"
+)
+
+// credentialCache keeps the credentials of the issuers that were fetched
+// and checked successfully for a short time, so that a burst of signings
+// does not read and check the credentials of their issuer for every
+// request. Concurrent fetches for the same issuer are collapsed into one.
+// The cached credentials are shared and must not be modified.
+type credentialCache struct {
+	ttl time.Duration
+	// now returns the current time. nil uses time.Now.
+	now   func() time.Time
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]credentialEntry
+}
+
+type credentialEntry struct {
+	// generation is the generation of the issuer the credentials were
+	// fetched for, so that a changed spec is not served stale credentials.
+	generation int64
+	secretData map[string][]byte
+	expires    time.Time
+}
+
+func newCredentialCache(ttl time.Duration) *credentialCache {
+	return &credentialCache{ttl: ttl, entries: map[string]credentialEntry{}}
+}
+
+func (c *credentialCache) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// get returns the cached credentials of the issuer, or fetches them with
+// fetch and caches them if that succeeds. A nil cache or a TTL of zero
+// always fetches.
+func (c *credentialCache) get(issuerObject issuerapi.Issuer, fetch func() (map[string][]byte, error)) (map[string][]byte, error) {
+	if c == nil || c.ttl <= 0 {
+		return fetch()
+	}
+
+	key, generation := credentialCacheKey(issuerObject), issuerObject.GetGeneration()
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && entry.generation == generation && c.clock().Before(entry.expires) {
+		return entry.secretData, nil
+	}
+
+	secretData, err, _ := c.group.Do(key+"@"+strconv.FormatInt(generation, 10), func() (any, error) {
+		secretData, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		c.put(issuerObject, secretData)
+		return secretData, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secretData.(map[string][]byte), nil
+}
+
+// put caches the credentials of the issuer, e.g. after its health check
+// passed.
+func (c *credentialCache) put(issuerObject issuerapi.Issuer, secretData map[string][]byte) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[credentialCacheKey(issuerObject)] = credentialEntry{
+		generation: issuerObject.GetGeneration(),
+		secretData: secretData,
+		expires:    c.clock().Add(c.ttl),
+	}
+}
+
+// forget drops the credentials of the issuer, e.g. after they were
+// rejected, so that the next signing fetches them again.
+func (c *credentialCache) forget(issuerObject issuerapi.Issuer) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, credentialCacheKey(issuerObject))
+}
+
+func credentialCacheKey(issuerObject issuerapi.Issuer) string {
+	kind, issuer := issuerMetricLabels(issuerObject)
+	return kind + "/" + issuer
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestCredentialCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := newCredentialCache(time.Minute)
+	cache.now = func() time.Time { return now }
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default", Generation: 1}}
+
+	var fetches int
+	fetch := func() (map[string][]byte, error) {
+		fetches++
+		return map[string][]byte{"cloudflare-api-key": []byte("token")}, nil
+	}
+	get := func() {
+		t.Helper()
+		if _, err := cache.get(issuer, fetch); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	}
+
+	get()
+	get()
+	if fetches != 1 {
+		t.Errorf("fetched %d times within the TTL, want 1", fetches)
+	}
+
+	now = now.Add(time.Minute)
+	get()
+	if fetches != 2 {
+		t.Errorf("fetched %d times after the TTL, want 2", fetches)
+	}
+
+	issuer.Generation = 2
+	get()
+	if fetches != 3 {
+		t.Errorf("fetched %d times after the spec changed, want 3", fetches)
+	}
+
+	cache.forget(issuer)
+	get()
+	if fetches != 4 {
+		t.Errorf("fetched %d times after forget, want 4", fetches)
+	}
+
+	// Failures are not cached.
+	cache.forget(issuer)
+	if _, err := cache.get(issuer, func() (map[string][]byte, error) { return nil, errors.New("not found") }); err == nil {
+		t.Fatal("get() succeeded, want the error of the fetch")
+	}
+	get()
+	if fetches != 5 {
+		t.Errorf("fetched %d times after a failure, want 5", fetches)
+	}
+}
+
+func TestCredentialCacheCollapsesConcurrentFetches(t *testing.T) {
+	cache := newCredentialCache(time.Minute)
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"}}
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (map[string][]byte, error) {
+		fetches.Add(1)
+		<-release
+		return map[string][]byte{}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.get(issuer, fetch); err != nil {
+				t.Errorf("get() error = %v", err)
+			}
+		}()
+	}
+	// Let the goroutines pile up behind the first fetch.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestCredentialCacheDisabled(t *testing.T) {
+	cache := newCredentialCache(0)
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer"}}
+
+	var fetches int
+	for i := 0; i < 2; i++ {
+		_, _ = cache.get(issuer, func() (map[string][]byte, error) {
+			fetches++
+			return map[string][]byte{}, nil
+		})
+	}
+	if fetches != 2 {
+		t.Errorf("fetched %d times, want 2", fetches)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// Environment variables holding the default credentials, which are used by
+// CFMTLSClusterIssuers that do not set authSecretName.
+const (
+	// APITokenEnvVar holds the default Cloudflare API token.
+	APITokenEnvVar = "CF_API_TOKEN"
+	// APITokenFileEnvVar holds the path of a file containing the default
+	// Cloudflare API token. It takes precedence over APITokenEnvVar and the
+	// file is re-read on every use, so that it can be rotated in place.
+	APITokenFileEnvVar = "CF_API_TOKEN_FILE"
+	// ZoneIDEnvVar holds the default Cloudflare zone ID.
+	ZoneIDEnvVar = "CF_ZONE_ID"
+)
+
+// CredentialProvider is a source of issuer credentials. Providers are
+// registered through Issuer.CredentialProviders.
+type CredentialProvider interface {
+	// Supports reports whether the provider reads the credentials of the
+	// given issuer.
+	Supports(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool
+	// Credentials returns the credentials of the given issuer, keyed like its
+	// auth Secret would be, see AuthSecretKeys. namespace is the namespace
+	// that the namespaced references of the issuer resolve in.
+	Credentials(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error)
+}
+
+// credentialProvider implements CredentialProvider with functions.
+type credentialProvider struct {
+	supports    func(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool
+	credentials func(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error)
+}
+
+func (p credentialProvider) Supports(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool {
+	return p.supports(issuerSpec)
+}
+
+func (p credentialProvider) Credentials(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error) {
+	return p.credentials(ctx, issuerSpec, namespace)
+}
+
+// credentialProviders returns the registered credential providers followed
+// by the built-in ones.
+func (o *Issuer) credentialProviders() []CredentialProvider {
+	providers := append([]CredentialProvider(nil), o.CredentialProviders...)
+	return append(providers,
+		credentialProvider{
+			supports:    func(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool { return issuerSpec.AuthFile != nil },
+			credentials: o.fileCredentials,
+		},
+		credentialProvider{
+			supports:    func(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool { return issuerSpec.Vault != nil },
+			credentials: o.vaultCredentials,
+		},
+		credentialProvider{
+			supports:    func(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool { return issuerSpec.SecretManager != nil },
+			credentials: secretManagerCredentials,
+		},
+		credentialProvider{
+			supports:    func(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool { return issuerSpec.AuthSecretName != "" },
+			credentials: o.secretCredentials,
+		},
+		// The environment is the fallback of issuers without any reference.
+		credentialProvider{
+			supports:    func(*CFMTLSIssuerapi.IssuerSpec) bool { return true },
+			credentials: defaultCredentials,
+		},
+	)
+}
+
+// credentialHash returns a SHA-256 fingerprint of the credentials of the
+// given issuer, which cannot be reversed into the API tokens.
+func credentialHash(issuerSpec *CFMTLSIssuerapi.IssuerSpec, secretData map[string][]byte) string {
+	h := sha256.New()
+	for _, key := range []string{apiTokenSecretKey(issuerSpec), secondaryAPITokenSecretKey(issuerSpec), zoneIDSecretKey(issuerSpec)} {
+		value := secretData[key]
+		fmt.Fprintf(h, "%d:", len(value))
+		h.Write(value)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// defaultCredentials returns the default credentials from the environment,
+// keyed like the auth Secret of the given issuer would be.
+func defaultCredentials(_ context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, _ string) (map[string][]byte, error) {
+	apiToken := os.Getenv(APITokenEnvVar)
+	if path := os.Getenv(APITokenFileEnvVar); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, withReason(CFMTLSIssuerapi.ReasonSecretNotFound, fmt.Errorf("failed to read default API token from %s: %w", path, err))
+		}
+		apiToken = strings.TrimSpace(string(data))
+	}
+
+	if apiToken == "" {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretNotFound,
+			errors.New("authSecretName is not set and no default API token is configured in the controller environment"))
+	}
+
+	data := map[string][]byte{apiTokenSecretKey(issuerSpec): []byte(apiToken)}
+	if zoneID := os.Getenv(ZoneIDEnvVar); zoneID != "" {
+		data[zoneIDSecretKey(issuerSpec)] = []byte(zoneID)
+	}
+	return data, nil
+}
+
+// fileCredentials reads the credentials of the given issuer from the files
+// referenced by spec.authFile, keyed like its auth Secret would be. The files
+// are read on every call, so that they can be rotated in place.
+func (o *Issuer) fileCredentials(_ context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, _ string) (map[string][]byte, error) {
+	if o.CredentialsDir == "" {
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration,
+			errors.New("authFile is set but the controller has no --credentials-dir configured"))
+	}
+
+	apiToken, err := o.readCredentialFile(issuerSpec.AuthFile.APITokenPath)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken == "" {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("credential file %q is empty", issuerSpec.AuthFile.APITokenPath))
+	}
+
+	data := map[string][]byte{apiTokenSecretKey(issuerSpec): []byte(apiToken)}
+	if path := issuerSpec.AuthFile.ZoneIDPath; path != "" {
+		zoneID, err := o.readCredentialFile(path)
+		if err != nil {
+			return nil, err
+		}
+		data[zoneIDSecretKey(issuerSpec)] = []byte(zoneID)
+	}
+	return data, nil
+}
+
+// readCredentialFile reads the file at path, which must be local to
+// CredentialsDir, and returns its trimmed content.
+func (o *Issuer) readCredentialFile(path string) (string, error) {
+	if !filepath.IsLocal(path) {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("credential file path %q must be relative to the credentials directory", path))
+	}
+
+	data, err := os.ReadFile(filepath.Join(o.CredentialsDir, path))
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonSecretNotFound, fmt.Errorf("failed to read credential file %q: %w", path, err))
+	}
+	return strings.TrimSpace(string(data)), nil
+}
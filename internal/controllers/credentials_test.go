@@ -0,0 +1,254 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestDefaultCredentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "api-token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		keys       CFMTLSIssuerapi.AuthSecretKeys
+		want       map[string]string
+		wantReason string
+	}{
+		{
+			name: "token and zone",
+			env:  map[string]string{APITokenEnvVar: "env-token", ZoneIDEnvVar: "zone"},
+			want: map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "env-token", CFMTLSIssuerapi.DefaultZoneIDSecretKey: "zone"},
+		},
+		{
+			name: "keyed like the auth Secret",
+			env:  map[string]string{APITokenEnvVar: "env-token", ZoneIDEnvVar: "zone"},
+			keys: CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "zone-id"},
+			want: map[string]string{"token": "env-token", "zone-id": "zone"},
+		},
+		{
+			name: "token file takes precedence",
+			env:  map[string]string{APITokenEnvVar: "env-token", APITokenFileEnvVar: tokenFile},
+			want: map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "file-token"},
+		},
+		{
+			name:       "missing token file",
+			env:        map[string]string{APITokenEnvVar: "env-token", APITokenFileEnvVar: filepath.Join(t.TempDir(), "missing")},
+			wantReason: CFMTLSIssuerapi.ReasonSecretNotFound,
+		},
+		{
+			name:       "no token",
+			env:        map[string]string{ZoneIDEnvVar: "zone"},
+			wantReason: CFMTLSIssuerapi.ReasonSecretNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{APITokenEnvVar, APITokenFileEnvVar, ZoneIDEnvVar} {
+				t.Setenv(name, tt.env[name])
+			}
+			o := &Issuer{}
+
+			// A cluster issuer without authSecretName uses the environment.
+			data, err := o.getSecretData(context.Background(), &CFMTLSIssuerapi.IssuerSpec{AuthSecretKeys: tt.keys}, "")
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("getSecretData() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSecretData() error = %v", err)
+			}
+			if len(data) != len(tt.want) {
+				t.Errorf("getSecretData() = %q, want %q", data, tt.want)
+			}
+			for key, value := range tt.want {
+				if got := string(data[key]); got != value {
+					t.Errorf("getSecretData()[%s] = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"api-token": "file-token\n",
+		"zone-id":   " zone \n",
+		"empty":     "\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(t.TempDir(), "api-token")
+	if err := os.WriteFile(outside, []byte("outside-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		credentialsDir string
+		authFile       CFMTLSIssuerapi.AuthFileSource
+		want           map[string]string
+		wantReason     string
+	}{
+		{
+			name:           "token and zone",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: "api-token", ZoneIDPath: "zone-id"},
+			want:           map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "file-token", CFMTLSIssuerapi.DefaultZoneIDSecretKey: "zone"},
+		},
+		{
+			name:           "token only",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: "api-token"},
+			want:           map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "file-token"},
+		},
+		{
+			name:       "no credentials directory",
+			authFile:   CFMTLSIssuerapi.AuthFileSource{APITokenPath: "api-token"},
+			wantReason: CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:           "absolute path",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: outside},
+			wantReason:     CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:           "path outside the credentials directory",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: "../" + filepath.Base(filepath.Dir(outside)) + "/api-token"},
+			wantReason:     CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:           "missing file",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: "missing"},
+			wantReason:     CFMTLSIssuerapi.ReasonSecretNotFound,
+		},
+		{
+			name:           "empty token",
+			credentialsDir: dir,
+			authFile:       CFMTLSIssuerapi.AuthFileSource{APITokenPath: "empty"},
+			wantReason:     CFMTLSIssuerapi.ReasonSecretInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{CredentialsDir: tt.credentialsDir}
+			data, err := o.getSecretData(context.Background(), &CFMTLSIssuerapi.IssuerSpec{AuthFile: &tt.authFile}, "")
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("getSecretData() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSecretData() error = %v", err)
+			}
+			if len(data) != len(tt.want) {
+				t.Errorf("getSecretData() = %q, want %q", data, tt.want)
+			}
+			for key, value := range tt.want {
+				if got := string(data[key]); got != value {
+					t.Errorf("getSecretData()[%s] = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+// staticProvider is a CredentialProvider returning fixed credentials for the
+// issuers with the given auth Secret name.
+type staticProvider struct {
+	authSecretName string
+	data           map[string][]byte
+	err            error
+}
+
+func (p staticProvider) Supports(issuerSpec *CFMTLSIssuerapi.IssuerSpec) bool {
+	return issuerSpec.AuthSecretName == p.authSecretName
+}
+
+func (p staticProvider) Credentials(context.Context, *CFMTLSIssuerapi.IssuerSpec, string) (map[string][]byte, error) {
+	return p.data, p.err
+}
+
+func TestCredentialProviders(t *testing.T) {
+	t.Setenv(APITokenEnvVar, "env-token")
+	t.Setenv(APITokenFileEnvVar, "")
+	t.Setenv(ZoneIDEnvVar, "")
+	providers := []CredentialProvider{
+		staticProvider{authSecretName: "first", data: map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("first-token")}},
+		staticProvider{authSecretName: "first", data: map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("second-token")}},
+		staticProvider{authSecretName: "failing", err: withReason(CFMTLSIssuerapi.ReasonSecretInvalid, errors.New("invalid"))},
+	}
+
+	tests := []struct {
+		name       string
+		issuerSpec CFMTLSIssuerapi.IssuerSpec
+		want       string
+		wantReason string
+	}{
+		{
+			name:       "first registered provider",
+			issuerSpec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "first"},
+			want:       "first-token",
+		},
+		{
+			name:       "registered provider failing",
+			issuerSpec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "failing"},
+			wantReason: CFMTLSIssuerapi.ReasonSecretInvalid,
+		},
+		{
+			name: "built-in provider",
+			want: "env-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{CredentialProviders: providers}
+			data, err := o.getSecretData(context.Background(), &tt.issuerSpec, "team-a")
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("getSecretData() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSecretData() error = %v", err)
+			}
+			if got := string(data[CFMTLSIssuerapi.DefaultAPITokenSecretKey]); got != tt.want {
+				t.Errorf("API token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 
 	certv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -27,7 +26,7 @@ func (c *CustomIssuerController) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	logger.V(2).Info(fmt.Sprintf("ME CertificateRequest Details: %+v", cr))
+	logger.V(2).Info("ME CertificateRequest details", "issuerRef", cr.Spec.IssuerRef, "conditions", cr.Status.Conditions)
 
 	return ctrl.Result{}, nil
 }
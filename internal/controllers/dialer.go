@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// dialFunc dials a connection, like net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// newCloudflareDialer returns the dial function of the transports to the
+// Cloudflare API for restricted networks, e.g. air-gapped DNS or split
+// horizon setups. The hosts in hostOverrides are dialed at the given IP
+// addresses, others are resolved with the DNS server at dnsServer, or with
+// the resolver of the host if empty. It returns nil if neither is set.
+func newCloudflareDialer(dnsServer string, hostOverrides map[string]string) dialFunc {
+	if dnsServer == "" && len(hostOverrides) == 0 {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	if dnsServer != "" {
+		dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{Timeout: dialTimeout}).DialContext(ctx, network, dnsServer)
+			},
+		}
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		// The TLS server name is taken from the URL, so only the address
+		// that is dialed changes.
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if ip, ok := hostOverrides[strings.ToLower(host)]; ok {
+				address = net.JoinHostPort(ip, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// ParseDNSServer validates the address of a DNS server, adding the default
+// port 53 if it has none. An empty address is returned as is.
+func ParseDNSServer(address string) (string, error) {
+	if address == "" {
+		return "", nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		if net.ParseIP(strings.Trim(address, "[]")) == nil {
+			return "", fmt.Errorf("invalid DNS server %q, want <ip>[:<port>]", address)
+		}
+		address = net.JoinHostPort(strings.Trim(address, "[]"), "53")
+	}
+	return address, nil
+}
+
+// ParseHostOverrides parses a comma separated list of static host to IP
+// address mappings, e.g. "api.cloudflare.com=104.19.192.29". An empty
+// list returns nil.
+func ParseHostOverrides(spec string) (map[string]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	overrides := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		host, ip, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid host override %q, want <host>=<ip>", item)
+		}
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP address %q of host %s", ip, host)
+		}
+		overrides[strings.ToLower(host)] = ip
+	}
+	return overrides, nil
+}
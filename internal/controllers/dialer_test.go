@@ -0,0 +1,99 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseHostOverrides(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{spec: ""},
+		{
+			spec: "API.cloudflare.com=104.19.192.29, proxy.internal=2001:db8::1",
+			want: map[string]string{"api.cloudflare.com": "104.19.192.29", "proxy.internal": "2001:db8::1"},
+		},
+		{spec: "api.cloudflare.com", wantErr: true},
+		{spec: "=104.19.192.29", wantErr: true},
+		{spec: "api.cloudflare.com=api.internal", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseHostOverrides(tt.spec)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ParseHostOverrides() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHostOverrides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: ""},
+		{address: "10.0.0.53", want: "10.0.0.53:53"},
+		{address: "10.0.0.53:5353", want: "10.0.0.53:5353"},
+		{address: "2001:db8::53", want: "[2001:db8::53]:53"},
+		{address: "[2001:db8::53]:5353", want: "[2001:db8::53]:5353"},
+		{address: "dns.internal", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := ParseDNSServer(tt.address)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ParseDNSServer() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDNSServer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudflareDialerHostOverrides(t *testing.T) {
+	if newCloudflareDialer("", nil) != nil {
+		t.Error("newCloudflareDialer() without options is not nil")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	// The host does not resolve, so the dial only succeeds if overridden.
+	dial := newCloudflareDialer("", map[string]string{"api.cloudflare.invalid": "127.0.0.1"})
+	conn, err := dial(context.Background(), "tcp", net.JoinHostPort("API.cloudflare.invalid", port))
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+	conn.Close()
+}
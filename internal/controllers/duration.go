@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	experimentalapi "github.com/cert-manager/cert-manager/pkg/apis/experimental/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// hasRequestedDuration reports whether the request explicitly asks for a
+// duration. issuer-lib substitutes the cert-manager default otherwise.
+func hasRequestedDuration(cr signer.CertificateRequestObject) bool {
+	switch r := cr.(type) {
+	case interface {
+		DeepCopy() *cmapi.CertificateRequest
+	}:
+		return r.DeepCopy().Spec.Duration != nil
+	case interface {
+		DeepCopy() *certificatesv1.CertificateSigningRequest
+	}:
+		if r.DeepCopy().Spec.ExpirationSeconds != nil {
+			return true
+		}
+		_, ok := cr.GetAnnotations()[experimentalapi.CertificateSigningRequestDurationAnnotationKey]
+		return ok
+	default:
+		return true
+	}
+}
+
+// validityDays returns the validity, in days, requested from Cloudflare.
+// durationInDays is the duration returned by the request, which is replaced
+// by the issuer's DefaultValidityDays if the request did not ask for one.
+func validityDays(issuerSpec *CFMTLSIssuerapi.IssuerSpec, cr signer.CertificateRequestObject, durationInDays int64) int64 {
+	if issuerSpec.DefaultValidityDays > 0 && !hasRequestedDuration(cr) {
+		return int64(issuerSpec.DefaultValidityDays)
+	}
+	return durationInDays
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+)
+
+const (
+	// eventAggregationWindow is the period in which identical Warning
+	// events are aggregated.
+	eventAggregationWindow = 5 * time.Minute
+	// eventAggregationBurst is the number of identical Warning events that
+	// are recorded per window before the rest are suppressed.
+	eventAggregationBurst = 5
+)
+
+// eventKey identifies identical events, regardless of their object.
+type eventKey struct {
+	reason  string
+	message string
+}
+
+// correlationIDs matches the IDs that errors are annotated with for
+// correlation, see withCFRay, which differ between otherwise identical
+// events.
+var correlationIDs = regexp.MustCompile(` \((cf-ray|request UID) [^)]*\)`)
+
+// newEventKey returns the key of an event with the given reason and message.
+func newEventKey(reason, message string) eventKey {
+	return eventKey{reason: reason, message: correlationIDs.ReplaceAllString(message, "")}
+}
+
+// eventAggregate counts the identical events of a window.
+type eventAggregate struct {
+	start      time.Time
+	count      int
+	suppressed int
+	// last is the object of the last suppressed event, which the summary
+	// of the window is recorded on.
+	last runtime.Object
+}
+
+// aggregatingRecorder collapses storms of identical Warning events, e.g.
+// when all requests of an issuer fail after its token was revoked. client-go
+// only aggregates the events of a single object, so one event per request
+// would still be written. Per window, the first eventAggregationBurst events
+// are recorded, and the rest are summarized in a single event with their
+// count once the window ends.
+type aggregatingRecorder struct {
+	record.EventRecorder
+
+	mu         sync.Mutex
+	aggregates map[eventKey]*eventAggregate
+}
+
+func newAggregatingRecorder(recorder record.EventRecorder) *aggregatingRecorder {
+	return &aggregatingRecorder{
+		EventRecorder: recorder,
+		aggregates:    map[eventKey]*eventAggregate{},
+	}
+}
+
+// Event implements record.EventRecorder.
+func (r *aggregatingRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	message = redact.String(message)
+	if r.admit(object, eventtype, reason, message, time.Now()) {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+// Eventf implements record.EventRecorder.
+func (r *aggregatingRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf implements record.EventRecorder.
+func (r *aggregatingRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	message := redact.String(fmt.Sprintf(messageFmt, args...))
+	if r.admit(object, eventtype, reason, message, time.Now()) {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, "%s", message)
+	}
+}
+
+// admit reports whether the event, recorded at now, is to be written.
+func (r *aggregatingRecorder) admit(object runtime.Object, eventtype, reason, message string, now time.Time) bool {
+	if eventtype != corev1.EventTypeWarning {
+		return true
+	}
+
+	r.mu.Lock()
+	key := newEventKey(reason, message)
+	aggregate, ok := r.aggregates[key]
+	var expired *eventAggregate
+	if ok && now.Sub(aggregate.start) >= eventAggregationWindow {
+		expired, ok = aggregate, false
+	}
+	if !ok {
+		aggregate = &eventAggregate{start: now}
+		r.aggregates[key] = aggregate
+	}
+	aggregate.count++
+	admitted := aggregate.count <= eventAggregationBurst
+	if !admitted {
+		aggregate.suppressed++
+		aggregate.last = object
+	}
+	r.mu.Unlock()
+
+	if expired != nil {
+		r.recordSummary(key, expired)
+	}
+	return admitted
+}
+
+// flush records the summaries of the windows that ended before now.
+func (r *aggregatingRecorder) flush(now time.Time) {
+	r.mu.Lock()
+	expired := map[eventKey]*eventAggregate{}
+	for key, aggregate := range r.aggregates {
+		if now.Sub(aggregate.start) >= eventAggregationWindow {
+			expired[key] = aggregate
+			delete(r.aggregates, key)
+		}
+	}
+	r.mu.Unlock()
+
+	for key, aggregate := range expired {
+		r.recordSummary(key, aggregate)
+	}
+}
+
+// recordSummary records the number of events suppressed in the window of
+// the given aggregate, if any.
+func (r *aggregatingRecorder) recordSummary(key eventKey, aggregate *eventAggregate) {
+	if aggregate.suppressed == 0 {
+		return
+	}
+	r.EventRecorder.Eventf(aggregate.last, corev1.EventTypeWarning, key.reason,
+		"%s (%d similar events were suppressed in the last %s)",
+		key.message, aggregate.suppressed, eventAggregationWindow)
+}
+
+// Start implements manager.Runnable. It records the summaries of the
+// windows in which no further event was recorded.
+func (r *aggregatingRecorder) Start(ctx context.Context) error {
+	ticker := time.NewTicker(eventAggregationWindow / 5)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.flush(time.Now().Add(eventAggregationWindow))
+			return nil
+		case now := <-ticker.C:
+			r.flush(now)
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Events are
+// recorded by every replica that signs.
+func (r *aggregatingRecorder) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestAggregatingRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	r := newAggregatingRecorder(fake)
+	now := time.Now()
+
+	// A storm of identical failures of many requests, and a different one.
+	for i := 0; i < 50; i++ {
+		cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("cr-%d", i)}}
+		if r.admit(cr, corev1.EventTypeWarning, "TokenInvalid", "token revoked", now) {
+			r.EventRecorder.Event(cr, corev1.EventTypeWarning, "TokenInvalid", "token revoked")
+		}
+		if i == 0 && r.admit(cr, corev1.EventTypeWarning, "ZoneNotFound", "zone deleted", now) {
+			r.EventRecorder.Event(cr, corev1.EventTypeWarning, "ZoneNotFound", "zone deleted")
+		}
+	}
+	// Normal events are never suppressed.
+	for i := 0; i < 10; i++ {
+		if !r.admit(&cmapi.CertificateRequest{}, corev1.EventTypeNormal, "Issued", "issued", now) {
+			t.Fatal("Normal event was suppressed")
+		}
+	}
+
+	if got, want := len(fake.Events), eventAggregationBurst+1; got != want {
+		t.Fatalf("recorded %d events during the window, want %d", got, want)
+	}
+	for len(fake.Events) > 0 {
+		<-fake.Events
+	}
+
+	r.flush(now.Add(eventAggregationWindow - time.Second))
+	if len(fake.Events) != 0 {
+		t.Fatalf("recorded a summary before the window ended: %q", <-fake.Events)
+	}
+
+	r.flush(now.Add(eventAggregationWindow))
+	if got := len(fake.Events); got != 1 {
+		t.Fatalf("recorded %d summaries, want 1", got)
+	}
+	summary := <-fake.Events
+	want := fmt.Sprintf("Warning TokenInvalid token revoked (%d similar events were suppressed", 50-eventAggregationBurst)
+	if !strings.HasPrefix(summary, want) {
+		t.Errorf("summary = %q, want prefix %q", summary, want)
+	}
+
+	// A new window starts after the summary.
+	if !r.admit(&cmapi.CertificateRequest{}, corev1.EventTypeWarning, "TokenInvalid", "token revoked", now.Add(eventAggregationWindow)) {
+		t.Error("first event of a new window was suppressed")
+	}
+}
+
+func TestNewEventKeyIgnoresCorrelationIDs(t *testing.T) {
+	resp := &http.Response{Header: http.Header{cfRayHeader: []string{"8f1a2b3c4d5e6f70-AMS"}}}
+	err := withCFRay(errors.New("Cloudflare API responded with status: 403"), resp)
+	message := fmt.Errorf("%w (request UID 0b6e1c9a-3f5e-4d2a-9c1b-7a8e6f5d4c3b)", err).Error()
+
+	if !strings.Contains(message, "cf-ray 8f1a2b3c4d5e6f70-AMS") {
+		t.Errorf("message %q does not contain the cf-ray ID", message)
+	}
+	if got, want := newEventKey("TokenInvalid", message).message, "Cloudflare API responded with status: 403"; got != want {
+		t.Errorf("newEventKey().message = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Reasons of the events recorded by the controllers.
+const (
+	// EventReasonCloudflareIssued is recorded on a request when Cloudflare
+	// issued its certificate.
+	EventReasonCloudflareIssued = "CloudflareIssued"
+	// EventReasonRateLimited is recorded on an issuer when Cloudflare
+	// rejected one of its requests with 429 Too Many Requests.
+	EventReasonRateLimited = "RateLimited"
+	// EventReasonQuotaExhausted is recorded on an issuer when its API token
+	// has used up the rate limit budget of the current window.
+	EventReasonQuotaExhausted = "QuotaExhausted"
+	// EventReasonIssuanceDeferred is recorded on a request, and on its
+	// issuer, when its issuance is deferred to stay within the weekly
+	// issuance budget of the zone.
+	EventReasonIssuanceDeferred = "IssuanceDeferred"
+	// EventReasonOutsideMaintenanceWindow is recorded on a request whose
+	// issuance is deferred until the next maintenance window of its issuer.
+	EventReasonOutsideMaintenanceWindow = "OutsideMaintenanceWindow"
+	// EventReasonPanic is recorded on a request or an issuer when signing
+	// or checking it panicked.
+	EventReasonPanic = "Panic"
+	// EventReasonCertificateRevoked is recorded on a
+	// CloudflareOriginCertificate when its certificate was revoked because
+	// it was deleted or superseded by a renewal.
+	EventReasonCertificateRevoked = "CertificateRevoked"
+	// EventReasonRevocationSkipped is recorded on a deleted
+	// CloudflareOriginCertificate whose certificate could not be revoked
+	// because its issuer no longer exists.
+	EventReasonRevocationSkipped = "RevocationSkipped"
+	// EventReasonOrphanedCertificates is recorded on an issuer when the
+	// orphan garbage collector found certificates in its zones that are no
+	// longer tracked, with the certificates it revoked or, in dry-run mode,
+	// would revoke.
+	EventReasonOrphanedCertificates = "OrphanedCertificates"
+	// EventReasonApprovalPending is recorded on a request that is not
+	// signed until it is approved, as the controller requires approval.
+	EventReasonApprovalPending = "ApprovalPending"
+	// EventReasonHostnameConflict is recorded on a request that is not
+	// signed, as a certificate for one of its DNS names was issued by the
+	// same issuer to another namespace.
+	EventReasonHostnameConflict = "HostnameConflict"
+)
+
+// recordIssuedEvent records an event with the Cloudflare certificate ID and
+// the expiry of the certificate issued for the given request, so that they
+// can be looked up without access to the Cloudflare dashboard.
+func (o *Issuer) recordIssuedEvent(cr signer.CertificateRequestObject, certID string, certPEM []byte) {
+	if o.recorder == nil {
+		return
+	}
+	object := requestObject(cr)
+	if object == nil {
+		return
+	}
+	cert, err := pki.DecodeX509CertificateBytes(certPEM)
+	if err != nil {
+		return
+	}
+
+	const message = "Cloudflare issued certificate %s with serial number %x, valid until %s"
+	notAfter := cert.NotAfter.UTC().Format(time.RFC3339)
+	o.recorder.Eventf(object, corev1.EventTypeNormal, EventReasonCloudflareIssued, message, certID, cert.SerialNumber, notAfter)
+
+	if !o.CertificateEvents {
+		return
+	}
+	if owner := metav1.GetControllerOf(cr); owner != nil && owner.Kind == cmapi.CertificateKind {
+		certificate := &cmapi.Certificate{ObjectMeta: metav1.ObjectMeta{Namespace: cr.GetNamespace(), Name: owner.Name, UID: owner.UID}}
+		o.recorder.Eventf(certificate, corev1.EventTypeNormal, EventReasonCloudflareIssued, message, certID, cert.SerialNumber, notAfter)
+	}
+}
+
+// requestObject returns the CertificateRequest or CertificateSigningRequest
+// wrapped by issuer-lib, which the event recorder can resolve the kind of.
+func requestObject(cr signer.CertificateRequestObject) runtime.Object {
+	switch r := cr.(type) {
+	case interface {
+		DeepCopy() *cmapi.CertificateRequest
+	}:
+		return r.DeepCopy()
+	case interface {
+		DeepCopy() *certificatesv1.CertificateSigningRequest
+	}:
+		return r.DeepCopy()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+)
+
+func TestRecordIssuedEvent(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	template := &x509.Certificate{SerialNumber: big.NewInt(0x1f), NotBefore: notAfter.AddDate(-1, 0, 0), NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "web-1",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: cmapi.SchemeGroupVersion.String(),
+			Kind:       cmapi.CertificateKind,
+			Name:       "web",
+			Controller: ptr.To(true),
+		}},
+	}}
+
+	for _, certificateEvents := range []bool{false, true} {
+		recorder := record.NewFakeRecorder(2)
+		o := &Issuer{recorder: recorder, CertificateEvents: certificateEvents}
+		o.recordIssuedEvent(signer.CertificateRequestObjectFromCertificateRequest(cr), "cert-id", certPEM)
+		close(recorder.Events)
+
+		var events []string
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		want := 1
+		if certificateEvents {
+			want = 2
+		}
+		if len(events) != want {
+			t.Fatalf("CertificateEvents=%v: recorded %d events, want %d: %q", certificateEvents, len(events), want, events)
+		}
+		for _, event := range events {
+			for _, s := range []string{"Normal", EventReasonCloudflareIssued, "cert-id", "1f", "2030-01-01T00:00:00Z"} {
+				if !strings.Contains(event, s) {
+					t.Errorf("event %q does not contain %q", event, s)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// faultBody is the body of the responses of injected faults, in the format
+// of the errors of the Cloudflare API.
+const faultBody = `{"success":false,"errors":[{"code":0,"message":"injected fault"}],"messages":[],"result":null}`
+
+// errInjectedReset is the error of the requests failed by fault injection.
+var errInjectedReset = errors.New("injected fault: connection reset")
+
+// FaultInjection describes the faults injected into the requests to the
+// Cloudflare API, to exercise the retries, backoff and circuit breaking of
+// the controller without an outage. It is meant for development and CI
+// only. The rates are the fractions of the requests, between 0 and 1, that
+// fail in the given way.
+type FaultInjection struct {
+	// ErrorRate is the rate of 503 Service Unavailable responses.
+	ErrorRate float64
+	// ThrottleRate is the rate of 429 Too Many Requests responses, with a
+	// Retry-After of a second.
+	ThrottleRate float64
+	// ResetRate is the rate of requests failing without a response.
+	ResetRate float64
+	// Latency is added to every request.
+	Latency time.Duration
+}
+
+// ParseFaultInjection parses a comma separated list of faults, e.g.
+// "error=0.1,throttle=0.05,reset=0.01,latency=500ms". An empty spec
+// injects no faults and returns nil.
+func ParseFaultInjection(spec string) (*FaultInjection, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	faults := &FaultInjection{}
+	for _, item := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault %q, want <fault>=<value>", item)
+		}
+		var rate *float64
+		switch key {
+		case "error":
+			rate = &faults.ErrorRate
+		case "throttle":
+			rate = &faults.ThrottleRate
+		case "reset":
+			rate = &faults.ResetRate
+		case "latency":
+			latency, err := time.ParseDuration(value)
+			if err != nil || latency < 0 {
+				return nil, fmt.Errorf("invalid latency %q", value)
+			}
+			faults.Latency = latency
+			continue
+		default:
+			return nil, fmt.Errorf("unknown fault %q, want one of error, throttle, reset or latency", key)
+		}
+		r, err := strconv.ParseFloat(value, 64)
+		if err != nil || r < 0 || r > 1 {
+			return nil, fmt.Errorf("invalid %s rate %q, want a number between 0 and 1", key, value)
+		}
+		*rate = r
+	}
+	if faults.ErrorRate+faults.ThrottleRate+faults.ResetRate > 1 {
+		return nil, errors.New("the fault rates add up to more than 1")
+	}
+	return faults, nil
+}
+
+// faultTransport injects faults into the requests sent by base. It is the
+// innermost transport, so that the injected faults go through the same
+// retries, metrics and circuit breaking as real ones.
+type faultTransport struct {
+	faults *FaultInjection
+	base   http.RoundTripper
+	// rand returns a number in [0, 1). nil uses math/rand.
+	rand func() float64
+}
+
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.faults.Latency > 0 {
+		timer := time.NewTimer(t.faults.Latency)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	random := t.rand
+	if random == nil {
+		random = rand.Float64
+	}
+	r := random()
+	switch {
+	case r < t.faults.ErrorRate:
+		closeBody(req)
+		return faultResponse(req, http.StatusServiceUnavailable), nil
+	case r < t.faults.ErrorRate+t.faults.ThrottleRate:
+		closeBody(req)
+		resp := faultResponse(req, http.StatusTooManyRequests)
+		resp.Header.Set(retryAfterHeader, "1")
+		return resp, nil
+	case r < t.faults.ErrorRate+t.faults.ThrottleRate+t.faults.ResetRate:
+		closeBody(req)
+		return nil, errInjectedReset
+	}
+	return t.base.RoundTrip(req)
+}
+
+// faultResponse returns a response to req with the given status code.
+func faultResponse(req *http.Request, code int) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(faultBody)),
+		ContentLength: int64(len(faultBody)),
+		Request:       req,
+	}
+}
+
+// closeBody closes the body of a request that is not sent, as RoundTrip
+// must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
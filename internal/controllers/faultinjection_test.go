@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFaultInjection(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *FaultInjection
+		wantErr bool
+	}{
+		{spec: ""},
+		{
+			spec: "error=0.1, throttle=0.05,reset=0.01,latency=500ms",
+			want: &FaultInjection{ErrorRate: 0.1, ThrottleRate: 0.05, ResetRate: 0.01, Latency: 500 * time.Millisecond},
+		},
+		{spec: "error=1", want: &FaultInjection{ErrorRate: 1}},
+		{spec: "error", wantErr: true},
+		{spec: "error=1.5", wantErr: true},
+		{spec: "error=0.6,throttle=0.6", wantErr: true},
+		{spec: "latency=-1s", wantErr: true},
+		{spec: "timeout=0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseFaultInjection(tt.spec)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ParseFaultInjection() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFaultInjection() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFaultTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	faults := &FaultInjection{ErrorRate: 0.2, ThrottleRate: 0.2, ResetRate: 0.2}
+	tests := []struct {
+		name       string
+		rand       float64
+		wantStatus int
+		wantErr    error
+	}{
+		{name: "error", rand: 0.1, wantStatus: http.StatusServiceUnavailable},
+		{name: "throttle", rand: 0.3, wantStatus: http.StatusTooManyRequests},
+		{name: "reset", rand: 0.5, wantErr: errInjectedReset},
+		{name: "no fault", rand: 0.7, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &faultTransport{faults: faults, base: http.DefaultTransport, rand: func() float64 { return tt.rand }}
+			req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+			resp, err := transport.RoundTrip(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RoundTrip() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("RoundTrip() status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && resp.Header.Get(retryAfterHeader) == "" {
+				t.Error("throttled response has no Retry-After header")
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+)
+
+// checkHostnameConflicts holds requests for DNS names that the issuer
+// already issued a certificate for, that has not expired, to another
+// namespace, so that teams sharing a cluster issuer cannot silently obtain
+// certificates for the hostnames of each other. The request is kept pending
+// with an event naming the conflicting certificate, and is signed once that
+// certificate expires or is no longer tracked. Wildcards conflict with the
+// hostnames they match, in either direction.
+func (o *Issuer) checkHostnameConflicts(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer, dnsNames []string) error {
+	if !o.featureEnabled(features.HostnameConflicts) || len(dnsNames) == 0 {
+		return nil
+	}
+
+	var tracked CFMTLSIssuerapi.CloudflareOriginCertificateList
+	if err := o.client.List(ctx, &tracked); err != nil {
+		return fmt.Errorf("failed to list the issued certificates: %w", err)
+	}
+	namespace, _ := o.trackingObjectKey(requestReference(cr))
+	conflict := hostnameConflict(tracked.Items, issuerReference(issuerObject), namespace, dnsNames, time.Now())
+	if conflict == nil {
+		return nil
+	}
+
+	message := fmt.Sprintf("%s is already issued to namespace %s, in certificate %s", conflict.hostname, conflict.cert.Namespace, conflict.cert.Spec.CertificateID)
+	if o.recorder != nil {
+		if object := requestObject(cr); object != nil {
+			o.recorder.Event(object, corev1.EventTypeWarning, EventReasonHostnameConflict, "Not signing the request: "+message)
+		}
+	}
+	return signer.PendingError{Err: withReason(CFMTLSIssuerapi.ReasonHostnameConflict, fmt.Errorf("hostname conflict: %s", message))}
+}
+
+// trackedHostname is a hostname of a tracked certificate.
+type trackedHostname struct {
+	hostname string
+	cert     *CFMTLSIssuerapi.CloudflareOriginCertificate
+}
+
+// hostnameConflict returns the first of the given tracked certificates that
+// was issued by ref to a namespace other than namespace, has not expired at
+// now, and has a hostname overlapping one of dnsNames, or nil if there is
+// none. Certificates being deleted are ignored.
+func hostnameConflict(tracked []CFMTLSIssuerapi.CloudflareOriginCertificate, ref CFMTLSIssuerapi.IssuerReference, namespace string, dnsNames []string, now time.Time) *trackedHostname {
+	issuerKey := issuerReferenceKey(ref, namespace)
+
+	for i := range tracked {
+		cert := &tracked[i]
+		if cert.Namespace == namespace || !cert.DeletionTimestamp.IsZero() ||
+			issuerReferenceKey(cert.Spec.IssuerRef, cert.Namespace) != issuerKey ||
+			(cert.Spec.NotAfter != nil && !cert.Spec.NotAfter.After(now)) {
+			continue
+		}
+		for _, hostname := range cert.Spec.Hostnames {
+			for _, name := range dnsNames {
+				if hostnamesOverlap(hostname, name) {
+					return &trackedHostname{hostname: hostname, cert: cert}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hostnamesOverlap reports whether a and b are the same hostname, compared
+// case-insensitively, or one is a wildcard matching the other.
+func hostnamesOverlap(a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	return (strings.HasPrefix(a, "*.") && matchesDomain(b, a)) ||
+		(strings.HasPrefix(b, "*.") && matchesDomain(a, b))
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+)
+
+func TestHostnameConflict(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clusterIssuer := CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSClusterIssuer", Name: "cloudflare"}
+	tracked := func(namespace, certificateID string, issuerRef CFMTLSIssuerapi.IssuerReference, notAfter time.Time, hostnames ...string) CFMTLSIssuerapi.CloudflareOriginCertificate {
+		expiry := metav1.NewTime(notAfter)
+		return CFMTLSIssuerapi.CloudflareOriginCertificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: certificateID},
+			Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+				CertificateID: certificateID,
+				Hostnames:     hostnames,
+				NotAfter:      &expiry,
+				IssuerRef:     issuerRef,
+			},
+		}
+	}
+	valid := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name     string
+		tracked  []CFMTLSIssuerapi.CloudflareOriginCertificate
+		ref      CFMTLSIssuerapi.IssuerReference
+		dnsNames []string
+		want     string
+	}{
+		{
+			name:     "no certificates",
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "other namespace",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "example.com", "www.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"api.example.com", "www.example.com"},
+			want:     "cert-1/www.example.com",
+		},
+		{
+			name:     "case-insensitive",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "WWW.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.Example.com"},
+			want:     "cert-1/WWW.example.com",
+		},
+		{
+			name:     "requested wildcard covers tracked hostname",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "www.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"*.example.com"},
+			want:     "cert-1/www.example.com",
+		},
+		{
+			name:     "tracked wildcard covers requested hostname",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "*.Example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+			want:     "cert-1/*.Example.com",
+		},
+		{
+			name:     "wildcard does not cover the apex",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "*.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"example.com"},
+		},
+		{
+			name:     "parent domain",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "same namespace",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-a", "cert-1", clusterIssuer, valid, "www.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "disjoint hostnames",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, valid, "api.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "expired",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", clusterIssuer, now, "www.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "other issuer",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSClusterIssuer", Name: "other"}, valid, "www.example.com")},
+			ref:      clusterIssuer,
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:     "namespaced issuers of the same name",
+			tracked:  []CFMTLSIssuerapi.CloudflareOriginCertificate{tracked("team-b", "cert-1", CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"}, valid, "www.example.com")},
+			ref:      CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"},
+			dnsNames: []string{"www.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if conflict := hostnameConflict(tt.tracked, tt.ref, "team-a", tt.dnsNames, now); conflict != nil {
+				got = conflict.cert.Spec.CertificateID + "/" + conflict.hostname
+			}
+			if got != tt.want {
+				t.Errorf("hostnameConflict() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHostnameConflicts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	issuer := &CFMTLSIssuerapi.CFMTLSClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"}}
+	notAfter := metav1.NewTime(time.Now().Add(24 * time.Hour))
+	existing := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-b", Name: "web-1"},
+		Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+			CertificateID: "cert-1",
+			Hostnames:     []string{"www.example.com"},
+			NotAfter:      &notAfter,
+			IssuerRef:     CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSClusterIssuer", Name: "cloudflare"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(existing).Build()
+	cr := signer.CertificateRequestObjectFromCertificateRequest(&cmapi.CertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "web-1"},
+	})
+	ctx := context.Background()
+
+	// Disabled by default.
+	o := &Issuer{client: c}
+	if err := o.checkHostnameConflicts(ctx, cr, issuer, []string{"www.example.com"}); err != nil {
+		t.Fatalf("checkHostnameConflicts() with the feature disabled = %v, want nil", err)
+	}
+
+	gate := features.NewFeatureGate()
+	if err := gate.SetFromMap(map[string]bool{string(features.HostnameConflicts): true}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(1)
+	o = &Issuer{client: c, recorder: recorder, FeatureGate: gate}
+	if err := o.checkHostnameConflicts(ctx, cr, issuer, []string{"api.example.com"}); err != nil {
+		t.Fatalf("checkHostnameConflicts() for other hostnames = %v, want nil", err)
+	}
+
+	err := o.checkHostnameConflicts(ctx, cr, issuer, []string{"www.example.com"})
+	if err == nil {
+		t.Fatal("checkHostnameConflicts() = nil, want error")
+	}
+	if got := errorReason(err); got != CFMTLSIssuerapi.ReasonHostnameConflict {
+		t.Errorf("reason = %q, want %q", got, CFMTLSIssuerapi.ReasonHostnameConflict)
+	}
+	if !errors.As(err, &signer.PendingError{}) {
+		t.Errorf("checkHostnameConflicts() = %v, want a PendingError", err)
+	}
+	event := <-recorder.Events
+	if want := "Warning " + EventReasonHostnameConflict + " "; !strings.HasPrefix(event, want) || !strings.Contains(event, "team-b") {
+		t.Errorf("event = %q, want a %q event naming the namespace", event, want)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+// httpClient returns the HTTP client used for Cloudflare API requests made
+// on behalf of the given issuer. namespace is the namespace of the auth
+// Secret, which is also used for the proxy CA bundle Secret.
+func (o *Issuer) httpClient(ctx context.Context, issuerObject issuerapi.Issuer, issuerSpec *CFMTLSIssuerapi.IssuerSpec, config issuerConfig, secretData map[string][]byte, namespace string) (*http.Client, error) {
+	access, err := accessServiceToken(issuerSpec, secretData)
+	if err != nil {
+		return nil, err
+	}
+
+	var proxyURL *url.URL
+	if config.proxyURL != "" {
+		proxyURL, err = url.Parse(config.proxyURL)
+		if err != nil {
+			return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("invalid proxy URL: %w", err))
+		}
+	}
+	if proxyURL != nil && issuerSpec.Proxy != nil && issuerSpec.Proxy.AuthSecretName != "" {
+		proxyURL.User, err = o.proxyCredentials(ctx, issuerSpec.Proxy.AuthSecretName, namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var caPEM []byte
+	if proxyURL != nil && issuerSpec.Proxy != nil && issuerSpec.Proxy.CABundleSecretRef != nil {
+		caPEM, err = o.caBundlePEM(ctx, issuerSpec.Proxy.CABundleSecretRef, namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The client is cheap, the pooled connections live in the shared
+	// transport. It has no timeout of its own: the retry transport bounds
+	// each attempt by the request timeout of the issuer, and all of them by
+	// the deadline of the signing or check.
+	client := &http.Client{
+		Transport: &limitTransport{base: o.transports.get(proxyURL, caPEM, issuerSpec.PinnedCertSHA256)},
+	}
+
+	if o.FaultInjection != nil {
+		client.Transport = &faultTransport{faults: o.FaultInjection, base: client.Transport}
+	}
+
+	if access != nil {
+		access.base = client.Transport
+		client.Transport = access
+	}
+
+	if o.DebugHTTP || o.DebugHTTPBodies {
+		client.Transport = &debugTransport{bodies: o.DebugHTTPBodies, base: client.Transport}
+	}
+
+	traced := otelhttp.NewTransport(client.Transport, otelhttp.WithSpanNameFormatter(cloudflareSpanName))
+	kind, issuer := issuerMetricLabels(issuerObject)
+	var transport http.RoundTripper = &metricsTransport{
+		issuerKind:   kind,
+		issuer:       issuer,
+		issuerObject: issuerObject,
+		recorder:     o.recorder,
+		base:         traced,
+	}
+	// The limiter is inside the retries, so that they are limited as well.
+	if limiter := o.rateLimiter(issuerSpec, resolveZoneID(issuerSpec, config, secretData)); limiter != nil {
+		transport = &rateLimitTransport{limiter: limiter, base: transport}
+	}
+	client.Transport = &retryTransport{base: transport, attemptTimeout: requestTimeout(issuerSpec)}
+	if breaker := o.breakers.get(transportKey(proxyURL, caPEM, issuerSpec.PinnedCertSHA256)); breaker != nil {
+		client.Transport = &circuitBreakerTransport{breaker: breaker, base: client.Transport}
+	}
+	return client, nil
+}
+
+// cloudflareSpanName names the spans of the Cloudflare API requests after
+// their endpoint.
+func cloudflareSpanName(_ string, req *http.Request) string {
+	return "Cloudflare " + req.Method + " " + cloudflareEndpoint(req.URL.Path)
+}
+
+// metricsTransport records the latency and status code of every request,
+// and the rate limit budget of the issuer, in the Cloudflare API metrics.
+// Throttling is also reported as Warning events on the issuer.
+type metricsTransport struct {
+	issuerKind string
+	issuer     string
+	// issuerObject and recorder record the events. A nil recorder
+	// disables them.
+	issuerObject runtime.Object
+	recorder     record.EventRecorder
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		t.observeRateLimit(req, resp, time.Now())
+	}
+	metrics.RecordCloudflareRequest(req.Method, cloudflareEndpoint(req.URL.Path), code, time.Since(start))
+	return resp, err
+}
+
+// cloudflareEndpoint returns the given path of the Cloudflare API with the
+// IDs replaced by placeholders and the prefix of the base URL removed, e.g.
+// "/zones/{id}/client_certificates" for
+// "/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353/client_certificates".
+func cloudflareEndpoint(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if segment == "zones" || segment == "user" {
+			segments = segments[i:]
+			break
+		}
+	}
+	for i := 1; i < len(segments); i++ {
+		switch segments[i-1] {
+		case "zones", "client_certificates", "tokens":
+			if segments[i] != "verify" {
+				segments[i] = "{id}"
+			}
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Headers carrying the Cloudflare Access service token.
+const (
+	accessClientIDHeader     = "CF-Access-Client-Id"
+	accessClientSecretHeader = "CF-Access-Client-Secret"
+)
+
+// accessTransport adds the headers of a Cloudflare Access service token to
+// every request, for API egress that is gated by Cloudflare Access.
+type accessTransport struct {
+	clientID     string
+	clientSecret string
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+}
+
+func (t *accessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// A RoundTripper must not modify the request it was given.
+	req = req.Clone(req.Context())
+	req.Header.Set(accessClientIDHeader, t.clientID)
+	req.Header.Set(accessClientSecretHeader, t.clientSecret)
+	return base.RoundTrip(req)
+}
+
+// accessServiceToken returns a transport adding the Cloudflare Access service
+// token from the credentials of the given issuer, or nil if the credentials
+// do not hold one.
+func accessServiceToken(issuerSpec *CFMTLSIssuerapi.IssuerSpec, secretData map[string][]byte) (*accessTransport, error) {
+	clientIDKey, clientSecretKey := accessClientIDSecretKey(issuerSpec), accessClientSecretSecretKey(issuerSpec)
+	clientID, clientSecret := string(secretData[clientIDKey]), string(secretData[clientSecretKey])
+	switch {
+	case clientID == "" && clientSecret == "":
+		return nil, nil
+	case clientID == "" || clientSecret == "":
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid,
+			fmt.Errorf("incomplete Cloudflare Access service token in secret, both keys %q and %q must be set", clientIDKey, clientSecretKey))
+	}
+	return &accessTransport{clientID: clientID, clientSecret: clientSecret}, nil
+}
+
+// caBundle returns the system roots extended with the CA certificates from
+// the referenced Secret.
+func (o *Issuer) caBundle(ctx context.Context, ref *CFMTLSIssuerapi.SecretKeySelector, namespace string) (*x509.CertPool, error) {
+	caPEM, err := o.caBundlePEM(ctx, ref, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		rootCAs = x509.NewCertPool()
+	}
+	rootCAs.AppendCertsFromPEM(caPEM)
+	return rootCAs, nil
+}
+
+// caBundlePEM returns the PEM encoded CA certificates from the referenced
+// Secret.
+func (o *Issuer) caBundlePEM(ctx context.Context, ref *CFMTLSIssuerapi.SecretKeySelector, namespace string) ([]byte, error) {
+	key := ref.Key
+	if key == "" {
+		key = CFMTLSIssuerapi.DefaultCABundleSecretKey
+	}
+
+	secretName := types.NamespacedName{Namespace: namespace, Name: ref.Name}
+	var secret corev1.Secret
+	if err := o.client.Get(ctx, secretName, &secret); err != nil {
+		wrapped := fmt.Errorf("failed to get CA bundle Secret %s: %v", secretName, err)
+		if apierrors.IsNotFound(err) {
+			return nil, withReason(CFMTLSIssuerapi.ReasonSecretNotFound, wrapped)
+		}
+		return nil, wrapped
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM(secret.Data[key]) {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("no PEM encoded certificates found in key %q of Secret %s", key, secretName))
+	}
+
+	return secret.Data[key], nil
+}
+
+// proxyCredentials returns the username and password of the given
+// kubernetes.io/basic-auth Secret, which authenticate to the proxy of an
+// issuer.
+func (o *Issuer) proxyCredentials(ctx context.Context, name, namespace string) (*url.Userinfo, error) {
+	secretName := types.NamespacedName{Namespace: namespace, Name: name}
+	var secret corev1.Secret
+	if err := o.client.Get(ctx, secretName, &secret); err != nil {
+		wrapped := fmt.Errorf("failed to get proxy credentials Secret %s: %v", secretName, err)
+		if apierrors.IsNotFound(err) {
+			return nil, withReason(CFMTLSIssuerapi.ReasonSecretNotFound, wrapped)
+		}
+		return nil, wrapped
+	}
+
+	username := string(secret.Data[corev1.BasicAuthUsernameKey])
+	if username == "" {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("missing key %q in proxy credentials Secret %s", corev1.BasicAuthUsernameKey, secretName))
+	}
+	return url.UserPassword(username, string(secret.Data[corev1.BasicAuthPasswordKey])), nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestHTTPClientAccessServiceToken(t *testing.T) {
+	tests := []struct {
+		name             string
+		keys             CFMTLSIssuerapi.AuthSecretKeys
+		secretData       map[string]string
+		wantClientID     string
+		wantClientSecret string
+		wantReason       string
+	}{
+		{
+			name:       "no service token",
+			secretData: map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "token"},
+		},
+		{
+			name: "default keys",
+			secretData: map[string]string{
+				CFMTLSIssuerapi.DefaultAccessClientIDSecretKey:     "client-id",
+				CFMTLSIssuerapi.DefaultAccessClientSecretSecretKey: "client-secret",
+			},
+			wantClientID:     "client-id",
+			wantClientSecret: "client-secret",
+		},
+		{
+			name:             "custom keys",
+			keys:             CFMTLSIssuerapi.AuthSecretKeys{AccessClientID: "id", AccessClientSecret: "secret"},
+			secretData:       map[string]string{"id": "client-id", "secret": "client-secret"},
+			wantClientID:     "client-id",
+			wantClientSecret: "client-secret",
+		},
+		{
+			name:       "client secret missing",
+			secretData: map[string]string{CFMTLSIssuerapi.DefaultAccessClientIDSecretKey: "client-id"},
+			wantReason: CFMTLSIssuerapi.ReasonSecretInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotHeader http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				gotHeader = req.Header.Clone()
+			}))
+			defer server.Close()
+
+			secretData := map[string][]byte{}
+			for key, value := range tt.secretData {
+				secretData[key] = []byte(value)
+			}
+
+			o := &Issuer{}
+			client, err := o.httpClient(context.Background(), &CFMTLSIssuerapi.CFMTLSIssuer{}, &CFMTLSIssuerapi.IssuerSpec{AuthSecretKeys: tt.keys}, issuerConfig{}, secretData, "")
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("httpClient() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("httpClient() error = %v", err)
+			}
+
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if got := gotHeader.Get(accessClientIDHeader); got != tt.wantClientID {
+				t.Errorf("%s = %q, want %q", accessClientIDHeader, got, tt.wantClientID)
+			}
+			if got := gotHeader.Get(accessClientSecretHeader); got != tt.wantClientSecret {
+				t.Errorf("%s = %q, want %q", accessClientSecretHeader, got, tt.wantClientSecret)
+			}
+		})
+	}
+}
+
+func TestCloudflareEndpoint(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353", want: "/zones/{id}"},
+		{path: "/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353/client_certificates", want: "/zones/{id}/client_certificates"},
+		{path: "/client/v4/zones/023e105f4ecef8ad9ca31a8372d0c353/client_certificates/b2a4b6f3-7e3c-4b1e-9f0a-1c2d3e4f5a6b", want: "/zones/{id}/client_certificates/{id}"},
+		{path: "/client/v4/user/tokens/verify", want: "/user/tokens/verify"},
+		{path: "/client/v4/user/tokens/ed17574386854bf78a67040be0a770b0", want: "/user/tokens/{id}"},
+		{path: "/zones/023e105f4ecef8ad9ca31a8372d0c353", want: "/zones/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := cloudflareEndpoint(tt.path); got != tt.want {
+				t.Errorf("cloudflareEndpoint(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransportCache(t *testing.T) {
+	proxyURL, err := url.Parse("http://proxy.example.com:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM := []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n")
+
+	c := newTransportCache(nil)
+	direct := c.get(nil, nil, nil)
+	if c.get(nil, nil, nil) != direct {
+		t.Errorf("get() returned a new transport for the same configuration")
+	}
+	proxied := c.get(proxyURL, nil, nil)
+	if proxied == direct {
+		t.Errorf("get() shared the transport of different proxies")
+	}
+	if c.get(proxyURL, caPEM, nil) == proxied {
+		t.Errorf("get() shared the transport of different CA bundles")
+	}
+	pin := strings.Repeat("ab", 32)
+	pinned := c.get(proxyURL, nil, []string{pin})
+	if pinned == proxied {
+		t.Errorf("get() shared the transport of different pins")
+	}
+	if c.get(proxyURL, nil, []string{strings.ToUpper(pin), pin}) != pinned {
+		t.Errorf("get() returned a new transport for the same pins")
+	}
+	authenticated := *proxyURL
+	authenticated.User = url.UserPassword("user", "secret")
+	if c.get(&authenticated, nil, nil) == proxied {
+		t.Errorf("get() shared the transport of different proxy credentials")
+	}
+	if key := transportKey(&authenticated, nil, nil); strings.Contains(key, "secret") {
+		t.Errorf("transportKey() = %q contains the proxy password", key)
+	}
+	if !direct.ForceAttemptHTTP2 || direct.TLSClientConfig.ClientSessionCache == nil {
+		t.Errorf("get() returned a transport without HTTP/2 or TLS session resumption")
+	}
+
+	var uncached *transportCache
+	if uncached.get(nil, nil, nil) == uncached.get(nil, nil, nil) {
+		t.Errorf("get() of a nil cache shared a transport")
+	}
+}
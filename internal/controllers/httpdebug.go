@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+)
+
+// maxDebugBodySize bounds the size of the bodies logged by debugTransport.
+const maxDebugBodySize = 16 << 10
+
+// debugTransport logs every request to the Cloudflare API and its response,
+// with the credentials redacted, to troubleshoot API incompatibilities. It
+// logs with the logger of the request context, so that the lines carry the
+// request being signed.
+type debugTransport struct {
+	// bodies logs the headers and bodies of the requests and responses as
+	// well.
+	bodies bool
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	logger := log.FromContext(req.Context()).WithName("http")
+	values := []any{"method", req.Method, "url", redact.String(req.URL.String())}
+	if t.bodies {
+		values = append(values, "requestHeaders", redact.Header(req.Header), "requestBody", requestBody(req))
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	values = append(values, "duration", time.Since(start))
+	if err != nil {
+		logger.Info("Cloudflare API request failed", append(values, "error", redact.String(err.Error()))...)
+		return resp, err
+	}
+
+	values = append(values, "status", resp.StatusCode, "cfRay", resp.Header.Get(cfRayHeader))
+	if t.bodies {
+		values = append(values, "responseHeaders", redact.Header(resp.Header), "responseBody", responseBody(resp))
+	}
+	logger.Info("Cloudflare API request", values...)
+	return resp, nil
+}
+
+// requestBody returns the redacted body of req, read from a copy so that
+// the request is sent unchanged.
+func requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody == nil {
+		return "<not replayable>"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "<unreadable>"
+	}
+	defer body.Close()
+	return readDebugBody(body)
+}
+
+// responseBody returns the redacted body of resp. The part that was read is
+// put back in front of the rest of the body.
+func responseBody(resp *http.Response) string {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return ""
+	}
+	var read bytes.Buffer
+	body := readDebugBody(io.TeeReader(resp.Body, &read))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&read, resp.Body), resp.Body}
+	return body
+}
+
+// readDebugBody reads up to maxDebugBodySize bytes from r and redacts them.
+func readDebugBody(r io.Reader) string {
+	data, err := io.ReadAll(io.LimitReader(r, maxDebugBodySize+1))
+	if err != nil {
+		return "<unreadable>"
+	}
+	if len(data) > maxDebugBodySize {
+		return redact.String(string(data[:maxDebugBodySize])) + "...<truncated>"
+	}
+	return redact.String(string(data))
+}
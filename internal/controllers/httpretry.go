@@ -0,0 +1,217 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// httpMaxAttempts is the number of times a request to the Cloudflare
+	// API is sent before a transient failure is returned.
+	httpMaxAttempts = 4
+	// httpInitialBackoff is the upper bound of the delay before the first
+	// retry. It doubles with each retry, up to httpMaxBackoff.
+	httpInitialBackoff = 250 * time.Millisecond
+	// httpMaxBackoff caps the delay between retries, including the delay
+	// asked for by a Retry-After header.
+	httpMaxBackoff = 4 * time.Second
+)
+
+// retryTransport retries the requests to the Cloudflare API that failed
+// transiently, with capped exponential backoff and full jitter, so that a
+// momentary blip does not fail the signing. Each attempt is bounded by
+// attemptTimeout, and all of them by the deadline of the request: a retry
+// whose backoff would not end before the deadline is not made, so the
+// attempts share the budget of the signing or check instead of multiplying
+// its timeouts.
+//
+// Requests that create objects, i.e. POSTs, are only retried when they were
+// certainly not processed, as a retry could otherwise issue a certificate
+// twice: if the connection could not be established, or Cloudflare answered
+// 429 or 503.
+type retryTransport struct {
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+	// attemptTimeout bounds each attempt, within the deadline of the
+	// request. Zero only bounds them by the deadline.
+	attemptTimeout time.Duration
+	// sleep waits for the given delay, or until ctx is done. nil uses a
+	// timer.
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.roundTrip(base, req)
+		if attempt == httpMaxAttempts || !retryable(req, resp, err) {
+			return resp, err
+		}
+		delay := httpBackoff(attempt, resp)
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) <= delay {
+			// The retry could not complete within the budget of the
+			// request.
+			return resp, err
+		}
+		retry, ok := rewind(req)
+		if !ok {
+			return resp, err
+		}
+
+		reason := "error"
+		if err == nil {
+			reason = strconv.Itoa(resp.StatusCode)
+			// Drain the body, so that the connection can be reused.
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDebugBodySize))
+			resp.Body.Close()
+		}
+		log.FromContext(req.Context()).V(1).Info("retrying Cloudflare API request",
+			"method", req.Method, "endpoint", cloudflareEndpoint(req.URL.Path), "attempt", attempt, "reason", reason, "delay", delay)
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+		req = retry
+	}
+}
+
+// roundTrip sends a single attempt of req, bounded by attemptTimeout. The
+// timeout is released once the body of the response is closed.
+func (t *retryTransport) roundTrip(base http.RoundTripper, req *http.Request) (*http.Response, error) {
+	if t.attemptTimeout <= 0 {
+		return base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.attemptTimeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of an attempt with its response body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryable reports whether the outcome of the request is a transient
+// failure that may be retried.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	idempotent := req.Method != http.MethodPost && req.Method != http.MethodPatch
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		if !idempotent {
+			return notSent(err)
+		}
+		var netErr net.Error
+		return notSent(err) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF) || (errors.As(err, &netErr) && netErr.Timeout())
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// notSent reports whether err means that the request did not reach the
+// server.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// rewind returns a copy of req with a fresh body, for sending it again. It
+// returns false if the body cannot be read again.
+func rewind(req *http.Request) (*http.Request, bool) {
+	retry := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return retry, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
+
+// httpBackoff returns the delay before the retry after the given number of
+// attempts: a random delay up to the exponential backoff, or the
+// Retry-After of a throttled response, capped at httpMaxBackoff.
+func httpBackoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.ParseInt(resp.Header.Get(retryAfterHeader), 10, 64); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, httpMaxBackoff)
+		}
+	}
+	ceiling := min(httpInitialBackoff<<(attempt-1), httpMaxBackoff)
+	return rand.N(ceiling) + 1
+}
+
+// sleepContext waits for delay, or until ctx is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int
+		retryAfter   string
+		wantStatus   int
+		wantAttempts int
+		wantDelays   []time.Duration
+	}{
+		{
+			name:         "success",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 1,
+		},
+		{
+			name:         "service unavailable",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "rate limited with Retry-After",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "2",
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantDelays:   []time.Duration{2 * time.Second},
+		},
+		{
+			name:         "Retry-After is capped",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "3600",
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+			wantDelays:   []time.Duration{httpMaxBackoff},
+		},
+		{
+			name:         "server error of an idempotent request",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusBadGateway, http.StatusOK},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "server error of a POST may have issued a certificate",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusBadGateway, http.StatusOK},
+			wantStatus:   http.StatusBadGateway,
+			wantAttempts: 1,
+		},
+		{
+			name:         "client error",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusForbidden, http.StatusOK},
+			wantStatus:   http.StatusForbidden,
+			wantAttempts: 1,
+		},
+		{
+			name:         "attempts exhausted",
+			method:       http.MethodGet,
+			statuses:     []int{503, 503, 503, 503, 200},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: httpMaxAttempts,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				bodies = append(bodies, string(body))
+				if tt.retryAfter != "" {
+					w.Header().Set(retryAfterHeader, tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			var delays []time.Duration
+			client := &http.Client{Transport: &retryTransport{sleep: func(_ context.Context, delay time.Duration) error {
+				delays = append(delays, delay)
+				return nil
+			}}}
+
+			var body io.Reader
+			if tt.method == http.MethodPost {
+				body = bytes.NewBufferString(`{"csr":""}`)
+			}
+			req, err := http.NewRequest(tt.method, server.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("sent %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			for i, body := range bodies {
+				if body != bodies[0] {
+					t.Errorf("attempt %d sent body %q, want %q", i+1, body, bodies[0])
+				}
+			}
+			if len(delays) != attempts-1 {
+				t.Fatalf("waited %d times, want %d", len(delays), attempts-1)
+			}
+			for i, delay := range delays {
+				if tt.wantDelays != nil && delay != tt.wantDelays[i] {
+					t.Errorf("delay %d = %s, want %s", i+1, delay, tt.wantDelays[i])
+				}
+				if delay <= 0 || delay > httpMaxBackoff {
+					t.Errorf("delay %d = %s, want in (0, %s]", i+1, delay, httpMaxBackoff)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	var waits int
+	client := &http.Client{Transport: &retryTransport{sleep: func(context.Context, time.Duration) error {
+		waits++
+		return nil
+	}}}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() succeeded, want an error")
+	}
+	if waits != httpMaxAttempts-1 {
+		t.Errorf("retried %d times, want %d", waits, httpMaxAttempts-1)
+	}
+}
+
+func TestRetryTransportDeadline(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts++
+		w.Header().Set(retryAfterHeader, "2")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// The backoff asked for would end after the deadline of the request.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	client := &http.Client{Transport: &retryTransport{}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if attempts != 1 {
+		t.Errorf("sent %d attempts, want 1", attempts)
+	}
+}
+
+func TestRetryTransportAttemptTimeout(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// The first attempt hangs until it times out.
+			<-req.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &retryTransport{
+		attemptTimeout: 50 * time.Millisecond,
+		sleep:          func(context.Context, time.Duration) error { return nil },
+	}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The body is still readable after the attempt returned.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"success":true}` {
+		t.Errorf("body = %q", body)
+	}
+	if attempts != 2 {
+		t.Errorf("sent %d attempts, want 2", attempts)
+	}
+}
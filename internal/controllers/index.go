@@ -0,0 +1,191 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+const (
+	// certificateIndexPrefix is the name prefix of the certificate index
+	// ConfigMaps, which are suffixed with the zone ID.
+	certificateIndexPrefix = "cfmtls-certificate-index-"
+	// certificateIndexLabelKey marks the certificate index ConfigMaps.
+	certificateIndexLabelKey = "cfmtls.cert.manager.io/certificate-index"
+)
+
+// indexEntry records the owner of a certificate in the certificate index.
+type indexEntry struct {
+	// IssuerRef references the issuer that signed the certificate.
+	IssuerRef CFMTLSIssuerapi.IssuerReference `json:"issuerRef"`
+	// Namespace and Name of the CloudflareOriginCertificate that tracks
+	// the certificate. The namespace is the one of a CFMTLSIssuer as well.
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Request references the request the certificate was issued for.
+	Request CFMTLSIssuerapi.RequestReference `json:"request"`
+	// IssuedAt is when the certificate was tracked.
+	IssuedAt metav1.Time `json:"issuedAt"`
+	// NotAfter is when the certificate expires.
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+}
+
+// certificateIndex maps the IDs of the certificates issued by the controller
+// to their owners, in a ConfigMap per zone in the cluster resource
+// namespace. Unlike the CloudflareOriginCertificates, entries outlive the
+// deletion of their tracking object until the certificate is revoked or
+// expires, so that the orphan garbage collector finds the certificates of a
+// zone by ID instead of listing them and matching their hostnames.
+//
+// Entries are added and removed with JSON merge patches of a single key, so
+// that concurrent writers do not conflict. A nil index records nothing.
+type certificateIndex struct {
+	client    client.Client
+	namespace string
+}
+
+// newCertificateEntry returns the index entry of a tracked certificate.
+func newCertificateEntry(tracked *CFMTLSIssuerapi.CloudflareOriginCertificate) indexEntry {
+	issuedAt := tracked.CreationTimestamp
+	if issuedAt.IsZero() {
+		issuedAt = metav1.Now()
+	}
+	return indexEntry{
+		IssuerRef: tracked.Spec.IssuerRef,
+		Namespace: tracked.Namespace,
+		Name:      tracked.Name,
+		Request:   tracked.Spec.CertificateRequestRef,
+		IssuedAt:  issuedAt,
+		NotAfter:  tracked.Spec.NotAfter,
+	}
+}
+
+// add records the certificate tracked by the given object.
+func (x *certificateIndex) add(ctx context.Context, tracked *CFMTLSIssuerapi.CloudflareOriginCertificate) error {
+	if x == nil {
+		return nil
+	}
+	value, err := json.Marshal(newCertificateEntry(tracked))
+	if err != nil {
+		return err
+	}
+	return x.patch(ctx, tracked.Spec.ZoneID, tracked.Spec.CertificateID, string(value))
+}
+
+// remove forgets the given certificate.
+func (x *certificateIndex) remove(ctx context.Context, zoneID, certificateID string) error {
+	if x == nil {
+		return nil
+	}
+	err := x.patch(ctx, zoneID, certificateID, nil)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// patch sets the entry of the given certificate to value, or removes it if
+// value is nil. The ConfigMap of the zone is created for the first entry.
+func (x *certificateIndex) patch(ctx context.Context, zoneID, certificateID string, value interface{}) error {
+	if errs := validation.IsConfigMapKey(certificateID); len(errs) > 0 {
+		return fmt.Errorf("invalid certificate ID %q: %s", certificateID, strings.Join(errs, ", "))
+	}
+	key, err := x.key(zoneID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"data": map[string]interface{}{certificateID: value}})
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	err = x.client.Patch(ctx, configMap, client.RawPatch(types.MergePatchType, data))
+	if !apierrors.IsNotFound(err) || value == nil {
+		return err
+	}
+
+	configMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Labels:    map[string]string{certificateIndexLabelKey: "true"},
+		},
+		Data: map[string]string{certificateID: value.(string)},
+	}
+	err = x.client.Create(ctx, configMap)
+	if apierrors.IsAlreadyExists(err) {
+		// Created concurrently for another certificate.
+		return x.client.Patch(ctx, configMap, client.RawPatch(types.MergePatchType, data))
+	}
+	return err
+}
+
+// key returns the key of the index ConfigMap of the given zone.
+func (x *certificateIndex) key(zoneID string) (types.NamespacedName, error) {
+	name := certificateIndexPrefix + strings.ToLower(zoneID)
+	if zoneID == "" || len(validation.IsDNS1123Subdomain(name)) > 0 {
+		return types.NamespacedName{}, fmt.Errorf("invalid zone ID %q", zoneID)
+	}
+	return types.NamespacedName{Namespace: x.namespace, Name: name}, nil
+}
+
+// entries returns all indexed certificates by zone ID and certificate ID.
+// Invalid entries are skipped.
+func (x *certificateIndex) entries(ctx context.Context) (map[string]map[string]indexEntry, error) {
+	if x == nil {
+		return nil, nil
+	}
+	var configMaps corev1.ConfigMapList
+	if err := x.client.List(ctx, &configMaps, client.InNamespace(x.namespace), client.MatchingLabels{certificateIndexLabelKey: "true"}); err != nil {
+		return nil, fmt.Errorf("failed to list the certificate index: %w", err)
+	}
+	zones := make(map[string]map[string]indexEntry, len(configMaps.Items))
+	for _, configMap := range configMaps.Items {
+		zoneID, ok := strings.CutPrefix(configMap.Name, certificateIndexPrefix)
+		if !ok {
+			continue
+		}
+		entries := make(map[string]indexEntry, len(configMap.Data))
+		for certificateID, value := range configMap.Data {
+			var entry indexEntry
+			if json.Unmarshal([]byte(value), &entry) == nil {
+				entries[certificateID] = entry
+			}
+		}
+		zones[zoneID] = entries
+	}
+	return zones, nil
+}
+
+// expired reports whether the certificate of the entry expired before t.
+func (e indexEntry) expired(t time.Time) bool {
+	return e.NotAfter != nil && e.NotAfter.Time.Before(t)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestCertificateIndex(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	index := &certificateIndex{client: c, namespace: "cfmtls-system"}
+	ctx := context.Background()
+
+	notAfter := metav1.NewTime(time.Now().Add(time.Hour).Truncate(time.Second))
+	for _, certificateID := range []string{"cert-1", "cert-2"} {
+		tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: certificateID},
+			Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+				CertificateID: certificateID,
+				ZoneID:        "zone-id",
+				NotAfter:      &notAfter,
+				IssuerRef:     CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"},
+			},
+		}
+		if err := index.add(ctx, tracked); err != nil {
+			t.Fatalf("add(%s) error = %v", certificateID, err)
+		}
+	}
+	if err := index.remove(ctx, "zone-id", "cert-1"); err != nil {
+		t.Fatalf("remove() error = %v", err)
+	}
+	// Removing from a zone without index is a no-op.
+	if err := index.remove(ctx, "other-zone", "cert-1"); err != nil {
+		t.Fatalf("remove() of another zone error = %v", err)
+	}
+
+	configMap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "cfmtls-system", Name: "cfmtls-certificate-index-zone-id"}, configMap); err != nil {
+		t.Fatalf("index ConfigMap not created: %v", err)
+	}
+	if configMap.Labels[certificateIndexLabelKey] != "true" {
+		t.Errorf("index ConfigMap labels = %v, want %s", configMap.Labels, certificateIndexLabelKey)
+	}
+
+	zones, err := index.entries(ctx)
+	if err != nil {
+		t.Fatalf("entries() error = %v", err)
+	}
+	if len(zones["zone-id"]) != 1 {
+		t.Fatalf("entries() = %v, want only cert-2", zones)
+	}
+	entry := zones["zone-id"]["cert-2"]
+	if entry.Namespace != "team-a" || entry.Name != "cert-2" || entry.IssuerRef.Name != "cloudflare" {
+		t.Errorf("entry = %+v, want the owner of cert-2", entry)
+	}
+	if entry.expired(time.Now()) || !entry.expired(time.Now().Add(2*time.Hour)) {
+		t.Errorf("entry expiry = %v, want %v", entry.NotAfter, notAfter)
+	}
+
+	if err := index.add(ctx, &CFMTLSIssuerapi.CloudflareOriginCertificate{
+		Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{CertificateID: "cert/3", ZoneID: "zone-id"},
+	}); err == nil {
+		t.Error("add() of an invalid certificate ID succeeded")
+	}
+
+	var nilIndex *certificateIndex
+	if err := nilIndex.remove(ctx, "zone-id", "cert-2"); err != nil {
+		t.Errorf("remove() of a nil index error = %v", err)
+	}
+}
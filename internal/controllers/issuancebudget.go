@@ -0,0 +1,157 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+const (
+	// issuanceBudgetWindow is the sliding window of the issuance budget,
+	// matching the weekly Origin CA issuance limits of Cloudflare.
+	issuanceBudgetWindow = 7 * 24 * time.Hour
+	// issuanceBudgetReserve is the share of the issuance budget of a zone
+	// that is reserved for urgent requests. Others are deferred once the
+	// rest is used up.
+	issuanceBudgetReserve = 0.2
+	// urgentIssuanceWindow is how close to the expiry of its certificate
+	// the renewal of a Certificate becomes urgent.
+	urgentIssuanceWindow = 7 * 24 * time.Hour
+)
+
+// issuanceBudgets tracks the certificates issued per zone over the
+// issuanceBudgetWindow. It only knows about the certificates issued by this
+// replica since it was started. A nil budget does not limit issuance.
+type issuanceBudgets struct {
+	budget int
+	now    func() time.Time
+
+	mu sync.Mutex
+	// issued holds the issuance times of each zone, oldest first.
+	issued map[string][]time.Time
+}
+
+func newIssuanceBudgets(budget int) *issuanceBudgets {
+	if budget <= 0 {
+		return nil
+	}
+	return &issuanceBudgets{budget: budget, now: time.Now, issued: map[string][]time.Time{}}
+}
+
+// allow reports whether a certificate may be issued for the zone. Urgent
+// requests may use up the whole budget, others only the part that is not
+// reserved. If not, it returns when enough issuances leave the window for
+// the request to be allowed, along with the number of certificates issued
+// in the window.
+func (b *issuanceBudgets) allow(zoneID string, urgent bool) (used int, next time.Time, ok bool) {
+	if b == nil {
+		return 0, time.Time{}, true
+	}
+	limit := b.budget
+	if !urgent {
+		limit -= int(float64(b.budget) * issuanceBudgetReserve)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	issued := b.prune(zoneID)
+	if len(issued) < limit {
+		return len(issued), time.Time{}, true
+	}
+	return len(issued), issued[len(issued)-limit].Add(issuanceBudgetWindow), false
+}
+
+// record counts a certificate issued for the zone.
+func (b *issuanceBudgets) record(zoneID string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.issued[zoneID] = append(b.prune(zoneID), b.now())
+}
+
+// prune drops the issuances of the zone that left the window and returns
+// the others. The caller must hold mu.
+func (b *issuanceBudgets) prune(zoneID string) []time.Time {
+	issued := b.issued[zoneID]
+	start := b.now().Add(-issuanceBudgetWindow)
+	i := 0
+	for i < len(issued) && !issued[i].After(start) {
+		i++
+	}
+	if i == len(issued) {
+		delete(b.issued, zoneID)
+		return nil
+	}
+	issued = issued[i:]
+	b.issued[zoneID] = issued
+	return issued
+}
+
+// checkIssuanceBudget defers the request while the issuance budget of the
+// zone does not allow it, and records why on the request and the issuer.
+// Deferred requests are kept pending, and retried as they become urgent or
+// as the budget frees up.
+func (o *Issuer) checkIssuanceBudget(cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer, zoneID string) error {
+	if o.budgets == nil {
+		return nil
+	}
+	urgent := o.urgentRequest(cr)
+	used, next, ok := o.budgets.allow(zoneID, urgent)
+	if ok {
+		return nil
+	}
+
+	until := next.UTC().Format(time.RFC3339)
+	err := withReason(CFMTLSIssuerapi.ReasonIssuanceDeferred, fmt.Errorf(
+		"%d of the %d certificates that may be issued per week for zone %s were issued, deferring issuance until %s",
+		used, o.budgets.budget, zoneID, until))
+	if o.recorder != nil {
+		if object := requestObject(cr); object != nil {
+			o.recorder.Eventf(object, corev1.EventTypeWarning, EventReasonIssuanceDeferred, "%s", err)
+		}
+		message := "The weekly issuance budget of zone %s is nearly used up, renewals that are not due are deferred until %s"
+		if urgent {
+			message = "The weekly issuance budget of zone %s is used up, all issuance is deferred until %s"
+		}
+		o.recorder.Eventf(issuerObject, corev1.EventTypeWarning, EventReasonIssuanceDeferred, message, zoneID, until)
+	}
+	return signer.PendingError{Err: err}
+}
+
+// urgentRequest reports whether the request cannot wait for the issuance
+// budget to free up. Only the renewals of Certificates whose certificate
+// is valid for longer than urgentIssuanceWindow can wait.
+func (o *Issuer) urgentRequest(cr signer.CertificateRequestObject) bool {
+	if cr.GetNamespace() == "" {
+		// CertificateSigningRequests do not belong to a Certificate.
+		return true
+	}
+	expiry := o.certificateExpiry(reconcile.Request{NamespacedName: types.NamespacedName{Namespace: cr.GetNamespace(), Name: cr.GetName()}})
+	return expiry.Equal(noExpiry) || time.Until(expiry) < urgentIssuanceWindow
+}
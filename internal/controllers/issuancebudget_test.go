@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIssuanceBudgets(t *testing.T) {
+	// A nil budget does not limit issuance.
+	var unlimited *issuanceBudgets
+	unlimited.record("zone")
+	if _, _, ok := unlimited.allow("zone", false); !ok {
+		t.Fatal("allow() on nil budget = false, want true")
+	}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newIssuanceBudgets(5)
+	b.now = func() time.Time { return now }
+
+	// 4 of 5 are available to requests that are not urgent.
+	for i := 0; i < 4; i++ {
+		if _, _, ok := b.allow("zone", false); !ok {
+			t.Fatalf("allow() after %d issuances = false, want true", i)
+		}
+		b.record("zone")
+		now = now.Add(time.Hour)
+	}
+
+	used, next, ok := b.allow("zone", false)
+	if ok || used != 4 {
+		t.Fatalf("allow() of request that is not urgent = %d, %v, want 4, false", used, ok)
+	}
+	if want := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("allow() next = %s, want %s", next, want)
+	}
+	if _, _, ok := b.allow("other-zone", false); !ok {
+		t.Error("allow() for other zone = false, want true")
+	}
+
+	// Urgent requests may use the reserve.
+	if _, _, ok := b.allow("zone", true); !ok {
+		t.Fatal("allow() of urgent request = false, want true")
+	}
+	b.record("zone")
+	if _, _, ok := b.allow("zone", true); ok {
+		t.Fatal("allow() of urgent request with budget used up = true, want false")
+	}
+
+	// The first issuance leaves the window.
+	now = time.Date(2024, 1, 8, 0, 0, 1, 0, time.UTC)
+	if used, _, ok := b.allow("zone", true); !ok || used != 4 {
+		t.Errorf("allow() a week later = %d, %v, want 4, true", used, ok)
+	}
+	if _, _, ok := b.allow("zone", false); ok {
+		t.Error("allow() of request that is not urgent a week later = true, want false")
+	}
+}
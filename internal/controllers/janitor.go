@@ -0,0 +1,289 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+// janitorPeriod is how often the janitor looks for stale data.
+const janitorPeriod = time.Hour
+
+// janitor removes the data that the controller keeps about requests once it
+// has been stale for longer than CleanupTTL, so that the objects stored in
+// etcd and the caches of the controller do not grow in clusters with many
+// renewals:
+//   - the retry annotations of requests that were finished, and
+//   - the CloudflareOriginCertificates of certificates that expired after
+//     their request was deleted, or after they were superseded by a
+//     renewal, and
+//   - the certificate index entries of certificates that expired.
+type janitor struct {
+	*Issuer
+	now func() time.Time
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (j *janitor) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable.
+func (j *janitor) Start(ctx context.Context) error {
+	for {
+		j.cleanUp(ctx)
+		timer := time.NewTimer(janitorPeriod)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// cleanUp removes all data that has been stale for longer than CleanupTTL.
+func (j *janitor) cleanUp(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("janitor")
+	ctx = log.IntoContext(ctx, logger)
+	cutoff := j.now().Add(-j.CleanupTTL)
+
+	j.cleanUpRequestAnnotations(ctx, cutoff)
+	j.cleanUpTrackingObjects(ctx, cutoff)
+	j.cleanUpIndex(ctx, cutoff)
+}
+
+// cleanUpRequestAnnotations removes the retry annotations of the finished
+// requests whose last signing attempt was before cutoff.
+func (j *janitor) cleanUpRequestAnnotations(ctx context.Context, cutoff time.Time) {
+	logger := log.FromContext(ctx)
+
+	var requests cmapi.CertificateRequestList
+	if err := j.client.List(ctx, &requests); err != nil {
+		logger.Error(err, "failed to list CertificateRequests")
+	}
+	for i := range requests.Items {
+		cr := &requests.Items[i]
+		key := issuerReferenceKey(CFMTLSIssuerapi.IssuerReference{Kind: cr.Spec.IssuerRef.Kind, Name: cr.Spec.IssuerRef.Name}, cr.Namespace)
+		if certificateRequestFinished(cr) && j.ownsIssuer(key) {
+			j.removeRetryAnnotations(ctx, cr, cutoff)
+		}
+	}
+
+	if !j.clusterScoped() {
+		return
+	}
+	var csrs certificatesv1.CertificateSigningRequestList
+	if err := j.client.List(ctx, &csrs); err != nil {
+		logger.Error(err, "failed to list CertificateSigningRequests")
+	}
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		_, name, _ := strings.Cut(csr.Spec.SignerName, "/")
+		if certificateSigningRequestFinished(csr) && j.ownsIssuer(types.NamespacedName{Name: name}) {
+			j.removeRetryAnnotations(ctx, csr, cutoff)
+		}
+	}
+}
+
+// removeRetryAnnotations removes the retry annotations of the given request
+// if its last signing attempt was before cutoff.
+func (j *janitor) removeRetryAnnotations(ctx context.Context, obj client.Object, cutoff time.Time) {
+	value, ok := obj.GetAnnotations()[CFMTLSIssuerapi.LastSigningAttemptAnnotationKey]
+	if !ok {
+		return
+	}
+	if lastAttempt, err := time.Parse(time.RFC3339, value); err == nil && lastAttempt.After(cutoff) {
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": map[string]*string{
+		CFMTLSIssuerapi.SigningAttemptsAnnotationKey:    nil,
+		CFMTLSIssuerapi.LastSigningErrorAnnotationKey:   nil,
+		CFMTLSIssuerapi.LastSigningAttemptAnnotationKey: nil,
+	}}})
+	if err == nil {
+		err = j.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+	}
+	if client.IgnoreNotFound(err) != nil {
+		log.FromContext(ctx).Error(err, "failed to remove the retry annotations of the request", "request", client.ObjectKeyFromObject(obj))
+		return
+	}
+	metrics.RecordJanitorCleanup("annotations")
+}
+
+// cleanUpTrackingObjects deletes the CloudflareOriginCertificates that are
+// stale since before cutoff.
+func (j *janitor) cleanUpTrackingObjects(ctx context.Context, cutoff time.Time) {
+	logger := log.FromContext(ctx)
+
+	var tracked CFMTLSIssuerapi.CloudflareOriginCertificateList
+	if err := j.client.List(ctx, &tracked); err != nil {
+		logger.Error(err, "failed to list CloudflareOriginCertificates")
+		return
+	}
+	for i := range tracked.Items {
+		cert := &tracked.Items[i]
+		if !cert.DeletionTimestamp.IsZero() || !j.ownsIssuer(issuerReferenceKey(cert.Spec.IssuerRef, cert.Namespace)) {
+			continue
+		}
+		expired, err := j.expiredWithoutRequest(ctx, cert, cutoff)
+		if err != nil {
+			logger.Error(err, "failed to check whether the tracked certificate is stale", "certificateID", cert.Spec.CertificateID)
+			continue
+		}
+		// Superseded certificates that are still valid are revoked and
+		// deleted by the supersededReconciler once the grace period of their
+		// issuer has passed, or kept until they expire.
+		if !expired && !(supersededBefore(cert, cutoff) && expiredBefore(cert, cutoff)) {
+			continue
+		}
+
+		// Expired certificates cannot be used anymore, so there is nothing
+		// left to revoke.
+		if controllerutil.ContainsFinalizer(cert, CFMTLSIssuerapi.RevokeOnDeleteFinalizer) {
+			original := cert.DeepCopy()
+			controllerutil.RemoveFinalizer(cert, CFMTLSIssuerapi.RevokeOnDeleteFinalizer)
+			if err := j.client.Patch(ctx, cert, client.MergeFrom(original)); client.IgnoreNotFound(err) != nil {
+				logger.Error(err, "failed to remove the finalizer of the tracked certificate", "certificateID", cert.Spec.CertificateID)
+				continue
+			}
+		}
+		if err := j.client.Delete(ctx, cert); client.IgnoreNotFound(err) != nil {
+			logger.Error(err, "failed to delete the tracked certificate", "certificateID", cert.Spec.CertificateID)
+			continue
+		}
+		logger.V(1).Info("deleted stale tracked certificate", "certificateID", cert.Spec.CertificateID, "namespace", cert.Namespace, "name", cert.Name)
+		metrics.RecordJanitorCleanup("trackingObjects")
+	}
+}
+
+// cleanUpIndex removes the certificate index entries of the certificates
+// that expired before cutoff.
+func (j *janitor) cleanUpIndex(ctx context.Context, cutoff time.Time) {
+	logger := log.FromContext(ctx)
+
+	zones, err := j.index.entries(ctx)
+	if err != nil {
+		logger.Error(err, "failed to read the certificate index")
+		return
+	}
+	for zoneID, entries := range zones {
+		for certificateID, entry := range entries {
+			if !entry.expired(cutoff) || !j.ownsIssuer(issuerReferenceKey(entry.IssuerRef, entry.Namespace)) {
+				continue
+			}
+			if err := j.index.remove(ctx, zoneID, certificateID); err != nil {
+				logger.Error(err, "failed to remove expired certificate from the index", "certificateID", certificateID, "zoneID", zoneID)
+				continue
+			}
+			metrics.RecordJanitorCleanup("indexEntries")
+		}
+	}
+}
+
+// expiredWithoutRequest reports whether the certificate tracked by cert
+// expired before cutoff and its request no longer exists.
+func (j *janitor) expiredWithoutRequest(ctx context.Context, cert *CFMTLSIssuerapi.CloudflareOriginCertificate, cutoff time.Time) (bool, error) {
+	if !expiredBefore(cert, cutoff) {
+		return false, nil
+	}
+
+	ref := cert.Spec.CertificateRequestRef
+	var request client.Object
+	switch ref.Kind {
+	case "CertificateRequest":
+		request = &cmapi.CertificateRequest{}
+	case "CertificateSigningRequest":
+		if !j.clusterScoped() {
+			return false, nil
+		}
+		request = &certificatesv1.CertificateSigningRequest{}
+	default:
+		return false, nil
+	}
+	err := j.client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, request)
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// A request with the same name may have been created since.
+	return ref.UID != "" && string(request.GetUID()) != ref.UID, nil
+}
+
+// expiredBefore reports whether the certificate tracked by cert expired
+// before cutoff.
+func expiredBefore(cert *CFMTLSIssuerapi.CloudflareOriginCertificate, cutoff time.Time) bool {
+	return cert.Spec.NotAfter != nil && !cert.Spec.NotAfter.After(cutoff)
+}
+
+// supersededBefore reports whether cert was superseded by a renewal before
+// cutoff.
+func supersededBefore(cert *CFMTLSIssuerapi.CloudflareOriginCertificate, cutoff time.Time) bool {
+	value, ok := cert.Annotations[CFMTLSIssuerapi.SupersededAtAnnotationKey]
+	if !ok {
+		return false
+	}
+	supersededAt, err := time.Parse(time.RFC3339, value)
+	return err == nil && supersededAt.Before(cutoff)
+}
+
+// certificateRequestFinished reports whether no more signing attempts are
+// made for the given CertificateRequest.
+func certificateRequestFinished(cr *cmapi.CertificateRequest) bool {
+	if len(cr.Status.Certificate) > 0 {
+		return true
+	}
+	for _, condition := range cr.Status.Conditions {
+		if condition.Type == cmapi.CertificateRequestConditionReady &&
+			(condition.Reason == cmapi.CertificateRequestReasonFailed || condition.Reason == cmapi.CertificateRequestReasonDenied) {
+			return true
+		}
+	}
+	return false
+}
+
+// certificateSigningRequestFinished reports whether no more signing attempts
+// are made for the given CertificateSigningRequest.
+func certificateSigningRequestFinished(csr *certificatesv1.CertificateSigningRequest) bool {
+	if len(csr.Status.Certificate) > 0 {
+		return true
+	}
+	for _, condition := range csr.Status.Conditions {
+		if (condition.Type == certificatesv1.CertificateFailed || condition.Type == certificatesv1.CertificateDenied) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
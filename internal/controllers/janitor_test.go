@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestJanitor(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{CFMTLSIssuerapi.AddToScheme, cmapi.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ttl := 7 * 24 * time.Hour
+	longAgo := metav1.NewTime(now.Add(-2 * ttl))
+	recently := metav1.NewTime(now.Add(-time.Hour))
+
+	failedRequest := func(name string, lastAttempt time.Time) *cmapi.CertificateRequest {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name), Annotations: map[string]string{
+				CFMTLSIssuerapi.SigningAttemptsAnnotationKey:    "5",
+				CFMTLSIssuerapi.LastSigningErrorAnnotationKey:   CFMTLSIssuerapi.ReasonAPIError,
+				CFMTLSIssuerapi.LastSigningAttemptAnnotationKey: lastAttempt.Format(time.RFC3339),
+			}},
+			Spec: cmapi.CertificateRequestSpec{IssuerRef: cmmeta.ObjectReference{Kind: "CFMTLSIssuer", Name: "issuer"}},
+			Status: cmapi.CertificateRequestStatus{Conditions: []cmapi.CertificateRequestCondition{{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Reason: cmapi.CertificateRequestReasonFailed,
+			}}},
+		}
+	}
+	tracked := func(name string, notAfter metav1.Time, annotations map[string]string) *CFMTLSIssuerapi.CloudflareOriginCertificate {
+		cert := trackedCertificate(name, name, "example.com")
+		cert.Annotations = annotations
+		cert.Finalizers = []string{CFMTLSIssuerapi.RevokeOnDeleteFinalizer}
+		cert.Spec.NotAfter = &notAfter
+		cert.Spec.CertificateRequestRef = CFMTLSIssuerapi.RequestReference{Kind: "CertificateRequest", Namespace: "default", Name: name, UID: name}
+		return cert
+	}
+
+	objects := []struct {
+		object      client.Object
+		wantRemoved bool
+	}{
+		{object: failedRequest("failed-long-ago", longAgo.Time), wantRemoved: true},
+		{object: failedRequest("failed-recently", recently.Time)},
+		{object: tracked("expired-without-request", longAgo, nil), wantRemoved: true},
+		{object: tracked("failed-long-ago", longAgo, nil)},
+		{object: tracked("valid-without-request", metav1.NewTime(now.Add(ttl)), nil)},
+		// Superseded certificates that are still valid are left to the
+		// supersededReconciler, which honors the grace period of the issuer.
+		{object: tracked("superseded-long-ago", metav1.NewTime(now.Add(ttl)), map[string]string{
+			CFMTLSIssuerapi.SupersededAtAnnotationKey: longAgo.Format(time.RFC3339),
+		})},
+		{object: tracked("superseded-recently", metav1.NewTime(now.Add(ttl)), map[string]string{
+			CFMTLSIssuerapi.SupersededAtAnnotationKey: recently.Format(time.RFC3339),
+		})},
+		{object: tracked("superseded-and-expired", longAgo, map[string]string{
+			CFMTLSIssuerapi.SupersededAtAnnotationKey: longAgo.Format(time.RFC3339),
+		}), wantRemoved: true},
+	}
+
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, o := range objects {
+		builder = builder.WithObjects(o.object)
+	}
+	c := builder.Build()
+	j := &janitor{Issuer: &Issuer{client: c, CleanupTTL: ttl}, now: func() time.Time { return now }}
+	ctx := context.Background()
+	j.cleanUp(ctx)
+
+	for _, o := range objects {
+		switch obj := o.object.(type) {
+		case *cmapi.CertificateRequest:
+			got := &cmapi.CertificateRequest{}
+			if err := c.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, got); err != nil {
+				t.Fatal(err)
+			}
+			if removed := !metav1.HasAnnotation(got.ObjectMeta, CFMTLSIssuerapi.SigningAttemptsAnnotationKey); removed != o.wantRemoved {
+				t.Errorf("annotations of CertificateRequest %s removed = %v, want %v", obj.Name, removed, o.wantRemoved)
+			}
+		case *CFMTLSIssuerapi.CloudflareOriginCertificate:
+			got := &CFMTLSIssuerapi.CloudflareOriginCertificate{}
+			err := c.Get(ctx, types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, got)
+			removed := apierrors.IsNotFound(err)
+			if removed != o.wantRemoved {
+				t.Errorf("CloudflareOriginCertificate %s removed = %v, want %v", obj.Name, removed, o.wantRemoved)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// checkMaintenanceWindows defers the renewals requested outside of the
+// maintenance windows of the issuer until the next window opens. Urgent
+// requests, see urgentRequest, are signed at any time. Deferred requests are
+// kept pending, with an event telling when they are signed.
+func (o *Issuer) checkMaintenanceWindows(cr signer.CertificateRequestObject, issuerSpec *CFMTLSIssuerapi.IssuerSpec, now time.Time) error {
+	if len(issuerSpec.MaintenanceWindows) == 0 || o.urgentRequest(cr) {
+		return nil
+	}
+	open, next, err := maintenanceWindowOpen(issuerSpec.MaintenanceWindows, now)
+	if err != nil {
+		return signer.IssuerError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, err)}
+	}
+	if open {
+		return nil
+	}
+
+	until := next.UTC().Format(time.RFC3339)
+	if o.recorder != nil {
+		if object := requestObject(cr); object != nil {
+			o.recorder.Eventf(object, corev1.EventTypeNormal, EventReasonOutsideMaintenanceWindow, "Deferring the renewal until the next maintenance window opens at %s", until)
+		}
+	}
+	return signer.PendingError{Err: withReason(CFMTLSIssuerapi.ReasonOutsideMaintenanceWindow, fmt.Errorf("outside of the maintenance windows of the issuer, deferring issuance until %s", until))}
+}
+
+// maintenanceWindowOpen reports whether one of the given windows is open at
+// now. If not, it returns when the next one opens.
+func maintenanceWindowOpen(windows []CFMTLSIssuerapi.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	var next time.Time
+	for i, window := range windows {
+		start, err := time.Parse("15:04", window.Start)
+		if err != nil {
+			return false, time.Time{}, fmt.Errorf("invalid start of maintenance window %d: %w", i, err)
+		}
+		location := time.UTC
+		if window.TimeZone != "" {
+			if location, err = time.LoadLocation(window.TimeZone); err != nil {
+				return false, time.Time{}, fmt.Errorf("invalid time zone of maintenance window %d: %w", i, err)
+			}
+		}
+		days := map[time.Weekday]bool{}
+		for _, day := range window.Days {
+			days[weekday(day)] = true
+		}
+
+		// Windows last at most a week, so the one open at now opened within
+		// the last week, and the next one opens within the next.
+		local := now.In(location)
+		for offset := -7; offset <= 7; offset++ {
+			opens := time.Date(local.Year(), local.Month(), local.Day()+offset, start.Hour(), start.Minute(), 0, 0, location)
+			if len(days) > 0 && !days[opens.Weekday()] {
+				continue
+			}
+			if !opens.After(now) && now.Before(opens.Add(window.Duration.Duration)) {
+				return true, time.Time{}, nil
+			}
+			if opens.After(now) && (next.IsZero() || opens.Before(next)) {
+				next = opens
+			}
+		}
+	}
+	return false, next, nil
+}
+
+// weekday returns the time.Weekday of the given day of a maintenance window.
+func weekday(day CFMTLSIssuerapi.Weekday) time.Weekday {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d.String() == string(day) {
+			return d
+		}
+	}
+	return -1
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	// A Wednesday.
+	now := time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)
+	window := func(start string, duration time.Duration, timeZone string, days ...CFMTLSIssuerapi.Weekday) CFMTLSIssuerapi.MaintenanceWindow {
+		return CFMTLSIssuerapi.MaintenanceWindow{Days: days, Start: start, Duration: metav1.Duration{Duration: duration}, TimeZone: timeZone}
+	}
+
+	tests := []struct {
+		name     string
+		windows  []CFMTLSIssuerapi.MaintenanceWindow
+		wantOpen bool
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "daily window passed",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("02:00", 4*time.Hour, "")},
+			wantNext: time.Date(2024, 1, 4, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily window open",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("09:00", 2*time.Hour, "")},
+			wantOpen: true,
+		},
+		{
+			name:     "window closes at now",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("08:00", 2*time.Hour, "")},
+			wantNext: time.Date(2024, 1, 4, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekend window",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("22:00", 48*time.Hour, "", "Saturday")},
+			wantNext: time.Date(2024, 1, 6, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "window opened the day before",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("22:00", 14*time.Hour, "", "Tuesday")},
+			wantOpen: true,
+		},
+		{
+			name:     "time zone ahead of UTC",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("10:30", time.Hour, "Europe/Berlin")},
+			wantOpen: true,
+		},
+		{
+			name:     "time zone behind UTC",
+			windows:  []CFMTLSIssuerapi.MaintenanceWindow{window("06:00", time.Hour, "America/New_York")},
+			wantNext: time.Date(2024, 1, 3, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "earliest of several windows",
+			windows: []CFMTLSIssuerapi.MaintenanceWindow{
+				window("02:00", time.Hour, "", "Sunday"),
+				window("20:00", time.Hour, "", "Monday", "Thursday"),
+			},
+			wantNext: time.Date(2024, 1, 4, 20, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "invalid time zone",
+			windows: []CFMTLSIssuerapi.MaintenanceWindow{window("02:00", time.Hour, "Mars/Olympus")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, next, err := maintenanceWindowOpen(tt.windows, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("maintenanceWindowOpen() error = %v, want error %v", err, tt.wantErr)
+			}
+			if open != tt.wantOpen {
+				t.Errorf("maintenanceWindowOpen() open = %v, want %v", open, tt.wantOpen)
+			}
+			if !next.Equal(tt.wantNext) {
+				t.Errorf("maintenanceWindowOpen() next = %s, want %s", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestCheckMaintenanceWindows(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	certificate := func(name string, notAfter time.Time) *cmapi.Certificate {
+		return &cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name)},
+			Status:     cmapi.CertificateStatus{NotAfter: &metav1.Time{Time: notAfter}},
+		}
+	}
+	request := func(owner *cmapi.Certificate) *cmapi.CertificateRequest {
+		controller := true
+		return &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      owner.Name + "-1",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: cmapi.SchemeGroupVersion.String(), Kind: cmapi.CertificateKind, Name: owner.Name, UID: owner.UID, Controller: &controller,
+			}},
+		}}
+	}
+	due, notDue := certificate("due", now.Add(24*time.Hour)), certificate("not-due", now.Add(60*24*time.Hour))
+	dueRequest, notDueRequest := request(due), request(notDue)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(due, notDue, dueRequest, notDueRequest).Build()
+
+	// Only open in the past hour of every day.
+	closed := &CFMTLSIssuerapi.IssuerSpec{MaintenanceWindows: []CFMTLSIssuerapi.MaintenanceWindow{{
+		Start:    now.UTC().Add(-2 * time.Hour).Format("15:04"),
+		Duration: metav1.Duration{Duration: time.Hour},
+	}}}
+
+	tests := []struct {
+		name        string
+		spec        *CFMTLSIssuerapi.IssuerSpec
+		cr          *cmapi.CertificateRequest
+		wantPending bool
+	}{
+		{
+			name: "no maintenance windows",
+			spec: &CFMTLSIssuerapi.IssuerSpec{},
+			cr:   notDueRequest,
+		},
+		{
+			name:        "renewal outside of the windows",
+			spec:        closed,
+			cr:          notDueRequest,
+			wantPending: true,
+		},
+		{
+			name: "urgent renewal outside of the windows",
+			spec: closed,
+			cr:   dueRequest,
+		},
+		{
+			name: "new certificate outside of the windows",
+			spec: closed,
+			cr:   &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "standalone"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			o := &Issuer{client: c, recorder: recorder}
+			err := o.checkMaintenanceWindows(signer.CertificateRequestObjectFromCertificateRequest(tt.cr), tt.spec, now)
+			close(recorder.Events)
+
+			if !tt.wantPending {
+				if err != nil {
+					t.Fatalf("checkMaintenanceWindows() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &signer.PendingError{}) {
+				t.Fatalf("checkMaintenanceWindows() = %v, want a PendingError", err)
+			}
+			if got := errorReason(err); got != CFMTLSIssuerapi.ReasonOutsideMaintenanceWindow {
+				t.Errorf("reason = %q, want %q", got, CFMTLSIssuerapi.ReasonOutsideMaintenanceWindow)
+			}
+			if event := <-recorder.Events; event == "" {
+				t.Error("no event recorded")
+			}
+		})
+	}
+}
@@ -0,0 +1,459 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+const (
+	// orphanMinAge is how old a certificate must be before it is considered
+	// orphaned, so that certificates whose CloudflareOriginCertificate is
+	// still being created are not collected.
+	orphanMinAge = time.Hour
+	// orphanPageSize is the number of certificates listed per request, the
+	// maximum of the Cloudflare API.
+	orphanPageSize = 50
+	// orphanMaxPages bounds the certificates listed per zone.
+	orphanMaxPages = 200
+	// orphanEventIDs bounds the certificate IDs listed in an event.
+	orphanEventIDs = 10
+)
+
+// cloudflareClientCertificate is a client certificate listed by the
+// Cloudflare API. Only the fields used by the controller are decoded.
+type cloudflareClientCertificate struct {
+	ID         string `json:"id"`
+	CommonName string `json:"common_name"`
+	// Certificate is the PEM encoded certificate.
+	Certificate string    `json:"certificate"`
+	IssuedOn    time.Time `json:"issued_on"`
+	ExpiresOn   time.Time `json:"expires_on"`
+}
+
+// clientCertificatesResponse is the body of a response listing client
+// certificates.
+type clientCertificatesResponse struct {
+	Result     []cloudflareClientCertificate `json:"result"`
+	ResultInfo struct {
+		TotalCount int `json:"total_count"`
+	} `json:"result_info"`
+}
+
+// orphanCollector finds the active certificates at Cloudflare that were
+// issued by an issuer of the controller but are no longer tracked by a
+// CloudflareOriginCertificate, e.g. because the tracking object was deleted
+// with its Certificate.
+//
+// With the CertificateIndex feature, the certificates are attributed to
+// their issuer by their entry in the certificate index. Otherwise, a
+// certificate listed at Cloudflare is attributed to an issuer if it was
+// issued for the same hostnames as one of the certificates that the issuer
+// tracks in the zone. Other certificates of the zone, including those whose
+// hostnames cannot be read, are never touched.
+//
+// Unless OrphanGCDryRun is false, orphans are only reported in the logs, in
+// an event on their issuer and in a metric, so that operators can validate
+// the matching before letting the collector revoke them.
+type orphanCollector struct {
+	*Issuer
+	now func() time.Time
+	// zones limits the collection to the given lower-cased zone IDs. Nil
+	// collects all zones.
+	zones map[string]bool
+}
+
+// orphanScope is what the collector knows about the certificates of an
+// issuer.
+type orphanScope struct {
+	ref       CFMTLSIssuerapi.IssuerReference
+	namespace string
+	// hostnameSets are the hostnames of the tracked certificates per zone
+	// ID, as returned by hostnameSetKey, whose certificates are listed at
+	// Cloudflare.
+	hostnameSets map[string]map[string]bool
+	// orphans are the orphans found in the certificate index.
+	orphans []orphan
+}
+
+// orphan is an orphaned certificate in a zone.
+type orphan struct {
+	cloudflareClientCertificate
+	zoneID string
+	// owner is the former CloudflareOriginCertificate of an orphan found in
+	// the certificate index.
+	owner string
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (g *orphanCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// Start implements manager.Runnable.
+func (g *orphanCollector) Start(ctx context.Context) error {
+	for {
+		// Errors are logged by collect and retried on the next run.
+		_ = g.collect(ctx)
+		timer := time.NewTimer(g.OrphanGCInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// CollectOrphans runs the orphan garbage collector once, outside of a
+// manager, e.g. from a CronJob. Only the given zones are collected, or all
+// zones if none are given. No events are recorded, orphans are reported in
+// the logs.
+func (o *Issuer) CollectOrphans(ctx context.Context, c client.Client, zoneIDs []string) error {
+	o.client = c
+	o.transports = newTransportCache(newCloudflareDialer(o.DNSServer, o.HostOverrides))
+	o.limiters = newZoneLimiters()
+	o.breakers = newCircuitBreakers()
+	if o.featureEnabled(features.CertificateIndex) {
+		if o.ClusterResourceNamespace == "" {
+			return errors.New("the CertificateIndex feature requires a cluster resource namespace")
+		}
+		o.index = &certificateIndex{client: c, namespace: o.ClusterResourceNamespace}
+	}
+
+	g := &orphanCollector{Issuer: o, now: time.Now}
+	for _, zoneID := range zoneIDs {
+		if g.zones == nil {
+			g.zones = map[string]bool{}
+		}
+		g.zones[strings.ToLower(zoneID)] = true
+	}
+	return g.collect(ctx)
+}
+
+// collect reports or revokes the orphaned certificates of all issuers. It
+// logs and returns the errors of all issuers.
+func (g *orphanCollector) collect(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("orphangc")
+	ctx = log.IntoContext(ctx, logger)
+
+	var tracked CFMTLSIssuerapi.CloudflareOriginCertificateList
+	if err := g.client.List(ctx, &tracked); err != nil {
+		logger.Error(err, "failed to list CloudflareOriginCertificates")
+		return err
+	}
+	trackedIDs := make(map[string]bool, len(tracked.Items))
+	for _, cert := range tracked.Items {
+		trackedIDs[cert.Spec.CertificateID] = true
+	}
+
+	var scopes map[string]*orphanScope
+	if g.index != nil {
+		var err error
+		if scopes, err = g.indexedScopes(ctx, tracked.Items, trackedIDs); err != nil {
+			logger.Error(err, "failed to look for orphaned certificates in the certificate index")
+			return err
+		}
+	} else {
+		scopes = g.hostnameScopes(tracked.Items)
+	}
+
+	keys := make([]string, 0, len(scopes))
+	for key := range scopes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		scope := scopes[key]
+		if err := g.collectIssuer(ctx, scope, trackedIDs); err != nil {
+			logger.Error(err, "failed to collect orphaned certificates", "issuerKind", scope.ref.Kind, "issuer", key)
+			errs = append(errs, fmt.Errorf("%s %s: %w", scope.ref.Kind, key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collectsZone reports whether the given zone is collected.
+func (g *orphanCollector) collectsZone(zoneID string) bool {
+	return g.zones == nil || g.zones[strings.ToLower(zoneID)]
+}
+
+// scope returns the scope of the given issuer in scopes, adding it if
+// needed, or nil if the issuer belongs to another shard.
+func (g *orphanCollector) scope(scopes map[string]*orphanScope, ref CFMTLSIssuerapi.IssuerReference, namespace string) *orphanScope {
+	key := issuerReferenceKey(ref, namespace)
+	if !g.ownsIssuer(key) {
+		return nil
+	}
+	scope, ok := scopes[key.String()]
+	if !ok {
+		scope = &orphanScope{ref: ref, namespace: key.Namespace}
+		scopes[key.String()] = scope
+	}
+	return scope
+}
+
+// hostnameScopes returns the hostnames of the certificates tracked by the
+// issuers.
+func (g *orphanCollector) hostnameScopes(tracked []CFMTLSIssuerapi.CloudflareOriginCertificate) map[string]*orphanScope {
+	scopes := map[string]*orphanScope{}
+	for _, cert := range tracked {
+		key := hostnameSetKey(cert.Spec.Hostnames)
+		if key == "" || !g.collectsZone(cert.Spec.ZoneID) {
+			continue
+		}
+		scope := g.scope(scopes, cert.Spec.IssuerRef, cert.Namespace)
+		if scope == nil {
+			continue
+		}
+		if scope.hostnameSets == nil {
+			scope.hostnameSets = map[string]map[string]bool{}
+		}
+		if scope.hostnameSets[cert.Spec.ZoneID] == nil {
+			scope.hostnameSets[cert.Spec.ZoneID] = map[string]bool{}
+		}
+		scope.hostnameSets[cert.Spec.ZoneID][key] = true
+	}
+	return scopes
+}
+
+// hostnameSetKey returns a key identifying the given set of hostnames,
+// regardless of their order and case, or "" if there are none.
+func hostnameSetKey(hostnames []string) string {
+	keys := make([]string, 0, len(hostnames))
+	for _, hostname := range hostnames {
+		if hostname = strings.TrimSuffix(strings.ToLower(hostname), "."); hostname != "" {
+			keys = append(keys, hostname)
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(slices.Compact(keys), ",")
+}
+
+// hostnames returns the DNS names of the certificate, or nil if it cannot
+// be decoded.
+func (c cloudflareClientCertificate) hostnames() []string {
+	cert, err := pki.DecodeX509CertificateBytes([]byte(c.Certificate))
+	if err != nil {
+		return nil
+	}
+	return cert.DNSNames
+}
+
+// indexedScopes returns the orphans of the issuers found in the certificate
+// index. Tracked certificates that are missing from the index, e.g. because
+// they were issued before the index was enabled, are added to it first.
+func (g *orphanCollector) indexedScopes(ctx context.Context, tracked []CFMTLSIssuerapi.CloudflareOriginCertificate, trackedIDs map[string]bool) (map[string]*orphanScope, error) {
+	zones, err := g.index.entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tracked {
+		cert := &tracked[i]
+		if _, ok := zones[strings.ToLower(cert.Spec.ZoneID)][cert.Spec.CertificateID]; ok || !g.collectsZone(cert.Spec.ZoneID) {
+			continue
+		}
+		if err := g.index.add(ctx, cert); err != nil {
+			log.FromContext(ctx).Error(err, "failed to index tracked certificate", "certificateID", cert.Spec.CertificateID)
+		}
+	}
+
+	cutoff := g.now().Add(-orphanMinAge)
+	scopes := map[string]*orphanScope{}
+	for zoneID, entries := range zones {
+		if !g.collectsZone(zoneID) {
+			continue
+		}
+		for certificateID, entry := range entries {
+			if trackedIDs[certificateID] || entry.IssuedAt.After(cutoff) || entry.expired(g.now()) {
+				continue
+			}
+			scope := g.scope(scopes, entry.IssuerRef, entry.Namespace)
+			if scope == nil {
+				continue
+			}
+			cert := cloudflareClientCertificate{ID: certificateID, IssuedOn: entry.IssuedAt.Time}
+			if entry.NotAfter != nil {
+				cert.ExpiresOn = entry.NotAfter.Time
+			}
+			scope.orphans = append(scope.orphans, orphan{cloudflareClientCertificate: cert, zoneID: zoneID, owner: entry.Namespace + "/" + entry.Name})
+		}
+	}
+	for _, scope := range scopes {
+		sort.Slice(scope.orphans, func(i, j int) bool { return scope.orphans[i].ID < scope.orphans[j].ID })
+	}
+	return scopes, nil
+}
+
+// collectIssuer reports or revokes the orphaned certificates of an issuer.
+func (g *orphanCollector) collectIssuer(ctx context.Context, scope *orphanScope, trackedIDs map[string]bool) error {
+	logger := log.FromContext(ctx).WithValues("issuerKind", scope.ref.Kind, "issuer", scope.ref.Name, "namespace", scope.namespace)
+
+	issuerObject, err := g.referencedIssuer(ctx, scope.ref, scope.namespace)
+	if apierrors.IsNotFound(err) {
+		logger.V(1).Info("issuer not found, not looking for orphaned certificates")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	api, err := g.zoneAPI(ctx, issuerObject)
+	if err != nil {
+		return err
+	}
+
+	orphans, err := g.listOrphans(ctx, api, scope, trackedIDs)
+	if err != nil {
+		return err
+	}
+	orphans = append(scope.orphans, orphans...)
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	if g.OrphanGCDryRun {
+		ids := make([]string, 0, len(orphans))
+		for _, orphan := range orphans {
+			logger.Info("found orphaned Cloudflare certificate, not revoking it in dry-run mode", orphan.keysAndValues()...)
+			metrics.RecordOrphanedCertificate("reported")
+			ids = append(ids, orphan.ID)
+		}
+		g.recordOrphanEvent(issuerObject, "Found %d orphaned certificate(s) that would be revoked: %s", len(orphans), orphanIDList(ids))
+		return nil
+	}
+
+	var revoked []string
+	for _, orphan := range orphans {
+		err := g.revokeCertificate(ctx, api, orphan.zoneID, orphan.ID)
+		if err != nil && errorReason(err) != CFMTLSIssuerapi.ReasonCertificateNotFound {
+			logger.Error(err, "failed to revoke orphaned Cloudflare certificate", "certificateID", orphan.ID, "zoneID", orphan.zoneID)
+			continue
+		}
+		logger.Info("revoked orphaned Cloudflare certificate", orphan.keysAndValues()...)
+		metrics.RecordOrphanedCertificate("revoked")
+		revoked = append(revoked, orphan.ID)
+	}
+	if len(revoked) > 0 {
+		g.recordOrphanEvent(issuerObject, "Revoked %d orphaned certificate(s): %s", len(revoked), orphanIDList(revoked))
+	}
+	return nil
+}
+
+// listOrphans lists the certificates of the zones of the issuer at
+// Cloudflare and returns those issued for the hostnames of one of its tracked
+// certificates that are no longer tracked.
+func (g *orphanCollector) listOrphans(ctx context.Context, api *zoneAPI, scope *orphanScope, trackedIDs map[string]bool) ([]orphan, error) {
+	zoneIDs := make([]string, 0, len(scope.hostnameSets))
+	for zoneID := range scope.hostnameSets {
+		zoneIDs = append(zoneIDs, zoneID)
+	}
+	sort.Strings(zoneIDs)
+
+	cutoff := g.now().Add(-orphanMinAge)
+	var orphans []orphan
+	for _, zoneID := range zoneIDs {
+		var certificates []cloudflareClientCertificate
+		err := api.do(ctx, zoneID, func(apiKey, baseURL, zoneID string, client *http.Client) (err error) {
+			certificates, err = listCloudflareCertificates(ctx, apiKey, baseURL, zoneID, client)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the certificates of zone %s: %w", zoneID, err)
+		}
+		for _, cert := range certificates {
+			if trackedIDs[cert.ID] {
+				continue
+			}
+			// Certificates whose hostnames cannot be read are never
+			// attributed to the issuer.
+			if key := hostnameSetKey(cert.hostnames()); key == "" || !scope.hostnameSets[zoneID][key] {
+				continue
+			}
+			if cert.IssuedOn.After(cutoff) || (!cert.ExpiresOn.IsZero() && cert.ExpiresOn.Before(g.now())) {
+				continue
+			}
+			orphans = append(orphans, orphan{cloudflareClientCertificate: cert, zoneID: zoneID})
+		}
+	}
+	return orphans, nil
+}
+
+// keysAndValues returns the log keys and values describing the orphan.
+func (o orphan) keysAndValues() []interface{} {
+	keysAndValues := []interface{}{"certificateID", o.ID, "zoneID", o.zoneID, "issuedOn", o.IssuedOn}
+	if o.CommonName != "" {
+		keysAndValues = append(keysAndValues, "commonName", o.CommonName)
+	}
+	if o.owner != "" {
+		keysAndValues = append(keysAndValues, "cloudflareOriginCertificate", o.owner)
+	}
+	return keysAndValues
+}
+
+// recordOrphanEvent records an event on the issuer of orphaned certificates.
+func (g *orphanCollector) recordOrphanEvent(issuerObject issuerapi.Issuer, message string, args ...interface{}) {
+	if g.recorder == nil {
+		return
+	}
+	g.recorder.Eventf(issuerObject, corev1.EventTypeNormal, EventReasonOrphanedCertificates, message, args...)
+}
+
+// orphanIDList returns the given certificate IDs for an event message,
+// bounded to orphanEventIDs.
+func orphanIDList(ids []string) string {
+	if len(ids) <= orphanEventIDs {
+		return strings.Join(ids, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(ids[:orphanEventIDs], ", "), len(ids)-orphanEventIDs)
+}
+
+// listCloudflareCertificates returns the active client certificates of the
+// given zone.
+func listCloudflareCertificates(ctx context.Context, apiKey, baseURL, zoneID string, client *http.Client) ([]cloudflareClientCertificate, error) {
+	var certificates []cloudflareClientCertificate
+	for page := 1; page <= orphanMaxPages; page++ {
+		url := fmt.Sprintf("%s/zones/%s/client_certificates?status=active&per_page=%d&page=%d", baseURL, zoneID, orphanPageSize, page)
+		var response clientCertificatesResponse
+		if err := cloudflareDo(ctx, apiKey, http.MethodGet, url, nil, client, &response); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, response.Result...)
+		if len(response.Result) < orphanPageSize || len(certificates) >= response.ResultInfo.TotalCount {
+			break
+		}
+	}
+	return certificates, nil
+}
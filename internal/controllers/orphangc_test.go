@@ -0,0 +1,284 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// fakeClientCertificateAPI serves the Cloudflare client certificate
+// endpoints of the zone "zone-id".
+type fakeClientCertificateAPI struct {
+	mu           sync.Mutex
+	certificates []cloudflareClientCertificate
+	revoked      []string
+}
+
+func (a *fakeClientCertificateAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	const path = "/zones/zone-id/client_certificates"
+	var result interface{}
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == path:
+		result = a.certificates
+	case req.Method == http.MethodDelete && strings.HasPrefix(req.URL.Path, path+"/"):
+		a.revoked = append(a.revoked, strings.TrimPrefix(req.URL.Path, path+"/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"result":      result,
+		"result_info": map[string]interface{}{"page": 1, "total_count": len(a.certificates)},
+	})
+}
+
+// clientCertificatePEM returns a PEM encoded certificate for the given DNS
+// names.
+func clientCertificatePEM(t *testing.T, dnsNames ...string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), DNSNames: dnsNames}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// acceptingHealthChecker accepts any credentials.
+type acceptingHealthChecker struct{}
+
+func (acceptingHealthChecker) Check() error { return nil }
+
+func TestOrphanCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		dryRun      bool
+		zones       map[string]bool
+		wantRevoked []string
+		wantEvent   string
+	}{
+		{name: "dry run", dryRun: true, wantEvent: "Found 1 orphaned certificate(s) that would be revoked: orphan"},
+		{name: "revoke", wantRevoked: []string{"orphan"}, wantEvent: "Revoked 1 orphaned certificate(s): orphan"},
+		{name: "other zone", zones: map[string]bool{"other-zone-id": true}},
+	}
+	web := clientCertificatePEM(t, "web.example.com")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now().UTC().Truncate(time.Second)
+			issuedOn := now.Add(-24 * time.Hour)
+			expiresOn := now.Add(365 * 24 * time.Hour)
+			api := &fakeClientCertificateAPI{certificates: []cloudflareClientCertificate{
+				{ID: "tracked", CommonName: "web.example.com", Certificate: web, IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				{ID: "orphan", CommonName: "web.example.com", Certificate: clientCertificatePEM(t, "WEB.example.com"), IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				// Issued for a hostname the issuer does not track.
+				{ID: "foreign", CommonName: "vpn.example.com", Certificate: clientCertificatePEM(t, "vpn.example.com"), IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				// Issued for more hostnames than the tracked certificate.
+				{ID: "superset", CommonName: "web.example.com", Certificate: clientCertificatePEM(t, "web.example.com", "vpn.example.com"), IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				// Its hostnames cannot be compared.
+				{ID: "unreadable", CommonName: "web.example.com", IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				{ID: "no-hostnames", CommonName: "web.example.com", Certificate: clientCertificatePEM(t), IssuedOn: issuedOn, ExpiresOn: expiresOn},
+				// Its tracking object may not have been created yet.
+				{ID: "fresh", CommonName: "web.example.com", Certificate: web, IssuedOn: now, ExpiresOn: expiresOn},
+				{ID: "expired", CommonName: "web.example.com", Certificate: web, IssuedOn: issuedOn.Add(-365 * 24 * time.Hour), ExpiresOn: issuedOn},
+			}}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			issuerObject := &CFMTLSIssuerapi.CFMTLSIssuer{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Spec: CFMTLSIssuerapi.IssuerSpec{
+					AuthSecretName: "cloudflare",
+					ConfigMapRef:   &CFMTLSIssuerapi.ConfigMapReference{Name: "cloudflare"},
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("token")},
+			}
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string]string{CFMTLSIssuerapi.ConfigMapAPIBaseURLKey: server.URL},
+			}
+			tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "web-1"},
+				Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+					CertificateID: "tracked",
+					ZoneID:        "zone-id",
+					Hostnames:     []string{"web.example.com"},
+					IssuerRef:     CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"},
+				},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuerObject, secret, configMap, tracked).Build()
+			recorder := record.NewFakeRecorder(10)
+			g := &orphanCollector{
+				Issuer: &Issuer{
+					client:         c,
+					recorder:       recorder,
+					OrphanGCDryRun: tt.dryRun,
+					HealthCheckerBuilder: func(*CFMTLSIssuerapi.IssuerSpec, map[string][]byte) (HealthChecker, error) {
+						return acceptingHealthChecker{}, nil
+					},
+				},
+				now:   func() time.Time { return now },
+				zones: tt.zones,
+			}
+
+			if err := g.collect(context.Background()); err != nil {
+				t.Fatalf("collect() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(api.revoked, tt.wantRevoked) {
+				t.Errorf("revoked = %v, want %v", api.revoked, tt.wantRevoked)
+			}
+			select {
+			case event := <-recorder.Events:
+				if tt.wantEvent == "" || !strings.Contains(event, EventReasonOrphanedCertificates) || !strings.Contains(event, tt.wantEvent) {
+					t.Errorf("event = %q, want %q", event, tt.wantEvent)
+				}
+			default:
+				if tt.wantEvent != "" {
+					t.Errorf("no event recorded, want %q", tt.wantEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestOrphanCollectorIndex(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	issuerRef := CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"}
+	trackedCert := func(name, certificateID string, created time.Time) *CFMTLSIssuerapi.CloudflareOriginCertificate {
+		return &CFMTLSIssuerapi.CloudflareOriginCertificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Spec:       CFMTLSIssuerapi.CloudflareOriginCertificateSpec{CertificateID: certificateID, ZoneID: "zone-id", IssuerRef: issuerRef},
+		}
+	}
+	issuerObject := &CFMTLSIssuerapi.CFMTLSIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+		Spec:       CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+		Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("token")},
+	}
+	// Issued before the index was enabled.
+	tracked := trackedCert("web-2", "tracked", now.Add(-24*time.Hour))
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuerObject, secret, tracked).Build()
+	index := &certificateIndex{client: c, namespace: "cfmtls-system"}
+	ctx := context.Background()
+	// The tracking object of the orphan was deleted after it was indexed.
+	for _, cert := range []*CFMTLSIssuerapi.CloudflareOriginCertificate{
+		trackedCert("web-1", "orphan", now.Add(-24*time.Hour)),
+		trackedCert("web-3", "fresh", now),
+	} {
+		if err := index.add(ctx, cert); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	g := &orphanCollector{
+		Issuer: &Issuer{
+			client:         c,
+			recorder:       recorder,
+			index:          index,
+			OrphanGCDryRun: true,
+			HealthCheckerBuilder: func(*CFMTLSIssuerapi.IssuerSpec, map[string][]byte) (HealthChecker, error) {
+				return acceptingHealthChecker{}, nil
+			},
+		},
+		now: func() time.Time { return now },
+	}
+
+	if err := g.collect(ctx); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if want := "Found 1 orphaned certificate(s) that would be revoked: orphan"; !strings.Contains(event, want) {
+			t.Errorf("event = %q, want %q", event, want)
+		}
+	default:
+		t.Error("no event recorded, want the orphan reported")
+	}
+	zones, err := index.entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := zones["zone-id"]["tracked"]; !ok {
+		t.Errorf("index = %v, want the tracked certificate added", zones)
+	}
+}
+
+func TestOrphanIDList(t *testing.T) {
+	ids := make([]string, orphanEventIDs+2)
+	for i := range ids {
+		ids[i] = "id"
+	}
+	if got := orphanIDList(ids); !strings.HasSuffix(got, "id and 2 more") {
+		t.Errorf("orphanIDList() = %q, want the IDs beyond %d summarized", got, orphanEventIDs)
+	}
+}
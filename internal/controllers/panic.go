@@ -0,0 +1,51 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+// recoverPanic runs fn, the given operation on object, and turns a panic,
+// e.g. of a SignerBuilder or HealthCheckerBuilder, into an error, so that
+// the reconcile fails and is retried instead of crashing the manager. The
+// panic is logged with its stack, counted in the metrics and recorded as a
+// Warning event on object, if not nil.
+func (o *Issuer) recoverPanic(ctx context.Context, operation string, object runtime.Object, fn func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		err = withReason(CFMTLSIssuerapi.ReasonInternalError, fmt.Errorf("recovered from panic in %s: %v", operation, r))
+		log.FromContext(ctx).Error(err, "panic", "operation", operation, "stack", string(debug.Stack()))
+		metrics.RecordPanic(operation)
+		if o.recorder != nil && object != nil {
+			o.recorder.Eventf(object, corev1.EventTypeWarning, EventReasonPanic, "%s", err)
+		}
+	}()
+	return fn()
+}
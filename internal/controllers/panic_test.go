@@ -0,0 +1,57 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	o := &Issuer{recorder: recorder}
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"}}
+
+	want := errors.New("failed")
+	if err := o.recoverPanic(context.Background(), "Check", issuer, func() error { return want }); err != want {
+		t.Errorf("recoverPanic() error = %v, want %v", err, want)
+	}
+
+	err := o.recoverPanic(context.Background(), "Check", issuer, func() error {
+		var checker HealthChecker
+		return checker.Check()
+	})
+	if err == nil || errorReason(err) != CFMTLSIssuerapi.ReasonInternalError {
+		t.Fatalf("recoverPanic() of a panic error = %v, want an InternalError", err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, EventReasonPanic) {
+			t.Errorf("event = %q, want reason %s", event, EventReasonPanic)
+		}
+	default:
+		t.Error("no event recorded for the panic")
+	}
+}
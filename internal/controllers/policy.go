@@ -0,0 +1,220 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/fips"
+)
+
+// requestedNames returns the DNS names and common name requested by the
+// certificate template.
+func requestedNames(template *x509.Certificate) []string {
+	names := append([]string(nil), template.DNSNames...)
+	if template.Subject.CommonName != "" {
+		names = append(names, template.Subject.CommonName)
+	}
+	return names
+}
+
+// checkDomainPolicy enforces the AllowedDomains and DeniedDomains of the
+// issuer. A requested wildcard is checked through its base name as well: it
+// is denied if a denied domain is its base name, a parent of it, or a name
+// the wildcard matches, so "*.example.com" is denied by "evil.example.com".
+// A violation is a permanent error, since retrying the same request cannot
+// succeed.
+func checkDomainPolicy(issuerSpec *CFMTLSIssuerapi.IssuerSpec, template *x509.Certificate) error {
+	if len(issuerSpec.AllowedDomains) == 0 && len(issuerSpec.DeniedDomains) == 0 {
+		return nil
+	}
+
+	for _, name := range requestedNames(template) {
+		if matchesAnyDomain(name, issuerSpec.DeniedDomains) || wildcardCoversAnyDomain(name, issuerSpec.DeniedDomains) {
+			return policyViolation(fmt.Errorf("%q is denied by the issuer's deniedDomains", name))
+		}
+		if len(issuerSpec.AllowedDomains) > 0 && !matchesAnyDomain(name, issuerSpec.AllowedDomains) {
+			return policyViolation(fmt.Errorf("%q is not in the issuer's allowedDomains", name))
+		}
+	}
+
+	return nil
+}
+
+// checkNamespaceSelector enforces the NamespaceSelector of a
+// CFMTLSClusterIssuer against the labels of the request's namespace.
+// Cluster scoped requests never match a selector.
+func (o *Issuer) checkNamespaceSelector(ctx context.Context, issuerObject issuerapi.Issuer, namespace string) error {
+	clusterIssuer, ok := issuerObject.(*CFMTLSIssuerapi.CFMTLSClusterIssuer)
+	if !ok || clusterIssuer.Spec.NamespaceSelector == nil {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(clusterIssuer.Spec.NamespaceSelector)
+	if err != nil {
+		return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("invalid namespaceSelector: %w", err))}
+	}
+
+	if namespace == "" {
+		return policyViolation(errors.New("cluster scoped requests are not allowed by the issuer's namespaceSelector"))
+	}
+
+	var ns corev1.Namespace
+	if err := o.client.Get(ctx, types.NamespacedName{Name: namespace}, &ns); err != nil {
+		return fmt.Errorf("failed to get namespace %q: %w", namespace, err)
+	}
+
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return policyViolation(fmt.Errorf("namespace %q does not match the issuer's namespaceSelector", namespace))
+	}
+
+	return nil
+}
+
+// subjectNames returns the common name and all subject alternative names
+// requested by the certificate template.
+func subjectNames(template *x509.Certificate) []string {
+	names := requestedNames(template)
+	names = append(names, template.EmailAddresses...)
+	for _, ip := range template.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range template.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+// checkSubjectPatterns enforces the SubjectPatterns of the issuer. Every
+// name must fully match at least one of the patterns.
+func checkSubjectPatterns(issuerSpec *CFMTLSIssuerapi.IssuerSpec, template *x509.Certificate) error {
+	if len(issuerSpec.SubjectPatterns) == 0 {
+		return nil
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(issuerSpec.SubjectPatterns))
+	for _, pattern := range issuerSpec.SubjectPatterns {
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("invalid subject pattern %q: %w", pattern, err))}
+		}
+		patterns = append(patterns, re)
+	}
+
+	for _, name := range subjectNames(template) {
+		matched := false
+		for _, re := range patterns {
+			if re.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return policyViolation(fmt.Errorf("%q does not match any of the issuer's subjectPatterns %q", name, issuerSpec.SubjectPatterns))
+		}
+	}
+
+	return nil
+}
+
+// issuerMode returns the issuance mode of the issuer.
+func issuerMode(issuerSpec *CFMTLSIssuerapi.IssuerSpec) CFMTLSIssuerapi.IssuerMode {
+	if issuerSpec.Mode != "" {
+		return issuerSpec.Mode
+	}
+	return CFMTLSIssuerapi.IssuerModeOriginCA
+}
+
+// checkFIPSRequest refuses CSRs with keys or signatures that are not FIPS
+// approved, if the FIPS mode is enabled.
+func checkFIPSRequest(csrPEM []byte) error {
+	if !fips.Enabled() {
+		return nil
+	}
+	csr, err := pki.DecodeX509CertificateRequestBytes(csrPEM)
+	if err != nil {
+		return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidRequest, fmt.Errorf("failed to decode CSR: %w", err))}
+	}
+	if err := fips.CheckCertificateRequest(csr); err != nil {
+		return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidRequest, fmt.Errorf("CSR is not allowed in FIPS mode: %w", err))}
+	}
+	return nil
+}
+
+func policyViolation(err error) error {
+	return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonPolicyViolation, err)}
+}
+
+func matchesAnyDomain(name string, domains []string) bool {
+	for _, domain := range domains {
+		if matchesDomain(name, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func wildcardCoversAnyDomain(name string, domains []string) bool {
+	for _, domain := range domains {
+		if wildcardCoversDomain(name, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardCoversDomain reports whether name is a wildcard that matches
+// domain, i.e. whether domain is a single label below the base name of the
+// wildcard. Wildcard domains only match deeper names, which the wildcard
+// does not cover.
+func wildcardCoversDomain(name, domain string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	base, ok := strings.CutPrefix(name, "*.")
+	if !ok {
+		return false
+	}
+	label, ok := strings.CutSuffix(domain, "."+base)
+	return ok && label != "" && !strings.Contains(label, ".")
+}
+
+// matchesDomain reports whether name is domain or one of its subdomains. A
+// domain of the form "*.example.com" only matches subdomains.
+func matchesDomain(name, domain string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+
+	if suffix, ok := strings.CutPrefix(domain, "*."); ok {
+		return strings.HasSuffix(name, "."+suffix)
+	}
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
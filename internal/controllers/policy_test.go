@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/x509"
+	"testing"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestIssuerMode(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CFMTLSIssuerapi.IssuerSpec
+		want CFMTLSIssuerapi.IssuerMode
+	}{
+		{name: "unset", want: CFMTLSIssuerapi.IssuerModeOriginCA},
+		{name: "explicit mode", spec: CFMTLSIssuerapi.IssuerSpec{Mode: CFMTLSIssuerapi.IssuerModeOriginCA}, want: CFMTLSIssuerapi.IssuerModeOriginCA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := issuerMode(&tt.spec); got != tt.want {
+				t.Errorf("issuerMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDomainPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		denied   []string
+		dnsNames []string
+		wantErr  bool
+	}{
+		{name: "no policy", dnsNames: []string{"evil.example.com"}},
+		{name: "allowed", allowed: []string{"example.com"}, dnsNames: []string{"www.example.com"}},
+		{name: "not allowed", allowed: []string{"example.com"}, dnsNames: []string{"www.example.org"}, wantErr: true},
+		{name: "allowed wildcard", allowed: []string{"*.example.com"}, dnsNames: []string{"*.example.com"}},
+		{name: "denied", denied: []string{"evil.example.com"}, dnsNames: []string{"evil.example.com"}, wantErr: true},
+		{name: "denied subdomain", denied: []string{"evil.example.com"}, dnsNames: []string{"www.evil.example.com"}, wantErr: true},
+		{name: "not denied", denied: []string{"evil.example.com"}, dnsNames: []string{"www.example.com"}},
+		{name: "wildcard covering a denied domain", denied: []string{"evil.example.com"}, dnsNames: []string{"*.example.com"}, wantErr: true},
+		{name: "wildcard on a denied base name", denied: []string{"example.com"}, dnsNames: []string{"*.example.com"}, wantErr: true},
+		{name: "wildcard below a denied wildcard", denied: []string{"*.example.com"}, dnsNames: []string{"*.www.example.com"}, wantErr: true},
+		{name: "wildcard not covering a deeper denied domain", denied: []string{"a.evil.example.com"}, dnsNames: []string{"*.example.com"}},
+		{name: "wildcard not covering a denied domain elsewhere", denied: []string{"evil.example.org"}, dnsNames: []string{"*.example.com"}},
+		{name: "wildcard covering a denied domain despite allowlist", allowed: []string{"example.com"}, denied: []string{"EVIL.example.com."}, dnsNames: []string{"*.example.com"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &CFMTLSIssuerapi.IssuerSpec{AllowedDomains: tt.allowed, DeniedDomains: tt.denied}
+			err := checkDomainPolicy(spec, &x509.Certificate{DNSNames: tt.dnsNames})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkDomainPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && errorReason(err) != CFMTLSIssuerapi.ReasonPolicyViolation {
+				t.Errorf("errorReason() = %q, want %q", errorReason(err), CFMTLSIssuerapi.ReasonPolicyViolation)
+			}
+		})
+	}
+}
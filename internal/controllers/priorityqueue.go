@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+
+// noExpiry is the priority of requests that are not owned by a Certificate.
+// They are signed after those that are.
+var noExpiry = time.Unix(math.MaxInt32, 0)
+
+// newExpiryQueue returns a work queue for the CertificateRequest controller
+// that hands out the requests of the Certificates that expire first before
+// the others, so that a backlog of requests, e.g. after a mass renewal, does
+// not let live certificates lapse.
+func (o *Issuer) newExpiryQueue(name string, rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) workqueue.TypedRateLimitingInterface[reconcile.Request] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(rateLimiter, workqueue.TypedRateLimitingQueueConfig[reconcile.Request]{
+		Name: name,
+		DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[reconcile.Request]{
+			Name: name,
+			Queue: workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[reconcile.Request]{
+				Name:  name,
+				Queue: newPriorityQueue(o.certificateExpiry),
+			}),
+		}),
+	})
+}
+
+// certificateExpiry returns the expiry of the certificate of the Certificate
+// that owns the given CertificateRequest. Certificates without a certificate
+// yet are as urgent as expired ones. It only reads from the cache, as it is
+// called with the lock of the work queue held.
+func (o *Issuer) certificateExpiry(req reconcile.Request) time.Time {
+	ctx := context.Background()
+
+	var cr cmapi.CertificateRequest
+	if err := o.client.Get(ctx, req.NamespacedName, &cr); err != nil {
+		return noExpiry
+	}
+	owner := metav1.GetControllerOf(&cr)
+	if owner == nil || owner.Kind != cmapi.CertificateKind {
+		return noExpiry
+	}
+
+	var certificate cmapi.Certificate
+	if err := o.client.Get(ctx, types.NamespacedName{Namespace: cr.Namespace, Name: owner.Name}, &certificate); err != nil {
+		return noExpiry
+	}
+	if certificate.Status.NotAfter == nil {
+		return time.Time{}
+	}
+	return certificate.Status.NotAfter.Time
+}
+
+// priorityQueue is a workqueue.Queue that pops the item with the earliest
+// deadline first, and items with the same deadline in the order they were
+// pushed.
+type priorityQueue struct {
+	deadline func(reconcile.Request) time.Time
+	items    priorityItems
+	index    map[reconcile.Request]*priorityItem
+	seq      uint64
+}
+
+type priorityItem struct {
+	request  reconcile.Request
+	deadline time.Time
+	seq      uint64
+	index    int
+}
+
+func newPriorityQueue(deadline func(reconcile.Request) time.Time) *priorityQueue {
+	return &priorityQueue{
+		deadline: deadline,
+		index:    map[reconcile.Request]*priorityItem{},
+	}
+}
+
+// Touch implements workqueue.Queue. The deadline of an item that is added
+// again is looked up again, as its Certificate may have changed.
+func (q *priorityQueue) Touch(request reconcile.Request) {
+	item, ok := q.index[request]
+	if !ok {
+		return
+	}
+	item.deadline = q.deadline(request)
+	heap.Fix(&q.items, item.index)
+}
+
+// Push implements workqueue.Queue.
+func (q *priorityQueue) Push(request reconcile.Request) {
+	q.seq++
+	item := &priorityItem{request: request, deadline: q.deadline(request), seq: q.seq}
+	q.index[request] = item
+	heap.Push(&q.items, item)
+}
+
+// Len implements workqueue.Queue.
+func (q *priorityQueue) Len() int {
+	return len(q.items)
+}
+
+// Pop implements workqueue.Queue.
+func (q *priorityQueue) Pop() reconcile.Request {
+	item := heap.Pop(&q.items).(*priorityItem)
+	delete(q.index, item.request)
+	return item.request
+}
+
+// priorityItems implements heap.Interface.
+type priorityItems []*priorityItem
+
+func (h priorityItems) Len() int { return len(h) }
+
+func (h priorityItems) Less(i, j int) bool {
+	if !h[i].deadline.Equal(h[j].deadline) {
+		return h[i].deadline.Before(h[j].deadline)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityItems) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityItems) Push(x any) {
+	item := x.(*priorityItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *priorityItems) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
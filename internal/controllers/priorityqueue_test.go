@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	now := time.Now()
+	deadlines := map[string]time.Time{
+		"later":    now.Add(48 * time.Hour),
+		"soon":     now.Add(time.Hour),
+		"expired":  now.Add(-time.Hour),
+		"unowned":  noExpiry,
+		"unowned2": noExpiry,
+	}
+	request := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+	}
+
+	q := newPriorityQueue(func(req reconcile.Request) time.Time { return deadlines[req.Name] })
+	for _, name := range []string{"unowned", "later", "soon", "unowned2", "expired"} {
+		q.Push(request(name))
+	}
+
+	// The Certificate of "later" was not renewed in time.
+	deadlines["later"] = now.Add(-2 * time.Hour)
+	q.Touch(request("later"))
+
+	var got []string
+	for q.Len() > 0 {
+		got = append(got, q.Pop().Name)
+	}
+	want := []string{"later", "expired", "soon", "unowned", "unowned2"}
+	if len(got) != len(want) {
+		t.Fatalf("popped %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("popped %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+// pendingRequestsTimeout bounds the listing of the CertificateRequests when
+// the metrics are scraped. They are read from the cache.
+const pendingRequestsTimeout = 5 * time.Second
+
+// controllerName returns the name of the issuer-lib controller of the given
+// kind. It is the "controller" and "name" label of the controller-runtime
+// controller and workqueue metrics, so the request controllers are prefixed
+// to tell them apart from other issuers running in the same manager.
+func controllerName(gvk schema.GroupVersionKind) string {
+	name := strings.ToLower(gvk.Kind)
+	if strings.HasPrefix(name, "cfmtls") {
+		return name
+	}
+	return "cfmtls-" + name
+}
+
+// pendingRequests returns the number of CertificateRequests of this shard
+// that are waiting to be signed, by issuer.
+func (o *Issuer) pendingRequests() []metrics.IssuerCount {
+	ctx, cancel := context.WithTimeout(context.Background(), pendingRequestsTimeout)
+	defer cancel()
+
+	var list cmapi.CertificateRequestList
+	if err := o.client.List(ctx, &list); err != nil {
+		return nil
+	}
+
+	counts := map[metrics.IssuerCount]int{}
+	for i := range list.Items {
+		cr := &list.Items[i]
+		ref := cr.Spec.IssuerRef
+		if ref.Group != CFMTLSIssuerapi.GroupVersion.Group || !certificateRequestPending(cr) {
+			continue
+		}
+
+		key := types.NamespacedName{Name: ref.Name}
+		switch ref.Kind {
+		case "CFMTLSIssuer":
+			key.Namespace = cr.Namespace
+		case "CFMTLSClusterIssuer":
+			if !o.clusterScoped() {
+				continue
+			}
+		default:
+			continue
+		}
+		if !o.ownsIssuer(key) {
+			continue
+		}
+
+		issuer := key.Name
+		if key.Namespace != "" {
+			issuer = key.String()
+		}
+		counts[metrics.IssuerCount{IssuerKind: ref.Kind, Issuer: issuer}]++
+	}
+
+	result := make([]metrics.IssuerCount, 0, len(counts))
+	for issuer, count := range counts {
+		issuer.Count = count
+		result = append(result, issuer)
+	}
+	return result
+}
+
+// certificateRequestPending reports whether the given CertificateRequest has
+// neither been signed nor failed or been denied.
+func certificateRequestPending(cr *cmapi.CertificateRequest) bool {
+	for _, condition := range cr.Status.Conditions {
+		if condition.Type == cmapi.CertificateRequestConditionReady {
+			return condition.Status != cmmeta.ConditionTrue && condition.Reason == cmapi.CertificateRequestReasonPending
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+func TestPendingRequests(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(name, kind, issuer, group string, conditions ...cmapi.CertificateRequestCondition) client.Object {
+		return &cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: cmapi.CertificateRequestSpec{
+				IssuerRef: cmmeta.ObjectReference{Group: group, Kind: kind, Name: issuer},
+			},
+			Status: cmapi.CertificateRequestStatus{Conditions: conditions},
+		}
+	}
+	group := CFMTLSIssuerapi.GroupVersion.Group
+	pending := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonPending}
+	issued := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionTrue, Reason: cmapi.CertificateRequestReasonIssued}
+	failed := cmapi.CertificateRequestCondition{Type: cmapi.CertificateRequestConditionReady, Status: cmmeta.ConditionFalse, Reason: cmapi.CertificateRequestReasonFailed}
+
+	o := &Issuer{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		request("new", "CFMTLSIssuer", "issuer", group),
+		request("pending", "CFMTLSIssuer", "issuer", group, pending),
+		request("issued", "CFMTLSIssuer", "issuer", group, issued),
+		request("failed", "CFMTLSIssuer", "issuer", group, failed),
+		request("cluster", "CFMTLSClusterIssuer", "cluster-issuer", group, pending),
+		request("other", "Issuer", "issuer", "cert-manager.io", pending),
+	).Build()}
+
+	got := o.pendingRequests()
+	sort.Slice(got, func(i, j int) bool { return got[i].Issuer < got[j].Issuer })
+	want := []metrics.IssuerCount{
+		{IssuerKind: "CFMTLSClusterIssuer", Issuer: "cluster-issuer", Count: 1},
+		{IssuerKind: "CFMTLSIssuer", Issuer: "default/issuer", Count: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pendingRequests() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+)
+
+// Headers of the Cloudflare API describing the rate limit of the token, e.g.
+//
+//	Ratelimit: "default";r=1199;t=299
+//	Ratelimit-Policy: "default";q=1200;w=300
+//
+// r is the remaining quota, t the seconds until it resets, q the quota and w
+// the window in seconds.
+const (
+	rateLimitHeader       = "Ratelimit"
+	rateLimitPolicyHeader = "Ratelimit-Policy"
+	retryAfterHeader      = "Retry-After"
+)
+
+// rateLimit is the rate limit budget reported by a response.
+type rateLimit struct {
+	// limit is the quota of the window, or -1 if not reported.
+	limit     int64
+	remaining int64
+	reset     time.Time
+}
+
+// parseRateLimit returns the rate limit budget reported by the given
+// response, received at now. A 429 response without rate limit headers
+// exhausts the budget until its Retry-After.
+func parseRateLimit(resp *http.Response, now time.Time) (rateLimit, bool) {
+	result := rateLimit{limit: -1}
+	if params, ok := parseRateLimitHeader(resp.Header.Get(rateLimitPolicyHeader)); ok {
+		if q, ok := params["q"]; ok {
+			result.limit = q
+		}
+	}
+
+	params, ok := parseRateLimitHeader(resp.Header.Get(rateLimitHeader))
+	if r, hasR := params["r"]; ok && hasR {
+		result.remaining = r
+		result.reset = now.Add(time.Duration(params["t"]) * time.Second)
+		return result, true
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, err := strconv.ParseInt(resp.Header.Get(retryAfterHeader), 10, 64)
+		if err != nil {
+			retryAfter = 0
+		}
+		result.reset = now.Add(time.Duration(retryAfter) * time.Second)
+		return result, true
+	}
+	return rateLimit{}, false
+}
+
+// parseRateLimitHeader returns the integer parameters of the first policy in
+// a Ratelimit or Ratelimit-Policy header.
+func parseRateLimitHeader(value string) (map[string]int64, bool) {
+	if value == "" {
+		return nil, false
+	}
+	policy, _, _ := strings.Cut(value, ",")
+	params := map[string]int64{}
+	// The first item is the name of the policy.
+	for _, param := range strings.Split(policy, ";")[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		params[key] = n
+	}
+	return params, true
+}
+
+// observeRateLimit updates the rate limit metrics of the issuer from the
+// headers of a Cloudflare API response received at now, and records a
+// Warning event on the issuer if it was throttled or used up its budget.
+func (t *metricsTransport) observeRateLimit(req *http.Request, resp *http.Response, now time.Time) {
+	limit, ok := parseRateLimit(resp, now)
+	if !ok {
+		return
+	}
+	metrics.RecordCloudflareRateLimit(t.issuerKind, t.issuer, limit.limit, limit.remaining, limit.reset)
+
+	if t.recorder == nil {
+		return
+	}
+	reset := limit.reset.UTC().Format(time.RFC3339)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		t.recorder.Eventf(t.issuerObject, corev1.EventTypeWarning, EventReasonRateLimited,
+			"Cloudflare rate limited a request to %s, retrying after %s", cloudflareEndpoint(req.URL.Path), reset)
+	case limit.remaining == 0:
+		t.recorder.Eventf(t.issuerObject, corev1.EventTypeWarning, EventReasonQuotaExhausted,
+			"The Cloudflare API rate limit of the API token is used up until %s, further requests will be rate limited", reset)
+	}
+}
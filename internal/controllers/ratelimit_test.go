@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/record"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		statusCode int
+		header     map[string]string
+		want       rateLimit
+		wantOK     bool
+	}{
+		{
+			name:       "no headers",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "budget and policy",
+			statusCode: http.StatusOK,
+			header: map[string]string{
+				rateLimitHeader:       `"default";r=1199;t=299`,
+				rateLimitPolicyHeader: `"default";q=1200;w=300`,
+			},
+			want:   rateLimit{limit: 1200, remaining: 1199, reset: now.Add(299 * time.Second)},
+			wantOK: true,
+		},
+		{
+			name:       "budget without policy",
+			statusCode: http.StatusOK,
+			header:     map[string]string{rateLimitHeader: `"default";r=10;t=5, "burst";r=1;t=1`},
+			want:       rateLimit{limit: -1, remaining: 10, reset: now.Add(5 * time.Second)},
+			wantOK:     true,
+		},
+		{
+			name:       "too many requests",
+			statusCode: http.StatusTooManyRequests,
+			header:     map[string]string{retryAfterHeader: "60"},
+			want:       rateLimit{limit: -1, reset: now.Add(time.Minute)},
+			wantOK:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.statusCode, Header: http.Header{}}
+			for key, value := range tt.header {
+				resp.Header.Set(key, value)
+			}
+
+			got, ok := parseRateLimit(resp, now)
+			if ok != tt.wantOK {
+				t.Fatalf("parseRateLimit() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if got.limit != tt.want.limit || got.remaining != tt.want.remaining || !got.reset.Equal(tt.want.reset) {
+				t.Errorf("parseRateLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveRateLimitEvents(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     map[string]string
+		wantReason string
+	}{
+		{
+			name:       "budget left",
+			statusCode: http.StatusOK,
+			header:     map[string]string{rateLimitHeader: `"default";r=10;t=5`},
+		},
+		{
+			name:       "budget used up",
+			statusCode: http.StatusOK,
+			header:     map[string]string{rateLimitHeader: `"default";r=0;t=5`},
+			wantReason: EventReasonQuotaExhausted,
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			header:     map[string]string{retryAfterHeader: "60"},
+			wantReason: EventReasonRateLimited,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			transport := &metricsTransport{
+				issuerKind:   "CFMTLSIssuer",
+				issuer:       "default/issuer",
+				issuerObject: &CFMTLSIssuerapi.CFMTLSIssuer{},
+				recorder:     recorder,
+			}
+			req, err := http.NewRequest(http.MethodPost, "https://api.cloudflare.com/client/v4/zones/zone/client_certificates", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{StatusCode: tt.statusCode, Header: http.Header{}, Request: req}
+			for key, value := range tt.header {
+				resp.Header.Set(key, value)
+			}
+
+			transport.observeRateLimit(req, resp, time.Now())
+			close(recorder.Events)
+
+			event := <-recorder.Events
+			if tt.wantReason == "" {
+				if event != "" {
+					t.Errorf("recorded event %q, want none", event)
+				}
+				return
+			}
+			if !strings.HasPrefix(event, "Warning "+tt.wantReason+" ") {
+				t.Errorf("recorded event %q, want a Warning %s event", event, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+const (
+	// readinessTimeout bounds the request to the Cloudflare API made by the
+	// readiness check.
+	readinessTimeout = 5 * time.Second
+	// readinessCacheDuration is how long the result of the Cloudflare
+	// reachability check is reused, so that frequent probes do not each
+	// reach out to Cloudflare.
+	readinessCacheDuration = 30 * time.Second
+)
+
+// ReadinessCheck returns a readiness check that fails while the issuers are
+// checked after this replica became the leader, while the Cloudflare API at
+// apiURL cannot be reached and, if requireReadyIssuer is set, while none of
+// the issuers served by the controller is Ready. Any HTTP response
+// counts as reachable, as the check does not authenticate. An empty apiURL
+// skips the reachability check.
+//
+// It must be called after SetupWithManager.
+func (o *Issuer) ReadinessCheck(apiURL string, requireReadyIssuer bool) healthz.Checker {
+	reachable := &reachabilityCheck{
+		url:    apiURL,
+		client: &http.Client{Timeout: readinessTimeout},
+	}
+	return func(req *http.Request) error {
+		if o.warmUp.running() {
+			return errors.New("issuers are being checked after becoming the leader")
+		}
+		if apiURL != "" {
+			if err := reachable.check(req); err != nil {
+				return err
+			}
+		}
+		if requireReadyIssuer {
+			return o.anyIssuerReady(req)
+		}
+		return nil
+	}
+}
+
+// reachabilityCheck checks that an URL can be reached, caching the result
+// for readinessCacheDuration.
+type reachabilityCheck struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	lastErr   error
+}
+
+func (c *reachabilityCheck) check(req *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < readinessCacheDuration {
+		return c.lastErr
+	}
+
+	c.lastErr = nil
+	probe, err := http.NewRequestWithContext(req.Context(), http.MethodHead, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid Cloudflare API URL: %w", err)
+	}
+	resp, err := c.client.Do(probe)
+	if err != nil {
+		c.lastErr = fmt.Errorf("Cloudflare API is unreachable: %w", err)
+	} else {
+		resp.Body.Close()
+	}
+	c.checkedAt = time.Now()
+	return c.lastErr
+}
+
+// anyIssuerReady returns an error unless at least one of the issuers served
+// by the controller is Ready.
+func (o *Issuer) anyIssuerReady(req *http.Request) error {
+	if o.client == nil {
+		return errors.New("controllers are not set up")
+	}
+
+	var issuers CFMTLSIssuerapi.CFMTLSIssuerList
+	if err := o.client.List(req.Context(), &issuers); err != nil {
+		return fmt.Errorf("failed to list CFMTLSIssuers: %w", err)
+	}
+	for i := range issuers.Items {
+		if issuerReady(&issuers.Items[i]) {
+			return nil
+		}
+	}
+
+	if o.clusterScoped() {
+		var clusterIssuers CFMTLSIssuerapi.CFMTLSClusterIssuerList
+		if err := o.client.List(req.Context(), &clusterIssuers); err != nil {
+			return fmt.Errorf("failed to list CFMTLSClusterIssuers: %w", err)
+		}
+		for i := range clusterIssuers.Items {
+			if issuerReady(&clusterIssuers.Items[i]) {
+				return nil
+			}
+		}
+	}
+	return errors.New("no issuer is Ready")
+}
+
+// issuerReady reports whether the Ready condition of the issuer is true.
+func issuerReady(issuerObject issuerapi.Issuer) bool {
+	status := issuerObject.GetStatus()
+	if status == nil {
+		return false
+	}
+	ready := conditions.GetIssuerStatusCondition(status.Conditions, cmapi.IssuerConditionReady)
+	return ready != nil && ready.Status == cmmeta.ConditionTrue
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestReadinessCheck(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		// The check does not authenticate, so Cloudflare rejects it.
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	readyIssuer := func(status cmmeta.ConditionStatus) client.Object {
+		issuer := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"}}
+		issuer.Status.Conditions = []cmapi.IssuerCondition{{Type: cmapi.IssuerConditionReady, Status: status}}
+		return issuer
+	}
+
+	tests := []struct {
+		name               string
+		apiURL             string
+		requireReadyIssuer bool
+		objects            []client.Object
+		wantErr            bool
+	}{
+		{
+			name:   "Cloudflare reachable",
+			apiURL: server.URL,
+		},
+		{
+			name:    "Cloudflare unreachable",
+			apiURL:  "http://127.0.0.1:0",
+			wantErr: true,
+		},
+		{
+			name:               "no issuer",
+			requireReadyIssuer: true,
+			wantErr:            true,
+		},
+		{
+			name:               "issuer not ready",
+			requireReadyIssuer: true,
+			objects:            []client.Object{readyIssuer(cmmeta.ConditionFalse)},
+			wantErr:            true,
+		},
+		{
+			name:               "issuer ready",
+			apiURL:             server.URL,
+			requireReadyIssuer: true,
+			objects:            []client.Object{readyIssuer(cmmeta.ConditionTrue)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).Build()}
+			check := o.ReadinessCheck(tt.apiURL, tt.requireReadyIssuer)
+			req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+			err := check(req)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("check() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			// The reachability result is cached.
+			before := requests
+			if err2 := check(req); (err2 != nil) != (err != nil) {
+				t.Fatalf("second check() error = %v, want %v", err2, err)
+			}
+			if requests != before {
+				t.Errorf("second check() sent %d requests to Cloudflare, want none", requests-before)
+			}
+		})
+	}
+}
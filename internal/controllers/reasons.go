@@ -0,0 +1,155 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// reasonError annotates an error with one of the condition reasons defined
+// in the API package. It wraps the original error, so issuer-lib still sees
+// any PermanentError or PendingError underneath.
+type reasonError struct {
+	Reason string
+	Err    error
+}
+
+func (e reasonError) Error() string {
+	return e.Err.Error()
+}
+
+func (e reasonError) Unwrap() error {
+	return e.Err
+}
+
+// withReason annotates err with reason. A nil err stays nil.
+func withReason(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return reasonError{Reason: reason, Err: err}
+}
+
+// errorReason returns the condition reason of err, or ReasonInternalError
+// if err was not annotated with one.
+func errorReason(err error) string {
+	var target reasonError
+	if errors.As(err, &target) {
+		return target.Reason
+	}
+	return CFMTLSIssuerapi.ReasonInternalError
+}
+
+// reasonForStatusCode maps a Cloudflare API response status to a condition
+// reason.
+func reasonForStatusCode(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return CFMTLSIssuerapi.ReasonTokenInvalid
+	case statusCode == http.StatusNotFound:
+		return CFMTLSIssuerapi.ReasonZoneNotFound
+	case statusCode == http.StatusTooManyRequests:
+		return CFMTLSIssuerapi.ReasonQuotaExceeded
+	case statusCode >= http.StatusInternalServerError:
+		return CFMTLSIssuerapi.ReasonAPIUnreachable
+	default:
+		return CFMTLSIssuerapi.ReasonAPIError
+	}
+}
+
+// requestError annotates an error sending a request to the Cloudflare API.
+// Requests rejected by the circuit breaker were not sent at all, and those
+// rejected by the pins of the issuer may have been intercepted.
+func requestError(err error) error {
+	if errors.Is(err, errCircuitOpen) {
+		return withReason(CFMTLSIssuerapi.ReasonUpstreamUnavailable, err)
+	}
+	if errors.Is(err, errPinMismatch) {
+		return withReason(CFMTLSIssuerapi.ReasonTLSPinMismatch, fmt.Errorf("failed to send request to Cloudflare: %w", err))
+	}
+	return withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, fmt.Errorf("failed to send request to Cloudflare: %w", err))
+}
+
+// signingError classifies a failed response of the Cloudflare API to a
+// signing request. Validation errors of the request, e.g. an invalid CSR or
+// hostname, are permanent, as sending the request again cannot succeed.
+// Throttling, server errors and problems with the credentials or the zone
+// may resolve, so those requests are retried.
+func signingError(resp *http.Response, body []byte) error {
+	err := fmt.Errorf("Cloudflare API responded with status: %d", resp.StatusCode)
+	if messages := cloudflareErrorMessages(body); messages != "" {
+		err = fmt.Errorf("%w: %s", err, messages)
+	}
+	err = withCFRay(err, resp)
+
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidRequest, err)}
+	}
+	return withReason(reasonForStatusCode(resp.StatusCode), err)
+}
+
+// cloudflareErrorMessages returns the errors listed in the body of a failed
+// Cloudflare API response, e.g. "1002: Invalid CSR", or "" if there are
+// none.
+func cloudflareErrorMessages(body []byte) string {
+	var response struct {
+		Errors []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return ""
+	}
+	messages := make([]string, 0, len(response.Errors))
+	for _, e := range response.Errors {
+		messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// cloudflareCertificateNotFound reports whether the body of a failed
+// Cloudflare API response says that the requested certificate does not
+// exist. Errors that may be about the zone instead, e.g. "Could not route
+// to ..., perhaps your object identifier is invalid?", do not count.
+func cloudflareCertificateNotFound(body []byte) bool {
+	var response struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false
+	}
+	for _, e := range response.Errors {
+		message := strings.ToLower(e.Message)
+		if strings.Contains(message, "certificate") &&
+			(strings.Contains(message, "not found") || strings.Contains(message, "does not exist")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestSigningError(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		body          string
+		wantReason    string
+		wantPermanent bool
+		wantMessage   string
+	}{
+		{
+			name:          "invalid CSR",
+			statusCode:    http.StatusBadRequest,
+			body:          `{"success":false,"errors":[{"code":1002,"message":"Invalid CSR"}]}`,
+			wantReason:    CFMTLSIssuerapi.ReasonInvalidRequest,
+			wantPermanent: true,
+			wantMessage:   "Cloudflare API responded with status: 400: 1002: Invalid CSR (cf-ray 8f1c-AMS)",
+		},
+		{
+			name:          "unprocessable",
+			statusCode:    http.StatusUnprocessableEntity,
+			body:          "not JSON",
+			wantReason:    CFMTLSIssuerapi.ReasonInvalidRequest,
+			wantPermanent: true,
+			wantMessage:   "Cloudflare API responded with status: 422 (cf-ray 8f1c-AMS)",
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			wantReason: CFMTLSIssuerapi.ReasonQuotaExceeded,
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusBadGateway,
+			wantReason: CFMTLSIssuerapi.ReasonAPIUnreachable,
+		},
+		{
+			name:       "token rejected",
+			statusCode: http.StatusForbidden,
+			body:       `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`,
+			wantReason: CFMTLSIssuerapi.ReasonTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.statusCode, Header: http.Header{}}
+			resp.Header.Set(cfRayHeader, "8f1c-AMS")
+
+			err := signingError(resp, []byte(tt.body))
+			if got := errorReason(err); got != tt.wantReason {
+				t.Errorf("signingError() reason = %s, want %s", got, tt.wantReason)
+			}
+			if got := errors.As(err, &signer.PermanentError{}); got != tt.wantPermanent {
+				t.Errorf("signingError() permanent = %v, want %v", got, tt.wantPermanent)
+			}
+			if tt.wantMessage != "" && err.Error() != tt.wantMessage {
+				t.Errorf("signingError() = %q, want %q", err, tt.wantMessage)
+			}
+			if !strings.Contains(err.Error(), "8f1c-AMS") {
+				t.Errorf("signingError() = %q, want the cf-ray ID", err)
+			}
+		})
+	}
+}
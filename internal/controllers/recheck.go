@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// checkSchedulerPeriod is how often the check scheduler looks for issuers
+// that are due for a health check.
+const checkSchedulerPeriod = 10 * time.Second
+
+// checkScheduler re-runs the health check of issuers that set
+// spec.checkInterval. issuer-lib only checks issuers when they change, so the
+// scheduler remembers when each issuer was last checked and enqueues the ones
+// that are due through a channel watched by the issuer controllers.
+type checkScheduler struct {
+	client client.Client
+
+	mu        sync.Mutex
+	lastCheck map[types.UID]time.Time
+
+	issuers        chan event.GenericEvent
+	clusterIssuers chan event.GenericEvent
+	// clusterScoped is false if the controllers are restricted to
+	// namespaces, in which case no controller reads clusterIssuers.
+	clusterScoped bool
+}
+
+func newCheckScheduler(c client.Client, clusterScoped bool) *checkScheduler {
+	return &checkScheduler{
+		client:         c,
+		lastCheck:      map[types.UID]time.Time{},
+		issuers:        make(chan event.GenericEvent),
+		clusterIssuers: make(chan event.GenericEvent),
+		clusterScoped:  clusterScoped,
+	}
+}
+
+// checked records that the issuer was checked at now.
+func (s *checkScheduler) checked(issuerObject issuerapi.Issuer, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCheck[issuerObject.GetUID()] = now
+}
+
+// checkedSince reports whether the issuer with the given UID was checked
+// after start.
+func (s *checkScheduler) checkedSince(uid types.UID, start time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.lastCheck[uid]
+	return ok && !last.Before(start)
+}
+
+// due reports whether the issuer should be checked again at now.
+func (s *checkScheduler) due(issuerObject issuerapi.Issuer, spec *CFMTLSIssuerapi.IssuerSpec, now time.Time) bool {
+	if spec.CheckInterval == nil || spec.CheckInterval.Duration <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.lastCheck[issuerObject.GetUID()]
+	return !ok || now.Sub(last) >= spec.CheckInterval.Duration
+}
+
+// setupWatch adds the channel of the given issuer kind as a source of the
+// issuer controller. It is used as the PreSetupWithManager hook of the
+// issuer-lib controllers, which is also called for the request controllers.
+func (s *checkScheduler) setupWatch(_ context.Context, gvk schema.GroupVersionKind, _ ctrl.Manager, b *builder.Builder) error {
+	switch gvk.Kind {
+	case "CFMTLSIssuer":
+		b.WatchesRawSource(source.Channel(s.issuers, &handler.EnqueueRequestForObject{}))
+	case "CFMTLSClusterIssuer":
+		b.WatchesRawSource(source.Channel(s.clusterIssuers, &handler.EnqueueRequestForObject{}))
+	}
+	return nil
+}
+
+// Start implements manager.Runnable.
+func (s *checkScheduler) Start(ctx context.Context) error {
+	ticker := time.NewTicker(checkSchedulerPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.enqueueDue(ctx)
+		}
+	}
+}
+
+// enqueueDue enqueues all issuers that are due for a health check.
+func (s *checkScheduler) enqueueDue(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("checkScheduler")
+	now := time.Now()
+
+	var issuers CFMTLSIssuerapi.CFMTLSIssuerList
+	if err := s.client.List(ctx, &issuers); err != nil {
+		logger.Error(err, "failed to list CFMTLSIssuers")
+	}
+	for i := range issuers.Items {
+		issuer := &issuers.Items[i]
+		if s.due(issuer, &issuer.Spec, now) && !s.send(ctx, s.issuers, issuer) {
+			return
+		}
+	}
+
+	if !s.clusterScoped {
+		return
+	}
+
+	var clusterIssuers CFMTLSIssuerapi.CFMTLSClusterIssuerList
+	if err := s.client.List(ctx, &clusterIssuers); err != nil {
+		logger.Error(err, "failed to list CFMTLSClusterIssuers")
+	}
+	for i := range clusterIssuers.Items {
+		issuer := &clusterIssuers.Items[i]
+		if s.due(issuer, &issuer.Spec, now) && !s.send(ctx, s.clusterIssuers, issuer) {
+			return
+		}
+	}
+}
+
+// send enqueues the object, returning false if ctx was cancelled first.
+func (s *checkScheduler) send(ctx context.Context, ch chan<- event.GenericEvent, obj client.Object) bool {
+	select {
+	case ch <- event.GenericEvent{Object: obj}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
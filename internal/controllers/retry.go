@@ -0,0 +1,224 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// retryPolicy is the resolved retry configuration of an issuer.
+type retryPolicy struct {
+	maxRetryDuration time.Duration
+	initialBackoff   time.Duration
+	multiplier       float64
+}
+
+// maxRetryDuration returns the MaxRetryDuration of issuers that do not set
+// one.
+func (o *Issuer) maxRetryDuration() time.Duration {
+	if o.MaxRetryDuration > 0 {
+		return o.MaxRetryDuration
+	}
+	return CFMTLSIssuerapi.DefaultMaxRetryDuration
+}
+
+// retryPolicyFor returns the retry policy of the given issuer, falling back
+// to the defaults for fields that are not set.
+func (o *Issuer) retryPolicyFor(issuerSpec *CFMTLSIssuerapi.IssuerSpec) retryPolicy {
+	policy := retryPolicy{
+		maxRetryDuration: o.maxRetryDuration(),
+		initialBackoff:   CFMTLSIssuerapi.DefaultInitialBackoff,
+		multiplier:       CFMTLSIssuerapi.DefaultBackoffMultiplier,
+	}
+	if issuerSpec == nil {
+		return policy
+	}
+	if issuerSpec.MaxRetryDuration != nil {
+		policy.maxRetryDuration = issuerSpec.MaxRetryDuration.Duration
+	}
+	if issuerSpec.InitialBackoff != nil {
+		policy.initialBackoff = issuerSpec.InitialBackoff.Duration
+	}
+	if m := issuerSpec.BackoffMultiplier; m != nil && m.AsApproximateFloat64() >= 1 {
+		policy.multiplier = m.AsApproximateFloat64()
+	}
+	return policy
+}
+
+// backoff returns the delay after the given number of failed attempts. The
+// delay stops growing at maxRetryDuration, before it could overflow, so the
+// loop ends once it is reached even for a large attempt count restored from
+// the annotations of a request.
+func (p retryPolicy) backoff(attempts int) time.Duration {
+	delay := p.initialBackoff
+	for i := 1; i < attempts && delay > 0 && delay < p.maxRetryDuration && p.multiplier > 1; i++ {
+		next := float64(delay) * p.multiplier
+		if next >= float64(p.maxRetryDuration) {
+			delay = p.maxRetryDuration
+			break
+		}
+		delay = time.Duration(next)
+	}
+	if delay > p.maxRetryDuration {
+		delay = p.maxRetryDuration
+	}
+	return delay
+}
+
+// retryState tracks the failed signing attempts of a single request.
+type retryState struct {
+	attempts    int
+	nextAttempt time.Time
+	lastErr     error
+}
+
+// retryTracker keeps the retry state of requests that failed to be signed,
+// keyed by the UID of the request.
+type retryTracker struct {
+	mu     sync.Mutex
+	states map[types.UID]retryState
+}
+
+func newRetryTracker() *retryTracker {
+	return &retryTracker{states: map[types.UID]retryState{}}
+}
+
+// get returns the retry state of the request. It returns false if the
+// request has no failed attempts.
+func (t *retryTracker) get(uid types.UID) (retryState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.states[uid]
+	return state, ok
+}
+
+// failed records a failed attempt and returns the time of the next attempt.
+func (t *retryTracker) failed(uid types.UID, policy retryPolicy, now time.Time, err error) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.states[uid]
+	state.attempts++
+	state.nextAttempt = now.Add(policy.backoff(state.attempts))
+	state.lastErr = err
+	t.states[uid] = state
+	return state.nextAttempt
+}
+
+// forget drops the retry state of the request.
+func (t *retryTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.states, uid)
+}
+
+// restore sets the retry state of the request, unless it already has one.
+func (t *retryTracker) restore(uid types.UID, state retryState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.states[uid]; !ok {
+		t.states[uid] = state
+	}
+}
+
+// restoreRetryState returns the retry state of the request recorded in its
+// annotations by a previous run of the controller, or false if it has none.
+func restoreRetryState(cr signer.CertificateRequestObject, policy retryPolicy) (retryState, bool) {
+	annotations := cr.GetAnnotations()
+	attempts, err := strconv.Atoi(annotations[CFMTLSIssuerapi.SigningAttemptsAnnotationKey])
+	if err != nil || attempts <= 0 {
+		return retryState{}, false
+	}
+	lastAttempt, err := time.Parse(time.RFC3339, annotations[CFMTLSIssuerapi.LastSigningAttemptAnnotationKey])
+	if err != nil {
+		return retryState{}, false
+	}
+	reason := annotations[CFMTLSIssuerapi.LastSigningErrorAnnotationKey]
+	if reason == "" {
+		reason = CFMTLSIssuerapi.ReasonInternalError
+	}
+	return retryState{
+		attempts:    attempts,
+		nextAttempt: lastAttempt.Add(policy.backoff(attempts)),
+		lastErr:     withReason(reason, fmt.Errorf("%d signing attempts failed before the controller restarted, the last with reason %s", attempts, reason)),
+	}, true
+}
+
+// recordRetryState records the failed signing attempts of the request in
+// its annotations. A nil state removes them. The annotations are best
+// effort: if they cannot be written, the request is only retried sooner
+// after a restart.
+func (o *Issuer) recordRetryState(ctx context.Context, cr signer.CertificateRequestObject, state *retryState, lastAttempt time.Time) {
+	annotations := map[string]*string{
+		CFMTLSIssuerapi.SigningAttemptsAnnotationKey:    nil,
+		CFMTLSIssuerapi.LastSigningErrorAnnotationKey:   nil,
+		CFMTLSIssuerapi.LastSigningAttemptAnnotationKey: nil,
+	}
+	if state == nil {
+		if _, ok := cr.GetAnnotations()[CFMTLSIssuerapi.SigningAttemptsAnnotationKey]; !ok {
+			return
+		}
+	} else {
+		attempts, reason, at := strconv.Itoa(state.attempts), errorReason(state.lastErr), lastAttempt.UTC().Format(time.RFC3339)
+		annotations[CFMTLSIssuerapi.SigningAttemptsAnnotationKey] = &attempts
+		annotations[CFMTLSIssuerapi.LastSigningErrorAnnotationKey] = &reason
+		annotations[CFMTLSIssuerapi.LastSigningAttemptAnnotationKey] = &at
+	}
+
+	// The attempt is recorded even if it ran out of time.
+	ctx = context.WithoutCancel(ctx)
+	var obj client.Object
+	switch requestReference(cr).Kind {
+	case "CertificateRequest":
+		obj = &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: cr.GetNamespace(), Name: cr.GetName()}}
+	case "CertificateSigningRequest":
+		obj = &certificatesv1.CertificateSigningRequest{ObjectMeta: metav1.ObjectMeta{Name: cr.GetName()}}
+	default:
+		return
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annotations}})
+	if err == nil {
+		err = o.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to record the signing attempts in the annotations of the request")
+	}
+}
+
+// recordFinalAttempt forgets the retry state of a request that failed
+// permanently and records its last attempt in its annotations.
+func (o *Issuer) recordFinalAttempt(ctx context.Context, cr signer.CertificateRequestObject, now time.Time, err error) {
+	state, _ := o.retries.get(cr.GetUID())
+	o.retries.forget(cr.GetUID())
+	state.attempts++
+	state.lastErr = err
+	o.recordRetryState(ctx, cr, &state, now)
+}
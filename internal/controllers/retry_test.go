@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestRetryPolicyForMaxRetryDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		controller time.Duration
+		spec       *CFMTLSIssuerapi.IssuerSpec
+		want       time.Duration
+	}{
+		{
+			name: "built-in default",
+			spec: &CFMTLSIssuerapi.IssuerSpec{},
+			want: CFMTLSIssuerapi.DefaultMaxRetryDuration,
+		},
+		{
+			name:       "controller default",
+			controller: time.Hour,
+			spec:       &CFMTLSIssuerapi.IssuerSpec{},
+			want:       time.Hour,
+		},
+		{
+			name:       "issuer overrides controller default",
+			controller: time.Hour,
+			spec:       &CFMTLSIssuerapi.IssuerSpec{MaxRetryDuration: &metav1.Duration{Duration: time.Minute}},
+			want:       time.Minute,
+		},
+		{
+			name:       "unknown issuer type",
+			controller: time.Hour,
+			want:       time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{MaxRetryDuration: tt.controller}
+			if got := o.retryPolicyFor(tt.spec).maxRetryDuration; got != tt.want {
+				t.Errorf("maxRetryDuration = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyForBackoffMultiplier(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier *resource.Quantity
+		want       float64
+	}{
+		{name: "default", want: CFMTLSIssuerapi.DefaultBackoffMultiplier},
+		{name: "integer", multiplier: ptr.To(resource.MustParse("3")), want: 3},
+		{name: "fractional", multiplier: ptr.To(resource.MustParse("1.5")), want: 1.5},
+		{name: "below 1", multiplier: ptr.To(resource.MustParse("500m")), want: CFMTLSIssuerapi.DefaultBackoffMultiplier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &CFMTLSIssuerapi.IssuerSpec{BackoffMultiplier: tt.multiplier}
+			if got := (&Issuer{}).retryPolicyFor(spec).multiplier; got != tt.want {
+				t.Errorf("multiplier = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   retryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{
+			name:     "first attempt",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Second, multiplier: 2},
+			attempts: 1,
+			want:     time.Second,
+		},
+		{
+			name:     "exponential growth",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Second, multiplier: 2},
+			attempts: 4,
+			want:     8 * time.Second,
+		},
+		{
+			name:     "capped at the max retry duration",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Second, multiplier: 2},
+			attempts: 20,
+			want:     time.Hour,
+		},
+		{
+			name:     "large attempt count",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Second, multiplier: 10},
+			attempts: math.MaxInt32,
+			want:     time.Hour,
+		},
+		{
+			name:     "max retry duration close to overflowing",
+			policy:   retryPolicy{maxRetryDuration: math.MaxInt64 - 1, initialBackoff: time.Second, multiplier: 10},
+			attempts: math.MaxInt32,
+			want:     math.MaxInt64 - 1,
+		},
+		{
+			name:     "fractional multiplier",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: 4 * time.Second, multiplier: 1.5},
+			attempts: 3,
+			want:     9 * time.Second,
+		},
+		{
+			name:     "no growth",
+			policy:   retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Minute, multiplier: 1},
+			attempts: math.MaxInt32,
+			want:     time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryStateAnnotations(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", UID: "uid"}}
+	o := &Issuer{client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cr).Build()}
+	ctx := context.Background()
+	policy := retryPolicy{maxRetryDuration: time.Hour, initialBackoff: time.Minute, multiplier: 2}
+
+	if _, ok := restoreRetryState(signer.CertificateRequestObjectFromCertificateRequest(cr), policy); ok {
+		t.Fatal("restoreRetryState() of a request without annotations = true, want false")
+	}
+
+	lastAttempt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	state := retryState{attempts: 3, lastErr: withReason(CFMTLSIssuerapi.ReasonQuotaExceeded, errors.New("throttled"))}
+	o.recordRetryState(ctx, signer.CertificateRequestObjectFromCertificateRequest(cr), &state, lastAttempt)
+
+	var recorded cmapi.CertificateRequest
+	if err := o.client.Get(ctx, client.ObjectKeyFromObject(cr), &recorded); err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := restoreRetryState(signer.CertificateRequestObjectFromCertificateRequest(&recorded), policy)
+	if !ok {
+		t.Fatalf("restoreRetryState() = false, annotations %v", recorded.Annotations)
+	}
+	if restored.attempts != 3 {
+		t.Errorf("attempts = %d, want 3", restored.attempts)
+	}
+	if want := lastAttempt.Add(4 * time.Minute); !restored.nextAttempt.Equal(want) {
+		t.Errorf("nextAttempt = %s, want %s", restored.nextAttempt, want)
+	}
+	if reason := errorReason(restored.lastErr); reason != CFMTLSIssuerapi.ReasonQuotaExceeded {
+		t.Errorf("reason = %q, want %q", reason, CFMTLSIssuerapi.ReasonQuotaExceeded)
+	}
+
+	// A signed request drops the annotations.
+	o.recordRetryState(ctx, signer.CertificateRequestObjectFromCertificateRequest(&recorded), nil, lastAttempt)
+	if err := o.client.Get(ctx, client.ObjectKeyFromObject(cr), &recorded); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded.Annotations) != 0 {
+		t.Errorf("annotations after signing = %v, want none", recorded.Annotations)
+	}
+}
@@ -0,0 +1,327 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// revocationTarget is a certificate selected for revocation. An empty zoneID
+// means the zone of the issuer is used.
+type revocationTarget struct {
+	certificateID string
+	zoneID        string
+}
+
+// revocationReconciler revokes the certificates selected by CFMTLSRevocations
+// using the credentials of the referenced issuer.
+type revocationReconciler struct {
+	*Issuer
+}
+
+// +kubebuilder:rbac:groups=cfmtls.cert.manager.io,resources=cfmtlsrevocations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cfmtls.cert.manager.io,resources=cfmtlsrevocations/status,verbs=patch
+
+func (r *revocationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&CFMTLSIssuerapi.CFMTLSRevocation{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("cfmtlsrevocation").
+		Complete(r)
+}
+
+func (r *revocationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	revocation := &CFMTLSIssuerapi.CFMTLSRevocation{}
+	if err := r.client.Get(ctx, req.NamespacedName, revocation); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if meta.IsStatusConditionTrue(revocation.Status.Conditions, CFMTLSIssuerapi.RevocationConditionRevoked) {
+		return ctrl.Result{}, nil
+	}
+	if !r.ownsIssuer(issuerReferenceKey(revocation.Spec.IssuerRef, revocation.Namespace)) {
+		return ctrl.Result{}, nil
+	}
+
+	original := revocation.DeepCopy()
+	err := r.revoke(ctx, revocation)
+
+	condition := metav1.Condition{
+		Type:               CFMTLSIssuerapi.RevocationConditionRevoked,
+		Status:             metav1.ConditionTrue,
+		Reason:             CFMTLSIssuerapi.ReasonRevoked,
+		Message:            fmt.Sprintf("Revoked %d certificate(s)", len(revocation.Status.RevokedCertificateIDs)),
+		ObservedGeneration: revocation.Generation,
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = errorReason(err)
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&revocation.Status.Conditions, condition)
+
+	if patchErr := r.client.Status().Patch(ctx, revocation, client.MergeFrom(original)); patchErr != nil {
+		return ctrl.Result{}, patchErr
+	}
+
+	// Returning the error requeues the revocation with backoff.
+	return ctrl.Result{}, err
+}
+
+// revoke revokes the certificates selected by the revocation that have not
+// been revoked yet, recording each one in the status as it goes.
+func (r *revocationReconciler) revoke(ctx context.Context, revocation *CFMTLSIssuerapi.CFMTLSRevocation) error {
+	logger := log.FromContext(ctx)
+
+	targets, err := r.revocationTargets(ctx, revocation)
+	if err != nil {
+		return err
+	}
+
+	issuerObject, err := r.referencedIssuer(ctx, revocation.Spec.IssuerRef, revocation.Namespace)
+	if err != nil {
+		return err
+	}
+
+	revoke, err := r.revoker(ctx, issuerObject)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		if slices.Contains(revocation.Status.RevokedCertificateIDs, target.certificateID) {
+			continue
+		}
+
+		err := revoke(target.zoneID, target.certificateID)
+		switch {
+		case errorReason(err) == CFMTLSIssuerapi.ReasonCertificateNotFound:
+			// A certificate that is gone cannot be used anymore.
+			logger.Info("Cloudflare certificate not found, treating it as revoked", "certificateID", target.certificateID, "zoneID", target.zoneID)
+		case err != nil:
+			return err
+		default:
+			logger.Info("revoked Cloudflare certificate", "certificateID", target.certificateID, "zoneID", target.zoneID, "reason", revocation.Spec.Reason)
+		}
+		now := metav1.Now()
+		revocation.Status.RevokedCertificateIDs = append(revocation.Status.RevokedCertificateIDs, target.certificateID)
+		revocation.Status.RevocationTime = &now
+	}
+
+	return nil
+}
+
+// revocationTargets returns the certificates selected by the revocation. Only
+// certificates tracked in the namespace of the revocation can be selected, so
+// that users cannot revoke certificates of other tenants. Revocations in the
+// cluster resource namespace may revoke any certificate by ID.
+func (r *revocationReconciler) revocationTargets(ctx context.Context, revocation *CFMTLSIssuerapi.CFMTLSRevocation) ([]revocationTarget, error) {
+	opts := []client.ListOption{client.InNamespace(revocation.Namespace)}
+	if ref := revocation.Spec.CertificateRef; ref != nil {
+		opts = append(opts, client.MatchingLabels{CFMTLSIssuerapi.CertificateNameLabelKey: ref.Name})
+	}
+
+	var tracked CFMTLSIssuerapi.CloudflareOriginCertificateList
+	if err := r.client.List(ctx, &tracked, opts...); err != nil {
+		return nil, fmt.Errorf("failed to list CloudflareOriginCertificates: %w", err)
+	}
+
+	var targets []revocationTarget
+	for _, cert := range tracked.Items {
+		if cert.Spec.IssuerRef != revocation.Spec.IssuerRef {
+			continue
+		}
+		if revocation.Spec.CertificateID != "" && cert.Spec.CertificateID != revocation.Spec.CertificateID {
+			continue
+		}
+		targets = append(targets, revocationTarget{certificateID: cert.Spec.CertificateID, zoneID: cert.Spec.ZoneID})
+	}
+
+	if len(targets) == 0 && revocation.Spec.CertificateID != "" && revocation.Namespace == r.ClusterResourceNamespace {
+		targets = append(targets, revocationTarget{certificateID: revocation.Spec.CertificateID})
+	}
+
+	if len(targets) == 0 {
+		return nil, withReason(CFMTLSIssuerapi.ReasonCertificateNotFound, fmt.Errorf("no certificate issued by %s %q matches the revocation", revocation.Spec.IssuerRef.Kind, revocation.Spec.IssuerRef.Name))
+	}
+
+	return targets, nil
+}
+
+// referencedIssuer returns the referenced issuer. A CFMTLSIssuer is read
+// from the given namespace, the namespace of the referencing object.
+func (o *Issuer) referencedIssuer(ctx context.Context, ref CFMTLSIssuerapi.IssuerReference, namespace string) (issuerapi.Issuer, error) {
+	key := types.NamespacedName{Name: ref.Name}
+
+	var issuerObject issuerapi.Issuer
+	switch ref.Kind {
+	case "CFMTLSIssuer":
+		issuerObject = &CFMTLSIssuerapi.CFMTLSIssuer{}
+		key.Namespace = namespace
+	case "CFMTLSClusterIssuer":
+		if !o.clusterScoped() {
+			return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration,
+				errors.New("CFMTLSClusterIssuers are not served while the controller is restricted to namespaces"))
+		}
+		issuerObject = &CFMTLSIssuerapi.CFMTLSClusterIssuer{}
+	default:
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("unsupported issuer kind %q", ref.Kind))
+	}
+
+	if err := o.client.Get(ctx, key, issuerObject); err != nil {
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to get %s %q: %w", ref.Kind, ref.Name, err))
+	}
+
+	return issuerObject, nil
+}
+
+// revoker returns a function that revokes certificates at Cloudflare with the
+// credentials of the given issuer. An empty zoneID revokes the certificate in
+// the zone of the issuer.
+func (o *Issuer) revoker(ctx context.Context, issuerObject issuerapi.Issuer) (func(zoneID, certificateID string) error, error) {
+	api, err := o.zoneAPI(ctx, issuerObject)
+	if err != nil {
+		return nil, err
+	}
+	return func(zoneID, certificateID string) error {
+		return o.revokeCertificate(ctx, api, zoneID, certificateID)
+	}, nil
+}
+
+// revokeCertificate revokes a certificate at Cloudflare and removes it from
+// the certificate index once it is revoked or gone. A certificate that
+// Cloudflare does not know is reported with ReasonCertificateNotFound; other
+// not found errors, e.g. for a deleted zone, leave the index entry in place.
+func (o *Issuer) revokeCertificate(ctx context.Context, api *zoneAPI, zoneID, certificateID string) error {
+	zoneID = api.zoneID(zoneID)
+	err := api.do(ctx, zoneID, func(apiKey, baseURL, zoneID string, client *http.Client) error {
+		return revokeCloudflareCertificate(ctx, apiKey, baseURL, zoneID, certificateID, client)
+	})
+	if err != nil && errorReason(err) != CFMTLSIssuerapi.ReasonCertificateNotFound {
+		return err
+	}
+	if indexErr := o.index.remove(ctx, zoneID, certificateID); indexErr != nil {
+		log.FromContext(ctx).Error(indexErr, "failed to remove revoked certificate from the index", "certificateID", certificateID, "zoneID", zoneID)
+	}
+	return err
+}
+
+// zoneAPI holds the credentials and the HTTP client of an issuer, for the
+// requests about its certificates that are not part of signing.
+type zoneAPI struct {
+	issuerSpec *CFMTLSIssuerapi.IssuerSpec
+	secretData map[string][]byte
+	config     issuerConfig
+	httpClient *http.Client
+}
+
+// zoneAPI returns the Cloudflare API credentials of the given issuer.
+func (o *Issuer) zoneAPI(ctx context.Context, issuerObject issuerapi.Issuer) (*zoneAPI, error) {
+	issuerSpec, namespace, err := o.getIssuerDetails(issuerObject)
+	if err != nil {
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, err)
+	}
+
+	secretData, err := o.getSecretData(ctx, issuerSpec, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := o.getIssuerConfig(ctx, issuerSpec, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	apiTokenKey := apiTokenSecretKey(issuerSpec)
+	if len(secretData[apiTokenKey]) == 0 {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("missing Cloudflare API key in secret (key %q)", apiTokenKey))
+	}
+
+	httpClient, err := o.httpClient(ctx, issuerObject, issuerSpec, config, secretData, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zoneAPI{issuerSpec: issuerSpec, secretData: secretData, config: config, httpClient: httpClient}, nil
+}
+
+// do calls request with the API token of the issuer, failing over to its
+// secondary token. An empty zoneID is the zone of the issuer.
+func (z *zoneAPI) do(ctx context.Context, zoneID string, request func(apiKey, baseURL, zoneID string, client *http.Client) error) error {
+	zoneID = z.zoneID(zoneID)
+	_, err := withTokenFailover(ctx, z.issuerSpec, z.secretData, func(apiKey string) error {
+		return request(apiKey, z.config.baseURL, zoneID, z.httpClient)
+	})
+	return err
+}
+
+// zoneID returns the given zone ID, or the zone of the issuer if empty.
+func (z *zoneAPI) zoneID(zoneID string) string {
+	if zoneID == "" {
+		return resolveZoneID(z.issuerSpec, z.config, z.secretData)
+	}
+	return zoneID
+}
+
+// revokeCloudflareCertificate revokes the client certificate with the given
+// ID in the given zone.
+func revokeCloudflareCertificate(ctx context.Context, apiKey, baseURL, zoneID, certID string, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%s/zones/%s/client_certificates/%s", baseURL, zoneID, certID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return requestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		err := fmt.Errorf("Cloudflare certificate revocation failed with status: %d", resp.StatusCode)
+		if messages := cloudflareErrorMessages(body); messages != "" {
+			err = fmt.Errorf("%w: %s", err, messages)
+		}
+		err = withCFRay(err, resp)
+		if resp.StatusCode == http.StatusNotFound && cloudflareCertificateNotFound(body) {
+			return withReason(CFMTLSIssuerapi.ReasonCertificateNotFound, err)
+		}
+		return withReason(reasonForStatusCode(resp.StatusCode), err)
+	}
+
+	return nil
+}
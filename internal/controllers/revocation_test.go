@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestRevocationReconciler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantErr     bool
+		wantRevoked metav1.ConditionStatus
+	}{
+		{name: "revoked", status: http.StatusOK, wantRevoked: metav1.ConditionTrue},
+		// The certificate is gone, so there is nothing left to revoke.
+		{
+			name:        "certificate not found",
+			status:      http.StatusNotFound,
+			body:        `{"success":false,"errors":[{"code":1404,"message":"Client certificate not found"}]}`,
+			wantRevoked: metav1.ConditionTrue,
+		},
+		// The zone may be wrong or deleted, so nothing was revoked.
+		{
+			name:        "zone not found",
+			status:      http.StatusNotFound,
+			body:        `{"success":false,"errors":[{"code":7003,"message":"Could not route to /zones/zone-id/client_certificates/cert-id, perhaps your object identifier is invalid?"}]}`,
+			wantErr:     true,
+			wantRevoked: metav1.ConditionFalse,
+		},
+		{name: "not found without details", status: http.StatusNotFound, wantErr: true, wantRevoked: metav1.ConditionFalse},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true, wantRevoked: metav1.ConditionFalse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			issuerRef := CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "cloudflare"}
+			issuerObject := &CFMTLSIssuerapi.CFMTLSIssuer{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Spec: CFMTLSIssuerapi.IssuerSpec{
+					AuthSecretName: "cloudflare",
+					ConfigMapRef:   &CFMTLSIssuerapi.ConfigMapReference{Name: "cloudflare"},
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("token")},
+			}
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string]string{CFMTLSIssuerapi.ConfigMapAPIBaseURLKey: server.URL},
+			}
+			tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "web-1"},
+				Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+					CertificateID: "cert-id",
+					ZoneID:        "zone-id",
+					IssuerRef:     issuerRef,
+				},
+			}
+			revocation := &CFMTLSIssuerapi.CFMTLSRevocation{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "compromised"},
+				Spec:       CFMTLSIssuerapi.CFMTLSRevocationSpec{IssuerRef: issuerRef, CertificateID: "cert-id"},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(issuerObject, secret, configMap, tracked, revocation).
+				WithStatusSubresource(revocation).
+				Build()
+			ctx := context.Background()
+			index := &certificateIndex{client: c, namespace: "cfmtls-system"}
+			if err := index.add(ctx, tracked); err != nil {
+				t.Fatal(err)
+			}
+			r := &revocationReconciler{Issuer: &Issuer{
+				client: c,
+				index:  index,
+				HealthCheckerBuilder: func(*CFMTLSIssuerapi.IssuerSpec, map[string][]byte) (HealthChecker, error) {
+					return acceptingHealthChecker{}, nil
+				},
+			}}
+
+			key := types.NamespacedName{Namespace: "team-a", Name: "compromised"}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Reconcile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := &CFMTLSIssuerapi.CFMTLSRevocation{}
+			if err := c.Get(ctx, key, got); err != nil {
+				t.Fatal(err)
+			}
+			condition := meta.FindStatusCondition(got.Status.Conditions, CFMTLSIssuerapi.RevocationConditionRevoked)
+			if condition == nil || condition.Status != tt.wantRevoked {
+				t.Errorf("Revoked condition = %+v, want status %s", condition, tt.wantRevoked)
+			}
+			if revoked := slices.Contains(got.Status.RevokedCertificateIDs, "cert-id"); revoked != (tt.wantRevoked == metav1.ConditionTrue) {
+				t.Errorf("revokedCertificateIDs = %v", got.Status.RevokedCertificateIDs)
+			}
+
+			// Only revoked certificates are removed from the index.
+			zones, err := index.entries(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, indexed := zones["zone-id"]["cert-id"]; indexed != (tt.wantRevoked == metav1.ConditionFalse) {
+				t.Errorf("certificate indexed = %v, want %v", indexed, tt.wantRevoked == metav1.ConditionFalse)
+			}
+		})
+	}
+}
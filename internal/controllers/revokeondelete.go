@@ -0,0 +1,121 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// revokeOnDeleteReconciler revokes the certificates of deleted
+// CloudflareOriginCertificates that carry the revoke-on-delete finalizer,
+// and then removes the finalizer.
+type revokeOnDeleteReconciler struct {
+	*Issuer
+}
+
+func (r *revokeOnDeleteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	deleted := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		return !object.GetDeletionTimestamp().IsZero() && controllerutil.ContainsFinalizer(object, CFMTLSIssuerapi.RevokeOnDeleteFinalizer)
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&CFMTLSIssuerapi.CloudflareOriginCertificate{}, builder.WithPredicates(deleted)).
+		Named("cloudflareorigincertificate").
+		Complete(r)
+}
+
+func (r *revokeOnDeleteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{}
+	if err := r.client.Get(ctx, req.NamespacedName, tracked); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if tracked.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(tracked, CFMTLSIssuerapi.RevokeOnDeleteFinalizer) {
+		return ctrl.Result{}, nil
+	}
+	if !r.ownsIssuer(issuerReferenceKey(tracked.Spec.IssuerRef, tracked.Namespace)) {
+		return ctrl.Result{}, nil
+	}
+
+	// Returning the error requeues the deletion with backoff.
+	if err := r.revokeTracked(ctx, tracked); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	original := tracked.DeepCopy()
+	controllerutil.RemoveFinalizer(tracked, CFMTLSIssuerapi.RevokeOnDeleteFinalizer)
+	return ctrl.Result{}, client.IgnoreNotFound(r.client.Patch(ctx, tracked, client.MergeFrom(original)))
+}
+
+// revokeTracked revokes the certificate of a deleted
+// CloudflareOriginCertificate. Certificates whose issuer no longer exists or
+// no longer sets revocationPolicy OnDelete, and certificates that are gone
+// at Cloudflare, are left as they are, so that the deletion does not hang.
+func (r *revokeOnDeleteReconciler) revokeTracked(ctx context.Context, tracked *CFMTLSIssuerapi.CloudflareOriginCertificate) error {
+	logger := log.FromContext(ctx).WithValues("certificateID", tracked.Spec.CertificateID, "zoneID", tracked.Spec.ZoneID)
+
+	issuerObject, err := r.referencedIssuer(ctx, tracked.Spec.IssuerRef, tracked.Namespace)
+	if apierrors.IsNotFound(err) {
+		logger.Info("issuer not found, not revoking Cloudflare certificate")
+		r.recordTrackedEvent(tracked, corev1.EventTypeWarning, EventReasonRevocationSkipped,
+			"Not revoking certificate %s: %s %q not found", tracked.Spec.CertificateID, tracked.Spec.IssuerRef.Kind, tracked.Spec.IssuerRef.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !r.revokeOnDelete(issuerObject) {
+		logger.Info("issuer no longer revokes certificates on delete, not revoking Cloudflare certificate")
+		return nil
+	}
+
+	revoke, err := r.revoker(ctx, issuerObject)
+	if err != nil {
+		return err
+	}
+	err = revoke(tracked.Spec.ZoneID, tracked.Spec.CertificateID)
+	if errorReason(err) == CFMTLSIssuerapi.ReasonCertificateNotFound {
+		logger.Info("Cloudflare certificate not found, nothing to revoke")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("revoked Cloudflare certificate on delete")
+	r.recordTrackedEvent(tracked, corev1.EventTypeNormal, EventReasonCertificateRevoked,
+		"Revoked certificate %s at Cloudflare", tracked.Spec.CertificateID)
+	return nil
+}
+
+// recordTrackedEvent records an event on the given CloudflareOriginCertificate.
+func (r *revokeOnDeleteReconciler) recordTrackedEvent(tracked *CFMTLSIssuerapi.CloudflareOriginCertificate, eventType, reason, message string, args ...interface{}) {
+	if r.recorder == nil {
+		return
+	}
+	r.recorder.Eventf(tracked, eventType, reason, message, args...)
+}
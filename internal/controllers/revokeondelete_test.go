@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestRevokeOnDeleteReconciler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	never := &CFMTLSIssuerapi.CFMTLSIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "never", Namespace: "default"},
+		Spec:       CFMTLSIssuerapi.IssuerSpec{RevocationPolicy: CFMTLSIssuerapi.RevocationPolicyNever},
+	}
+
+	tests := []struct {
+		name      string
+		issuer    string
+		wantEvent string
+	}{
+		{name: "issuer not found", issuer: "missing", wantEvent: EventReasonRevocationSkipped},
+		{name: "revocation policy changed to Never", issuer: "never"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := metav1.Now()
+			tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "web-1",
+					Namespace:         "default",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{CFMTLSIssuerapi.RevokeOnDeleteFinalizer},
+				},
+				Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+					CertificateID: "cert-id",
+					ZoneID:        "zone-id",
+					IssuerRef:     CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: tt.issuer},
+				},
+			}
+
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(never, tracked).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &revokeOnDeleteReconciler{Issuer: &Issuer{client: c, recorder: recorder}}
+
+			key := types.NamespacedName{Namespace: "default", Name: "web-1"}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			// The fake client deletes the object once its last finalizer is
+			// removed.
+			if err := c.Get(context.Background(), key, &CFMTLSIssuerapi.CloudflareOriginCertificate{}); !apierrors.IsNotFound(err) {
+				t.Errorf("Get() error = %v, want the finalizer to be removed", err)
+			}
+
+			select {
+			case event := <-recorder.Events:
+				if tt.wantEvent == "" || !strings.Contains(event, tt.wantEvent) {
+					t.Errorf("event = %q, want reason %q", event, tt.wantEvent)
+				}
+			default:
+				if tt.wantEvent != "" {
+					t.Errorf("no event recorded, want reason %s", tt.wantEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestCertificateOwner(t *testing.T) {
+	cr := &cmapi.CertificateRequest{ObjectMeta: metav1.ObjectMeta{
+		Name:      "web-1",
+		Namespace: "default",
+		OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: cmapi.SchemeGroupVersion.String(),
+			Kind:       cmapi.CertificateKind,
+			Name:       "web",
+			UID:        "certificate-uid",
+			Controller: ptr.To(true),
+		}},
+	}}
+
+	owner := certificateOwner(signer.CertificateRequestObjectFromCertificateRequest(cr))
+	if owner == nil || owner.Name != "web" || owner.UID != "certificate-uid" {
+		t.Fatalf("certificateOwner() = %+v, want the Certificate web", owner)
+	}
+	if owner.Controller != nil || owner.BlockOwnerDeletion != nil {
+		t.Errorf("certificateOwner() = %+v, want a non-controlling owner", owner)
+	}
+
+	refs := upsertOwnerReference(nil, *owner)
+	if refs = upsertOwnerReference(refs, *owner); len(refs) != 1 {
+		t.Errorf("upsertOwnerReference() = %+v, want a single reference", refs)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=update
+
+const (
+	// tokenRotatorPeriod is how often the token rotator looks for API
+	// tokens that are about to expire.
+	tokenRotatorPeriod = time.Hour
+	// tokenRotatorRetryDelay is the first delay before saving a rolled
+	// token is retried. It doubles with each failure, up to
+	// tokenRotatorPeriod.
+	tokenRotatorRetryDelay = 10 * time.Second
+)
+
+// tokenRotator rolls the API tokens of issuers that set spec.tokenRotation
+// before they expire, and writes the new values to their auth Secrets. The
+// Secret watch then re-checks the issuers with the new token.
+type tokenRotator struct {
+	*Issuer
+
+	// pending holds the rolled tokens that could not be written to their
+	// auth Secrets, by Secret. The old values no longer work, so these are
+	// the only copies of the credentials. It is only used by Start.
+	pending map[types.NamespacedName]rolledToken
+}
+
+// rolledToken is a token value that replaced oldKey in an auth Secret.
+type rolledToken struct {
+	oldKey    string
+	newKey    string
+	expiresOn time.Time
+}
+
+// Start implements manager.Runnable.
+func (r *tokenRotator) Start(ctx context.Context) error {
+	delay := tokenRotatorRetryDelay
+	for {
+		r.rotateDue(ctx)
+
+		wait := tokenRotatorPeriod
+		if len(r.pending) > 0 {
+			// The issuers cannot reach Cloudflare until the rolled tokens
+			// are saved, so they are retried sooner.
+			wait, delay = delay, min(2*delay, tokenRotatorPeriod)
+		} else {
+			delay = tokenRotatorRetryDelay
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// rotateDue rotates the tokens of all issuers that are due for rotation.
+func (r *tokenRotator) rotateDue(ctx context.Context) {
+	logger := log.FromContext(ctx).WithName("tokenRotator")
+
+	var issuers CFMTLSIssuerapi.CFMTLSIssuerList
+	if err := r.client.List(ctx, &issuers); err != nil {
+		logger.Error(err, "failed to list CFMTLSIssuers")
+	}
+	for i := range issuers.Items {
+		issuer := &issuers.Items[i]
+		if issuer.Spec.TokenRotation == nil || !r.ownsIssuer(client.ObjectKeyFromObject(issuer)) {
+			continue
+		}
+		if err := r.rotate(ctx, issuer); err != nil {
+			logger.Error(err, "failed to rotate API token", "issuer", issuer.Namespace+"/"+issuer.Name)
+		}
+	}
+
+	if !r.clusterScoped() {
+		return
+	}
+
+	var clusterIssuers CFMTLSIssuerapi.CFMTLSClusterIssuerList
+	if err := r.client.List(ctx, &clusterIssuers); err != nil {
+		logger.Error(err, "failed to list CFMTLSClusterIssuers")
+	}
+	for i := range clusterIssuers.Items {
+		issuer := &clusterIssuers.Items[i]
+		if issuer.Spec.TokenRotation == nil || !r.ownsIssuer(client.ObjectKeyFromObject(issuer)) {
+			continue
+		}
+		if err := r.rotate(ctx, issuer); err != nil {
+			logger.Error(err, "failed to rotate API token", "issuer", issuer.Name)
+		}
+	}
+}
+
+// rotate rolls the API token of the issuer if it expires within
+// renewBefore.
+func (r *tokenRotator) rotate(ctx context.Context, issuerObject issuerapi.Issuer) error {
+	issuerSpec, namespace, err := r.getIssuerDetails(issuerObject)
+	if err != nil {
+		return err
+	}
+	if issuerSpec.AuthSecretName == "" {
+		return fmt.Errorf("tokenRotation requires authSecretName")
+	}
+
+	renewBefore, validity := CFMTLSIssuerapi.DefaultTokenRenewBefore, CFMTLSIssuerapi.DefaultTokenValidity
+	if d := issuerSpec.TokenRotation.RenewBefore; d != nil {
+		renewBefore = d.Duration
+	}
+	if d := issuerSpec.TokenRotation.Validity; d != nil {
+		validity = d.Duration
+	}
+
+	secretName := types.NamespacedName{Namespace: namespace, Name: issuerSpec.AuthSecretName}
+	var secret corev1.Secret
+	if err := r.client.Get(ctx, secretName, &secret); err != nil {
+		return fmt.Errorf("failed to get Secret %s: %w", secretName, err)
+	}
+
+	registerCredentials(issuerSpec, secret.Data)
+	apiTokenKey := apiTokenSecretKey(issuerSpec)
+	apiKey := string(secret.Data[apiTokenKey])
+	if rolled, ok := r.pending[secretName]; ok {
+		if apiKey == rolled.oldKey {
+			return r.saveToken(ctx, issuerObject, secretName, apiTokenKey, rolled)
+		}
+		// The Secret was updated since, so the rolled token is not needed.
+		delete(r.pending, secretName)
+	}
+	if apiKey == "" {
+		return fmt.Errorf("missing Cloudflare API key in secret (key %q)", apiTokenKey)
+	}
+
+	config, err := r.getIssuerConfig(ctx, issuerSpec, namespace)
+	if err != nil {
+		return err
+	}
+	httpClient, err := r.httpClient(ctx, issuerObject, issuerSpec, config, secret.Data, namespace)
+	if err != nil {
+		return err
+	}
+
+	id, expiresOn, err := tokenExpiry(ctx, apiKey, config.baseURL, httpClient)
+	if err != nil {
+		return err
+	}
+	if expiresOn.IsZero() {
+		// Tokens without an expiry never need to be rotated.
+		return nil
+	}
+	r.updateStatus(ctx, issuerObject, func(status *CFMTLSIssuerapi.IssuerStatus) {
+		status.TokenExpirationTime = &metav1.Time{Time: expiresOn}
+	})
+	if time.Until(expiresOn) > renewBefore {
+		return nil
+	}
+
+	newExpiry := time.Now().Add(validity).UTC().Truncate(time.Second)
+	newKey, err := rollToken(ctx, apiKey, config.baseURL, id, newExpiry, httpClient)
+	if err != nil {
+		return err
+	}
+	redact.Register(newKey)
+	// The old value no longer works, so signings must not reuse it.
+	r.credentials.forget(issuerObject)
+	return r.saveToken(ctx, issuerObject, secretName, apiTokenKey, rolledToken{oldKey: apiKey, newKey: newKey, expiresOn: newExpiry})
+}
+
+// saveToken writes the rolled token to the auth Secret. If that fails, the
+// token is kept in pending and saved again by the next rotation.
+func (r *tokenRotator) saveToken(ctx context.Context, issuerObject issuerapi.Issuer, secretName types.NamespacedName, apiTokenKey string, rolled rolledToken) error {
+	// The old value stops working as soon as the token is rolled, so the
+	// Secret must be updated even if it changed in the meantime or the
+	// controller is shutting down.
+	ctx = context.WithoutCancel(ctx)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var latest corev1.Secret
+		if err := r.client.Get(ctx, secretName, &latest); err != nil {
+			return err
+		}
+		if latest.Data == nil {
+			latest.Data = map[string][]byte{}
+		}
+		latest.Data[apiTokenKey] = []byte(rolled.newKey)
+		return r.client.Update(ctx, &latest)
+	})
+	if err != nil {
+		if r.pending == nil {
+			r.pending = map[types.NamespacedName]rolledToken{}
+		}
+		r.pending[secretName] = rolled
+		return fmt.Errorf("API token was rolled but Secret %s could not be updated, retrying: %w", secretName, err)
+	}
+	delete(r.pending, secretName)
+
+	log.FromContext(ctx).Info("rotated Cloudflare API token", "secret", secretName.String(), "expiresOn", rolled.expiresOn)
+	r.updateStatus(ctx, issuerObject, func(status *CFMTLSIssuerapi.IssuerStatus) {
+		status.TokenExpirationTime = &metav1.Time{Time: rolled.expiresOn}
+		status.LastTokenRotationTime = &metav1.Time{Time: time.Now()}
+	})
+	return nil
+}
+
+// tokenExpiry returns the ID and expiry of the given API token. The expiry
+// is zero if the token does not expire.
+func tokenExpiry(ctx context.Context, apiKey, baseURL string, client *http.Client) (string, time.Time, error) {
+	var verified struct {
+		Result struct {
+			ID        string    `json:"id"`
+			ExpiresOn time.Time `json:"expires_on"`
+		} `json:"result"`
+	}
+	if err := cloudflareDo(ctx, apiKey, http.MethodGet, baseURL+"/user/tokens/verify", nil, client, &verified); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to verify token: %w", err)
+	}
+	return verified.Result.ID, verified.Result.ExpiresOn, nil
+}
+
+// rollToken extends the expiry of the API token and rolls its value, which
+// invalidates the old value. It returns the new value.
+func rollToken(ctx context.Context, apiKey, baseURL, id string, expiresOn time.Time, client *http.Client) (string, error) {
+	tokenURL := fmt.Sprintf("%s/user/tokens/%s", baseURL, id)
+
+	// Updating a token replaces it, so the current policies are sent back
+	// along with the new expiry.
+	var token struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := cloudflareDo(ctx, apiKey, http.MethodGet, tokenURL, nil, client, &token); err != nil {
+		return "", fmt.Errorf("failed to read token, the token needs the API Tokens Edit permission: %w", err)
+	}
+	update := map[string]interface{}{"expires_on": expiresOn.Format(time.RFC3339)}
+	for _, key := range []string{"name", "policies", "condition", "not_before", "status"} {
+		if v, ok := token.Result[key]; ok && string(v) != "null" {
+			update[key] = v
+		}
+	}
+	if err := cloudflareDo(ctx, apiKey, http.MethodPut, tokenURL, update, client, nil); err != nil {
+		return "", fmt.Errorf("failed to extend token expiry: %w", err)
+	}
+
+	// Rolling invalidates the old value, and the response holds the only
+	// copy of the new one, so the request is not cancelled halfway.
+	var rolled struct {
+		Result string `json:"result"`
+	}
+	if err := cloudflareDo(context.WithoutCancel(ctx), apiKey, http.MethodPut, tokenURL+"/value", map[string]interface{}{}, client, &rolled); err != nil {
+		return "", fmt.Errorf("failed to roll token: %w", err)
+	}
+	if rolled.Result == "" {
+		return "", fmt.Errorf("Cloudflare returned an empty token value")
+	}
+	return rolled.Result, nil
+}
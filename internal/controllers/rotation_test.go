@@ -0,0 +1,262 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// fakeTokenAPI serves the Cloudflare token endpoints for a single token,
+// which only accepts its current value.
+type fakeTokenAPI struct {
+	mu        sync.Mutex
+	value     string
+	expiresOn time.Time
+	updates   []map[string]interface{}
+	rolls     int
+}
+
+func (a *fakeTokenAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if req.Header.Get("Authorization") != "Bearer "+a.value {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var result interface{}
+	switch req.Method + " " + req.URL.Path {
+	case "GET /user/tokens/verify":
+		result = map[string]interface{}{"id": "token-id", "status": "active", "expires_on": a.expiresOn}
+	case "GET /user/tokens/token-id":
+		result = map[string]interface{}{"id": "token-id", "name": "cfmtls-issuer", "status": "active", "policies": []interface{}{map[string]interface{}{"effect": "allow"}}}
+	case "PUT /user/tokens/token-id":
+		var update map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		a.updates = append(a.updates, update)
+		result = update
+	case "PUT /user/tokens/token-id/value":
+		a.rolls++
+		a.value = "rolled-token"
+		result = a.value
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+}
+
+func TestTokenRotatorRotate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// expiresIn is the time left until the current token expires.
+		expiresIn time.Duration
+		// updateFailures is how many Secret updates fail.
+		updateFailures int
+		wantRolls      int
+		wantToken      string
+		wantErr        bool
+	}{
+		{
+			name:      "not due",
+			expiresIn: 30 * 24 * time.Hour,
+			wantToken: "current-token",
+		},
+		{
+			name:      "rolled and saved",
+			expiresIn: 24 * time.Hour,
+			wantRolls: 1,
+			wantToken: "rolled-token",
+		},
+		{
+			name:           "rolled and saved on retry",
+			expiresIn:      24 * time.Hour,
+			updateFailures: 1,
+			wantRolls:      1,
+			wantToken:      "rolled-token",
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeTokenAPI{value: "current-token", expiresOn: time.Now().Add(tt.expiresIn).UTC().Truncate(time.Second)}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			issuerObject := &CFMTLSIssuerapi.CFMTLSIssuer{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Spec: CFMTLSIssuerapi.IssuerSpec{
+					AuthSecretName: "cloudflare",
+					ConfigMapRef:   &CFMTLSIssuerapi.ConfigMapReference{Name: "cloudflare"},
+					TokenRotation:  &CFMTLSIssuerapi.TokenRotation{},
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("current-token")},
+			}
+			configMap := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+				Data:       map[string]string{CFMTLSIssuerapi.ConfigMapAPIBaseURLKey: server.URL},
+			}
+			failures := tt.updateFailures
+			c := fake.NewClientBuilder().WithScheme(scheme).
+				WithObjects(issuerObject, secret, configMap).
+				WithStatusSubresource(issuerObject).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+						if failures > 0 {
+							failures--
+							return apierrors.NewForbidden(corev1.Resource("secrets"), obj.GetName(), errors.New("denied"))
+						}
+						return c.Update(ctx, obj, opts...)
+					},
+				}).Build()
+			o := &Issuer{client: c}
+			r := &tokenRotator{Issuer: o}
+
+			err := r.rotate(context.Background(), issuerObject)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rotate() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil {
+				// The rolled token is kept and saved by the next rotation,
+				// without rolling it again.
+				if len(r.pending) != 1 {
+					t.Fatalf("pending = %d tokens, want 1", len(r.pending))
+				}
+				if err := r.rotate(context.Background(), issuerObject); err != nil {
+					t.Fatalf("rotate() retry error = %v", err)
+				}
+			}
+			if len(r.pending) != 0 {
+				t.Errorf("pending = %d tokens after saving, want 0", len(r.pending))
+			}
+
+			if api.rolls != tt.wantRolls {
+				t.Errorf("rolls = %d, want %d", api.rolls, tt.wantRolls)
+			}
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(secret.Data[CFMTLSIssuerapi.DefaultAPITokenSecretKey]); got != tt.wantToken {
+				t.Errorf("Secret token = %q, want %q", got, tt.wantToken)
+			}
+			if tt.wantRolls == 0 {
+				return
+			}
+
+			// Updating a token replaces it, so its policies are sent back
+			// with the new expiry.
+			if len(api.updates) != 1 {
+				t.Fatalf("updates = %d, want 1", len(api.updates))
+			}
+			update := api.updates[0]
+			if update["policies"] == nil || update["name"] != "cfmtls-issuer" {
+				t.Errorf("update = %v, want the current name and policies", update)
+			}
+			expiresOn, err := time.Parse(time.RFC3339, update["expires_on"].(string))
+			if err != nil || expiresOn.Before(time.Now().Add(CFMTLSIssuerapi.DefaultTokenValidity-time.Minute)) {
+				t.Errorf("update expires_on = %v, want %s from now", update["expires_on"], CFMTLSIssuerapi.DefaultTokenValidity)
+			}
+
+			if err := c.Get(context.Background(), client.ObjectKeyFromObject(issuerObject), issuerObject); err != nil {
+				t.Fatal(err)
+			}
+			if issuerObject.Status.LastTokenRotationTime == nil || issuerObject.Status.TokenExpirationTime == nil || !issuerObject.Status.TokenExpirationTime.Time.Equal(expiresOn) {
+				t.Errorf("status = %+v, want the rotation and new expiry", issuerObject.Status)
+			}
+		})
+	}
+}
+
+func TestTokenRotatorDropsReplacedToken(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	api := &fakeTokenAPI{value: "replaced-token", expiresOn: time.Now().Add(30 * 24 * time.Hour)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	issuerObject := &CFMTLSIssuerapi.CFMTLSIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+		Spec: CFMTLSIssuerapi.IssuerSpec{
+			AuthSecretName: "cloudflare",
+			ConfigMapRef:   &CFMTLSIssuerapi.ConfigMapReference{Name: "cloudflare"},
+			TokenRotation:  &CFMTLSIssuerapi.TokenRotation{},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+		Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("replaced-token")},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cloudflare"},
+		Data:       map[string]string{CFMTLSIssuerapi.ConfigMapAPIBaseURLKey: server.URL},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuerObject, secret, configMap).WithStatusSubresource(issuerObject).Build()
+	o := &Issuer{client: c}
+	r := &tokenRotator{Issuer: o, pending: map[client.ObjectKey]rolledToken{
+		client.ObjectKeyFromObject(secret): {oldKey: "current-token", newKey: "rolled-token"},
+	}}
+
+	// The Secret was given another token since, which is kept.
+	if err := r.rotate(context.Background(), issuerObject); err != nil {
+		t.Fatalf("rotate() error = %v", err)
+	}
+	if len(r.pending) != 0 {
+		t.Errorf("pending = %d tokens, want 0", len(r.pending))
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(secret), secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data[CFMTLSIssuerapi.DefaultAPITokenSecretKey]); got != "replaced-token" {
+		t.Errorf("Secret token = %q, want %q", got, "replaced-token")
+	}
+}
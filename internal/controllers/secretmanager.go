@@ -0,0 +1,375 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// Environment variables injected into the controller Pod by the workload
+// identity integrations of EKS and AKS.
+const (
+	awsRoleARNEnvVar              = "AWS_ROLE_ARN"
+	awsWebIdentityTokenFileEnvVar = "AWS_WEB_IDENTITY_TOKEN_FILE"
+
+	azureClientIDEnvVar           = "AZURE_CLIENT_ID"
+	azureTenantIDEnvVar           = "AZURE_TENANT_ID"
+	azureFederatedTokenFileEnvVar = "AZURE_FEDERATED_TOKEN_FILE"
+	azureAuthorityHostEnvVar      = "AZURE_AUTHORITY_HOST"
+)
+
+const (
+	defaultAzureAuthorityHost = "https://login.microsoftonline.com/"
+	gcpMetadataTokenURL       = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// secretManagerCredentials reads the credentials of the given issuer from
+// the cloud secret manager referenced by spec.secretManager, keyed like its
+// auth Secret would be.
+func secretManagerCredentials(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, _ string) (map[string][]byte, error) {
+	manager := issuerSpec.SecretManager
+	client := &http.Client{Timeout: requestTimeout(issuerSpec), Transport: credentialTransport()}
+
+	var value string
+	var err error
+	switch {
+	case manager.AWS != nil:
+		value, err = awsSecretValue(ctx, client, manager.AWS)
+	case manager.GCP != nil:
+		value, err = gcpSecretValue(ctx, client, manager.GCP)
+	case manager.Azure != nil:
+		value, err = azureSecretValue(ctx, client, manager.Azure)
+	default:
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, errors.New("secretManager must set one of aws, gcp and azure"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSecretValue(issuerSpec, value)
+}
+
+// parseSecretValue returns the credentials held by a secret manager value,
+// which is either the API token itself or a JSON object with the keys set
+// in AuthSecretKeys.
+func parseSecretValue(issuerSpec *CFMTLSIssuerapi.IssuerSpec, value string) (map[string][]byte, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "{") {
+		if value == "" {
+			return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, errors.New("secret manager value is empty"))
+		}
+		return map[string][]byte{apiTokenSecretKey(issuerSpec): []byte(value)}, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("failed to parse secret manager value: %w", err))
+	}
+	data := map[string][]byte{}
+	for _, key := range []string{apiTokenSecretKey(issuerSpec), secondaryAPITokenSecretKey(issuerSpec), zoneIDSecretKey(issuerSpec)} {
+		if value, ok := values[key].(string); ok {
+			data[key] = []byte(value)
+		}
+	}
+	return data, nil
+}
+
+// awsSecretValue reads a secret from AWS Secrets Manager with credentials
+// obtained through IAM roles for service accounts.
+func awsSecretValue(ctx context.Context, client *http.Client, secret *CFMTLSIssuerapi.AWSSecretsManager) (string, error) {
+	creds, err := awsAssumeRoleWithWebIdentity(ctx, client, secret.Region)
+	if err != nil {
+		return "", err
+	}
+
+	input := map[string]string{"SecretId": secret.SecretID}
+	if secret.VersionStage != "" {
+		input["VersionStage"] = secret.VersionStage
+	}
+	body, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal GetSecretValue request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", secret.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsSignV4(req, body, creds, secret.Region, "secretsmanager", time.Now())
+
+	var result struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := secretManagerDo(client, req, "AWS Secrets Manager", &result); err != nil {
+		return "", fmt.Errorf("failed to read AWS secret %q: %w", secret.SecretID, err)
+	}
+	return result.SecretString, nil
+}
+
+// awsCredentials are temporary AWS credentials.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+}
+
+// awsAssumeRoleWithWebIdentity exchanges the projected ServiceAccount token
+// of the controller for temporary credentials of the IAM role it is
+// annotated with.
+func awsAssumeRoleWithWebIdentity(ctx context.Context, client *http.Client, region string) (awsCredentials, error) {
+	roleARN := os.Getenv(awsRoleARNEnvVar)
+	tokenFile := os.Getenv(awsWebIdentityTokenFileEnvVar)
+	if roleARN == "" || tokenFile == "" {
+		return awsCredentials{}, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration,
+			fmt.Errorf("IAM roles for service accounts are not configured: %s and %s must be set", awsRoleARNEnvVar, awsWebIdentityTokenFileEnvVar))
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to read web identity token: %w", err))
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {"cfmtls-issuer"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := fmt.Sprintf("https://sts.%s.amazonaws.com/", region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var result struct {
+		Response struct {
+			Result struct {
+				Credentials awsCredentials `json:"Credentials"`
+			} `json:"AssumeRoleWithWebIdentityResult"`
+		} `json:"AssumeRoleWithWebIdentityResponse"`
+	}
+	if err := secretManagerDo(client, req, "AWS STS", &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume IAM role %q: %w", roleARN, err)
+	}
+	return result.Response.Result.Credentials, nil
+}
+
+// awsSignV4 signs req with AWS Signature Version 4.
+func awsSignV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	signedHeaders = append(signedHeaders, "x-amz-target")
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpSecretValue reads a secret from Google Cloud Secret Manager with an
+// access token of the GKE workload identity of the controller.
+func gcpSecretValue(ctx context.Context, client *http.Client, secret *CFMTLSIssuerapi.GCPSecretManager) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := secretManagerDo(client, req, "GCP metadata server", &token); err != nil {
+		return "", fmt.Errorf("failed to get workload identity token: %w", err)
+	}
+
+	version := secret.Version
+	if version == "" {
+		version = "latest"
+	}
+	endpoint := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/%s:access",
+		url.PathEscape(secret.Project), url.PathEscape(secret.Secret), url.PathEscape(version))
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := secretManagerDo(client, req, "GCP Secret Manager", &result); err != nil {
+		return "", fmt.Errorf("failed to read GCP secret %q: %w", secret.Secret, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonAPIError, fmt.Errorf("failed to decode GCP secret %q: %w", secret.Secret, err))
+	}
+	return string(value), nil
+}
+
+// azureSecretValue reads a secret from Azure Key Vault with an access token
+// of the Microsoft Entra workload identity of the controller.
+func azureSecretValue(ctx context.Context, client *http.Client, secret *CFMTLSIssuerapi.AzureKeyVault) (string, error) {
+	clientID := os.Getenv(azureClientIDEnvVar)
+	tenantID := os.Getenv(azureTenantIDEnvVar)
+	tokenFile := os.Getenv(azureFederatedTokenFileEnvVar)
+	if clientID == "" || tenantID == "" || tokenFile == "" {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration,
+			fmt.Errorf("workload identity is not configured: %s, %s and %s must be set", azureClientIDEnvVar, azureTenantIDEnvVar, azureFederatedTokenFileEnvVar))
+	}
+	assertion, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to read federated token: %w", err))
+	}
+	authorityHost := os.Getenv(azureAuthorityHostEnvVar)
+	if authorityHost == "" {
+		authorityHost = defaultAzureAuthorityHost
+	}
+
+	form := url.Values{
+		"client_id":             {clientID},
+		"scope":                 {"https://vault.azure.net/.default"},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authorityHost, "/"), url.PathEscape(tenantID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := secretManagerDo(client, req, "Microsoft Entra ID", &token); err != nil {
+		return "", fmt.Errorf("failed to get workload identity token: %w", err)
+	}
+
+	endpoint = fmt.Sprintf("%s/secrets/%s/%s?api-version=7.4",
+		strings.TrimSuffix(secret.VaultURL, "/"), url.PathEscape(secret.SecretName), url.PathEscape(secret.Version))
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var result struct {
+		Value string `json:"value"`
+	}
+	if err := secretManagerDo(client, req, "Azure Key Vault", &result); err != nil {
+		return "", fmt.Errorf("failed to read Azure secret %q: %w", secret.SecretName, err)
+	}
+	return result.Value, nil
+}
+
+// secretManagerDo sends a request to the named cloud service and decodes
+// the JSON response into result.
+func secretManagerDo(client *http.Client, req *http.Request, service string, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, fmt.Errorf("failed to send request to %s: %w", service, err))
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return withReason(CFMTLSIssuerapi.ReasonSecretNotFound, fmt.Errorf("%s responded with status: 404", service))
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, fmt.Errorf("%s responded with status: %d", service, resp.StatusCode))
+	case resp.StatusCode >= http.StatusBadRequest:
+		// Error responses may carry a message, but never secret material.
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("%s responded with status: %d: %s", service, resp.StatusCode, strings.TrimSpace(string(message))))
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(result); err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonAPIError, fmt.Errorf("failed to parse %s response: %w", service, err))
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestParseSecretValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       CFMTLSIssuerapi.AuthSecretKeys
+		value      string
+		want       map[string]string
+		wantReason string
+	}{
+		{
+			name:  "API token",
+			value: " token\n",
+			want:  map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "token"},
+		},
+		{
+			name:  "JSON object",
+			value: `{"cloudflare-api-key": "token", "cloudflare-zone-id": "zone", "unrelated": "value"}`,
+			want:  map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "token", CFMTLSIssuerapi.DefaultZoneIDSecretKey: "zone"},
+		},
+		{
+			name:  "JSON object with custom keys",
+			keys:  CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "zone-id"},
+			value: `{"token": "token", "zone-id": "zone"}`,
+			want:  map[string]string{"token": "token", "zone-id": "zone"},
+		},
+		{
+			name:       "invalid JSON object",
+			value:      `{"cloudflare-api-key": `,
+			wantReason: CFMTLSIssuerapi.ReasonSecretInvalid,
+		},
+		{
+			name:       "empty",
+			value:      "\n",
+			wantReason: CFMTLSIssuerapi.ReasonSecretInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := parseSecretValue(&CFMTLSIssuerapi.IssuerSpec{AuthSecretKeys: tt.keys}, tt.value)
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("parseSecretValue() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSecretValue() error = %v", err)
+			}
+			if len(data) != len(tt.want) {
+				t.Errorf("parseSecretValue() = %q, want %q", data, tt.want)
+			}
+			for key, value := range tt.want {
+				if got := string(data[key]); got != value {
+					t.Errorf("parseSecretValue()[%s] = %q, want %q", key, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestSecretManagerDo(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       string
+		wantReason string
+	}{
+		{
+			name:       "OK",
+			statusCode: http.StatusOK,
+			body:       `{"SecretString": "token"}`,
+			want:       "token",
+		},
+		{
+			name:       "not found",
+			statusCode: http.StatusNotFound,
+			wantReason: CFMTLSIssuerapi.ReasonSecretNotFound,
+		},
+		{
+			name:       "access denied",
+			statusCode: http.StatusForbidden,
+			body:       `{"message": "not authorized"}`,
+			wantReason: CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:       "unavailable",
+			statusCode: http.StatusServiceUnavailable,
+			wantReason: CFMTLSIssuerapi.ReasonAPIUnreachable,
+		},
+		{
+			name:       "invalid response",
+			statusCode: http.StatusOK,
+			body:       "<html>",
+			wantReason: CFMTLSIssuerapi.ReasonAPIError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var result struct {
+				SecretString string `json:"SecretString"`
+			}
+			err = secretManagerDo(server.Client(), req, "AWS Secrets Manager", &result)
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("secretManagerDo() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("secretManagerDo() error = %v", err)
+			}
+			if result.SecretString != tt.want {
+				t.Errorf("SecretString = %q, want %q", result.SecretString, tt.want)
+			}
+		})
+	}
+}
+
+func TestAWSSignV4(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sign := func(creds awsCredentials, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "https://secretsmanager.eu-west-1.amazonaws.com/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+		awsSignV4(req, []byte(body), creds, "eu-west-1", "secretsmanager", now)
+		return req
+	}
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI"}
+
+	req := sign(creds, `{"SecretId":"cloudflare"}`)
+	if got := req.Header.Get("X-Amz-Date"); got != "20240501T100000Z" {
+		t.Errorf("X-Amz-Date = %q, want 20240501T100000Z", got)
+	}
+	authorization := req.Header.Get("Authorization")
+	for _, want := range []string{
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-west-1/secretsmanager/aws4_request",
+		"SignedHeaders=content-type;host;x-amz-date;x-amz-target",
+	} {
+		if !strings.Contains(authorization, want) {
+			t.Errorf("Authorization = %q, want it to contain %q", authorization, want)
+		}
+	}
+	if strings.Contains(authorization, creds.SecretAccessKey) {
+		t.Errorf("Authorization = %q contains the secret access key", authorization)
+	}
+
+	// The signature covers the body and the secret access key.
+	signature := func(req *http.Request) string {
+		_, signature, _ := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+		return signature
+	}
+	if signature(sign(creds, `{"SecretId":"other"}`)) == signature(req) {
+		t.Error("signature does not depend on the body")
+	}
+	if signature(sign(awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "other"}, `{"SecretId":"cloudflare"}`)) == signature(req) {
+		t.Error("signature does not depend on the secret access key")
+	}
+
+	// The session token of temporary credentials is signed.
+	req = sign(awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI", SessionToken: "session"}, `{"SecretId":"cloudflare"}`)
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session" {
+		t.Errorf("X-Amz-Security-Token = %q, want session", got)
+	}
+	if want := "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target"; !strings.Contains(req.Header.Get("Authorization"), want) {
+		t.Errorf("Authorization = %q, want it to contain %q", req.Header.Get("Authorization"), want)
+	}
+}
+
+func TestSecretManagerCredentialsNotConfigured(t *testing.T) {
+	for _, name := range []string{awsRoleARNEnvVar, awsWebIdentityTokenFileEnvVar} {
+		t.Setenv(name, "")
+	}
+	issuerSpec := &CFMTLSIssuerapi.IssuerSpec{SecretManager: &CFMTLSIssuerapi.SecretManagerAuth{
+		AWS: &CFMTLSIssuerapi.AWSSecretsManager{Region: "eu-west-1", SecretID: "cloudflare"},
+	}}
+	_, err := secretManagerCredentials(context.Background(), issuerSpec, "")
+	if got := errorReason(err); got != CFMTLSIssuerapi.ReasonInvalidConfiguration {
+		t.Errorf("secretManagerCredentials() error = %v, want reason %s", err, CFMTLSIssuerapi.ReasonInvalidConfiguration)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// secretRefIndexField indexes issuers by the "<namespace>/<name>" keys of
+// the Secrets they reference.
+const secretRefIndexField = ".spec.secretRefs"
+
+// preSetupWithManager is the PreSetupWithManager hook of the issuer-lib
+// controllers, which is called for both the issuer and request controllers.
+func (o *Issuer) preSetupWithManager(ctx context.Context, gvk schema.GroupVersionKind, mgr ctrl.Manager, b *builder.Builder) error {
+	b.Named(controllerName(gvk))
+	if err := o.setupConcurrency(ctx, gvk, mgr, b); err != nil {
+		return err
+	}
+	if err := o.checks.setupWatch(ctx, gvk, mgr, b); err != nil {
+		return err
+	}
+	return o.setupSecretWatch(ctx, gvk, mgr, b)
+}
+
+// setupSecretWatch makes the issuer controllers reconcile, and thereby
+// re-check, the issuers referencing a Secret whenever it changes, so that a
+// rotated or revoked token is noticed immediately.
+func (o *Issuer) setupSecretWatch(ctx context.Context, gvk schema.GroupVersionKind, mgr ctrl.Manager, b *builder.Builder) error {
+	var issuerObject client.Object
+	var newList func() client.ObjectList
+	switch gvk.Kind {
+	case "CFMTLSIssuer":
+		issuerObject = &CFMTLSIssuerapi.CFMTLSIssuer{}
+		newList = func() client.ObjectList { return &CFMTLSIssuerapi.CFMTLSIssuerList{} }
+	case "CFMTLSClusterIssuer":
+		issuerObject = &CFMTLSIssuerapi.CFMTLSClusterIssuer{}
+		newList = func() client.ObjectList { return &CFMTLSIssuerapi.CFMTLSClusterIssuerList{} }
+	default:
+		return nil
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, issuerObject, secretRefIndexField, o.referencedSecrets); err != nil {
+		return err
+	}
+
+	b.Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, secret client.Object) []reconcile.Request {
+		list := newList()
+		key := client.ObjectKeyFromObject(secret).String()
+		if err := o.client.List(ctx, list, client.MatchingFields{secretRefIndexField: key}); err != nil {
+			log.FromContext(ctx).Error(err, "failed to list issuers referencing Secret", "secret", key)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		switch list := list.(type) {
+		case *CFMTLSIssuerapi.CFMTLSIssuerList:
+			for _, issuer := range list.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&issuer)})
+			}
+		case *CFMTLSIssuerapi.CFMTLSClusterIssuerList:
+			for _, issuer := range list.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&issuer)})
+			}
+		}
+		return requests
+	}))
+	return nil
+}
+
+// referencedSecrets returns the keys of the Secrets read on behalf of the
+// given issuer object.
+func (o *Issuer) referencedSecrets(obj client.Object) []string {
+	var spec *CFMTLSIssuerapi.IssuerSpec
+	var namespace string
+	switch t := obj.(type) {
+	case *CFMTLSIssuerapi.CFMTLSIssuer:
+		spec, namespace = &t.Spec, t.Namespace
+	case *CFMTLSIssuerapi.CFMTLSClusterIssuer:
+		ns, err := o.clusterIssuerSecretNamespace(&t.Spec)
+		if err != nil {
+			return nil
+		}
+		spec, namespace = &t.Spec, ns
+	default:
+		return nil
+	}
+
+	var names []string
+	if spec.AuthSecretName != "" {
+		names = append(names, spec.AuthSecretName)
+	}
+	if spec.Proxy != nil && spec.Proxy.CABundleSecretRef != nil {
+		names = append(names, spec.Proxy.CABundleSecretRef.Name)
+	}
+	if spec.Vault != nil && spec.Vault.CABundleSecretRef != nil {
+		names = append(names, spec.Vault.CABundleSecretRef.Name)
+	}
+
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, types.NamespacedName{Namespace: namespace, Name: name}.String())
+	}
+	return keys
+}
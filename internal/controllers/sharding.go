@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"hash/fnv"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// sharded reports whether the issuers are partitioned across replicas.
+func (o *Issuer) sharded() bool {
+	return o.ShardCount > 1
+}
+
+// ownsIssuer reports whether the issuer with the given key belongs to the
+// shard of this replica. The key of a cluster issuer has no namespace.
+func (o *Issuer) ownsIssuer(key types.NamespacedName) bool {
+	if !o.sharded() {
+		return true
+	}
+	return shardOf(key, o.ShardCount) == o.ShardIndex
+}
+
+// shardOf returns the shard, out of count, that the issuer with the given
+// key belongs to.
+func shardOf(key types.NamespacedName, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key.String()))
+	return int(h.Sum32() % uint32(count))
+}
+
+// ignoreIssuer is the IgnoreIssuer hook of issuer-lib, which leaves the
+// issuers of other shards to their replicas.
+func (o *Issuer) ignoreIssuer(_ context.Context, issuerObject issuerapi.Issuer) (bool, error) {
+	return !o.ownsIssuer(types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}), nil
+}
+
+// ignoreCertificateRequest is the IgnoreCertificateRequest hook of
+// issuer-lib, which leaves the requests for the issuers of other shards to
+// their replicas.
+func (o *Issuer) ignoreCertificateRequest(_ context.Context, _ signer.CertificateRequestObject, _ schema.GroupVersionKind, issuerName types.NamespacedName) (bool, error) {
+	return !o.ownsIssuer(issuerName), nil
+}
+
+// issuerReferenceKey returns the key of the referenced issuer. A
+// CFMTLSIssuer is in the namespace of the referencing object.
+func issuerReferenceKey(ref CFMTLSIssuerapi.IssuerReference, namespace string) types.NamespacedName {
+	key := types.NamespacedName{Name: ref.Name}
+	if ref.Kind != "CFMTLSClusterIssuer" {
+		key.Namespace = namespace
+	}
+	return key
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestOwnsIssuer(t *testing.T) {
+	const shards = 3
+	replicas := make([]*Issuer, shards)
+	for i := range replicas {
+		replicas[i] = &Issuer{ShardCount: shards, ShardIndex: i}
+	}
+
+	served := make([]int, shards)
+	for i := 0; i < 300; i++ {
+		key := types.NamespacedName{Namespace: fmt.Sprintf("team-%d", i%7), Name: fmt.Sprintf("issuer-%d", i)}
+		if i%5 == 0 {
+			// A cluster issuer.
+			key.Namespace = ""
+		}
+
+		owners := 0
+		for index, replica := range replicas {
+			if replica.ownsIssuer(key) {
+				owners++
+				served[index]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("issuer %s is owned by %d replicas, want 1", key, owners)
+		}
+	}
+	for index, n := range served {
+		if n == 0 {
+			t.Errorf("replica %d serves no issuer", index)
+		}
+	}
+
+	if !(&Issuer{}).ownsIssuer(types.NamespacedName{Name: "issuer"}) {
+		t.Error("unsharded replica does not own the issuer")
+	}
+}
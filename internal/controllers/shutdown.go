@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// statusWriteTimeout bounds the status writes that are completed while the
+// controller shuts down.
+const statusWriteTimeout = 30 * time.Second
+
+// signingTracker counts the signings that are in flight, so that shutdown
+// can wait for them instead of abandoning certificates that Cloudflare has
+// already issued.
+type signingTracker struct {
+	mu       sync.Mutex
+	draining bool
+	inFlight int
+	// idle is closed once draining and no signing is in flight.
+	idle chan struct{}
+}
+
+func newSigningTracker() *signingTracker {
+	return &signingTracker{idle: make(chan struct{})}
+}
+
+// start registers a signing. It returns false once the tracker is draining,
+// in which case the signing must not be started.
+func (t *signingTracker) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.inFlight++
+	return true
+}
+
+// done unregisters a signing registered by start.
+func (t *signingTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	if t.draining && t.inFlight == 0 {
+		close(t.idle)
+	}
+}
+
+// drain stops new signings from starting and waits until those in flight
+// are done, or ctx is cancelled.
+func (t *signingTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.draining {
+		t.draining = true
+		if t.inFlight == 0 {
+			close(t.idle)
+		}
+	}
+	inFlight := t.inFlight
+	t.mu.Unlock()
+
+	select {
+	case <-t.idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d signings still in flight: %w", inFlight, ctx.Err())
+	}
+}
+
+// Drain prepares the controllers for shutdown: new signings are kept pending
+// for the next replica, and Drain returns once the signings in flight have
+// completed, or ctx is cancelled. The manager should only be stopped after
+// that, so that the issued certificates are not requested again.
+func (o *Issuer) Drain(ctx context.Context) error {
+	if o.signings == nil {
+		return nil
+	}
+	return o.signings.drain(ctx)
+}
+
+// shutdownManager hands the controllers a client whose status writes
+// outlive the cancellation of the manager, so that the status of a request
+// that was signed while draining is still patched.
+type shutdownManager struct {
+	ctrl.Manager
+	client client.Client
+}
+
+func newShutdownManager(mgr ctrl.Manager) shutdownManager {
+	return shutdownManager{Manager: mgr, client: detachedStatusClient{Client: mgr.GetClient()}}
+}
+
+// GetClient implements ctrl.Manager.
+func (m shutdownManager) GetClient() client.Client {
+	return m.client
+}
+
+// detachedStatusClient is a client whose status writes are not cancelled
+// with the context of the caller, but time out after statusWriteTimeout.
+type detachedStatusClient struct {
+	client.Client
+}
+
+// Status implements client.StatusClient.
+func (c detachedStatusClient) Status() client.SubResourceWriter {
+	return detachedStatusWriter{writer: c.Client.Status()}
+}
+
+type detachedStatusWriter struct {
+	writer client.SubResourceWriter
+}
+
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), statusWriteTimeout)
+}
+
+func (w detachedStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	ctx, cancel := detach(ctx)
+	defer cancel()
+	return w.writer.Create(ctx, obj, subResource, opts...)
+}
+
+func (w detachedStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	ctx, cancel := detach(ctx)
+	defer cancel()
+	return w.writer.Update(ctx, obj, opts...)
+}
+
+func (w detachedStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	ctx, cancel := detach(ctx)
+	defer cancel()
+	return w.writer.Patch(ctx, obj, patch, opts...)
+}
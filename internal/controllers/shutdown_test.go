@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSigningTrackerDrain(t *testing.T) {
+	tracker := newSigningTracker()
+	if !tracker.start() {
+		t.Fatal("start() = false before draining")
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- tracker.drain(context.Background()) }()
+
+	// Wait for drain to take effect before checking that new signings are
+	// refused.
+	for deadline := time.Now().Add(time.Second); ; {
+		tracker.mu.Lock()
+		draining := tracker.draining
+		tracker.mu.Unlock()
+		if draining {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tracker did not start draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if tracker.start() {
+		t.Fatal("start() = true while draining")
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("drain() returned %v with a signing in flight", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	tracker.done()
+	if err := <-drained; err != nil {
+		t.Fatalf("drain() error = %v", err)
+	}
+}
+
+func TestSigningTrackerDrainTimeout(t *testing.T) {
+	tracker := newSigningTracker()
+	tracker.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tracker.drain(ctx); err == nil {
+		t.Fatal("drain() succeeded with a signing in flight")
+	}
+
+	// A second drain must not close idle twice.
+	tracker.done()
+	if err := tracker.drain(context.Background()); err != nil {
+		t.Fatalf("drain() error = %v", err)
+	}
+}
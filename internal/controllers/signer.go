@@ -23,24 +23,43 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	"github.com/cert-manager/cert-manager/pkg/util/pki"
 	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/conditions"
 	"github.com/cert-manager/issuer-lib/controllers"
 	"github.com/cert-manager/issuer-lib/controllers/signer"
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/featuregate"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/audit"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+	"github.com/krisek/cfmtls-issuer/internal/tracing"
 
 	// "encoding/base64"
 
 )
 
+// DefaultFieldOwner is the default server-side apply field manager of the
+// controllers.
+const DefaultFieldOwner = "CFMTLSIssuer.cert-manager.io"
+
 var (
 	errGetAuthSecret        = errors.New("failed to get Secret containing Issuer credentials")
 	errHealthCheckerBuilder = errors.New("failed to build the healthchecker")
@@ -50,9 +69,98 @@ var (
 	errSignerSign    = errors.New("failed to sign")
 )
 
+// apiTokenSecretKey returns the key of the auth Secret that holds the
+// Cloudflare API token for the given issuer.
+func apiTokenSecretKey(issuerSpec *CFMTLSIssuerapi.IssuerSpec) string {
+	if issuerSpec.AuthSecretKeys.APIToken != "" {
+		return issuerSpec.AuthSecretKeys.APIToken
+	}
+	return CFMTLSIssuerapi.DefaultAPITokenSecretKey
+}
+
+// zoneIDSecretKey returns the key of the auth Secret that holds the
+// Cloudflare zone ID for the given issuer.
+func zoneIDSecretKey(issuerSpec *CFMTLSIssuerapi.IssuerSpec) string {
+	if issuerSpec.AuthSecretKeys.ZoneID != "" {
+		return issuerSpec.AuthSecretKeys.ZoneID
+	}
+	return CFMTLSIssuerapi.DefaultZoneIDSecretKey
+}
+
+// secondaryAPITokenSecretKey returns the key of the auth Secret that holds
+// the secondary Cloudflare API token for the given issuer.
+func secondaryAPITokenSecretKey(issuerSpec *CFMTLSIssuerapi.IssuerSpec) string {
+	if issuerSpec.AuthSecretKeys.SecondaryAPIToken != "" {
+		return issuerSpec.AuthSecretKeys.SecondaryAPIToken
+	}
+	return CFMTLSIssuerapi.DefaultSecondaryAPITokenSecretKey
+}
+
+// accessClientIDSecretKey returns the key of the auth Secret that holds the
+// Cloudflare Access client ID for the given issuer.
+func accessClientIDSecretKey(issuerSpec *CFMTLSIssuerapi.IssuerSpec) string {
+	if issuerSpec.AuthSecretKeys.AccessClientID != "" {
+		return issuerSpec.AuthSecretKeys.AccessClientID
+	}
+	return CFMTLSIssuerapi.DefaultAccessClientIDSecretKey
+}
+
+// accessClientSecretSecretKey returns the key of the auth Secret that holds
+// the Cloudflare Access client secret for the given issuer.
+func accessClientSecretSecretKey(issuerSpec *CFMTLSIssuerapi.IssuerSpec) string {
+	if issuerSpec.AuthSecretKeys.AccessClientSecret != "" {
+		return issuerSpec.AuthSecretKeys.AccessClientSecret
+	}
+	return CFMTLSIssuerapi.DefaultAccessClientSecretSecretKey
+}
+
+// registerCredentials makes the credentials of the given issuer redacted
+// from logs, events and errors.
+func registerCredentials(issuerSpec *CFMTLSIssuerapi.IssuerSpec, secretData map[string][]byte) {
+	redact.Register(
+		string(secretData[apiTokenSecretKey(issuerSpec)]),
+		string(secretData[secondaryAPITokenSecretKey(issuerSpec)]),
+		string(secretData[accessClientSecretSecretKey(issuerSpec)]),
+	)
+}
+
+// withTokenFailover calls fn with the primary API token of the issuer and,
+// if Cloudflare rejects it and a secondary token is configured, again with
+// the secondary token. It reports whether the secondary token was used.
+func withTokenFailover(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, secretData map[string][]byte, fn func(apiKey string) error) (bool, error) {
+	err := fn(string(secretData[apiTokenSecretKey(issuerSpec)]))
+	secondary := string(secretData[secondaryAPITokenSecretKey(issuerSpec)])
+	if err == nil || secondary == "" || errorReason(err) != CFMTLSIssuerapi.ReasonTokenInvalid {
+		return false, err
+	}
+
+	log.FromContext(ctx).Info("Cloudflare rejected the primary API token, retrying with the secondary token", "reason", errorReason(err), "error", err.Error())
+	return true, fn(secondary)
+}
+
+// resolveZoneID returns the zone ID from the issuer spec or ConfigMap,
+// falling back to the zone ID stored in the auth Secret.
+func resolveZoneID(issuerSpec *CFMTLSIssuerapi.IssuerSpec, config issuerConfig, secretData map[string][]byte) string {
+	if config.zoneID != "" {
+		return config.zoneID
+	}
+	return string(secretData[zoneIDSecretKey(issuerSpec)])
+}
+
+// requestTimeout returns the timeout of Cloudflare API requests made for the
+// given issuer.
+func requestTimeout(issuerSpec *CFMTLSIssuerapi.IssuerSpec) time.Duration {
+	if issuerSpec.RequestTimeout != nil {
+		return issuerSpec.RequestTimeout.Duration
+	}
+	return CFMTLSIssuerapi.DefaultRequestTimeout
+}
+
 type CloudflareSigner struct {
-	APIKey string
-	ZoneID string
+	APIKey     string
+	ZoneID     string
+	BaseURL    string
+	HTTPClient *http.Client
 }
 
 type HealthChecker interface {
@@ -71,8 +179,150 @@ type Issuer struct {
 	HealthCheckerBuilder     HealthCheckerBuilder
 	SignerBuilder            SignerBuilder
 	ClusterResourceNamespace string
-
-	client client.Client
+	// AllowedSecretNamespaces lists the namespaces, besides the
+	// ClusterResourceNamespace, that a CFMTLSClusterIssuer may reference an
+	// auth Secret in.
+	AllowedSecretNamespaces []string
+	// CredentialsDir is the directory that spec.authFile paths of
+	// CFMTLSClusterIssuers are resolved against. Empty disables authFile.
+	CredentialsDir string
+	// SecretSelector is the label selector the Secret cache of the manager
+	// is restricted to, if any. It is only used to explain missing Secrets.
+	SecretSelector labels.Selector
+	// TrustBundleSource is the ConfigMap holding the CA certificates that
+	// the TrustBundle feature publishes, under the key "ca.crt".
+	TrustBundleSource types.NamespacedName
+	// TrustBundleConfigMap is the name of the ConfigMaps the trust bundle is
+	// published in.
+	TrustBundleConfigMap string
+	// TrustBundleNamespaces selects the namespaces the trust bundle is
+	// published to. Nil selects none.
+	TrustBundleNamespaces labels.Selector
+	// CredentialProviders registers additional sources of issuer
+	// credentials. They are consulted in order before the built-in providers.
+	CredentialProviders []CredentialProvider
+	// MaxRetryDuration is the MaxRetryDuration of issuers that do not set
+	// one. Zero uses CFMTLSIssuerapi.DefaultMaxRetryDuration.
+	MaxRetryDuration time.Duration
+	// MaxConcurrentReconciles is the number of CertificateRequests and
+	// CertificateSigningRequests that are signed in parallel. Zero uses the
+	// controller-runtime default of one.
+	MaxConcurrentReconciles int
+	// Namespaces restricts the controllers to the given namespaces, which
+	// the cache of the manager must be restricted to as well. The cluster
+	// scoped CFMTLSClusterIssuers and CertificateSigningRequests are not
+	// served then. Empty serves all namespaces.
+	Namespaces []string
+	// FeatureGate decides which optional subsystems are run. Nil uses the
+	// defaults of the features package.
+	FeatureGate featuregate.FeatureGate
+	// FieldOwner is the server-side apply field manager of the status
+	// patches. Empty uses DefaultFieldOwner.
+	FieldOwner string
+	// ShardCount partitions the issuers, by a hash of their namespace and
+	// name, across that many active replicas. Each replica only serves the
+	// issuers of shard ShardIndex, and the requests and revocations that
+	// reference them. Zero or one disables sharding.
+	ShardCount int
+	// ShardIndex is the shard served by this replica, in [0, ShardCount).
+	ShardIndex int
+	// AuditLog records every issuance and failed signing. Nil disables the
+	// audit log.
+	AuditLog *audit.Logger
+	// CertificateEvents records the issuance event on the cert-manager
+	// Certificate owning a CertificateRequest as well.
+	CertificateEvents bool
+	// RequireApproval refuses to sign requests that lack the Approved
+	// condition, and fails those that were denied, keeping the former
+	// pending with an ApprovalPending event.
+	RequireApproval bool
+	// TenantLabel is the key of the namespace label naming the team that
+	// owns a namespace. Its value is added to the issuance metrics, the
+	// audit records and the tracking objects of the requests of the
+	// namespace. Empty disables tenants.
+	TenantLabel string
+	// DebugHTTP logs the method, URL, status, duration and cf-ray ID of
+	// every Cloudflare API request.
+	DebugHTTP bool
+	// DebugHTTPBodies logs the headers and bodies of the Cloudflare API
+	// requests and responses as well, with the credentials redacted. It
+	// implies DebugHTTP.
+	DebugHTTPBodies bool
+	// DNSServer is the address of the DNS server that resolves the host of
+	// the Cloudflare API, and of the proxies, instead of the resolver of
+	// the host. Empty uses the resolver of the host.
+	DNSServer string
+	// HostOverrides maps host names, e.g. api.cloudflare.com, to the IP
+	// addresses that the transports to the Cloudflare API dial instead of
+	// resolving them.
+	HostOverrides map[string]string
+	// FaultInjection injects faults into the Cloudflare API requests. It
+	// is meant for development and CI only. Nil injects no faults.
+	FaultInjection *FaultInjection
+	// CloudflareRateLimit is the number of requests per minute sent to the
+	// Cloudflare API for a zone on behalf of the issuers that do not set a
+	// RateLimit. Zero does not limit them.
+	CloudflareRateLimit int
+	// CloudflareRateLimitBurst is the burst of CloudflareRateLimit. Zero
+	// uses CFMTLSIssuerapi.DefaultRateLimitBurst.
+	CloudflareRateLimitBurst int
+	// CredentialCacheTTL is how long the credentials of an issuer that
+	// were fetched and checked successfully are reused by its signings.
+	// Zero disables the cache.
+	CredentialCacheTTL time.Duration
+	// CleanupTTL is how long the retry annotations of finished requests and
+	// the CloudflareOriginCertificates of expired or superseded certificates
+	// are kept before the janitor removes them. Zero disables the janitor.
+	CleanupTTL time.Duration
+	// OrphanGCInterval is how often the orphan garbage collector looks for
+	// certificates at Cloudflare that are no longer tracked. It requires the
+	// Revocation feature. Zero disables it.
+	OrphanGCInterval time.Duration
+	// OrphanGCDryRun only reports the orphaned certificates instead of
+	// revoking them.
+	OrphanGCDryRun bool
+	// MaxConcurrentSignings is the number of signing requests sent to the
+	// Cloudflare API at once, independently of MaxConcurrentReconciles.
+	// Zero does not limit them.
+	MaxConcurrentSignings int
+	// IssuanceBudget is the number of certificates issued per zone over a
+	// sliding week. Once most of it is used, renewals that are not due yet
+	// are deferred, so that it is left to urgent requests. Zero does not
+	// limit issuance.
+	IssuanceBudget int
+	// WarmUpConcurrency is the number of issuers checked in parallel, most
+	// notably by the warm-up when this replica becomes the leader. Zero
+	// checks them one at a time.
+	WarmUpConcurrency int
+	// AttemptTimeout bounds an attempt to sign a request or to check an
+	// issuer, including all its Cloudflare API requests and their retries.
+	// Zero does not bound them beyond the timeouts of the requests.
+	AttemptTimeout time.Duration
+
+	client   client.Client
+	issued   *issuanceCounter
+	retries  *retryTracker
+	checks   *checkScheduler
+	signings *signingTracker
+	recorder record.EventRecorder
+	// transports pools the connections to the Cloudflare API.
+	transports *transportCache
+	// limiters rate limits the requests to the Cloudflare API per zone.
+	limiters *zoneLimiters
+	// breakers stop the requests to the Cloudflare API while it is failing.
+	breakers *circuitBreakers
+	// credentials caches the credentials of the issuers for their
+	// signings.
+	credentials *credentialCache
+	// signingSlots bounds the signing requests in flight.
+	signingSlots signingSlots
+	// budgets tracks the issuance budget of the zones.
+	budgets *issuanceBudgets
+	// warmUp tracks the checks of the issuers on startup.
+	warmUp *warmUp
+	// index records the owners of the issued certificates. Nil unless the
+	// CertificateIndex feature is enabled.
+	index *certificateIndex
 }
 
 func convertDurationToDays(duration string) (int, error) {
@@ -90,36 +340,173 @@ func convertDurationToDays(duration string) (int, error) {
 
 // +kubebuilder:rbac:groups=cfmtls.cert.manager.io,resources=CFMTLSClusterIssuers;CFMTLSIssuers,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cfmtls.cert.manager.io,resources=CFMTLSClusterIssuers/status;CFMTLSIssuers/status,verbs=patch
+// +kubebuilder:rbac:groups=cfmtls.cert.manager.io,resources=cloudflareorigincertificates,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
-// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;patch
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=patch
-// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch;patch
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/status,verbs=patch
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,verbs=sign,resourceNames=CFMTLSClusterIssuers.cfmtls.cert.manager.io/*;CFMTLSIssuers.cfmtls.cert.manager.io/*
 
-func (s Issuer) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+func (s *Issuer) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	// Status writes must complete even if the manager stops right after a
+	// signing, see Drain.
+	mgr = newShutdownManager(mgr)
+
 	s.client = mgr.GetClient()
+	s.issued = newIssuanceCounter()
+	s.retries = newRetryTracker()
+	s.checks = newCheckScheduler(mgr.GetClient(), s.clusterScoped())
+	s.signings = newSigningTracker()
+	s.transports = newTransportCache(newCloudflareDialer(s.DNSServer, s.HostOverrides))
+	s.limiters = newZoneLimiters()
+	s.breakers = newCircuitBreakers()
+	s.credentials = newCredentialCache(s.CredentialCacheTTL)
+	s.signingSlots = newSigningSlots(s.MaxConcurrentSignings)
+	s.budgets = newIssuanceBudgets(s.IssuanceBudget)
+	s.warmUp = &warmUp{Issuer: s}
+	if s.featureEnabled(features.CertificateIndex) {
+		if s.ClusterResourceNamespace == "" {
+			return errors.New("the CertificateIndex feature requires a cluster resource namespace")
+		}
+		s.index = &certificateIndex{client: mgr.GetClient(), namespace: s.ClusterResourceNamespace}
+	}
+	recorder := newAggregatingRecorder(mgr.GetEventRecorderFor("CFMTLSIssuer.cert-manager.io"))
+	s.recorder = recorder
+
+	if err := mgr.Add(s.checks); err != nil {
+		return err
+	}
+	if err := mgr.Add(s.warmUp); err != nil {
+		return err
+	}
+	if s.CleanupTTL > 0 {
+		if err := mgr.Add(&janitor{Issuer: s, now: time.Now}); err != nil {
+			return err
+		}
+	}
+	if err := mgr.Add(recorder); err != nil {
+		return err
+	}
+	if err := metrics.RegisterPendingRequests(s.pendingRequests); err != nil {
+		return err
+	}
+	if s.featureEnabled(features.TokenRotation) {
+		if err := mgr.Add(&tokenRotator{Issuer: s}); err != nil {
+			return err
+		}
+	}
+
+	var clusterIssuerTypes []issuerapi.Issuer
+	if s.clusterScoped() {
+		clusterIssuerTypes = []issuerapi.Issuer{&CFMTLSIssuerapi.CFMTLSClusterIssuer{}}
+	}
 
-	return (&controllers.CombinedController{
+	if err := (&controllers.CombinedController{
 		IssuerTypes:        []issuerapi.Issuer{&CFMTLSIssuerapi.CFMTLSIssuer{}},
-		ClusterIssuerTypes: []issuerapi.Issuer{&CFMTLSIssuerapi.CFMTLSClusterIssuer{}},
+		ClusterIssuerTypes: clusterIssuerTypes,
+		// CertificateSigningRequests are cluster scoped and can only
+		// reference cluster issuers.
+		DisableKubernetesCSRController: !s.clusterScoped(),
+
+		FieldOwner: s.fieldOwner(),
+		// Retries are normally governed by the per-issuer retry policy in
+		// Sign; this only bounds errors that bypass it.
+		MaxRetryDuration: s.maxRetryDuration(),
 
-		FieldOwner:       "CFMTLSIssuer.cert-manager.io",
-		MaxRetryDuration: 1 * time.Minute,
+		// Re-run health checks of issuers that set spec.checkInterval or
+		// whose Secrets change, and parallelize signing.
+		PreSetupWithManager: s.preSetupWithManager,
+
+		// Leave the issuers and requests of other shards to their replicas.
+		IgnoreIssuer:             s.ignoreIssuer,
+		IgnoreCertificateRequest: s.ignoreCertificateRequest,
 
 		Sign:          s.Sign,
 		Check:         s.Check,
-		EventRecorder: mgr.GetEventRecorderFor("CFMTLSIssuer.cert-manager.io"),
-	}).SetupWithManager(ctx, mgr)
+		EventRecorder: s.recorder,
+	}).SetupWithManager(ctx, mgr); err != nil {
+		return err
+	}
+
+	if s.featureEnabled(features.TrustBundle) {
+		if !s.clusterScoped() {
+			return errors.New("the TrustBundle feature requires a controller that is not restricted to namespaces")
+		}
+		if err := (&trustBundleReconciler{Issuer: s}).SetupWithManager(mgr); err != nil {
+			return err
+		}
+	}
+
+	if !s.featureEnabled(features.Revocation) {
+		return nil
+	}
+	if err := (&revocationReconciler{Issuer: s}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+	if err := (&revokeOnDeleteReconciler{Issuer: s}).SetupWithManager(mgr); err != nil {
+		return err
+	}
+	if s.OrphanGCInterval > 0 {
+		if err := mgr.Add(&orphanCollector{Issuer: s, now: time.Now}); err != nil {
+			return err
+		}
+	}
+	return (&supersededReconciler{Issuer: s}).SetupWithManager(mgr)
+}
+
+// fieldOwner returns the server-side apply field manager of the controllers.
+func (o *Issuer) fieldOwner() string {
+	if o.FieldOwner != "" {
+		return o.FieldOwner
+	}
+	return DefaultFieldOwner
+}
+
+// featureEnabled reports whether the given feature is enabled.
+func (o *Issuer) featureEnabled(feature featuregate.Feature) bool {
+	gate := o.FeatureGate
+	if gate == nil {
+		gate = features.NewFeatureGate()
+	}
+	return gate.Enabled(feature)
 }
 
 func (o *Issuer) getIssuerDetails(issuerObject issuerapi.Issuer) (*CFMTLSIssuerapi.IssuerSpec, string, error) {
 	switch t := issuerObject.(type) {
 	case *CFMTLSIssuerapi.CFMTLSIssuer:
+		// The default credentials, credential files and workload identity
+		// of the controller are reserved for cluster issuers.
+		if t.Spec.AuthFile != nil {
+			return nil, "", signer.PermanentError{
+				Err: errors.New("authFile is only supported on CFMTLSClusterIssuer"),
+			}
+		}
+		if t.Spec.SecretManager != nil {
+			return nil, "", signer.PermanentError{
+				Err: errors.New("secretManager is only supported on CFMTLSClusterIssuer"),
+			}
+		}
+		if t.Spec.AuthSecretName == "" && t.Spec.Vault == nil {
+			return nil, "", signer.PermanentError{
+				Err: errors.New("one of authSecretName and vault is required on CFMTLSIssuer"),
+			}
+		}
+		if t.Spec.AuthSecretNamespace != "" && t.Spec.AuthSecretNamespace != t.GetNamespace() {
+			return nil, "", signer.PermanentError{
+				Err: fmt.Errorf("authSecretNamespace %q is only supported on CFMTLSClusterIssuer", t.Spec.AuthSecretNamespace),
+			}
+		}
 		return &t.Spec, issuerObject.GetNamespace(), nil
 	case *CFMTLSIssuerapi.CFMTLSClusterIssuer:
-		return &t.Spec, o.ClusterResourceNamespace, nil
+		namespace, err := o.clusterIssuerSecretNamespace(&t.Spec)
+		if err != nil {
+			return nil, "", err
+		}
+		return &t.Spec, namespace, nil
 	default:
 		// A permanent error will cause the Issuer to not retry until the
 		// Issuer is updated.
@@ -129,6 +516,45 @@ func (o *Issuer) getIssuerDetails(issuerObject issuerapi.Issuer) (*CFMTLSIssuera
 	}
 }
 
+// clusterScoped reports whether the controllers serve all namespaces, and
+// thereby the cluster scoped resources.
+func (o *Issuer) clusterScoped() bool {
+	return len(o.Namespaces) == 0
+}
+
+// issuerSpecOf returns the spec of the given issuer object, or nil if the
+// object is not one of our issuer types.
+func issuerSpecOf(issuerObject issuerapi.Issuer) *CFMTLSIssuerapi.IssuerSpec {
+	switch t := issuerObject.(type) {
+	case *CFMTLSIssuerapi.CFMTLSIssuer:
+		return &t.Spec
+	case *CFMTLSIssuerapi.CFMTLSClusterIssuer:
+		return &t.Spec
+	default:
+		return nil
+	}
+}
+
+// clusterIssuerSecretNamespace returns the namespace that the auth Secret of
+// a CFMTLSClusterIssuer is read from. Namespaces other than the
+// ClusterResourceNamespace must be present in AllowedSecretNamespaces.
+func (o *Issuer) clusterIssuerSecretNamespace(issuerSpec *CFMTLSIssuerapi.IssuerSpec) (string, error) {
+	namespace := issuerSpec.AuthSecretNamespace
+	if namespace == "" || namespace == o.ClusterResourceNamespace {
+		return o.ClusterResourceNamespace, nil
+	}
+
+	for _, allowed := range o.AllowedSecretNamespaces {
+		if namespace == allowed {
+			return namespace, nil
+		}
+	}
+
+	return "", signer.PermanentError{
+		Err: fmt.Errorf("authSecretNamespace %q is not in the list of allowed cluster issuer secret namespaces", namespace),
+	}
+}
+
 // isClientAuthCert checks if the certificate request includes client authentication usage.
 func isClientAuthCert(usages []x509.ExtKeyUsage) bool {
     for _, usage := range usages {
@@ -139,67 +565,102 @@ func isClientAuthCert(usages []x509.ExtKeyUsage) bool {
     return false
 }
 
-func (c *CloudflareSigner) Sign(ctx context.Context, csrPEM []byte, validity_days int64) ([]byte, error) {
+func (c *CloudflareSigner) Sign(ctx context.Context, csrPEM []byte, validity_days int64) ([]byte, string, error) {
 	logger := log.FromContext(ctx).WithName("Sign")
 
-	requestData := map[string]interface{}{
-		"csr": string(csrPEM),
-		"validity_days": validity_days,
-	}
-
 	// 🔹 Log the request being sent
-	requestBody, err := json.MarshalIndent(requestData, "", "  ") // Pretty-print JSON
+	requestBody, err := json.Marshal(signingRequest{CSR: string(csrPEM), ValidityDays: validity_days})
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	logger.V(2).Info("Full request to Cloudflare API:\n", string(requestBody))
+	logger.V(2).Info("sending request to Cloudflare", "zoneID", c.ZoneID, "request", redact.String(string(requestBody)))
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/client_certificates", c.ZoneID), bytes.NewBuffer(requestBody))
+	// The request carries the span and the deadline of the signing, but is
+	// not cancelled with it, so that an issued certificate is not lost on
+	// shutdown.
+	reqCtx := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithDeadline(reqCtx, deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, "POST", fmt.Sprintf("%s/zones/%s/client_certificates", c.BaseURL, c.ZoneID), bytes.NewReader(requestBody))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, "", fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request to Cloudflare: %w", err)
+		return nil, "", requestError(err)
 	}
 	defer resp.Body.Close()
 
-	// 🔹 Log Cloudflare's response
-	respBody := new(bytes.Buffer)
-	_, _ = respBody.ReadFrom(resp.Body)
-	logger.V(2).Info("Cloudflare API Response:", resp.Status, "\n", respBody.String())
+	logger = logger.WithValues("cfRay", resp.Header.Get(cfRayHeader))
+	succeeded := resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated
+
+	// The response is decoded as it is read. It is only buffered to be
+	// logged, or for the error messages of a failed request.
+	var body io.Reader = resp.Body
+	var buf *bytes.Buffer
+	if !succeeded || logger.V(2).Enabled() {
+		buf = getBuffer()
+		defer putBuffer(buf)
+		body = io.TeeReader(body, buf)
+	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("Cloudflare API responded with status: %d", resp.StatusCode)
+	if !succeeded {
+		_, _ = io.Copy(io.Discard, io.LimitReader(body, maxErrorBodySize))
+		logger.V(2).Info("received response from Cloudflare", "status", resp.Status, "response", redact.String(buf.String()))
+		return nil, "", signingError(resp, buf.Bytes())
 	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(respBody).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to parse Cloudflare response: %w", err)
+	var result signingResponse
+	err = json.NewDecoder(body).Decode(&result)
+	if buf != nil {
+		// 🔹 Log Cloudflare's response
+		logger.V(2).Info("received response from Cloudflare", "status", resp.Status, "response", redact.String(buf.String()))
+	}
+	if err != nil {
+		return nil, "", withReason(CFMTLSIssuerapi.ReasonAPIError, withCFRay(fmt.Errorf("failed to parse Cloudflare response: %w", err), resp))
 	}
-	
-	// Access the certificate from the "result" field
-	resultData, ok := result["result"].(map[string]interface{})
-	if !ok {
-		return nil, errors.New("invalid response format: missing 'result' field")
+	if result.Result == nil {
+		return nil, "", withReason(CFMTLSIssuerapi.ReasonAPIError, withCFRay(errors.New("invalid response format: missing 'result' field"), resp))
 	}
-	
-	certPEM, ok := resultData["certificate"].(string)
-	if !ok {
-		return nil, errors.New("invalid certificate response from Cloudflare API")
+	if result.Result.Certificate == "" {
+		return nil, "", withReason(CFMTLSIssuerapi.ReasonAPIError, withCFRay(errors.New("invalid certificate response from Cloudflare API"), resp))
 	}
-	
-	return []byte(certPEM), nil
+
+	logger.Info("Cloudflare issued certificate", "certificateID", result.Result.ID)
+	return []byte(result.Result.Certificate), result.Result.ID, nil
 }
 
 
-func (o *Issuer) getSecretData(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error) {
+// getSecretData returns the credentials of the given issuer, keyed like its
+// auth Secret would be, from the first credential provider that supports it.
+func (o *Issuer) getSecretData(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (_ map[string][]byte, err error) {
+	ctx, span := tracing.Start(ctx, "getSecretData")
+	defer func() { tracing.End(span, err) }()
+
+	for _, provider := range o.credentialProviders() {
+		if provider.Supports(issuerSpec) {
+			secretData, err := provider.Credentials(ctx, issuerSpec, namespace)
+			if err != nil {
+				return nil, err
+			}
+			registerCredentials(issuerSpec, secretData)
+			return secretData, nil
+		}
+	}
+	return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, errors.New("no credential provider supports the issuer"))
+}
+
+// secretCredentials reads the credentials of the given issuer from its auth
+// Secret and verifies them with the HealthCheckerBuilder.
+func (o *Issuer) secretCredentials(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error) {
 	secretName := types.NamespacedName{
 		Namespace: namespace,
 		Name:      issuerSpec.AuthSecretName,
@@ -207,25 +668,32 @@ func (o *Issuer) getSecretData(ctx context.Context, issuerSpec *CFMTLSIssuerapi.
 
 	var secret corev1.Secret
 	if err := o.client.Get(ctx, secretName, &secret); err != nil {
-		return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, secretName, err)
+		wrapped := fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, secretName, err)
+		if apierrors.IsNotFound(err) {
+			if o.SecretSelector != nil && !o.SecretSelector.Empty() {
+				wrapped = fmt.Errorf("%w (only Secrets matching %q are visible to the controller)", wrapped, o.SecretSelector)
+			}
+			return nil, withReason(CFMTLSIssuerapi.ReasonSecretNotFound, wrapped)
+		}
+		return nil, wrapped
 	}
 
 	checker, err := o.HealthCheckerBuilder(issuerSpec, secret.Data)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err)
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err))
 	}
 
 	if err := checker.Check(); err != nil {
-		return nil, fmt.Errorf("%w: %v", errHealthCheckerCheck, err)
+		return nil, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("%w: %v", errHealthCheckerCheck, err))
 	}
 
 	return secret.Data, nil
 }
 
 // validateCloudflareToken validates the Cloudflare API token by calling the /user/tokens/verify endpoint
-func validateCloudflareToken(apiKey string) error {
+func validateCloudflareToken(ctx context.Context, apiKey, baseURL string, client *http.Client) error {
     // Prepare the request headers
-    req, err := http.NewRequest("GET", "https://api.cloudflare.com/client/v4/user/tokens/verify", nil)
+    req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/user/tokens/verify", nil)
     if err != nil {
         return fmt.Errorf("failed to create HTTP request: %w", err)
     }
@@ -233,104 +701,456 @@ func validateCloudflareToken(apiKey string) error {
     req.Header.Set("Authorization", "Bearer "+apiKey)
     req.Header.Set("Content-Type", "application/json")
 
-    client := &http.Client{Timeout: 10 * time.Second}
     resp, err := client.Do(req)
     if err != nil {
-        return fmt.Errorf("failed to send request to Cloudflare: %w", err)
+        return requestError(err)
     }
     defer resp.Body.Close()
 
     if resp.StatusCode != http.StatusOK {
-        return fmt.Errorf("Cloudflare token validation failed with status: %d", resp.StatusCode)
+        reason := reasonForStatusCode(resp.StatusCode)
+        if reason == CFMTLSIssuerapi.ReasonZoneNotFound {
+            // The verify endpoint is not zone scoped.
+            reason = CFMTLSIssuerapi.ReasonTokenInvalid
+        }
+        return withReason(reason, withCFRay(fmt.Errorf("Cloudflare token validation failed with status: %d", resp.StatusCode), resp))
     }
 
     // Optionally, log the response or check for specific content in the response
     return nil
 }
 
+// lookupZoneName returns the name of the Cloudflare zone with the given ID.
+func lookupZoneName(ctx context.Context, apiKey, baseURL, zoneID string, client *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/zones/%s", baseURL, zoneID), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", requestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", withReason(reasonForStatusCode(resp.StatusCode), withCFRay(fmt.Errorf("Cloudflare zone lookup failed with status: %d", resp.StatusCode), resp))
+	}
+
+	var result struct {
+		Result struct {
+			Name string `json:"name"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonAPIError, fmt.Errorf("failed to parse Cloudflare response: %w", err))
+	}
+
+	return result.Result.Name, nil
+}
+
 
 func (o *Issuer) Check(ctx context.Context, issuerObject issuerapi.Issuer) error {
+	ctx, span := tracing.Start(ctx, "Check", issuerAttributes(issuerObject)...)
+	start := time.Now()
+	checkCtx, cancel := o.attemptContext(ctx)
+	var result checkResult
+	err := o.recoverPanic(ctx, "Check", issuerObject, func() (err error) {
+		result, err = o.check(checkCtx, issuerObject)
+		return err
+	})
+	cancel()
+	if err != nil {
+		o.credentials.forget(issuerObject)
+	}
+	err = redact.Error(err)
+	tracing.End(span, err)
+	now := metav1.Now()
+	o.checks.checked(issuerObject, now.Time)
+	defer recordCheckResult(issuerObject, err, now.Time, now.Sub(start))
+
+	o.updateStatus(ctx, issuerObject, func(status *CFMTLSIssuerapi.IssuerStatus) {
+		if result.zoneID != "" && result.zoneID != status.ZoneID {
+			status.ZoneID = result.zoneID
+			status.ZoneName = ""
+		}
+		if result.credentialHash != "" {
+			status.CredentialHash = result.credentialHash
+		}
+		if issuerSpec := issuerSpecOf(issuerObject); issuerSpec != nil {
+			status.Mode = issuerMode(issuerSpec)
+		}
+		status.LastError = ""
+		conditionStatus, reason, message := cmmeta.ConditionTrue, CFMTLSIssuerapi.ReasonChecked, "Succeeded checking the issuer"
+		if err != nil {
+			status.LastError = err.Error()
+			status.RecentErrors = addRecentError(status.RecentErrors, now, err)
+			conditionStatus, reason, message = cmmeta.ConditionFalse, errorReason(err), err.Error()
+		} else {
+			status.SecondaryTokenInUse = result.secondaryToken
+			if result.secondaryToken {
+				message = "Succeeded checking the issuer with the secondary API token"
+			}
+			status.TokenScopeWarning = result.tokenScopeWarning
+			if result.tokenScopeWarning != "" {
+				message = fmt.Sprintf("%s; %s", message, result.tokenScopeWarning)
+			}
+		}
+		conditions.SetIssuerStatusCondition(
+			clock.RealClock{},
+			status.Conditions,
+			&status.Conditions,
+			issuerObject.GetGeneration(),
+			CFMTLSIssuerapi.IssuerConditionCloudflareReady,
+			conditionStatus, reason, message,
+		)
+	})
+
+	return err
+}
+
+// attemptContext bounds an attempt to sign a request or to check an issuer
+// by AttemptTimeout, so that the time spent on it is predictable however
+// many Cloudflare API requests and retries it takes.
+func (o *Issuer) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.AttemptTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, o.AttemptTimeout)
+}
+
+// checkResult describes the credentials found by a health check.
+type checkResult struct {
+	// zoneID is the zone ID that was resolved for the issuer.
+	zoneID string
+	// secondaryToken is set if the secondary API token had to be used.
+	secondaryToken bool
+	// credentialHash is the fingerprint of the credentials.
+	credentialHash string
+	// tokenScopeWarning describes a too broad API token.
+	tokenScopeWarning string
+}
+
+// check performs the health check of the issuer. The result is filled in as
+// far as the check got.
+func (o *Issuer) check(ctx context.Context, issuerObject issuerapi.Issuer) (checkResult, error) {
+    var result checkResult
     issuerSpec, namespace, err := o.getIssuerDetails(issuerObject)
     if err != nil {
-        return err
+        return result, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, err)
     }
 
     // Get secret data from Cloudflare
     secretData, err := o.getSecretData(ctx, issuerSpec, namespace)
     if err != nil {
-        return err
+        return result, err
+    }
+
+    config, err := o.getIssuerConfig(ctx, issuerSpec, namespace)
+    if err != nil {
+        return result, err
     }
 
-    cfAPIKey := string(secretData["cloudflare-api-key"])
+    result.zoneID = resolveZoneID(issuerSpec, config, secretData)
+    result.credentialHash = credentialHash(issuerSpec, secretData)
+
+    apiTokenKey := apiTokenSecretKey(issuerSpec)
+    cfAPIKey := string(secretData[apiTokenKey])
     if cfAPIKey == "" {
-        return errors.New("missing Cloudflare API key in secret")
+        return result, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("missing Cloudflare API key in secret (key %q)", apiTokenKey))
+    }
+
+    httpClient, err := o.httpClient(ctx, issuerObject, issuerSpec, config, secretData, namespace)
+    if err != nil {
+        return result, err
     }
 
     // Validate the Cloudflare token
-    if err := validateCloudflareToken(cfAPIKey); err != nil {
-        return fmt.Errorf("Cloudflare token validation failed: %w", err)
+    result.secondaryToken, err = withTokenFailover(ctx, issuerSpec, secretData, func(apiKey string) error {
+        return validateCloudflareToken(ctx, apiKey, config.baseURL, httpClient)
+    })
+    if err != nil {
+        return result, fmt.Errorf("Cloudflare token validation failed: %w", err)
+    }
+
+    if issuerSpec.TokenScopeCheck != "" && result.zoneID != "" {
+        apiKey := cfAPIKey
+        if result.secondaryToken {
+            apiKey = string(secretData[secondaryAPITokenSecretKey(issuerSpec)])
+        }
+        enforce := issuerSpec.TokenScopeCheck == CFMTLSIssuerapi.TokenScopeCheckEnforce
+        scope, err := tokenScope(ctx, apiKey, config.baseURL, result.zoneID, httpClient)
+        switch {
+        case err != nil && enforce:
+            return result, fmt.Errorf("Cloudflare token scope check failed: %w", err)
+        case err != nil:
+            result.tokenScopeWarning = fmt.Sprintf("Cloudflare token scope check failed: %v", err)
+        case scope != "" && enforce:
+            return result, withReason(CFMTLSIssuerapi.ReasonTokenTooBroad, errors.New(scope))
+        default:
+            result.tokenScopeWarning = scope
+        }
     }
 
     // Additional health checks (e.g., Cloudflare CA cert check)
     checker, err := o.HealthCheckerBuilder(issuerSpec, secretData)
     if err != nil {
-        return fmt.Errorf("%w: %v", errHealthCheckerBuilder, err)
+        return result, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err))
     }
 
     if err := checker.Check(); err != nil {
-        return fmt.Errorf("%w: %v", errHealthCheckerCheck, err)
+        return result, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("%w: %v", errHealthCheckerCheck, err))
     }
 
-    return nil
+    // The signings reuse the checked credentials.
+    o.credentials.put(issuerObject, secretData)
+    return result, nil
+}
+
+
+func (o *Issuer) Sign(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer) (_ signer.PEMBundle, err error) {
+	ctx, span := tracing.Start(ctx, "Sign", append(issuerAttributes(issuerObject),
+		attribute.String("request.kind", requestReference(cr).Kind),
+		attribute.String("request.namespace", cr.GetNamespace()),
+		attribute.String("request.name", cr.GetName()),
+	)...)
+	defer func() { tracing.End(span, err) }()
+
+	// Correlate the logs of the signing with the request.
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("certificateRequestUID", cr.GetUID()))
+
+	if err := o.checkApproval(cr); err != nil {
+		return signer.PEMBundle{}, signer.SetCertificateRequestConditionError{
+			Err:           err,
+			ConditionType: CFMTLSIssuerapi.CertificateRequestConditionCloudflareIssued,
+			Status:        cmmeta.ConditionFalse,
+			Reason:        errorReason(err),
+		}
+	}
+
+	if o.signings != nil {
+		if !o.signings.start() {
+			// The request is signed by the next replica instead.
+			return signer.PEMBundle{}, signer.PendingError{Err: errors.New("controller is shutting down")}
+		}
+		defer o.signings.done()
+	}
+
+	signCtx, cancel := o.attemptContext(ctx)
+	var bundle signer.PEMBundle
+	err = o.recoverPanic(ctx, "Sign", requestObject(cr), func() (err error) {
+		bundle, err = o.signWithRetry(signCtx, cr, issuerObject)
+		return err
+	})
+	cancel()
+	o.recordRecentError(ctx, issuerObject, err)
+	var issuerErr signer.IssuerError
+	if errors.As(err, &issuerErr) {
+		// Issuer errors are surfaced on the issuer instead, which reports
+		// the wrapped error.
+		err = signer.IssuerError{Err: redact.Error(issuerErr.Err)}
+	} else if err != nil {
+		err = signer.SetCertificateRequestConditionError{
+			Err:           redact.Error(fmt.Errorf("%w (request UID %s)", err, cr.GetUID())),
+			ConditionType: CFMTLSIssuerapi.CertificateRequestConditionCloudflareIssued,
+			Status:        cmmeta.ConditionFalse,
+			Reason:        errorReason(err),
+		}
+	}
+	return bundle, err
+}
+
+// signWithRetry applies the retry policy of the issuer to transient signing
+// errors. Failed requests are kept pending and are not sent to Cloudflare
+// again until their backoff has expired. Once the request is older than
+// the issuer's MaxRetryDuration, the error becomes permanent.
+func (o *Issuer) signWithRetry(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer) (signer.PEMBundle, error) {
+	now := time.Now()
+	policy := o.retryPolicyFor(issuerSpecOf(issuerObject))
+	if state, ok := restoreRetryState(cr, policy); ok {
+		// The backoff of a request that failed before a restart goes on.
+		o.retries.restore(cr.GetUID(), state)
+	}
+	if state, ok := o.retries.get(cr.GetUID()); ok && now.Before(state.nextAttempt) {
+		return signer.PEMBundle{}, signer.PendingError{
+			Err: fmt.Errorf("retrying at %s: %w", state.nextAttempt.Format(time.RFC3339), state.lastErr),
+		}
+	}
+
+	bundle, err := o.sign(ctx, cr, issuerObject)
+	switch {
+	case err == nil:
+		o.retries.forget(cr.GetUID())
+		o.recordRetryState(ctx, cr, nil, now)
+		return bundle, nil
+	case errors.As(err, &signer.PendingError{}), errors.As(err, &signer.IssuerError{}):
+		return bundle, err
+	case errors.As(err, &signer.PermanentError{}):
+		o.recordFinalAttempt(ctx, cr, now, err)
+		return bundle, err
+	}
+
+	if now.Sub(cr.GetCreationTimestamp().Time) >= policy.maxRetryDuration {
+		o.recordFinalAttempt(ctx, cr, now, err)
+		return signer.PEMBundle{}, signer.PermanentError{Err: err}
+	}
+
+	next := o.retries.failed(cr.GetUID(), policy, now, err)
+	if state, ok := o.retries.get(cr.GetUID()); ok {
+		o.recordRetryState(ctx, cr, &state, now)
+	}
+	return signer.PEMBundle{}, signer.PendingError{
+		Err: fmt.Errorf("retrying at %s: %w", next.Format(time.RFC3339), err),
+	}
 }
 
+func (o *Issuer) sign(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer) (_ signer.PEMBundle, err error) {
+	var zoneID, certID string
+	var signed []byte
+	tenant := o.requestTenant(ctx, cr)
+	defer func() {
+		recordSignResult(issuerObject, tenant, zoneID, err)
+		o.auditSignResult(ctx, cr, issuerObject, tenant, zoneID, certID, signed, err)
+	}()
 
-func (o *Issuer) Sign(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer) (signer.PEMBundle, error) {
 	issuerSpec, namespace, err := o.getIssuerDetails(issuerObject)
 	logger := log.FromContext(ctx).WithName("Sign")
 
+	if err != nil {
+		return signer.PEMBundle{}, signer.IssuerError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, err)}
+	}
+
+	if issuerSpec.Paused {
+		// Keep the request pending; issuer-lib requeues it until the issuer
+		// is resumed.
+		return signer.PEMBundle{}, signer.PendingError{
+			Err: withReason(CFMTLSIssuerapi.ReasonPaused, errors.New("issuer is paused")),
+		}
+	}
+
+	secretData, err := o.credentials.get(issuerObject, func() (map[string][]byte, error) {
+		return o.getSecretData(ctx, issuerSpec, namespace)
+	})
 	if err != nil {
 		return signer.PEMBundle{}, signer.IssuerError{Err: err}
 	}
 
-	secretData, err := o.getSecretData(ctx, issuerSpec, namespace)
+	apiTokenKey := apiTokenSecretKey(issuerSpec)
+	zoneIDKey := zoneIDSecretKey(issuerSpec)
+	cfAPIKey := string(secretData[apiTokenKey])
+	config, err := o.getIssuerConfig(ctx, issuerSpec, namespace)
 	if err != nil {
 		return signer.PEMBundle{}, signer.IssuerError{Err: err}
 	}
 
-	cfAPIKey := string(secretData["cloudflare-api-key"])
-	zoneID := string(secretData["cloudflare-zone-id"])
+	zoneID = resolveZoneID(issuerSpec, config, secretData)
 	if cfAPIKey == "" || zoneID == "" {
-		return signer.PEMBundle{}, errors.New("missing Cloudflare API key or Zone ID in secret")
+		return signer.PEMBundle{}, withReason(CFMTLSIssuerapi.ReasonSecretInvalid, fmt.Errorf("missing Cloudflare API key or Zone ID in secret (keys %q, %q)", apiTokenKey, zoneIDKey))
 	}
 
-	_, duration, csrPEM, err := cr.GetRequest()
+	template, duration, csrPEM, err := cr.GetRequest()
 	if err != nil {
-		return signer.PEMBundle{}, fmt.Errorf("failed to get CSR from CertificateRequest: %w", err)
+		return signer.PEMBundle{}, signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidRequest, fmt.Errorf("failed to get CSR from CertificateRequest: %w", err))}
+	}
+
+	if err := o.checkNamespaceSelector(ctx, issuerObject, cr.GetNamespace()); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	if err := checkDomainPolicy(issuerSpec, template); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	if err := checkSubjectPatterns(issuerSpec, template); err != nil {
+		return signer.PEMBundle{}, err
 	}
 
 	// Convert duration (which is in hours) to days
-	durationInDays := int64(duration.Hours() / 24)
+	durationInDays := validityDays(issuerSpec, cr, int64(duration.Hours()/24))
 
 	if len(csrPEM) == 0 {
-		return signer.PEMBundle{}, errors.New("CSR in CertificateRequest is empty")
+		return signer.PEMBundle{}, signer.PermanentError{Err: withReason(CFMTLSIssuerapi.ReasonInvalidRequest, errors.New("CSR in CertificateRequest is empty"))}
+	}
+
+	if err := checkFIPSRequest(csrPEM); err != nil {
+		return signer.PEMBundle{}, err
 	}
 
 	// 🔹 Print the CSR before sending
-	logger.V(2).Info("CSR being sent to Cloudflare:\n", string(csrPEM))
-	logger.V(2).Info("Cert duration requested:\n", fmt.Sprintf("%d", durationInDays))
+	logger.V(2).Info("signing CSR with Cloudflare", "csr", string(csrPEM), "validityDays", durationInDays)
+
+	httpClient, err := o.httpClient(ctx, issuerObject, issuerSpec, config, secretData, namespace)
+	if err != nil {
+		return signer.PEMBundle{}, signer.IssuerError{Err: err}
+	}
 
 	// 🔹 Pass CSR to CloudflareSigner
-	signerObj := &CloudflareSigner{APIKey: cfAPIKey, ZoneID: zoneID}
-	signed, err := signerObj.Sign(ctx, csrPEM, durationInDays)
+	signerObj := &CloudflareSigner{APIKey: cfAPIKey, ZoneID: zoneID, BaseURL: config.baseURL, HTTPClient: httpClient}
+
+	secondary, err := checkZoneHostnamesWithFailover(ctx, issuerSpec, secretData, issuerStatus(issuerObject), signerObj, template)
 	if err != nil {
+		if errorReason(err) == CFMTLSIssuerapi.ReasonTokenInvalid {
+			// The credentials may have changed since they were cached.
+			o.credentials.forget(issuerObject)
+		}
 		return signer.PEMBundle{}, err
 	}
 
-	bundle, err := pki.ParseSingleCertificateChainPEM(signed)
+	if err := o.checkHostnameConflicts(ctx, cr, issuerObject, template.DNSNames); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	if err := o.checkMaintenanceWindows(cr, issuerSpec, time.Now()); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	if err := o.checkIssuanceBudget(cr, issuerObject, zoneID); err != nil {
+		return signer.PEMBundle{}, err
+	}
+
+	release, err := o.signingSlots.acquire(ctx)
 	if err != nil {
 		return signer.PEMBundle{}, err
 	}
 
+	signWith := func(apiKey string) error {
+		signerObj.APIKey = apiKey
+		signed, certID, err = signerObj.Sign(ctx, csrPEM, durationInDays)
+		return err
+	}
+	if secondary {
+		// The primary token was already rejected by the zone lookups.
+		err = signWith(signerObj.APIKey)
+	} else {
+		secondary, err = withTokenFailover(ctx, issuerSpec, secretData, signWith)
+	}
+	release()
+	if err != nil {
+		if errorReason(err) == CFMTLSIssuerapi.ReasonTokenInvalid {
+			// The credentials may have changed since they were cached.
+			o.credentials.forget(issuerObject)
+		}
+		return signer.PEMBundle{}, err
+	}
+
+	_, span := tracing.Start(ctx, "parseCertificateChain")
+	bundle, err := pki.ParseSingleCertificateChainPEM(signed)
+	tracing.End(span, err)
+	if err != nil {
+		return signer.PEMBundle{}, withReason(CFMTLSIssuerapi.ReasonAPIError, err)
+	}
+
+	// The certificate has been issued, so it is recorded even if the
+	// controller is shutting down.
+	ctx = context.WithoutCancel(ctx)
+	o.budgets.record(zoneID)
+	o.recordIssuance(ctx, issuerObject, signerObj, secondary)
+	o.trackCertificate(ctx, cr, issuerObject, tenant, zoneID, certID, signed)
+	recordCertificateExpiry(cr, issuerObject, signed)
+	o.recordIssuedEvent(cr, certID, signed)
+
 	return signer.PEMBundle(bundle), nil
 }
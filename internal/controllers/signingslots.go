@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+// signingSlotWait is how long a signing waits for a free slot before its
+// request is requeued, so that the reconcile workers are not held up by a
+// backlog of signings.
+const signingSlotWait = 5 * time.Second
+
+// signingSlots is a semaphore bounding the signing requests in flight to
+// the Cloudflare API, independently of the number of reconcile workers. A
+// nil semaphore does not bound them.
+type signingSlots chan struct{}
+
+func newSigningSlots(n int) signingSlots {
+	if n <= 0 {
+		return nil
+	}
+	return make(signingSlots, n)
+}
+
+// acquire waits up to signingSlotWait for a free slot and returns the
+// function releasing it. If no slot became free, the request is kept
+// pending and requeued.
+func (s signingSlots) acquire(ctx context.Context) (func(), error) {
+	if s == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(signingSlotWait)
+	defer timer.Stop()
+	select {
+	case s <- struct{}{}:
+		return func() { <-s }, nil
+	case <-ctx.Done():
+		return nil, signer.PendingError{Err: fmt.Errorf("waiting for a Cloudflare signing slot: %w", ctx.Err())}
+	case <-timer.C:
+		return nil, signer.PendingError{Err: fmt.Errorf("all %d Cloudflare signing slots are in use", cap(s))}
+	}
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+)
+
+func TestSigningSlots(t *testing.T) {
+	// A nil semaphore does not limit the signings.
+	var unlimited signingSlots
+	for i := 0; i < 3; i++ {
+		if _, err := unlimited.acquire(context.Background()); err != nil {
+			t.Fatalf("acquire() on nil slots error = %v", err)
+		}
+	}
+
+	slots := newSigningSlots(1)
+	release, err := slots.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := slots.acquire(ctx); !errors.As(err, &signer.PendingError{}) {
+		t.Fatalf("acquire() with all slots in use error = %v, want a PendingError", err)
+	}
+
+	release()
+	if _, err := slots.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() after release error = %v", err)
+	}
+}
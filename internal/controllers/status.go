@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/metrics"
+	"github.com/krisek/cfmtls-issuer/internal/redact"
+)
+
+// issuerStatus returns the status of the given issuer object, or nil if the
+// object is not one of our issuer types.
+func issuerStatus(issuerObject issuerapi.Issuer) *CFMTLSIssuerapi.IssuerStatus {
+	switch t := issuerObject.(type) {
+	case *CFMTLSIssuerapi.CFMTLSIssuer:
+		return &t.Status
+	case *CFMTLSIssuerapi.CFMTLSClusterIssuer:
+		return &t.Status
+	default:
+		return nil
+	}
+}
+
+// updateStatus records the outcome of a health check in the status fields
+// that are not managed by issuer-lib. The Ready condition itself is still
+// written by issuer-lib, so failing to patch is logged but not returned.
+func (o *Issuer) updateStatus(ctx context.Context, issuerObject issuerapi.Issuer, mutate func(*CFMTLSIssuerapi.IssuerStatus)) {
+	status := issuerStatus(issuerObject)
+	if status == nil {
+		return
+	}
+
+	original := issuerObject.DeepCopyObject().(client.Object)
+	updated := status.DeepCopy()
+	mutate(updated)
+	if equality.Semantic.DeepEqual(updated, status) {
+		return
+	}
+	*status = *updated
+
+	if err := o.client.Status().Patch(ctx, issuerObject, client.MergeFrom(original)); err != nil {
+		log.FromContext(ctx).Error(err, "failed to update issuer status")
+	}
+}
+
+// recordCheckResult updates the health metrics of the issuer with the
+// outcome of a health check that took duration. The time of the last change
+// is the transition time of the CloudflareReady condition, which outlives
+// restarts of the controller.
+func recordCheckResult(issuerObject issuerapi.Issuer, err error, now time.Time, duration time.Duration) {
+	var changed time.Time
+	if status := issuerStatus(issuerObject); status != nil {
+		for _, condition := range status.Conditions {
+			if condition.Type == CFMTLSIssuerapi.IssuerConditionCloudflareReady && condition.LastTransitionTime != nil {
+				changed = condition.LastTransitionTime.Time
+			}
+		}
+	}
+	kind, issuer := issuerMetricLabels(issuerObject)
+	metrics.RecordIssuerCheck(kind, issuer, err == nil, changed, now, duration)
+}
+
+// maxRecentErrorLength bounds the length of the messages in the recent
+// errors of an issuer, so that a verbose error cannot bloat its status.
+const maxRecentErrorLength = 512
+
+// recordRecentError adds the error of a signing to the recent errors in the
+// issuer status. Requests kept pending are not failures.
+func (o *Issuer) recordRecentError(ctx context.Context, issuerObject issuerapi.Issuer, err error) {
+	if err == nil || errors.As(err, &signer.PendingError{}) {
+		return
+	}
+	now := metav1.Now()
+	o.updateStatus(ctx, issuerObject, func(status *CFMTLSIssuerapi.IssuerStatus) {
+		status.RecentErrors = addRecentError(status.RecentErrors, now, err)
+	})
+}
+
+// addRecentError returns the recent errors with err, which occurred at now,
+// in front, keeping at most MaxRecentErrors. If err only differs from the
+// newest error by its correlation IDs, that one is counted again instead.
+func addRecentError(recent []CFMTLSIssuerapi.RecentError, now metav1.Time, err error) []CFMTLSIssuerapi.RecentError {
+	reason, message := errorReason(err), redact.String(err.Error())
+	if len(message) > maxRecentErrorLength {
+		message = strings.ToValidUTF8(message[:maxRecentErrorLength], "") + "..."
+	}
+
+	if len(recent) > 0 && recent[0].Reason == reason &&
+		correlationIDs.ReplaceAllString(recent[0].Message, "") == correlationIDs.ReplaceAllString(message, "") {
+		recent = append([]CFMTLSIssuerapi.RecentError(nil), recent...)
+		recent[0].Time, recent[0].Message = now, message
+		recent[0].Count++
+		return recent
+	}
+
+	recent = append([]CFMTLSIssuerapi.RecentError{{Time: now, Reason: reason, Message: message, Count: 1}}, recent...)
+	if len(recent) > CFMTLSIssuerapi.MaxRecentErrors {
+		recent = recent[:CFMTLSIssuerapi.MaxRecentErrors]
+	}
+	return recent
+}
+
+// issuanceCounter counts the certificates signed per issuer since the
+// controller was started.
+type issuanceCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newIssuanceCounter() *issuanceCounter {
+	return &issuanceCounter{counts: map[string]int64{}}
+}
+
+// inc increments and returns the count for the given issuer.
+func (c *issuanceCounter) inc(issuerObject issuerapi.Issuer) int64 {
+	key := issuerObject.GetIssuerTypeIdentifier() + "/" + client.ObjectKeyFromObject(issuerObject).String()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+	return c.counts[key]
+}
+
+// recordIssuance records a successfully signed certificate in the issuer
+// status, along with whether it was signed with the secondary API token.
+// The zone name is only looked up when it is not yet known for the
+// zone the certificate was signed for.
+func (o *Issuer) recordIssuance(ctx context.Context, issuerObject issuerapi.Issuer, cf *CloudflareSigner, secondary bool) {
+	status := issuerStatus(issuerObject)
+	if status == nil {
+		return
+	}
+
+	zoneName, err := resolveZoneName(ctx, status, cf)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "failed to resolve Cloudflare zone name", "zoneID", cf.ZoneID)
+	}
+
+	count := o.issued.inc(issuerObject)
+	now := metav1.Now()
+	o.updateStatus(ctx, issuerObject, func(status *CFMTLSIssuerapi.IssuerStatus) {
+		status.ZoneID = cf.ZoneID
+		status.ZoneName = zoneName
+		status.LastIssuanceTime = &now
+		status.IssuedCount = count
+		status.SecondaryTokenInUse = secondary
+	})
+}
+
+// recordSignResult updates the issuance metrics with the outcome of a
+// signing attempt. Requests kept pending, e.g. while the issuer is paused,
+// are not failures.
+func recordSignResult(issuerObject issuerapi.Issuer, tenant, zoneID string, err error) {
+	kind, issuer := issuerMetricLabels(issuerObject)
+	switch {
+	case err == nil:
+		metrics.RecordIssuance(kind, issuer, zoneID, tenant)
+	case errors.As(err, &signer.PendingError{}):
+	default:
+		metrics.RecordSignFailure(kind, issuer, zoneID, tenant, errorReason(err))
+	}
+}
+
+// recordCertificateExpiry sets the expiry metric of the certificate issued
+// for the given request. The series is named after the cert-manager
+// Certificate, so that it is replaced on renewal, or after the request if it
+// does not belong to one.
+func recordCertificateExpiry(cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer, certPEM []byte) {
+	cert, err := pki.DecodeX509CertificateBytes(certPEM)
+	if err != nil {
+		return
+	}
+	name := cr.GetAnnotations()[cmapi.CertificateNameKey]
+	if name == "" {
+		name = cr.GetName()
+	}
+	kind, issuer := issuerMetricLabels(issuerObject)
+	metrics.RecordCertificateExpiry(kind, issuer, cr.GetNamespace(), name, cert.NotAfter)
+}
+
+// issuerMetricLabels returns the issuer_kind and issuer labels of the
+// metrics of the given issuer. The issuer is "<namespace>/<name>" for
+// namespaced issuers and "<name>" for cluster issuers.
+func issuerMetricLabels(issuerObject issuerapi.Issuer) (kind, issuer string) {
+	kind = issuerReference(issuerObject).Kind
+	if issuerObject.GetNamespace() == "" {
+		return kind, issuerObject.GetName()
+	}
+	return kind, client.ObjectKeyFromObject(issuerObject).String()
+}
+
+// issuerAttributes returns the span attributes of the given issuer, which
+// match the labels of its metrics.
+func issuerAttributes(issuerObject issuerapi.Issuer) []attribute.KeyValue {
+	kind, issuer := issuerMetricLabels(issuerObject)
+	return []attribute.KeyValue{
+		attribute.String("issuer.kind", kind),
+		attribute.String("issuer.name", issuer),
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestAddRecentError(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) metav1.Time { return metav1.NewTime(start.Add(time.Duration(minutes) * time.Minute)) }
+	rateLimited := withReason(CFMTLSIssuerapi.ReasonQuotaExceeded, errors.New("Cloudflare API responded with status: 429 (cf-ray 1)"))
+	rateLimitedAgain := withReason(CFMTLSIssuerapi.ReasonQuotaExceeded, errors.New("Cloudflare API responded with status: 429 (cf-ray 2)"))
+	unreachable := withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, errors.New("failed to send request to Cloudflare"))
+
+	var recent []CFMTLSIssuerapi.RecentError
+	recent = addRecentError(recent, at(0), rateLimited)
+	last := at(1)
+	recent = addRecentError(recent, last, rateLimitedAgain)
+	if len(recent) != 1 || recent[0].Count != 2 || !recent[0].Time.Equal(&last) {
+		t.Fatalf("addRecentError() = %+v, want a single error seen twice", recent)
+	}
+	if !strings.Contains(recent[0].Message, "cf-ray 2") {
+		t.Errorf("addRecentError() message = %q, want the latest message", recent[0].Message)
+	}
+
+	recent = addRecentError(recent, at(2), unreachable)
+	if len(recent) != 2 || recent[0].Reason != CFMTLSIssuerapi.ReasonAPIUnreachable || recent[1].Reason != CFMTLSIssuerapi.ReasonQuotaExceeded {
+		t.Fatalf("addRecentError() = %+v, want the newest error first", recent)
+	}
+
+	for i := 0; i < 2*CFMTLSIssuerapi.MaxRecentErrors; i++ {
+		recent = addRecentError(recent, at(3+i), fmt.Errorf("error %d", i))
+	}
+	if len(recent) != CFMTLSIssuerapi.MaxRecentErrors {
+		t.Fatalf("addRecentError() kept %d errors, want %d", len(recent), CFMTLSIssuerapi.MaxRecentErrors)
+	}
+	if want := fmt.Sprintf("error %d", 2*CFMTLSIssuerapi.MaxRecentErrors-1); recent[0].Message != want {
+		t.Errorf("addRecentError() newest = %q, want %q", recent[0].Message, want)
+	}
+
+	recent = addRecentError(nil, at(0), errors.New(strings.Repeat("x", 2*maxRecentErrorLength)))
+	if len(recent[0].Message) > maxRecentErrorLength+len("...") {
+		t.Errorf("addRecentError() kept a message of %d bytes, want at most %d", len(recent[0].Message), maxRecentErrorLength)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+)
+
+// markSuperseded annotates the other CloudflareOriginCertificates of the
+// Certificate of tracked that were issued for the same hostnames as
+// superseded, if the issuer sets revokeSupersededAfter. The certificate has
+// already been issued at this point, so failures are logged and the
+// superseded certificates are kept until they expire.
+func (o *Issuer) markSuperseded(ctx context.Context, tracked *CFMTLSIssuerapi.CloudflareOriginCertificate, issuerObject issuerapi.Issuer) {
+	spec := issuerSpecOf(issuerObject)
+	if spec == nil || spec.RevokeSupersededAfter == nil || !o.featureEnabled(features.Revocation) {
+		return
+	}
+	certificateName := tracked.Labels[CFMTLSIssuerapi.CertificateNameLabelKey]
+	if certificateName == "" {
+		return
+	}
+
+	logger := log.FromContext(ctx)
+	var list CFMTLSIssuerapi.CloudflareOriginCertificateList
+	if err := o.client.List(ctx, &list, client.InNamespace(tracked.Namespace), client.MatchingLabels{CFMTLSIssuerapi.CertificateNameLabelKey: certificateName}); err != nil {
+		logger.Error(err, "failed to list the previous certificates of the Certificate", "certificate", certificateName)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for i := range list.Items {
+		previous := &list.Items[i]
+		if !supersedes(tracked, previous) {
+			continue
+		}
+		original := previous.DeepCopy()
+		metav1.SetMetaDataAnnotation(&previous.ObjectMeta, CFMTLSIssuerapi.SupersededAtAnnotationKey, now)
+		if err := o.client.Patch(ctx, previous, client.MergeFrom(original)); err != nil {
+			logger.Error(err, "failed to mark certificate as superseded", "certificateID", previous.Spec.CertificateID)
+			continue
+		}
+		logger.V(1).Info("marked certificate as superseded", "certificateID", previous.Spec.CertificateID, "supersededBy", tracked.Spec.CertificateID)
+	}
+}
+
+// supersedes reports whether the certificate tracked by current replaces the
+// one tracked by previous, that is whether both were issued by the same
+// issuer for the same hostnames and previous does not expire later.
+func supersedes(current, previous *CFMTLSIssuerapi.CloudflareOriginCertificate) bool {
+	if previous.Name == current.Name || previous.Spec.CertificateID == current.Spec.CertificateID {
+		return false
+	}
+	if metav1.HasAnnotation(previous.ObjectMeta, CFMTLSIssuerapi.SupersededAtAnnotationKey) || !previous.DeletionTimestamp.IsZero() {
+		return false
+	}
+	if previous.Spec.IssuerRef != current.Spec.IssuerRef {
+		return false
+	}
+	if previous.Spec.NotAfter != nil && current.Spec.NotAfter != nil && previous.Spec.NotAfter.After(current.Spec.NotAfter.Time) {
+		return false
+	}
+	return sameHostnames(previous.Spec.Hostnames, current.Spec.Hostnames)
+}
+
+// sameHostnames reports whether a and b contain the same hostnames, in any
+// order and case.
+func sameHostnames(a, b []string) bool {
+	normalize := func(hostnames []string) []string {
+		normalized := make([]string, len(hostnames))
+		for i, hostname := range hostnames {
+			normalized[i] = strings.ToLower(hostname)
+		}
+		slices.Sort(normalized)
+		return slices.Compact(normalized)
+	}
+	return slices.Equal(normalize(a), normalize(b))
+}
+
+// supersededReconciler revokes the certificates of superseded
+// CloudflareOriginCertificates once the grace period of their issuer has
+// passed, and then deletes them.
+type supersededReconciler struct {
+	*Issuer
+}
+
+func (r *supersededReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	superseded := predicate.NewPredicateFuncs(func(object client.Object) bool {
+		_, ok := object.GetAnnotations()[CFMTLSIssuerapi.SupersededAtAnnotationKey]
+		return ok && object.GetDeletionTimestamp().IsZero()
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&CFMTLSIssuerapi.CloudflareOriginCertificate{}, builder.WithPredicates(superseded)).
+		Named("supersededcertificate").
+		Complete(r)
+}
+
+func (r *supersededReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{}
+	if err := r.client.Get(ctx, req.NamespacedName, tracked); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	value, ok := tracked.Annotations[CFMTLSIssuerapi.SupersededAtAnnotationKey]
+	if !ok || !tracked.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	if !r.ownsIssuer(issuerReferenceKey(tracked.Spec.IssuerRef, tracked.Namespace)) {
+		return ctrl.Result{}, nil
+	}
+
+	logger := log.FromContext(ctx).WithValues("certificateID", tracked.Spec.CertificateID, "zoneID", tracked.Spec.ZoneID)
+	supersededAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logger.Error(err, "invalid annotation, not revoking superseded certificate", "annotation", CFMTLSIssuerapi.SupersededAtAnnotationKey)
+		return ctrl.Result{}, nil
+	}
+
+	// Superseded certificates of issuers that no longer exist or no longer
+	// set revokeSupersededAfter are kept until they expire.
+	issuerObject, err := r.referencedIssuer(ctx, tracked.Spec.IssuerRef, tracked.Namespace)
+	if apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	spec := issuerSpecOf(issuerObject)
+	if spec == nil || spec.RevokeSupersededAfter == nil {
+		return ctrl.Result{}, nil
+	}
+	if remaining := time.Until(supersededAt.Add(spec.RevokeSupersededAfter.Duration)); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
+	// Returning the error requeues the certificate with backoff.
+	revoke, err := r.revoker(ctx, issuerObject)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = revoke(tracked.Spec.ZoneID, tracked.Spec.CertificateID)
+	if err != nil && errorReason(err) != CFMTLSIssuerapi.ReasonCertificateNotFound {
+		return ctrl.Result{}, err
+	}
+	if err == nil {
+		logger.Info("revoked superseded Cloudflare certificate")
+		if r.recorder != nil {
+			r.recorder.Eventf(tracked, corev1.EventTypeNormal, EventReasonCertificateRevoked, "Revoked superseded certificate %s at Cloudflare", tracked.Spec.CertificateID)
+		}
+	}
+
+	// The certificate is revoked, so the tracking object is no longer
+	// needed and must not be revoked again on delete.
+	if controllerutil.ContainsFinalizer(tracked, CFMTLSIssuerapi.RevokeOnDeleteFinalizer) {
+		original := tracked.DeepCopy()
+		controllerutil.RemoveFinalizer(tracked, CFMTLSIssuerapi.RevokeOnDeleteFinalizer)
+		if err := r.client.Patch(ctx, tracked, client.MergeFrom(original)); err != nil {
+			return ctrl.Result{}, client.IgnoreNotFound(err)
+		}
+	}
+	return ctrl.Result{}, client.IgnoreNotFound(r.client.Delete(ctx, tracked))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func trackedCertificate(name, certID string, hostnames ...string) *CFMTLSIssuerapi.CloudflareOriginCertificate {
+	return &CFMTLSIssuerapi.CloudflareOriginCertificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{CFMTLSIssuerapi.CertificateNameLabelKey: "web"},
+		},
+		Spec: CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+			CertificateID: certID,
+			ZoneID:        "zone-id",
+			Hostnames:     hostnames,
+			IssuerRef:     CFMTLSIssuerapi.IssuerReference{Kind: "CFMTLSIssuer", Name: "issuer"},
+		},
+	}
+}
+
+func TestSupersedes(t *testing.T) {
+	current := trackedCertificate("web-2", "cert-2", "example.com", "www.example.com")
+
+	otherIssuer := trackedCertificate("web-1", "cert-1", "example.com", "www.example.com")
+	otherIssuer.Spec.IssuerRef.Name = "other"
+	marked := trackedCertificate("web-1", "cert-1", "example.com", "www.example.com")
+	marked.Annotations = map[string]string{CFMTLSIssuerapi.SupersededAtAnnotationKey: "2024-01-01T00:00:00Z"}
+
+	tests := []struct {
+		name     string
+		previous *CFMTLSIssuerapi.CloudflareOriginCertificate
+		want     bool
+	}{
+		{name: "same hostnames", previous: trackedCertificate("web-1", "cert-1", "WWW.example.com", "example.com"), want: true},
+		{name: "other hostnames", previous: trackedCertificate("web-1", "cert-1", "example.com")},
+		{name: "same certificate", previous: trackedCertificate("web-0", "cert-2", "example.com", "www.example.com")},
+		{name: "other issuer", previous: otherIssuer},
+		{name: "already superseded", previous: marked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := supersedes(current, tt.previous); got != tt.want {
+				t.Errorf("supersedes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkSuperseded(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := trackedCertificate("web-1", "cert-1", "example.com")
+	current := trackedCertificate("web-2", "cert-2", "example.com")
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "issuer", Namespace: "default"},
+		Spec:       CFMTLSIssuerapi.IssuerSpec{RevokeSupersededAfter: &metav1.Duration{Duration: time.Hour}},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(issuer, previous, current).Build()
+	o := &Issuer{client: c}
+	ctx := context.Background()
+	o.markSuperseded(ctx, current, issuer)
+
+	for _, tt := range []struct {
+		name           string
+		wantSuperseded bool
+	}{{"web-1", true}, {"web-2", false}} {
+		tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: "default", Name: tt.name}, tracked); err != nil {
+			t.Fatal(err)
+		}
+		if got := metav1.HasAnnotation(tracked.ObjectMeta, CFMTLSIssuerapi.SupersededAtAnnotationKey); got != tt.wantSuperseded {
+			t.Errorf("%s superseded = %v, want %v", tt.name, got, tt.wantSuperseded)
+		}
+	}
+
+	// The certificate is kept during the grace period.
+	r := &supersededReconciler{Issuer: o}
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "web-1"}})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+		t.Errorf("Reconcile() RequeueAfter = %s, want the rest of the grace period", result.RequeueAfter)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// requestTenant returns the tenant of the given request, which is the value
+// of the TenantLabel of its namespace. It is empty if TenantLabel is not
+// set, for the cluster scoped CertificateSigningRequests, and if the
+// namespace does not have the label. The tenant only annotates metrics,
+// audit records and tracking objects, so failing to read the namespace does
+// not fail the request.
+func (o *Issuer) requestTenant(ctx context.Context, cr signer.CertificateRequestObject) string {
+	if o.TenantLabel == "" || cr.GetNamespace() == "" {
+		return ""
+	}
+	namespace := &corev1.Namespace{}
+	if err := o.client.Get(ctx, types.NamespacedName{Name: cr.GetNamespace()}, namespace); err != nil {
+		log.FromContext(ctx).Error(err, "failed to get the namespace of the request to find its tenant", "namespace", cr.GetNamespace())
+		return ""
+	}
+	return namespace.Labels[o.TenantLabel]
+}
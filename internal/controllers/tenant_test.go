@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRequestTenant(t *testing.T) {
+	c := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments", Labels: map[string]string{"team": "checkout"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "sandbox"}},
+	).Build()
+	certificateRequest := func(namespace string) signer.CertificateRequestObject {
+		return signer.CertificateRequestObjectFromCertificateRequest(&cmapi.CertificateRequest{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web-1"},
+		})
+	}
+
+	tests := []struct {
+		name        string
+		tenantLabel string
+		cr          signer.CertificateRequestObject
+		want        string
+	}{
+		{
+			name: "tenants disabled",
+			cr:   certificateRequest("payments"),
+		},
+		{
+			name:        "labeled namespace",
+			tenantLabel: "team",
+			cr:          certificateRequest("payments"),
+			want:        "checkout",
+		},
+		{
+			name:        "unlabeled namespace",
+			tenantLabel: "team",
+			cr:          certificateRequest("sandbox"),
+		},
+		{
+			name:        "missing namespace",
+			tenantLabel: "team",
+			cr:          certificateRequest("deleted"),
+		},
+		{
+			name:        "CertificateSigningRequest",
+			tenantLabel: "team",
+			cr: signer.CertificateRequestObjectFromCertificateSigningRequest(&certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-1"},
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{client: c, TenantLabel: tt.tenantLabel}
+			if got := o.requestTenant(context.Background(), tt.cr); got != tt.want {
+				t.Errorf("requestTenant() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
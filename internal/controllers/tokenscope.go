@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// zoneResourcePrefix prefixes the zone IDs in the resources of Cloudflare
+// API token policies.
+const zoneResourcePrefix = "com.cloudflare.api.account.zone."
+
+// tokenScope returns a description of the resources that the given API
+// token can access besides the given zone, or "" if it is limited to it.
+func tokenScope(ctx context.Context, apiKey, baseURL, zoneID string, client *http.Client) (string, error) {
+	var verified struct {
+		Result struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	if err := cloudflareDo(ctx, apiKey, http.MethodGet, baseURL+"/user/tokens/verify", nil, client, &verified); err != nil {
+		return "", fmt.Errorf("failed to verify token: %w", err)
+	}
+
+	var token struct {
+		Result struct {
+			Policies []struct {
+				Effect    string                     `json:"effect"`
+				Resources map[string]json.RawMessage `json:"resources"`
+			} `json:"policies"`
+		} `json:"result"`
+	}
+	if err := cloudflareDo(ctx, apiKey, http.MethodGet, fmt.Sprintf("%s/user/tokens/%s", baseURL, verified.Result.ID), nil, client, &token); err != nil {
+		return "", fmt.Errorf("failed to read token policies, the token needs the API Tokens Read permission: %w", err)
+	}
+
+	var extra []string
+	for _, policy := range token.Result.Policies {
+		if policy.Effect != "allow" {
+			continue
+		}
+		for resource := range policy.Resources {
+			if resource != zoneResourcePrefix+zoneID {
+				extra = append(extra, resource)
+			}
+		}
+	}
+	if len(extra) == 0 {
+		return "", nil
+	}
+
+	sort.Strings(extra)
+	return fmt.Sprintf("API token grants access beyond zone %s: %s", zoneID, strings.Join(extra, ", ")), nil
+}
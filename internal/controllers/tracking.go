@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+	"github.com/krisek/cfmtls-issuer/internal/features"
+)
+
+// requestReference returns a reference to the given request. The kind is
+// derived from the underlying object wrapped by issuer-lib.
+func requestReference(cr signer.CertificateRequestObject) CFMTLSIssuerapi.RequestReference {
+	ref := CFMTLSIssuerapi.RequestReference{
+		Namespace: cr.GetNamespace(),
+		Name:      cr.GetName(),
+		UID:       string(cr.GetUID()),
+	}
+	switch cr.(type) {
+	case interface {
+		DeepCopy() *cmapi.CertificateRequest
+	}:
+		ref.Kind = "CertificateRequest"
+	case interface {
+		DeepCopy() *certificatesv1.CertificateSigningRequest
+	}:
+		ref.Kind = "CertificateSigningRequest"
+	}
+	return ref
+}
+
+// issuerReference returns a reference to the given issuer.
+func issuerReference(issuerObject issuerapi.Issuer) CFMTLSIssuerapi.IssuerReference {
+	ref := CFMTLSIssuerapi.IssuerReference{Name: issuerObject.GetName()}
+	switch issuerObject.(type) {
+	case *CFMTLSIssuerapi.CFMTLSIssuer:
+		ref.Kind = "CFMTLSIssuer"
+	case *CFMTLSIssuerapi.CFMTLSClusterIssuer:
+		ref.Kind = "CFMTLSClusterIssuer"
+	}
+	return ref
+}
+
+// trackingObjectKey returns the namespace and name of the
+// CloudflareOriginCertificate for the given request. CertificateSigningRequests
+// are cluster scoped, so they are tracked in the cluster resource namespace
+// under a prefixed name.
+func (o *Issuer) trackingObjectKey(ref CFMTLSIssuerapi.RequestReference) (string, string) {
+	if ref.Namespace == "" {
+		return o.ClusterResourceNamespace, "csr-" + ref.Name
+	}
+	return ref.Namespace, ref.Name
+}
+
+// trackCertificate records a certificate issued by Cloudflare in a
+// CloudflareOriginCertificate, labeled with the tenant of the request, if
+// any. The certificate has already been issued at this point, so failures
+// are logged and do not fail the request.
+func (o *Issuer) trackCertificate(ctx context.Context, cr signer.CertificateRequestObject, issuerObject issuerapi.Issuer, tenant, zoneID, certID string, certPEM []byte) {
+	logger := log.FromContext(ctx)
+
+	if certID == "" {
+		logger.Info("Cloudflare did not return a certificate ID, not tracking certificate")
+		return
+	}
+
+	ref := requestReference(cr)
+	namespace, name := o.trackingObjectKey(ref)
+	tracked := &CFMTLSIssuerapi.CloudflareOriginCertificate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, o.client, tracked, func() error {
+		if certificateName := cr.GetAnnotations()[cmapi.CertificateNameKey]; certificateName != "" {
+			if tracked.Labels == nil {
+				tracked.Labels = map[string]string{}
+			}
+			tracked.Labels[CFMTLSIssuerapi.CertificateNameLabelKey] = certificateName
+		}
+		if tenant != "" {
+			if tracked.Labels == nil {
+				tracked.Labels = map[string]string{}
+			}
+			tracked.Labels[CFMTLSIssuerapi.TenantLabelKey] = tenant
+		}
+		if o.revokeOnDelete(issuerObject) {
+			controllerutil.AddFinalizer(tracked, CFMTLSIssuerapi.RevokeOnDeleteFinalizer)
+			if owner := certificateOwner(cr); owner != nil {
+				tracked.OwnerReferences = upsertOwnerReference(tracked.OwnerReferences, *owner)
+			}
+		}
+		tracked.Spec = CFMTLSIssuerapi.CloudflareOriginCertificateSpec{
+			CertificateID:         certID,
+			ZoneID:                zoneID,
+			IssuerRef:             issuerReference(issuerObject),
+			CertificateRequestRef: ref,
+		}
+
+		cert, err := pki.DecodeX509CertificateBytes(certPEM)
+		if err != nil {
+			return fmt.Errorf("failed to decode issued certificate: %w", err)
+		}
+		tracked.Spec.SerialNumber = fmt.Sprintf("%x", cert.SerialNumber)
+		tracked.Spec.Hostnames = cert.DNSNames
+		notAfter := metav1.NewTime(cert.NotAfter)
+		tracked.Spec.NotAfter = &notAfter
+		return nil
+	})
+	if err != nil {
+		logger.Error(err, "failed to record issued certificate", "certificateID", certID)
+		return
+	}
+	if err := o.index.add(ctx, tracked); err != nil {
+		logger.Error(err, "failed to index issued certificate", "certificateID", certID)
+	}
+	o.markSuperseded(ctx, tracked, issuerObject)
+}
+
+// revokeOnDelete reports whether the certificates of the given issuer are
+// revoked when their CloudflareOriginCertificate is deleted. The finalizer is
+// only handled by the revocation controllers, so it is not set while they
+// are disabled.
+func (o *Issuer) revokeOnDelete(issuerObject issuerapi.Issuer) bool {
+	spec := issuerSpecOf(issuerObject)
+	return spec != nil && spec.RevocationPolicy == CFMTLSIssuerapi.RevocationPolicyOnDelete && o.featureEnabled(features.Revocation)
+}
+
+// certificateOwner returns a reference to the cert-manager Certificate that
+// owns the given request, or nil if there is none. It is set as a
+// non-controlling owner of the CloudflareOriginCertificate, so that deleting
+// the Certificate garbage collects, and with the finalizer revokes, the
+// certificates issued for it.
+func certificateOwner(cr signer.CertificateRequestObject) *metav1.OwnerReference {
+	for _, ref := range cr.GetOwnerReferences() {
+		if ref.Kind == cmapi.CertificateKind && ref.APIVersion == cmapi.SchemeGroupVersion.String() {
+			return &metav1.OwnerReference{APIVersion: ref.APIVersion, Kind: ref.Kind, Name: ref.Name, UID: ref.UID}
+		}
+	}
+	return nil
+}
+
+// upsertOwnerReference adds ref to refs, replacing a reference with the
+// same UID.
+func upsertOwnerReference(refs []metav1.OwnerReference, ref metav1.OwnerReference) []metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].UID == ref.UID {
+			refs[i] = ref
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krisek/cfmtls-issuer/internal/fips"
+)
+
+// cloudflareMaxIdleConnsPerHost is the number of idle connections to the
+// Cloudflare API kept per transport. The default of two would close most
+// connections of concurrent signings after use.
+const cloudflareMaxIdleConnsPerHost = 16
+
+// Bounds of the connections and responses of the transports, so that a
+// misbehaving endpoint or proxy cannot hang a signing or exhaust the memory
+// of the controller. The requests are bounded as a whole by the request
+// timeout of the issuer.
+const (
+	dialTimeout            = 10 * time.Second
+	tlsHandshakeTimeout    = 10 * time.Second
+	responseHeaderTimeout  = 30 * time.Second
+	maxResponseHeaderBytes = 64 << 10
+	// maxResponseSize bounds the bodies of the responses. The largest
+	// Cloudflare API responses, pages of certificates, are a fraction of
+	// it.
+	maxResponseSize = 4 << 20
+)
+
+// errResponseTooLarge is returned when reading a response body beyond
+// maxResponseSize.
+var errResponseTooLarge = errors.New("response body exceeds 4 MiB")
+
+// credentialTransport returns the transport of the requests to the external
+// credential sources, e.g. Vault. It is created on first use, after the
+// FIPS mode was set up.
+var credentialTransport = sync.OnceValue(newHardenedTransport)
+
+// transportCache shares the transports, and so the pooled connections and
+// TLS sessions, of the Cloudflare API clients. The transports are keyed by
+// the egress configuration of the issuers rather than by issuer, as the
+// credentials are sent per request: issuers with the same proxy, CA bundle
+// and pins share their connections.
+type transportCache struct {
+	// dial dials the connections of the transports. nil uses the dialer
+	// of newHardenedTransport.
+	dial dialFunc
+
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newTransportCache(dial dialFunc) *transportCache {
+	return &transportCache{dial: dial, transports: map[string]*http.Transport{}}
+}
+
+// get returns the transport sending requests through proxyURL, or the
+// proxy of the environment if nil, trusting caPEM in addition to the system
+// roots, and pinned to pins if any. A nil cache returns a new transport on
+// every call.
+func (c *transportCache) get(proxyURL *url.URL, caPEM []byte, pins []string) *http.Transport {
+	if c == nil {
+		return newCloudflareTransport(proxyURL, caPEM, pins, nil)
+	}
+
+	key := transportKey(proxyURL, caPEM, pins)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	transport, ok := c.transports[key]
+	if !ok {
+		transport = newCloudflareTransport(proxyURL, caPEM, pins, c.dial)
+		c.transports[key] = transport
+	}
+	return transport
+}
+
+// transportKey identifies the egress configuration of a transport. The
+// proxy credentials and the CA bundle are hashed, so that rotated ones get a
+// new transport without being kept in the clear.
+func transportKey(proxyURL *url.URL, caPEM []byte, pins []string) string {
+	key := ""
+	if proxyURL != nil {
+		key = proxyURL.Redacted()
+		if proxyURL.User != nil {
+			sum := sha256.Sum256([]byte(proxyURL.User.String()))
+			key += "|" + hex.EncodeToString(sum[:])
+		}
+	}
+	if caPEM != nil {
+		sum := sha256.Sum256(caPEM)
+		key += "|" + hex.EncodeToString(sum[:])
+	}
+	if len(pins) > 0 {
+		key += "|pins=" + strings.Join(normalizePins(pins), ",")
+	}
+	return key
+}
+
+// newHardenedTransport returns a transport that requires TLS 1.2, and the
+// approved algorithms in FIPS mode, and bounds the time spent dialing and
+// waiting for responses.
+func newHardenedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	transport.MaxResponseHeaderBytes = maxResponseHeaderBytes
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	fips.ConfigureTLS(transport.TLSClientConfig)
+	return transport
+}
+
+// newCloudflareTransport returns a hardened transport with keep-alives,
+// HTTP/2 and TLS session resumption for the Cloudflare API. A non-nil dial
+// replaces its dialer.
+func newCloudflareTransport(proxyURL *url.URL, caPEM []byte, pins []string, dial dialFunc) *http.Transport {
+	transport := newHardenedTransport()
+	if dial != nil {
+		transport.DialContext = dial
+	}
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = cloudflareMaxIdleConnsPerHost
+	transport.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if caPEM != nil {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		rootCAs.AppendCertsFromPEM(caPEM)
+		transport.TLSClientConfig.RootCAs = rootCAs
+	}
+	if len(pins) > 0 {
+		transport.TLSClientConfig.VerifyConnection = verifyPins(pins)
+	}
+	return transport
+}
+
+// errPinMismatch is returned when the TLS connection to the Cloudflare API
+// does not match the pinned digests of the issuer.
+var errPinMismatch = errors.New("no certificate of the TLS connection matches the pinned SHA-256 digests")
+
+// verifyPins returns a TLS connection check that accepts the connections
+// whose verified chains contain a certificate, or a public key, with one of
+// the given SHA-256 digests. It runs after the chain was verified, and for
+// resumed sessions as well.
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	pinned := map[string]bool{}
+	for _, pin := range normalizePins(pins) {
+		pinned[pin] = true
+	}
+	return func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				certSum := sha256.Sum256(cert.Raw)
+				keySum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pinned[hex.EncodeToString(certSum[:])] || pinned[hex.EncodeToString(keySum[:])] {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("%w (server %s)", errPinMismatch, state.ServerName)
+	}
+}
+
+// normalizePins returns the pins in lowercase, sorted and without
+// duplicates.
+func normalizePins(pins []string) []string {
+	normalized := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		normalized = append(normalized, strings.ToLower(pin))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// limitTransport bounds the bodies of the responses of base to
+// maxResponseSize.
+type limitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: maxResponseSize}
+	return resp, nil
+}
+
+// limitedBody fails with errResponseTooLarge once more than remaining bytes
+// are read, rather than truncating the body like io.LimitReader.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	// One more byte than allowed is read to tell a body of exactly the
+	// maximum size from a larger one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n, b.remaining = int(b.remaining), 0
+		return n, errResponseTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestLimitedBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{name: "smaller", size: 10},
+		{name: "maximum", size: 100},
+		{name: "larger", size: 101, wantErr: errResponseTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte("x"), tt.size)
+			// Reading a byte at a time exercises the boundary.
+			for _, r := range []io.Reader{bytes.NewReader(data), iotest.OneByteReader(bytes.NewReader(data))} {
+				body := &limitedBody{ReadCloser: io.NopCloser(r), remaining: 100}
+				got, err := io.ReadAll(body)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadAll() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(got) > 100 {
+					t.Errorf("ReadAll() read %d bytes, want at most 100", len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestNewCloudflareTransport(t *testing.T) {
+	transport := newCloudflareTransport(nil, nil, nil, nil)
+	if transport.TLSClientConfig.MinVersion == 0 || transport.TLSClientConfig.ClientSessionCache == nil {
+		t.Errorf("TLSClientConfig = %+v, want a minimum version and a session cache", transport.TLSClientConfig)
+	}
+	if transport.ResponseHeaderTimeout == 0 || transport.TLSHandshakeTimeout == 0 {
+		t.Error("transport does not bound the time waiting for responses")
+	}
+}
+
+func TestCloudflareTransportPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	cert := server.Certificate()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	certSum := sha256.Sum256(cert.Raw)
+	keySum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	tests := []struct {
+		name     string
+		pins     []string
+		mismatch bool
+	}{
+		{name: "not pinned"},
+		{name: "certificate", pins: []string{strings.Repeat("0", 64), strings.ToUpper(hex.EncodeToString(certSum[:]))}},
+		{name: "public key", pins: []string{hex.EncodeToString(keySum[:])}},
+		{name: "mismatch", pins: []string{strings.Repeat("0", 64)}, mismatch: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: newCloudflareTransport(nil, caPEM, tt.pins, nil)}
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if !tt.mismatch {
+				if err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+				resp.Body.Close()
+				return
+			}
+			if !errors.Is(err, errPinMismatch) {
+				t.Fatalf("Do() error = %v, want %v", err, errPinMismatch)
+			}
+			if retryable(req, nil, err) {
+				t.Error("retryable() = true for a pin mismatch")
+			}
+			if got := errorReason(requestError(err)); got != CFMTLSIssuerapi.ReasonTLSPinMismatch {
+				t.Errorf("reason = %q, want %q", got, CFMTLSIssuerapi.ReasonTLSPinMismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=create;update;patch;delete
+
+const (
+	// trustBundleKey is the key of the PEM encoded CA certificates in the
+	// trust bundle ConfigMaps and in their source ConfigMap.
+	trustBundleKey = "ca.crt"
+	// trustBundleLabelKey marks the trust bundle ConfigMaps managed by the
+	// controller. ConfigMaps without it are never overwritten or deleted.
+	trustBundleLabelKey = "cfmtls.cert.manager.io/trust-bundle"
+)
+
+// trustBundleReconciler publishes the Cloudflare Origin and client CA roots
+// from the TrustBundleSource ConfigMap in a ConfigMap in every namespace
+// matching TrustBundleNamespaces, so that workloads verifying peer
+// certificates can mount them. The ConfigMaps follow changes of the source
+// and are removed from namespaces that no longer match. If trust-manager is
+// installed, the roots are published in a trust-manager Bundle instead.
+type trustBundleReconciler struct {
+	*Issuer
+}
+
+func (r *trustBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// trust-manager distributes the bundle itself, if it is installed.
+	_, err := mgr.GetRESTMapper().RESTMapping(trustManagerBundleGVK.GroupKind(), trustManagerBundleGVK.Version)
+	if err == nil {
+		mgr.GetLogger().Info("trust-manager is installed, publishing the trust bundle in a trust-manager Bundle")
+		return (&trustManagerBundleReconciler{Issuer: r.Issuer}).SetupWithManager(mgr)
+	}
+	if !meta.IsNoMatchError(err) {
+		return fmt.Errorf("failed to look up the trust-manager Bundle API: %w", err)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.configMapRequests)).
+		Named("trustbundle").
+		Complete(r)
+}
+
+// configMapRequests maps a change of the source ConfigMap to all namespaces,
+// and a change of a trust bundle ConfigMap to its namespace, so that edits
+// of the published bundles are reverted.
+func (r *trustBundleReconciler) configMapRequests(ctx context.Context, object client.Object) []reconcile.Request {
+	if client.ObjectKeyFromObject(object) == r.TrustBundleSource {
+		var namespaces corev1.NamespaceList
+		if err := r.client.List(ctx, &namespaces); err != nil {
+			log.FromContext(ctx).Error(err, "failed to list namespaces for the trust bundle")
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(namespaces.Items))
+		for _, namespace := range namespaces.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: namespace.Name}})
+		}
+		return requests
+	}
+	if object.GetName() == r.TrustBundleConfigMap {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: object.GetNamespace()}}}
+	}
+	return nil
+}
+
+func (r *trustBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	namespace := &corev1.Namespace{}
+	if err := r.client.Get(ctx, req.NamespacedName, namespace); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !namespace.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	key := types.NamespacedName{Namespace: namespace.Name, Name: r.TrustBundleConfigMap}
+	configMap := &corev1.ConfigMap{}
+	err := r.client.Get(ctx, key, configMap)
+	exists := err == nil
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if exists && configMap.Labels[trustBundleLabelKey] != "true" {
+		logger.Info("not publishing the trust bundle, the ConfigMap exists and is not managed by the controller", "configMap", key)
+		return ctrl.Result{}, nil
+	}
+
+	if !r.trustBundleSelector().Matches(labels.Set(namespace.Labels)) {
+		if !exists {
+			return ctrl.Result{}, nil
+		}
+		logger.Info("removing trust bundle from namespace", "configMap", key)
+		return ctrl.Result{}, client.IgnoreNotFound(r.client.Delete(ctx, configMap))
+	}
+
+	// Returning the error requeues the namespace with backoff, so that the
+	// bundle is published once the source is fixed.
+	bundle, err := r.trustBundlePEM(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !exists {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: key.Namespace,
+				Name:      key.Name,
+				Labels:    map[string]string{trustBundleLabelKey: "true"},
+			},
+			Data: map[string]string{trustBundleKey: bundle},
+		}
+		logger.Info("publishing trust bundle to namespace", "configMap", key)
+		return ctrl.Result{}, client.IgnoreAlreadyExists(r.client.Create(ctx, configMap))
+	}
+	if configMap.Data[trustBundleKey] == bundle && len(configMap.Data) == 1 {
+		return ctrl.Result{}, nil
+	}
+	original := configMap.DeepCopy()
+	configMap.Data = map[string]string{trustBundleKey: bundle}
+	logger.Info("updating trust bundle in namespace", "configMap", key)
+	return ctrl.Result{}, r.client.Patch(ctx, configMap, client.MergeFrom(original))
+}
+
+// trustBundleSelector returns the selector of the namespaces that the trust
+// bundle is published to. Nil selects no namespace.
+func (r *trustBundleReconciler) trustBundleSelector() labels.Selector {
+	if r.TrustBundleNamespaces == nil {
+		return labels.Nothing()
+	}
+	return r.TrustBundleNamespaces
+}
+
+// trustBundlePEM returns the CA certificates of the source ConfigMap in a
+// canonical form, so that formatting changes of the source do not update
+// every published bundle.
+func (o *Issuer) trustBundlePEM(ctx context.Context) (string, error) {
+	source := &corev1.ConfigMap{}
+	if err := o.client.Get(ctx, o.TrustBundleSource, source); err != nil {
+		return "", fmt.Errorf("failed to get trust bundle source ConfigMap %s: %w", o.TrustBundleSource, err)
+	}
+	bundle, err := canonicalCABundle([]byte(source.Data[trustBundleKey]))
+	if err != nil {
+		return "", fmt.Errorf("invalid key %q of trust bundle source ConfigMap %s: %w", trustBundleKey, o.TrustBundleSource, err)
+	}
+	return bundle, nil
+}
+
+// canonicalCABundle returns the CA certificates of the given PEM data,
+// without duplicates, comments or other blocks, in their original order.
+func canonicalCABundle(data []byte) (string, error) {
+	var bundle bytes.Buffer
+	seen := map[string]bool{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if !cert.IsCA {
+			return "", fmt.Errorf("certificate %q is not a CA", cert.Subject)
+		}
+		if seen[string(cert.Raw)] {
+			continue
+		}
+		seen[string(cert.Raw)] = true
+		_ = pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	if bundle.Len() == 0 {
+		return "", errors.New("no PEM encoded certificates found")
+	}
+	return bundle.String(), nil
+}
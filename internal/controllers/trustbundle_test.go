@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testCertificatePEM(t *testing.T, isCA bool) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), IsCA: isCA, BasicConstraintsValid: true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCanonicalCABundle(t *testing.T) {
+	root := testCertificatePEM(t, true)
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "duplicates and comments", data: "# Cloudflare\n" + root + root, want: root},
+		{name: "empty", data: "", wantErr: true},
+		{name: "not a CA", data: testCertificatePEM(t, false), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalCABundle([]byte(tt.data))
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("canonicalCABundle() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalCABundle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustBundleReconciler(t *testing.T) {
+	root := testCertificatePEM(t, true)
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cfmtls-system", Name: "cfmtls-ca-roots"},
+		Data:       map[string]string{trustBundleKey: root},
+	}
+	selected := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "selected", Labels: map[string]string{"trust-bundle": "enabled"}}}
+	other := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}}
+	// Published before the namespace was unlabelled.
+	stale := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "cfmtls-ca-bundle", Labels: map[string]string{trustBundleLabelKey: "true"}},
+		Data:       map[string]string{trustBundleKey: root},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(source, selected, other, stale).Build()
+	r := &trustBundleReconciler{Issuer: &Issuer{
+		client:                c,
+		TrustBundleSource:     types.NamespacedName{Namespace: "cfmtls-system", Name: "cfmtls-ca-roots"},
+		TrustBundleConfigMap:  "cfmtls-ca-bundle",
+		TrustBundleNamespaces: labels.SelectorFromSet(labels.Set{"trust-bundle": "enabled"}),
+	}}
+
+	ctx := context.Background()
+	for _, namespace := range []string{"selected", "other"} {
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: namespace}}); err != nil {
+			t.Fatalf("Reconcile(%s) error = %v", namespace, err)
+		}
+	}
+
+	published := &corev1.ConfigMap{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "selected", Name: "cfmtls-ca-bundle"}, published); err != nil {
+		t.Fatalf("trust bundle not published: %v", err)
+	}
+	if published.Data[trustBundleKey] != root {
+		t.Errorf("published bundle = %q, want %q", published.Data[trustBundleKey], root)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: "other", Name: "cfmtls-ca-bundle"}, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get() of the stale trust bundle error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// +kubebuilder:rbac:groups=trust.cert-manager.io,resources=bundles,verbs=get;list;watch;create;update;patch
+
+// trustManagerBundleGVK is the trust-manager Bundle API. The trust-manager
+// types are not imported, so that the controller does not depend on a
+// specific trust-manager release.
+var trustManagerBundleGVK = schema.GroupVersionKind{Group: "trust.cert-manager.io", Version: "v1alpha1", Kind: "Bundle"}
+
+// trustManagerBundleReconciler publishes the CA roots of the
+// TrustBundleSource ConfigMap in a trust-manager Bundle named
+// TrustBundleConfigMap, which trust-manager distributes to the namespaces
+// matching TrustBundleNamespaces. The roots are inlined, so that the source
+// does not have to be in the trust namespace of trust-manager.
+type trustManagerBundleReconciler struct {
+	*Issuer
+}
+
+func (r *trustManagerBundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(newTrustManagerBundle()).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.sourceRequests)).
+		Named("trustmanagerbundle").
+		Complete(r)
+}
+
+// sourceRequests maps a change of the source ConfigMap to the Bundle.
+func (r *trustManagerBundleReconciler) sourceRequests(_ context.Context, object client.Object) []reconcile.Request {
+	if client.ObjectKeyFromObject(object) != r.TrustBundleSource {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: r.TrustBundleConfigMap}}}
+}
+
+func (r *trustManagerBundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// Unlike the controller, trust-manager treats an empty selector as all
+	// namespaces, so no Bundle is published without a selector.
+	if req.Name != r.TrustBundleConfigMap || r.TrustBundleNamespaces == nil {
+		return ctrl.Result{}, nil
+	}
+	logger := log.FromContext(ctx).WithValues("bundle", req.Name)
+
+	// Returning the error requeues the Bundle with backoff, so that it is
+	// published once the source is fixed.
+	pemBundle, err := r.trustBundlePEM(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	namespaceSelector, err := r.bundleNamespaceSelector()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	bundle := newTrustManagerBundle()
+	bundle.SetName(req.Name)
+	result, err := controllerutil.CreateOrUpdate(ctx, r.client, bundle, func() error {
+		if bundle.GetResourceVersion() != "" && bundle.GetLabels()[trustBundleLabelKey] != "true" {
+			return errBundleNotManaged
+		}
+		bundleLabels := bundle.GetLabels()
+		if bundleLabels == nil {
+			bundleLabels = map[string]string{}
+		}
+		bundleLabels[trustBundleLabelKey] = "true"
+		bundle.SetLabels(bundleLabels)
+
+		spec := map[string]interface{}{
+			"sources": []interface{}{
+				map[string]interface{}{"inLine": pemBundle},
+			},
+			"target": map[string]interface{}{
+				"configMap":         map[string]interface{}{"key": trustBundleKey},
+				"namespaceSelector": namespaceSelector,
+			},
+		}
+		return unstructured.SetNestedMap(bundle.Object, spec, "spec")
+	})
+	if errors.Is(err, errBundleNotManaged) {
+		logger.Info("not publishing the trust bundle, the Bundle exists and is not managed by the controller")
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to publish the trust-manager Bundle: %w", err)
+	}
+	if result != controllerutil.OperationResultNone {
+		logger.Info("published trust bundle in trust-manager Bundle", "operation", result)
+	}
+	return ctrl.Result{}, nil
+}
+
+// errBundleNotManaged is returned when a Bundle with the name of the trust
+// bundle exists, but was not created by the controller.
+var errBundleNotManaged = errors.New("bundle is not managed by the controller")
+
+// bundleNamespaceSelector returns TrustBundleNamespaces as the namespace
+// selector of the Bundle target.
+func (r *trustManagerBundleReconciler) bundleNamespaceSelector() (map[string]interface{}, error) {
+	selector, err := metav1.ParseToLabelSelector(r.TrustBundleNamespaces.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust bundle namespace selector: %w", err)
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(selector)
+}
+
+func newTrustManagerBundle() *unstructured.Unstructured {
+	bundle := &unstructured.Unstructured{}
+	bundle.SetGroupVersionKind(trustManagerBundleGVK)
+	return bundle
+}
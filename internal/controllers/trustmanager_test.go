@@ -0,0 +1,88 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTrustManagerBundleReconciler(t *testing.T) {
+	root := testCertificatePEM(t, true)
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cfmtls-system", Name: "cfmtls-ca-roots"},
+		Data:       map[string]string{trustBundleKey: "# Cloudflare\n" + root},
+	}
+	// Not created by the controller.
+	foreign := newTrustManagerBundle()
+	foreign.SetName("foreign")
+	foreign.Object["spec"] = map[string]interface{}{"sources": []interface{}{}}
+
+	c := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(source, foreign).Build()
+	issuer := &Issuer{
+		client:                c,
+		TrustBundleSource:     types.NamespacedName{Namespace: "cfmtls-system", Name: "cfmtls-ca-roots"},
+		TrustBundleConfigMap:  "cfmtls-ca-bundle",
+		TrustBundleNamespaces: labels.SelectorFromSet(labels.Set{"trust-bundle": "enabled"}),
+	}
+	r := &trustManagerBundleReconciler{Issuer: issuer}
+
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "cfmtls-ca-bundle"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	bundle := newTrustManagerBundle()
+	if err := c.Get(ctx, types.NamespacedName{Name: "cfmtls-ca-bundle"}, bundle); err != nil {
+		t.Fatalf("Bundle not published: %v", err)
+	}
+	if bundle.GetLabels()[trustBundleLabelKey] != "true" {
+		t.Errorf("Bundle labels = %v, want %s", bundle.GetLabels(), trustBundleLabelKey)
+	}
+	sources, _, _ := unstructured.NestedSlice(bundle.Object, "spec", "sources")
+	if want := []interface{}{map[string]interface{}{"inLine": root}}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("Bundle sources = %v, want %v", sources, want)
+	}
+	matchLabels, _, _ := unstructured.NestedStringMap(bundle.Object, "spec", "target", "namespaceSelector", "matchLabels")
+	if want := map[string]string{"trust-bundle": "enabled"}; !reflect.DeepEqual(matchLabels, want) {
+		t.Errorf("Bundle namespace selector = %v, want %v", matchLabels, want)
+	}
+
+	// A Bundle of the same name that the controller did not create is left
+	// as it is.
+	issuer.TrustBundleConfigMap = "foreign"
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "foreign"}}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	got := newTrustManagerBundle()
+	if err := c.Get(ctx, client.ObjectKeyFromObject(foreign), got); err != nil {
+		t.Fatal(err)
+	}
+	if sources, _, _ := unstructured.NestedSlice(got.Object, "spec", "sources"); len(sources) != 0 {
+		t.Errorf("foreign Bundle sources = %v, want unchanged", sources)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// vaultTokenExpirationSeconds is the lifetime of the ServiceAccount tokens
+// requested to log in to Vault. They are only used once.
+const vaultTokenExpirationSeconds = 600
+
+// +kubebuilder:rbac:groups="",resources=serviceaccounts/token,verbs=create
+
+// vaultCredentials reads the credentials of the given issuer from Vault,
+// keyed like its auth Secret would be. namespace is the namespace of the
+// auth Secret, which holds the ServiceAccount and CA bundle Secret.
+func (o *Issuer) vaultCredentials(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, namespace string) (map[string][]byte, error) {
+	vault := issuerSpec.Vault
+
+	client := &http.Client{Timeout: requestTimeout(issuerSpec), Transport: credentialTransport()}
+	if vault.CABundleSecretRef != nil {
+		rootCAs, err := o.caBundle(ctx, vault.CABundleSecretRef, namespace)
+		if err != nil {
+			return nil, err
+		}
+		transport := newHardenedTransport()
+		transport.TLSClientConfig.RootCAs = rootCAs
+		client.Transport = transport
+	}
+
+	jwt, err := o.serviceAccountToken(ctx, namespace, vault.ServiceAccountRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := vaultLogin(ctx, client, vault, jwt)
+	if err != nil {
+		return nil, err
+	}
+	defer vaultRevokeSelf(ctx, client, vault, token)
+
+	values, err := vaultReadKV(ctx, client, vault, token)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for _, key := range []string{apiTokenSecretKey(issuerSpec), secondaryAPITokenSecretKey(issuerSpec), zoneIDSecretKey(issuerSpec)} {
+		if value, ok := values[key].(string); ok {
+			data[key] = []byte(value)
+		}
+	}
+	return data, nil
+}
+
+// serviceAccountToken requests a short-lived token for the given
+// ServiceAccount.
+func (o *Issuer) serviceAccountToken(ctx context.Context, namespace, name string) (string, error) {
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: ptr.To[int64](vaultTokenExpirationSeconds)},
+	}
+	if err := o.client.SubResource("token").Create(ctx, serviceAccount, tokenRequest); err != nil {
+		return "", withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to request token for ServiceAccount %s/%s: %w", namespace, name, err))
+	}
+	return tokenRequest.Status.Token, nil
+}
+
+// vaultLogin logs in to Vault with the Kubernetes auth method and returns
+// the Vault token.
+func vaultLogin(ctx context.Context, client *http.Client, vault *CFMTLSIssuerapi.VaultAuth, jwt string) (string, error) {
+	mountPath := vault.AuthMountPath
+	if mountPath == "" {
+		mountPath = CFMTLSIssuerapi.DefaultVaultAuthMountPath
+	}
+
+	body, err := json.Marshal(map[string]string{"role": vault.Role, "jwt": jwt})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Vault login request: %w", err)
+	}
+
+	var result struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	url := fmt.Sprintf("%s/v1/auth/%s/login", strings.TrimSuffix(vault.Server, "/"), strings.Trim(mountPath, "/"))
+	if err := vaultDo(ctx, client, vault, http.MethodPost, url, "", bytes.NewReader(body), &result); err != nil {
+		return "", fmt.Errorf("Vault login failed: %w", err)
+	}
+	if result.Auth.ClientToken == "" {
+		return "", withReason(CFMTLSIssuerapi.ReasonAPIError, errors.New("Vault login returned no client token"))
+	}
+	return result.Auth.ClientToken, nil
+}
+
+// vaultReadKV reads the KV version 2 secret at vault.Path.
+func vaultReadKV(ctx context.Context, client *http.Client, vault *CFMTLSIssuerapi.VaultAuth, token string) (map[string]interface{}, error) {
+	mount, path, ok := strings.Cut(strings.Trim(vault.Path, "/"), "/")
+	if !ok || path == "" {
+		return nil, withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("Vault path %q must be of the form <mount>/<path>", vault.Path))
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(vault.Server, "/"), mount, path)
+	if err := vaultDo(ctx, client, vault, http.MethodGet, url, token, nil, &result); err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret %q: %w", vault.Path, err)
+	}
+	return result.Data.Data, nil
+}
+
+// vaultRevokeSelf revokes the given Vault token. Failures are only logged,
+// the token expires on its own.
+func vaultRevokeSelf(ctx context.Context, client *http.Client, vault *CFMTLSIssuerapi.VaultAuth, token string) {
+	url := fmt.Sprintf("%s/v1/auth/token/revoke-self", strings.TrimSuffix(vault.Server, "/"))
+	if err := vaultDo(ctx, client, vault, http.MethodPost, url, token, nil, nil); err != nil {
+		log.FromContext(ctx).V(1).Info("failed to revoke Vault token", "error", err.Error())
+	}
+}
+
+// vaultDo sends a request to Vault and decodes the JSON response into
+// result, if not nil.
+func vaultDo(ctx context.Context, client *http.Client, vault *CFMTLSIssuerapi.VaultAuth, method, url, token string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("failed to create HTTP request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vault.Namespace)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, fmt.Errorf("failed to send request to Vault: %w", err))
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return withReason(CFMTLSIssuerapi.ReasonSecretNotFound, errors.New("Vault responded with status: 404"))
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return withReason(CFMTLSIssuerapi.ReasonAPIUnreachable, fmt.Errorf("Vault responded with status: %d", resp.StatusCode))
+	case resp.StatusCode >= http.StatusBadRequest:
+		return withReason(CFMTLSIssuerapi.ReasonInvalidConfiguration, fmt.Errorf("Vault responded with status: %d", resp.StatusCode))
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(result); err != nil {
+		return withReason(CFMTLSIssuerapi.ReasonAPIError, fmt.Errorf("failed to parse Vault response: %w", err))
+	}
+	return nil
+}
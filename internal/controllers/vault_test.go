@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestVaultCredentials(t *testing.T) {
+	tests := []struct {
+		name  string
+		vault CFMTLSIssuerapi.VaultAuth
+		// loginStatus and readStatus are the status codes of the login and
+		// the read of the secret, if not 200.
+		loginStatus int
+		readStatus  int
+		want        map[string]string
+		wantReason  string
+	}{
+		{
+			name:  "default auth mount path",
+			vault: CFMTLSIssuerapi.VaultAuth{Path: "secret/cloudflare", Role: "issuer"},
+			want:  map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "vault-token", CFMTLSIssuerapi.DefaultZoneIDSecretKey: "zone"},
+		},
+		{
+			name:  "custom auth mount path and namespace",
+			vault: CFMTLSIssuerapi.VaultAuth{Path: "secret/cloudflare", Role: "issuer", AuthMountPath: "/k8s/", Namespace: "team-a"},
+			want:  map[string]string{CFMTLSIssuerapi.DefaultAPITokenSecretKey: "vault-token", CFMTLSIssuerapi.DefaultZoneIDSecretKey: "zone"},
+		},
+		{
+			name:       "path without mount",
+			vault:      CFMTLSIssuerapi.VaultAuth{Path: "cloudflare", Role: "issuer"},
+			wantReason: CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:        "login denied",
+			vault:       CFMTLSIssuerapi.VaultAuth{Path: "secret/cloudflare", Role: "issuer"},
+			loginStatus: http.StatusForbidden,
+			wantReason:  CFMTLSIssuerapi.ReasonInvalidConfiguration,
+		},
+		{
+			name:       "secret not found",
+			vault:      CFMTLSIssuerapi.VaultAuth{Path: "secret/missing", Role: "issuer"},
+			readStatus: http.StatusNotFound,
+			wantReason: CFMTLSIssuerapi.ReasonSecretNotFound,
+		},
+		{
+			name:       "Vault unavailable",
+			vault:      CFMTLSIssuerapi.VaultAuth{Path: "secret/cloudflare", Role: "issuer"},
+			readStatus: http.StatusServiceUnavailable,
+			wantReason: CFMTLSIssuerapi.ReasonAPIUnreachable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mountPath := "kubernetes"
+			if tt.vault.AuthMountPath != "" {
+				mountPath = "k8s"
+			}
+			revoked := false
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /v1/auth/"+mountPath+"/login", func(w http.ResponseWriter, r *http.Request) {
+				var login map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+					t.Errorf("failed to decode login request: %v", err)
+				}
+				if login["role"] != tt.vault.Role || login["jwt"] != "sa-token" {
+					t.Errorf("login request = %v, want role %s and the ServiceAccount token", login, tt.vault.Role)
+				}
+				if got := r.Header.Get("X-Vault-Namespace"); got != tt.vault.Namespace {
+					t.Errorf("X-Vault-Namespace = %q, want %q", got, tt.vault.Namespace)
+				}
+				if tt.loginStatus != 0 {
+					w.WriteHeader(tt.loginStatus)
+					return
+				}
+				_, _ = w.Write([]byte(`{"auth":{"client_token":"client-token"}}`))
+			})
+			mux.HandleFunc("GET /v1/secret/data/", func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("X-Vault-Token"); got != "client-token" {
+					t.Errorf("X-Vault-Token = %q, want the client token", got)
+				}
+				if tt.readStatus != 0 {
+					w.WriteHeader(tt.readStatus)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": map[string]string{
+					CFMTLSIssuerapi.DefaultAPITokenSecretKey: "vault-token",
+					CFMTLSIssuerapi.DefaultZoneIDSecretKey:   "zone",
+					"unrelated":                              "value",
+				}}})
+			})
+			mux.HandleFunc("POST /v1/auth/token/revoke-self", func(w http.ResponseWriter, r *http.Request) {
+				revoked = r.Header.Get("X-Vault-Token") == "client-token"
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			tt.vault.Server = server.URL + "/"
+			tt.vault.ServiceAccountRef = CFMTLSIssuerapi.ServiceAccountReference{Name: "issuer"}
+
+			c := fake.NewClientBuilder().WithScheme(runtime.NewScheme()).WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+					if _, ok := obj.(*corev1.ServiceAccount); !ok || subResourceName != "token" {
+						t.Errorf("unexpected %s subresource of %T", subResourceName, obj)
+					}
+					if obj.GetNamespace() != "team-a" || obj.GetName() != "issuer" {
+						t.Errorf("requested token for ServiceAccount %s/%s, want team-a/issuer", obj.GetNamespace(), obj.GetName())
+					}
+					subResource.(*authenticationv1.TokenRequest).Status.Token = "sa-token"
+					return nil
+				},
+			}).Build()
+			o := &Issuer{client: c}
+
+			data, err := o.getSecretData(context.Background(), &CFMTLSIssuerapi.IssuerSpec{Vault: &tt.vault}, "team-a")
+			if tt.wantReason != "" {
+				if got := errorReason(err); got != tt.wantReason {
+					t.Fatalf("getSecretData() error = %v, want reason %s", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getSecretData() error = %v", err)
+			}
+			if len(data) != len(tt.want) {
+				t.Errorf("getSecretData() = %q, want %q", data, tt.want)
+			}
+			for key, value := range tt.want {
+				if got := string(data[key]); got != value {
+					t.Errorf("getSecretData()[%s] = %q, want %q", key, got, value)
+				}
+			}
+			if !revoked {
+				t.Error("Vault token was not revoked")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	"github.com/cert-manager/issuer-lib/conditions"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+const (
+	// warmUpPollPeriod is how often the warm-up looks for the issuers that
+	// were checked.
+	warmUpPollPeriod = 500 * time.Millisecond
+	// warmUpTimeout bounds the warm-up, so that issuers whose checks hang
+	// do not keep the controller from becoming ready.
+	warmUpTimeout = 2 * time.Minute
+)
+
+// Phases of the warm-up.
+const (
+	warmUpNotStarted int32 = iota
+	warmUpRunning
+	warmUpDone
+)
+
+// warmUp waits for the issuer controllers to check all issuers once this
+// replica became the leader. issuer-lib checks every issuer when its
+// controller starts, WarmUpConcurrency at a time, so until then the
+// conditions of the issuers may be stale. The replica is not ready while
+// the warm-up runs, see ReadinessCheck. Standby replicas do not run it.
+type warmUp struct {
+	*Issuer
+
+	phase atomic.Int32
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable.
+func (w *warmUp) NeedLeaderElection() bool {
+	return true
+}
+
+// running reports whether the warm-up started and has not finished yet.
+func (w *warmUp) running() bool {
+	return w != nil && w.phase.Load() == warmUpRunning
+}
+
+// Start implements manager.Runnable.
+func (w *warmUp) Start(ctx context.Context) error {
+	start := time.Now()
+	w.phase.Store(warmUpRunning)
+	defer w.phase.Store(warmUpDone)
+
+	logger := log.FromContext(ctx).WithName("warmUp")
+	pending := w.uncheckedIssuers(ctx)
+	logger.Info("waiting for the issuers to be checked", "issuers", len(pending))
+
+	ticker := time.NewTicker(warmUpPollPeriod)
+	defer ticker.Stop()
+	timeout := time.NewTimer(warmUpTimeout)
+	defer timeout.Stop()
+	for {
+		for uid := range pending {
+			if w.checks.checkedSince(uid, start) {
+				delete(pending, uid)
+			}
+		}
+		if len(pending) == 0 {
+			logger.Info("checked all issuers", "duration", time.Since(start))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timeout.C:
+			logger.Info("gave up waiting for the issuers to be checked", "unchecked", len(pending), "duration", time.Since(start))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// uncheckedIssuers returns the issuers of this replica that issuer-lib
+// checks on startup, i.e. all but those that failed permanently.
+func (w *warmUp) uncheckedIssuers(ctx context.Context) map[types.UID]bool {
+	logger := log.FromContext(ctx).WithName("warmUp")
+	pending := map[types.UID]bool{}
+	add := func(issuerObject issuerapi.Issuer) {
+		key := types.NamespacedName{Namespace: issuerObject.GetNamespace(), Name: issuerObject.GetName()}
+		if w.ownsIssuer(key) && !permanentlyFailed(issuerObject) {
+			pending[issuerObject.GetUID()] = true
+		}
+	}
+
+	var issuers CFMTLSIssuerapi.CFMTLSIssuerList
+	if err := w.client.List(ctx, &issuers); err != nil {
+		logger.Error(err, "failed to list CFMTLSIssuers")
+	}
+	for i := range issuers.Items {
+		add(&issuers.Items[i])
+	}
+
+	if w.clusterScoped() {
+		var clusterIssuers CFMTLSIssuerapi.CFMTLSClusterIssuerList
+		if err := w.client.List(ctx, &clusterIssuers); err != nil {
+			logger.Error(err, "failed to list CFMTLSClusterIssuers")
+		}
+		for i := range clusterIssuers.Items {
+			add(&clusterIssuers.Items[i])
+		}
+	}
+	return pending
+}
+
+// permanentlyFailed reports whether issuer-lib marked the current
+// generation of the issuer as failed, in which case it is not checked
+// again until it changes.
+func permanentlyFailed(issuerObject issuerapi.Issuer) bool {
+	status := issuerObject.GetStatus()
+	if status == nil {
+		return false
+	}
+	ready := conditions.GetIssuerStatusCondition(status.Conditions, cmapi.IssuerConditionReady)
+	return ready != nil &&
+		ready.Status == cmmeta.ConditionFalse &&
+		ready.Reason == issuerapi.IssuerConditionReasonFailed &&
+		ready.ObservedGeneration >= issuerObject.GetGeneration()
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	issuerapi "github.com/cert-manager/issuer-lib/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestWarmUp(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := CFMTLSIssuerapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default", UID: "pending"}}
+	// issuer-lib does not check issuers that failed permanently.
+	failed := &CFMTLSIssuerapi.CFMTLSIssuer{ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: "default", UID: "failed", Generation: 1}}
+	failed.Status.Conditions = []cmapi.IssuerCondition{{
+		Type:               cmapi.IssuerConditionReady,
+		Status:             cmmeta.ConditionFalse,
+		Reason:             issuerapi.IssuerConditionReasonFailed,
+		ObservedGeneration: 1,
+	}}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pending, failed).Build()
+	o := &Issuer{client: c, checks: newCheckScheduler(c, false)}
+	o.warmUp = &warmUp{Issuer: o}
+	check := o.ReadinessCheck("", false)
+	req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+	// Standby replicas do not run the warm-up and are ready.
+	if err := check(req); err != nil {
+		t.Fatalf("check() before warm-up error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = o.warmUp.Start(context.Background())
+	}()
+	for !o.warmUp.running() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := check(req); err == nil {
+		t.Fatal("check() during warm-up error = nil, want an error")
+	}
+
+	o.checks.checked(pending, time.Now())
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("warm-up did not finish after all issuers were checked")
+	}
+	if err := check(req); err != nil {
+		t.Errorf("check() after warm-up error = %v", err)
+	}
+}
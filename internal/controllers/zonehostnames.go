@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// checkZoneHostnames rejects requests for DNS names that are neither in the
+// zone that the certificate is signed for nor custom hostnames of the zone,
+// so that a typo fails with a clear message instead of a Cloudflare error.
+// Custom hostnames are only looked up for names outside the zone.
+func checkZoneHostnames(ctx context.Context, status *CFMTLSIssuerapi.IssuerStatus, cf *CloudflareSigner, template *x509.Certificate) error {
+	if len(template.DNSNames) == 0 {
+		return nil
+	}
+	zoneName, err := resolveZoneName(ctx, status, cf)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the name of zone %s: %w", cf.ZoneID, err)
+	}
+
+	for _, name := range template.DNSNames {
+		if matchesDomain(name, zoneName) {
+			continue
+		}
+		custom, err := lookupCustomHostname(ctx, cf.APIKey, cf.BaseURL, cf.ZoneID, name, cf.HTTPClient)
+		if err != nil {
+			return err
+		}
+		if !custom {
+			return policyViolation(fmt.Errorf("%q is not in zone %s", name, zoneName))
+		}
+	}
+	return nil
+}
+
+// checkZoneHostnamesWithFailover runs checkZoneHostnames with the primary
+// API token of the issuer and, if Cloudflare rejects it, with the secondary
+// token, see withTokenFailover. cf is left with the accepted token, so that
+// the certificate is signed with it. It reports whether the secondary token
+// was used.
+func checkZoneHostnamesWithFailover(ctx context.Context, issuerSpec *CFMTLSIssuerapi.IssuerSpec, secretData map[string][]byte, status *CFMTLSIssuerapi.IssuerStatus, cf *CloudflareSigner, template *x509.Certificate) (bool, error) {
+	return withTokenFailover(ctx, issuerSpec, secretData, func(apiKey string) error {
+		cf.APIKey = apiKey
+		return checkZoneHostnames(ctx, status, cf, template)
+	})
+}
+
+// resolveZoneName returns the name of the zone that cf signs for, from the
+// issuer status if it was resolved for that zone before.
+func resolveZoneName(ctx context.Context, status *CFMTLSIssuerapi.IssuerStatus, cf *CloudflareSigner) (string, error) {
+	if status != nil && status.ZoneName != "" && status.ZoneID == cf.ZoneID {
+		return status.ZoneName, nil
+	}
+	return lookupZoneName(ctx, cf.APIKey, cf.BaseURL, cf.ZoneID, cf.HTTPClient)
+}
+
+// lookupCustomHostname reports whether hostname is a custom hostname of the
+// Cloudflare zone with the given ID.
+func lookupCustomHostname(ctx context.Context, apiKey, baseURL, zoneID, hostname string, client *http.Client) (bool, error) {
+	hostname = strings.TrimSuffix(hostname, ".")
+	query := url.Values{"hostname": {hostname}}
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/zones/%s/custom_hostnames?%s", baseURL, zoneID, query.Encode()), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, requestError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, withReason(reasonForStatusCode(resp.StatusCode), withCFRay(fmt.Errorf("Cloudflare custom hostname lookup failed with status: %d", resp.StatusCode), resp))
+	}
+
+	var result struct {
+		Result []struct {
+			Hostname string `json:"hostname"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, withReason(CFMTLSIssuerapi.ReasonAPIError, fmt.Errorf("failed to parse Cloudflare response: %w", err))
+	}
+	for _, customHostname := range result.Result {
+		if strings.EqualFold(customHostname.Hostname, hostname) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cert-manager/issuer-lib/controllers/signer"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestCheckZoneHostnames(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/zones/zone":
+			fmt.Fprint(w, `{"success":true,"result":{"id":"zone","name":"example.com"}}`)
+		case "/zones/zone/custom_hostnames":
+			switch r.URL.Query().Get("hostname") {
+			case "app.customer.net":
+				fmt.Fprint(w, `{"success":true,"result":[{"id":"1","hostname":"App.Customer.net"}]}`)
+			case "broken.customer.net":
+				w.WriteHeader(http.StatusBadGateway)
+			default:
+				fmt.Fprint(w, `{"success":true,"result":[]}`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		status       *CFMTLSIssuerapi.IssuerStatus
+		dnsNames     []string
+		wantErr      string
+		wantReason   string
+		wantRequests int
+	}{
+		{
+			name: "no DNS names",
+		},
+		{
+			name:         "in zone",
+			dnsNames:     []string{"example.com", "www.example.com", "*.api.example.com."},
+			wantRequests: 1,
+		},
+		{
+			name:     "zone name from status",
+			status:   &CFMTLSIssuerapi.IssuerStatus{ZoneID: "zone", ZoneName: "example.com"},
+			dnsNames: []string{"www.example.com"},
+		},
+		{
+			name:         "zone name of other zone in status",
+			status:       &CFMTLSIssuerapi.IssuerStatus{ZoneID: "other", ZoneName: "example.org"},
+			dnsNames:     []string{"www.example.com"},
+			wantRequests: 1,
+		},
+		{
+			name:         "custom hostname",
+			status:       &CFMTLSIssuerapi.IssuerStatus{ZoneID: "zone", ZoneName: "example.com"},
+			dnsNames:     []string{"www.example.com", "app.customer.net"},
+			wantRequests: 1,
+		},
+		{
+			name:         "not in zone",
+			status:       &CFMTLSIssuerapi.IssuerStatus{ZoneID: "zone", ZoneName: "example.com"},
+			dnsNames:     []string{"www.exmaple.com"},
+			wantErr:      `"www.exmaple.com" is not in zone example.com`,
+			wantReason:   CFMTLSIssuerapi.ReasonPolicyViolation,
+			wantRequests: 1,
+		},
+		{
+			name:         "custom hostname lookup failed",
+			status:       &CFMTLSIssuerapi.IssuerStatus{ZoneID: "zone", ZoneName: "example.com"},
+			dnsNames:     []string{"broken.customer.net"},
+			wantErr:      "Cloudflare custom hostname lookup failed with status: 502",
+			wantReason:   CFMTLSIssuerapi.ReasonAPIUnreachable,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			cf := &CloudflareSigner{APIKey: "token", ZoneID: "zone", BaseURL: server.URL, HTTPClient: server.Client()}
+			err := checkZoneHostnames(context.Background(), tt.status, cf, &x509.Certificate{DNSNames: tt.dnsNames})
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkZoneHostnames() = %v, want nil", err)
+				}
+			} else {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("checkZoneHostnames() = %v, want %q", err, tt.wantErr)
+				}
+				if got := errorReason(err); got != tt.wantReason {
+					t.Errorf("reason = %q, want %q", got, tt.wantReason)
+				}
+				wantPermanent := tt.wantReason == CFMTLSIssuerapi.ReasonPolicyViolation
+				if got := errors.As(err, &signer.PermanentError{}); got != wantPermanent {
+					t.Errorf("permanent = %v, want %v", got, wantPermanent)
+				}
+			}
+			if len(requests) != tt.wantRequests {
+				t.Errorf("sent requests %q, want %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestCheckZoneHostnamesWithFailover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secondary" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"success":true,"result":{"id":"zone","name":"example.com"}}`)
+	}))
+	defer server.Close()
+
+	issuerSpec := &CFMTLSIssuerapi.IssuerSpec{}
+	template := &x509.Certificate{DNSNames: []string{"www.example.com"}}
+	tests := []struct {
+		name          string
+		secretData    map[string][]byte
+		wantSecondary bool
+		wantReason    string
+	}{
+		{
+			name: "primary token rejected",
+			secretData: map[string][]byte{
+				CFMTLSIssuerapi.DefaultAPITokenSecretKey:          []byte("revoked"),
+				CFMTLSIssuerapi.DefaultSecondaryAPITokenSecretKey: []byte("secondary"),
+			},
+			wantSecondary: true,
+		},
+		{
+			name:       "no secondary token",
+			secretData: map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("revoked")},
+			wantReason: CFMTLSIssuerapi.ReasonTokenInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := &CloudflareSigner{ZoneID: "zone", BaseURL: server.URL, HTTPClient: server.Client()}
+			secondary, err := checkZoneHostnamesWithFailover(context.Background(), issuerSpec, tt.secretData, nil, cf, template)
+			if tt.wantReason == "" && err != nil {
+				t.Fatalf("checkZoneHostnamesWithFailover() = %v, want nil", err)
+			}
+			if tt.wantReason != "" && errorReason(err) != tt.wantReason {
+				t.Fatalf("checkZoneHostnamesWithFailover() = %v, want reason %q", err, tt.wantReason)
+			}
+			if secondary != tt.wantSecondary {
+				t.Errorf("secondary = %v, want %v", secondary, tt.wantSecondary)
+			}
+			if tt.wantSecondary && cf.APIKey != "secondary" {
+				t.Errorf("APIKey = %q, want the secondary token to sign with", cf.APIKey)
+			}
+		})
+	}
+}
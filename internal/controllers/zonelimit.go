@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// zoneLimiters holds a token bucket per Cloudflare zone that all requests
+// for the zone wait for, so that a renewal storm is spread out instead of
+// tripping the API rate limit of Cloudflare.
+type zoneLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newZoneLimiters() *zoneLimiters {
+	return &zoneLimiters{limiters: map[string]*rate.Limiter{}}
+}
+
+// get returns the limiter of the zone, allowing perMinute requests per
+// minute with the given burst. The limit of an existing limiter is updated,
+// so the issuer of the zone that sent a request last sets its limit. A nil
+// set or a perMinute of zero returns nil, which does not limit.
+func (l *zoneLimiters) get(zoneID string, perMinute, burst int) *rate.Limiter {
+	if l == nil || perMinute <= 0 {
+		return nil
+	}
+	limit := rate.Every(time.Minute / time.Duration(perMinute))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.limiters[zoneID]
+	if !ok {
+		limiter = rate.NewLimiter(limit, burst)
+		l.limiters[zoneID] = limiter
+		return limiter
+	}
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter
+}
+
+// rateLimiter returns the limiter of the zone of the issuer, or nil if its
+// requests are not limited. The RateLimit of the issuer overrides the limit
+// the controller is configured with.
+func (o *Issuer) rateLimiter(issuerSpec *CFMTLSIssuerapi.IssuerSpec, zoneID string) *rate.Limiter {
+	perMinute, burst := o.CloudflareRateLimit, o.CloudflareRateLimitBurst
+	if issuerSpec.RateLimit != nil {
+		perMinute, burst = int(issuerSpec.RateLimit.RequestsPerMinute), int(issuerSpec.RateLimit.Burst)
+	}
+	if burst <= 0 {
+		burst = CFMTLSIssuerapi.DefaultRateLimitBurst
+	}
+	return o.limiters.get(zoneID, perMinute, burst)
+}
+
+// rateLimitTransport waits for a token of the limiter of the zone before
+// every request, including retries.
+type rateLimitTransport struct {
+	limiter *rate.Limiter
+	// base is the transport that sends the request. nil uses
+	// http.DefaultTransport.
+	base http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, fmt.Errorf("waiting for the Cloudflare API rate limit of the zone: %w", err)
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		spec      CFMTLSIssuerapi.IssuerSpec
+		wantLimit rate.Limit
+		wantBurst int
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:      "controller default",
+			perMinute: 120,
+			wantLimit: 2,
+			wantBurst: CFMTLSIssuerapi.DefaultRateLimitBurst,
+		},
+		{
+			name:      "issuer override",
+			perMinute: 120,
+			burst:     20,
+			spec:      CFMTLSIssuerapi.IssuerSpec{RateLimit: &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 30, Burst: 5}},
+			wantLimit: 0.5,
+			wantBurst: 5,
+		},
+		{
+			name:      "issuer override without burst",
+			spec:      CFMTLSIssuerapi.IssuerSpec{RateLimit: &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60}},
+			wantLimit: 1,
+			wantBurst: CFMTLSIssuerapi.DefaultRateLimitBurst,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &Issuer{CloudflareRateLimit: tt.perMinute, CloudflareRateLimitBurst: tt.burst, limiters: newZoneLimiters()}
+			limiter := o.rateLimiter(&tt.spec, "zone")
+			if tt.wantLimit == 0 {
+				if limiter != nil {
+					t.Fatalf("rateLimiter() = %v, want nil", limiter)
+				}
+				return
+			}
+			if limiter.Limit() != tt.wantLimit || limiter.Burst() != tt.wantBurst {
+				t.Errorf("rateLimiter() = %v/s burst %d, want %v/s burst %d", limiter.Limit(), limiter.Burst(), tt.wantLimit, tt.wantBurst)
+			}
+		})
+	}
+}
+
+func TestZoneLimiters(t *testing.T) {
+	limiters := newZoneLimiters()
+
+	a := limiters.get("a", 60, 5)
+	if limiters.get("a", 60, 5) != a {
+		t.Error("get() returned a new limiter for the same zone")
+	}
+	if limiters.get("b", 60, 5) == a {
+		t.Error("get() shared the limiter of another zone")
+	}
+
+	// A changed limit updates the limiter of the zone in place.
+	if limiters.get("a", 120, 10) != a {
+		t.Error("get() returned a new limiter for a changed limit")
+	}
+	if a.Limit() != 2 || a.Burst() != 10 {
+		t.Errorf("limiter = %v/s burst %d, want 2/s burst 10", a.Limit(), a.Burst())
+	}
+
+	var nilLimiters *zoneLimiters
+	if nilLimiters.get("a", 60, 5) != nil {
+		t.Error("get() on a nil set returned a limiter")
+	}
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	transport := &rateLimitTransport{limiter: rate.NewLimiter(rate.Every(time.Hour), 1)}
+	send := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := send(context.Background()); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	// The second token is not available before the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := send(ctx); err == nil {
+		t.Fatal("second request succeeded, want it to be rate limited")
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package features defines the feature gates of the controller. New
+// subsystems are added as Alpha features, which are disabled by default and
+// enabled per cluster with --feature-gates.
+package features
+
+import (
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/component-base/featuregate"
+)
+
+const (
+	// Revocation enables the CFMTLSRevocation controller, which revokes
+	// issued certificates at Cloudflare, and the revocationPolicy OnDelete
+	// and revokeSupersededAfter of issuers.
+	Revocation featuregate.Feature = "Revocation"
+
+	// TokenRotation enables the rotation of the API tokens of issuers that
+	// set spec.tokenRotation.
+	TokenRotation featuregate.Feature = "TokenRotation"
+
+	// ExpiryPriorityQueue makes the CertificateRequest controller sign the
+	// requests of the Certificates that expire first before the others,
+	// instead of in the order they were queued. It watches Certificates.
+	ExpiryPriorityQueue featuregate.Feature = "ExpiryPriorityQueue"
+
+	// TrustBundle publishes the Cloudflare Origin and client CA roots in a
+	// ConfigMap in the namespaces matching --trust-bundle-namespace-selector,
+	// or in a trust-manager Bundle if trust-manager is installed.
+	TrustBundle featuregate.Feature = "TrustBundle"
+
+	// CertificateIndex records the owner of every issued certificate in a
+	// ConfigMap per zone in the cluster resource namespace, so that the
+	// orphan garbage collector finds orphans by certificate ID.
+	CertificateIndex featuregate.Feature = "CertificateIndex"
+
+	// HostnameConflicts holds the requests for DNS names that an issuer
+	// already issued a certificate for to another namespace, with a
+	// HostnameConflict reason, until that certificate expires.
+	HostnameConflicts featuregate.Feature = "HostnameConflicts"
+)
+
+// defaultFeatureGates lists the features of the controller and their
+// defaults.
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	Revocation:    {Default: true, PreRelease: featuregate.Beta},
+	TokenRotation: {Default: true, PreRelease: featuregate.Beta},
+
+	ExpiryPriorityQueue: {Default: false, PreRelease: featuregate.Alpha},
+	TrustBundle:         {Default: false, PreRelease: featuregate.Alpha},
+	CertificateIndex:    {Default: false, PreRelease: featuregate.Alpha},
+	HostnameConflicts:   {Default: false, PreRelease: featuregate.Alpha},
+}
+
+// FeatureGate is a mutable feature gate that implements flag.Value, so that
+// it can be bound to the --feature-gates flag.
+type FeatureGate interface {
+	featuregate.MutableFeatureGate
+	String() string
+}
+
+// NewFeatureGate returns a feature gate with the features of the controller
+// set to their defaults. It can be bound to the --feature-gates flag.
+func NewFeatureGate() FeatureGate {
+	gate := featuregate.NewFeatureGate()
+	runtime.Must(gate.Add(defaultFeatureGates))
+	return gate
+}
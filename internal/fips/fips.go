@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fips restricts the cryptography of the controller to FIPS 140
+// approved algorithms, for FIPS-constrained environments.
+//
+// The mode is enabled by the --fips flag, and always in binaries built with
+// GOEXPERIMENT=boringcrypto, in which the FIPS validated BoringCrypto module
+// implements the cryptography and crypto/tls/fipsonly restricts every TLS
+// configuration. The checks of this package apply in both builds: TLS
+// configurations are limited to approved cipher suites and curves, and
+// CSRs with keys or signatures that are not approved are refused.
+package fips
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+)
+
+// minRSAKeySize is the smallest approved RSA modulus, in bits.
+const minRSAKeySize = 2048
+
+// boringCrypto is set if the binary was built with GOEXPERIMENT=boringcrypto
+// and BoringCrypto is in use.
+var boringCrypto bool
+
+var enabled atomic.Bool
+
+// Enable enables the FIPS mode. It is called before any TLS configuration
+// is created.
+func Enable() {
+	enabled.Store(true)
+}
+
+// Enabled reports whether the FIPS mode is enabled.
+func Enabled() bool {
+	return boringCrypto || enabled.Load()
+}
+
+// BoringCrypto reports whether the cryptography is implemented by the
+// BoringCrypto module.
+func BoringCrypto() bool {
+	return boringCrypto
+}
+
+// cipherSuites are the approved TLS 1.2 cipher suites.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// curves are the approved key exchange curves.
+var curves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// ConfigureTLS restricts config to the approved cipher suites and curves if
+// the FIPS mode is enabled. The TLS 1.3 cipher suites cannot be configured,
+// so without BoringCrypto, which restricts them itself, the connections are
+// limited to TLS 1.2.
+func ConfigureTLS(config *tls.Config) {
+	if !Enabled() {
+		return
+	}
+	config.MinVersion = tls.VersionTLS12
+	if !boringCrypto {
+		config.MaxVersion = tls.VersionTLS12
+	}
+	config.CipherSuites = cipherSuites
+	config.CurvePreferences = curves
+}
+
+// CheckCertificateRequest returns an error if the FIPS mode is enabled and
+// the key or the signature of csr is not approved: RSA keys must have at
+// least 2048 bits, ECDSA keys must be on the P-256, P-384 or P-521 curve,
+// and the CSR must be signed with SHA-256 or a stronger hash.
+func CheckCertificateRequest(csr *x509.CertificateRequest) error {
+	if !Enabled() {
+		return nil
+	}
+
+	switch key := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if size := key.N.BitLen(); size < minRSAKeySize {
+			return fmt.Errorf("RSA key size %d is not approved, it must be at least %d bits", size, minRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return fmt.Errorf("ECDSA curve %s is not approved", key.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("public key algorithm %s is not approved", csr.PublicKeyAlgorithm)
+	}
+
+	switch csr.SignatureAlgorithm {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS,
+		x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+	default:
+		return fmt.Errorf("signature algorithm %s is not approved", csr.SignatureAlgorithm)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fips
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"testing"
+)
+
+// enableForTest enables the FIPS mode until the end of the test.
+func enableForTest(t *testing.T) {
+	t.Helper()
+	Enable()
+	t.Cleanup(func() { enabled.Store(false) })
+}
+
+func TestCheckCertificateRequest(t *testing.T) {
+	rsaKey := func(bits int) *rsa.PublicKey {
+		return &rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), uint(bits-1)), E: 65537}
+	}
+	ecKey := func(curve elliptic.Curve) *ecdsa.PublicKey {
+		return &ecdsa.PublicKey{Curve: curve}
+	}
+
+	tests := []struct {
+		name    string
+		csr     *x509.CertificateRequest
+		wantErr string
+	}{
+		{
+			name: "RSA 2048",
+			csr:  &x509.CertificateRequest{PublicKey: rsaKey(2048), SignatureAlgorithm: x509.SHA256WithRSA},
+		},
+		{
+			name: "ECDSA P-384",
+			csr:  &x509.CertificateRequest{PublicKey: ecKey(elliptic.P384()), SignatureAlgorithm: x509.ECDSAWithSHA384},
+		},
+		{
+			name:    "RSA 1024",
+			csr:     &x509.CertificateRequest{PublicKey: rsaKey(1024), SignatureAlgorithm: x509.SHA256WithRSA},
+			wantErr: "RSA key size 1024 is not approved, it must be at least 2048 bits",
+		},
+		{
+			name:    "ECDSA P-224",
+			csr:     &x509.CertificateRequest{PublicKey: ecKey(elliptic.P224()), SignatureAlgorithm: x509.ECDSAWithSHA256},
+			wantErr: "ECDSA curve P-224 is not approved",
+		},
+		{
+			name:    "Ed25519",
+			csr:     &x509.CertificateRequest{PublicKey: ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)), PublicKeyAlgorithm: x509.Ed25519, SignatureAlgorithm: x509.PureEd25519},
+			wantErr: "public key algorithm Ed25519 is not approved",
+		},
+		{
+			name:    "SHA-1 signature",
+			csr:     &x509.CertificateRequest{PublicKey: rsaKey(2048), SignatureAlgorithm: x509.SHA1WithRSA},
+			wantErr: "signature algorithm SHA1-RSA is not approved",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckCertificateRequest(tt.csr); err != nil {
+				t.Fatalf("CheckCertificateRequest() without FIPS mode = %v, want nil", err)
+			}
+
+			enableForTest(t)
+			err := CheckCertificateRequest(tt.csr)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckCertificateRequest() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("CheckCertificateRequest() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	config := &tls.Config{}
+	ConfigureTLS(config)
+	if config.CipherSuites != nil || config.MaxVersion != 0 {
+		t.Fatalf("ConfigureTLS() without FIPS mode changed the config to %+v", config)
+	}
+
+	enableForTest(t)
+	ConfigureTLS(config)
+	if config.MinVersion != tls.VersionTLS12 || config.MaxVersion != tls.VersionTLS12 {
+		t.Errorf("ConfigureTLS() versions = %x-%x, want TLS 1.2 only", config.MinVersion, config.MaxVersion)
+	}
+	if len(config.CipherSuites) == 0 || len(config.CurvePreferences) == 0 {
+		t.Errorf("ConfigureTLS() = %+v, want approved cipher suites and curves", config)
+	}
+}
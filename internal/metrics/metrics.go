@@ -0,0 +1,250 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the Prometheus metrics of the controller. They are
+// served on the metrics endpoint of the manager.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/krisek/cfmtls-issuer/internal/version"
+)
+
+const namespace = "cfmtls_issuer"
+
+// buildInfo is always 1, its labels describe the running binary.
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "build_info",
+	Help:      "A metric with a constant '1' value labeled by the version, commit and build date of the controller, and the Go version it was built with.",
+}, []string{"version", "commit", "date", "goversion"})
+
+// certificatesIssued counts the certificates signed by Cloudflare.
+var certificatesIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_certificates_issued_total",
+	Help: "Number of certificates issued by Cloudflare, by issuer, zone and tenant.",
+}, []string{"issuer_kind", "issuer", "zone", "tenant"})
+
+// signFailures counts the signing attempts that failed, by the condition
+// reason of the failure.
+var signFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_sign_failures_total",
+	Help: "Number of failed attempts to sign a certificate request, by issuer, zone, tenant and reason.",
+}, []string{"issuer_kind", "issuer", "zone", "tenant", "reason"})
+
+// cloudflareRequestDuration observes the latency of the Cloudflare API, as
+// seen by the controller.
+var cloudflareRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "cfmtls_cloudflare_request_duration_seconds",
+	Help:    "Duration of the requests to the Cloudflare API, by method and endpoint.",
+	Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+}, []string{"method", "endpoint"})
+
+// cloudflareRequests counts the responses of the Cloudflare API. The code of
+// requests that got no response is "error".
+var cloudflareRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_cloudflare_requests_total",
+	Help: "Number of requests to the Cloudflare API, by method, endpoint and status code.",
+}, []string{"method", "endpoint", "code"})
+
+// cloudflareRateLimitLimit, cloudflareRateLimitRemaining and
+// cloudflareRateLimitReset describe the rate limit budget of the API token of
+// an issuer, as reported by the last response of the Cloudflare API.
+var (
+	cloudflareRateLimitLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_cloudflare_ratelimit_limit",
+		Help: "Number of requests to the Cloudflare API allowed per rate limit window, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+	cloudflareRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_cloudflare_ratelimit_remaining",
+		Help: "Number of requests to the Cloudflare API left in the current rate limit window, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+	cloudflareRateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_cloudflare_ratelimit_reset_timestamp_seconds",
+		Help: "Unix time at which the rate limit window of the Cloudflare API resets, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+)
+
+// certificateExpiry is the notAfter time of the last certificate issued for
+// each Certificate.
+var certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "cfmtls_certificate_expiration_timestamp_seconds",
+	Help: "Unix time at which the last certificate issued for a Certificate expires, by issuer and Certificate.",
+}, []string{"issuer_kind", "issuer", "namespace", "certificate"})
+
+// issuerReady, issuerReadyChange, issuerCheckDuration and issuerLastCheck
+// describe the last health check of each issuer.
+var (
+	issuerReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_issuer_ready",
+		Help: "Whether the last health check of an issuer succeeded (1) or failed (0), by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+	issuerReadyChange = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_issuer_ready_change_timestamp_seconds",
+		Help: "Unix time at which the health check result of an issuer last changed, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+	issuerCheckDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_issuer_check_duration_seconds",
+		Help: "Duration of the last health check of an issuer, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+	issuerLastCheck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cfmtls_issuer_last_check_timestamp_seconds",
+		Help: "Unix time of the last health check of an issuer, by issuer.",
+	}, []string{"issuer_kind", "issuer"})
+)
+
+// panics counts the panics recovered from, e.g. in the signer and health
+// checker builders.
+var panics = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_panics_total",
+	Help: "Number of panics recovered from, by operation.",
+}, []string{"operation"})
+
+// janitorCleanups counts the stale objects cleaned up by the janitor.
+var janitorCleanups = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_janitor_cleanups_total",
+	Help: "Number of stale request annotations, tracking objects and certificate index entries removed by the janitor, by kind.",
+}, []string{"kind"})
+
+// orphanedCertificates counts the orphaned Cloudflare certificates found by
+// the orphan garbage collector.
+var orphanedCertificates = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cfmtls_orphaned_certificates_total",
+	Help: "Number of orphaned Cloudflare certificates found by the orphan garbage collector, by action taken.",
+}, []string{"action"})
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(buildInfo, certificatesIssued, signFailures, cloudflareRequestDuration, cloudflareRequests,
+		cloudflareRateLimitLimit, cloudflareRateLimitRemaining, cloudflareRateLimitReset, certificateExpiry,
+		issuerReady, issuerReadyChange, issuerCheckDuration, issuerLastCheck, panics, janitorCleanups,
+		orphanedCertificates)
+}
+
+// RecordIssuance counts a certificate issued by the given issuer, which is
+// "<namespace>/<name>" for namespaced issuers and "<name>" for cluster
+// issuers. The tenant is the team owning the namespace of the request, and
+// empty if tenants are disabled.
+func RecordIssuance(issuerKind, issuer, zone, tenant string) {
+	certificatesIssued.WithLabelValues(issuerKind, issuer, zone, tenant).Inc()
+}
+
+// RecordSignFailure counts a failed signing attempt of the given issuer.
+// The zone is empty if the failure occurred before it was known.
+func RecordSignFailure(issuerKind, issuer, zone, tenant, reason string) {
+	signFailures.WithLabelValues(issuerKind, issuer, zone, tenant, reason).Inc()
+}
+
+// RecordPanic counts a panic recovered from during the given operation,
+// e.g. "Sign" or "Check".
+func RecordPanic(operation string) {
+	panics.WithLabelValues(operation).Inc()
+}
+
+// RecordJanitorCleanup counts a stale object of the given kind, either
+// "annotations", "trackingObjects" or "indexEntries", cleaned up by the
+// janitor.
+func RecordJanitorCleanup(kind string) {
+	janitorCleanups.WithLabelValues(kind).Inc()
+}
+
+// RecordOrphanedCertificate counts an orphaned Cloudflare certificate found
+// by the orphan garbage collector, with the action taken, either "reported"
+// in dry-run mode or "revoked".
+func RecordOrphanedCertificate(action string) {
+	orphanedCertificates.WithLabelValues(action).Inc()
+}
+
+// RecordCloudflareRequest observes a request to the Cloudflare API. The
+// endpoint must not contain IDs, to bound the number of series.
+func RecordCloudflareRequest(method, endpoint, code string, duration time.Duration) {
+	cloudflareRequestDuration.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+	cloudflareRequests.WithLabelValues(method, endpoint, code).Inc()
+}
+
+// RecordCloudflareRateLimit sets the rate limit budget of the given issuer.
+// A negative limit means that the response did not report it.
+func RecordCloudflareRateLimit(issuerKind, issuer string, limit, remaining int64, reset time.Time) {
+	if limit >= 0 {
+		cloudflareRateLimitLimit.WithLabelValues(issuerKind, issuer).Set(float64(limit))
+	}
+	cloudflareRateLimitRemaining.WithLabelValues(issuerKind, issuer).Set(float64(remaining))
+	cloudflareRateLimitReset.WithLabelValues(issuerKind, issuer).Set(float64(reset.Unix()))
+}
+
+// RecordCertificateExpiry sets the expiry of the certificate issued for the
+// given Certificate. The namespace is empty for CertificateSigningRequests.
+func RecordCertificateExpiry(issuerKind, issuer, namespace, certificate string, notAfter time.Time) {
+	certificateExpiry.WithLabelValues(issuerKind, issuer, namespace, certificate).Set(float64(notAfter.Unix()))
+}
+
+// RecordIssuerCheck records the result of a health check of the given
+// issuer that finished at now and took duration. changed is the time at
+// which the result last changed; it is zero if unknown.
+func RecordIssuerCheck(issuerKind, issuer string, ready bool, changed, now time.Time, duration time.Duration) {
+	value := 0.0
+	if ready {
+		value = 1
+	}
+	issuerReady.WithLabelValues(issuerKind, issuer).Set(value)
+	if !changed.IsZero() {
+		issuerReadyChange.WithLabelValues(issuerKind, issuer).Set(float64(changed.Unix()))
+	}
+	issuerCheckDuration.WithLabelValues(issuerKind, issuer).Set(duration.Seconds())
+	issuerLastCheck.WithLabelValues(issuerKind, issuer).Set(float64(now.Unix()))
+}
+
+// IssuerCount is a number of objects of an issuer.
+type IssuerCount struct {
+	IssuerKind string
+	Issuer     string
+	Count      int
+}
+
+var pendingRequestsDesc = prometheus.NewDesc(
+	"cfmtls_certificaterequests_pending",
+	"Number of CertificateRequests waiting to be signed, by issuer.",
+	[]string{"issuer_kind", "issuer"}, nil,
+)
+
+// pendingRequestsCollector collects the pending CertificateRequests when the
+// metrics are scraped.
+type pendingRequestsCollector func() []IssuerCount
+
+func (c pendingRequestsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingRequestsDesc
+}
+
+func (c pendingRequestsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, count := range c() {
+		ch <- prometheus.MustNewConstMetric(pendingRequestsDesc, prometheus.GaugeValue, float64(count.Count), count.IssuerKind, count.Issuer)
+	}
+}
+
+// RegisterPendingRequests registers the gauge of the pending
+// CertificateRequests, which are counted by the given function on every
+// scrape.
+func RegisterPendingRequests(count func() []IssuerCount) error {
+	return ctrlmetrics.Registry.Register(pendingRequestsCollector(count))
+}
+
+// RecordBuildInfo sets the build info metric from the version package.
+func RecordBuildInfo() {
+	buildInfo.WithLabelValues(version.Version, version.Commit, version.Date, version.GoVersion).Set(1)
+}
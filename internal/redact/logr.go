@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+)
+
+// Logger returns a logger that redacts the messages and values logged to
+// logger, including those logged at the debug levels.
+func Logger(logger logr.Logger) logr.Logger {
+	sink := logger.GetSink()
+	if sink == nil {
+		return logger
+	}
+	// The wrapper adds a call frame between the caller and the sink.
+	if withCallDepth, ok := sink.(logr.CallDepthLogSink); ok {
+		sink = withCallDepth.WithCallDepth(1)
+	}
+	return logr.New(&logSink{sink: sink})
+}
+
+// logSink redacts the log lines passed to sink.
+type logSink struct {
+	sink logr.LogSink
+}
+
+// Init implements logr.LogSink. The wrapped sink was initialized already.
+func (s *logSink) Init(logr.RuntimeInfo) {}
+
+func (s *logSink) Enabled(level int) bool {
+	return s.sink.Enabled(level)
+}
+
+func (s *logSink) Info(level int, msg string, keysAndValues ...any) {
+	s.sink.Info(level, String(msg), values(keysAndValues)...)
+}
+
+func (s *logSink) Error(err error, msg string, keysAndValues ...any) {
+	s.sink.Error(Error(err), String(msg), values(keysAndValues)...)
+}
+
+func (s *logSink) WithValues(keysAndValues ...any) logr.LogSink {
+	return &logSink{sink: s.sink.WithValues(values(keysAndValues)...)}
+}
+
+func (s *logSink) WithName(name string) logr.LogSink {
+	return &logSink{sink: s.sink.WithName(name)}
+}
+
+// WithCallDepth implements logr.CallDepthLogSink.
+func (s *logSink) WithCallDepth(depth int) logr.LogSink {
+	if withCallDepth, ok := s.sink.(logr.CallDepthLogSink); ok {
+		return &logSink{sink: withCallDepth.WithCallDepth(depth)}
+	}
+	return s
+}
+
+// values returns a copy of the given key/value pairs with the credentials
+// redacted. The values of keys naming a credential are dropped entirely.
+func values(keysAndValues []any) []any {
+	redacted := make([]any, len(keysAndValues))
+	for i, v := range keysAndValues {
+		if i%2 == 1 {
+			if key, ok := keysAndValues[i-1].(string); ok && secretKeyName.MatchString(key) {
+				redacted[i] = Placeholder
+				continue
+			}
+		}
+		redacted[i] = value(v)
+	}
+	return redacted
+}
+
+func value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return String(v)
+	case []byte:
+		return String(string(v))
+	case error:
+		return Error(v)
+	case fmt.Stringer:
+		return String(v.String())
+	}
+	return v
+}
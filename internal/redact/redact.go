@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redact removes credentials from the strings that leave the
+// controller: log lines, events, status conditions and errors. Credentials
+// are recognized by their format, e.g. bearer tokens and private keys, and
+// by their value once they were registered with Register.
+package redact
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Placeholder replaces the redacted credentials.
+const Placeholder = "[REDACTED]"
+
+// minSecretLength is the length below which registered values are ignored,
+// as replacing them would mangle unrelated text.
+const minSecretLength = 8
+
+var (
+	// bearerToken matches the credentials of an Authorization header.
+	bearerToken = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`)
+	// secretHeader matches the value of a header or field carrying a
+	// credential, e.g. in a dumped request or a JSON body.
+	secretHeader = regexp.MustCompile(`(?i)("?(?:authorization|cf-access-client-secret|x-auth-key|x-auth-user-service-key|api_?token|api_?key|client_secret|secret_?key|password)"?\s*[:=]\s*"?)(?:(?:bearer|basic)\s+)?[^\s",}]+`)
+	// originCAKey matches a Cloudflare Origin CA key.
+	originCAKey = regexp.MustCompile(`\bv1\.0-[A-Za-z0-9-]{40,}`)
+	// privateKey matches a PEM encoded private key.
+	privateKey = regexp.MustCompile(`-----BEGIN ([A-Z ]*)PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// secretKeyName matches the keys of log values and the names of headers
+// that hold credentials. Keys like "secret" name a Secret rather than hold
+// its data, so they are not matched.
+var secretKeyName = regexp.MustCompile(`(?i)(token|password|authorization|api[-_]?key|auth[-_]key|service[-_]key|client[-_]?secret|private[-_]?key)`)
+
+var (
+	mu      sync.RWMutex
+	secrets = map[string]struct{}{}
+	// replacer replaces the registered secrets. It is rebuilt when a new
+	// secret is registered.
+	replacer = strings.NewReplacer()
+)
+
+// Register makes String redact the given credentials wherever they occur,
+// regardless of their format.
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	added := false
+	for _, value := range values {
+		if len(value) < minSecretLength {
+			continue
+		}
+		if _, ok := secrets[value]; !ok {
+			secrets[value] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	oldnew := make([]string, 0, 2*len(secrets))
+	for secret := range secrets {
+		oldnew = append(oldnew, secret, Placeholder)
+	}
+	replacer = strings.NewReplacer(oldnew...)
+}
+
+// String returns s with all credentials replaced by Placeholder.
+func String(s string) string {
+	mu.RLock()
+	r := replacer
+	mu.RUnlock()
+
+	s = r.Replace(s)
+	s = privateKey.ReplaceAllString(s, "-----BEGIN ${1}PRIVATE KEY-----"+Placeholder+"-----END ${1}PRIVATE KEY-----")
+	s = secretHeader.ReplaceAllString(s, "${1}"+Placeholder)
+	s = bearerToken.ReplaceAllString(s, "$1 "+Placeholder)
+	return originCAKey.ReplaceAllString(s, Placeholder)
+}
+
+// Header returns a copy of h with the values of the headers carrying
+// credentials replaced, for dumping requests.
+func Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		if secretKeyName.MatchString(name) {
+			redacted[name] = []string{Placeholder}
+			continue
+		}
+		redacted[name] = make([]string, len(values))
+		for i, value := range values {
+			redacted[name][i] = String(value)
+		}
+	}
+	return redacted
+}
+
+// Error returns err with a redacted message. The original error remains
+// available to errors.Is and errors.As. A nil err stays nil.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(redactedError); ok {
+		return err
+	}
+	return redactedError{err: err}
+}
+
+type redactedError struct {
+	err error
+}
+
+func (e redactedError) Error() string {
+	return String(e.err.Error())
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
@@ -16,6 +16,54 @@ limitations under the License.
 
 package version
 
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// These are set at build time with
+//
+//	-ldflags "-X github.com/krisek/cfmtls-issuer/internal/version.Version=..."
+//
+// Commit and Date fall back to the VCS information that the Go toolchain
+// embeds in the binary.
 var (
 	Version = "development"
+	Commit  = ""
+	Date    = ""
 )
+
+// GoVersion is the version of Go that the binary was built with.
+var GoVersion = runtime.Version()
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if Commit == "" {
+				Commit = setting.Value
+			}
+		case "vcs.time":
+			if Date == "" {
+				Date = setting.Value
+			}
+		}
+	}
+}
+
+// String returns the version information in a single line.
+func String() string {
+	return fmt.Sprintf("version %s, commit %s, built %s with %s", Version, orUnknown(Commit), orUnknown(Date), GoVersion)
+}
+
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// SetupCFMTLSClusterIssuerWebhookWithManager registers the webhook for CFMTLSClusterIssuer in the manager.
+// clusterResourceNamespace is the namespace that auth Secrets of cluster
+// issuers are read from when spec.authSecretNamespace is not set.
+func SetupCFMTLSClusterIssuerWebhookWithManager(mgr ctrl.Manager, clusterResourceNamespace string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&CFMTLSIssuerapi.CFMTLSClusterIssuer{}).
+		WithValidator(&CFMTLSClusterIssuerCustomValidator{
+			Client:                   mgr.GetClient(),
+			ClusterResourceNamespace: clusterResourceNamespace,
+		}).
+		WithDefaulter(&CFMTLSClusterIssuerCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-cfmtls-cert-manager-io-v1alpha1-cfmtlsclusterissuer,mutating=true,failurePolicy=fail,sideEffects=None,groups=cfmtls.cert.manager.io,resources=cfmtlsclusterissuers,verbs=create;update,versions=v1alpha1,name=mcfmtlsclusterissuer-v1alpha1.cfmtls.cert.manager.io,admissionReviewVersions=v1
+
+// CFMTLSClusterIssuerCustomDefaulter sets default values on CFMTLSClusterIssuer resources when they
+// are created or updated.
+type CFMTLSClusterIssuerCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &CFMTLSClusterIssuerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *CFMTLSClusterIssuerCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	issuer, ok := obj.(*CFMTLSIssuerapi.CFMTLSClusterIssuer)
+	if !ok {
+		return fmt.Errorf("expected a CFMTLSClusterIssuer object but got %T", obj)
+	}
+
+	defaultIssuerSpec(&issuer.Spec)
+
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-cfmtls-cert-manager-io-v1alpha1-cfmtlsclusterissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=cfmtls.cert.manager.io,resources=cfmtlsclusterissuers,verbs=create;update,versions=v1alpha1,name=vcfmtlsclusterissuer-v1alpha1.cfmtls.cert.manager.io,admissionReviewVersions=v1
+
+// CFMTLSClusterIssuerCustomValidator validates CFMTLSClusterIssuer resources when they are
+// created or updated.
+type CFMTLSClusterIssuerCustomValidator struct {
+	// Client is used to look up the auth Secret, which is reported in
+	// admission warnings if it is missing or malformed. Optional.
+	Client client.Reader
+	// ClusterResourceNamespace is the default namespace of auth Secrets.
+	ClusterResourceNamespace string
+}
+
+var _ webhook.CustomValidator = &CFMTLSClusterIssuerCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *CFMTLSClusterIssuerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	issuer, ok := obj.(*CFMTLSIssuerapi.CFMTLSClusterIssuer)
+	if !ok {
+		return nil, fmt.Errorf("expected a CFMTLSClusterIssuer object but got %T", obj)
+	}
+
+	return v.secretWarnings(ctx, issuer), validateCFMTLSClusterIssuer(issuer)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *CFMTLSClusterIssuerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	issuer, ok := newObj.(*CFMTLSIssuerapi.CFMTLSClusterIssuer)
+	if !ok {
+		return nil, fmt.Errorf("expected a CFMTLSClusterIssuer object for the newObj but got %T", newObj)
+	}
+
+	return v.secretWarnings(ctx, issuer), validateCFMTLSClusterIssuer(issuer)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *CFMTLSClusterIssuerCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CFMTLSClusterIssuerCustomValidator) secretWarnings(ctx context.Context, issuer *CFMTLSIssuerapi.CFMTLSClusterIssuer) admission.Warnings {
+	namespace := issuer.Spec.AuthSecretNamespace
+	if namespace == "" {
+		namespace = v.ClusterResourceNamespace
+	}
+	return secretWarnings(ctx, v.Client, &issuer.Spec, namespace)
+}
+
+func validateCFMTLSClusterIssuer(issuer *CFMTLSIssuerapi.CFMTLSClusterIssuer) error {
+	allErrs := validateIssuerSpec(&issuer.Spec, "", field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		CFMTLSIssuerapi.GroupVersion.WithKind("CFMTLSClusterIssuer").GroupKind(),
+		issuer.Name, allErrs)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// SetupCFMTLSIssuerWebhookWithManager registers the webhook for CFMTLSIssuer in the manager.
+func SetupCFMTLSIssuerWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&CFMTLSIssuerapi.CFMTLSIssuer{}).
+		WithValidator(&CFMTLSIssuerCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&CFMTLSIssuerCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-cfmtls-cert-manager-io-v1alpha1-cfmtlsissuer,mutating=true,failurePolicy=fail,sideEffects=None,groups=cfmtls.cert.manager.io,resources=cfmtlsissuers,verbs=create;update,versions=v1alpha1,name=mcfmtlsissuer-v1alpha1.cfmtls.cert.manager.io,admissionReviewVersions=v1
+
+// CFMTLSIssuerCustomDefaulter sets default values on CFMTLSIssuer resources when they
+// are created or updated.
+type CFMTLSIssuerCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &CFMTLSIssuerCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter.
+func (d *CFMTLSIssuerCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	issuer, ok := obj.(*CFMTLSIssuerapi.CFMTLSIssuer)
+	if !ok {
+		return fmt.Errorf("expected a CFMTLSIssuer object but got %T", obj)
+	}
+
+	defaultIssuerSpec(&issuer.Spec)
+
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-cfmtls-cert-manager-io-v1alpha1-cfmtlsissuer,mutating=false,failurePolicy=fail,sideEffects=None,groups=cfmtls.cert.manager.io,resources=cfmtlsissuers,verbs=create;update,versions=v1alpha1,name=vcfmtlsissuer-v1alpha1.cfmtls.cert.manager.io,admissionReviewVersions=v1
+
+// CFMTLSIssuerCustomValidator validates CFMTLSIssuer resources when they are
+// created or updated.
+type CFMTLSIssuerCustomValidator struct {
+	// Client is used to look up the auth Secret, which is reported in
+	// admission warnings if it is missing or malformed. Optional.
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &CFMTLSIssuerCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator.
+func (v *CFMTLSIssuerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	issuer, ok := obj.(*CFMTLSIssuerapi.CFMTLSIssuer)
+	if !ok {
+		return nil, fmt.Errorf("expected a CFMTLSIssuer object but got %T", obj)
+	}
+
+	return secretWarnings(ctx, v.Client, &issuer.Spec, issuer.GetNamespace()), validateCFMTLSIssuer(issuer)
+}
+
+// ValidateUpdate implements webhook.CustomValidator.
+func (v *CFMTLSIssuerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	issuer, ok := newObj.(*CFMTLSIssuerapi.CFMTLSIssuer)
+	if !ok {
+		return nil, fmt.Errorf("expected a CFMTLSIssuer object for the newObj but got %T", newObj)
+	}
+
+	return secretWarnings(ctx, v.Client, &issuer.Spec, issuer.GetNamespace()), validateCFMTLSIssuer(issuer)
+}
+
+// ValidateDelete implements webhook.CustomValidator.
+func (v *CFMTLSIssuerCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateCFMTLSIssuer(issuer *CFMTLSIssuerapi.CFMTLSIssuer) error {
+	allErrs := validateIssuerSpec(&issuer.Spec, issuer.GetNamespace(), field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		CFMTLSIssuerapi.GroupVersion.WithKind("CFMTLSIssuer").GroupKind(),
+		issuer.Name, allErrs)
+}
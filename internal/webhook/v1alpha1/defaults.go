@@ -0,0 +1,52 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// defaultIssuerSpec fills in the defaults of the IssuerSpec shared by
+// CFMTLSIssuer and CFMTLSClusterIssuer. Persisting the defaults keeps the
+// behaviour of existing issuers stable when the controller defaults change.
+func defaultIssuerSpec(spec *CFMTLSIssuerapi.IssuerSpec) {
+	if spec.Mode == "" {
+		spec.Mode = CFMTLSIssuerapi.IssuerModeOriginCA
+	}
+	if spec.DefaultValidityDays == 0 {
+		spec.DefaultValidityDays = CFMTLSIssuerapi.DefaultCertificateValidityDays
+	}
+	if spec.RequestTimeout == nil {
+		spec.RequestTimeout = &metav1.Duration{Duration: CFMTLSIssuerapi.DefaultRequestTimeout}
+	}
+	if spec.RateLimit != nil && spec.RateLimit.Burst == 0 {
+		spec.RateLimit.Burst = CFMTLSIssuerapi.DefaultRateLimitBurst
+	}
+
+	// The Secret keys are meaningless when the default credentials are used.
+	if spec.AuthSecretName == "" {
+		return
+	}
+	if spec.AuthSecretKeys.APIToken == "" {
+		spec.AuthSecretKeys.APIToken = CFMTLSIssuerapi.DefaultAPITokenSecretKey
+	}
+	if spec.AuthSecretKeys.ZoneID == "" {
+		spec.AuthSecretKeys.ZoneID = CFMTLSIssuerapi.DefaultZoneIDSecretKey
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestDefaultIssuerSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec CFMTLSIssuerapi.IssuerSpec
+		want CFMTLSIssuerapi.IssuerSpec
+	}{
+		{
+			name: "minimal issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare"},
+			want: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{
+					APIToken: CFMTLSIssuerapi.DefaultAPITokenSecretKey,
+					ZoneID:   CFMTLSIssuerapi.DefaultZoneIDSecretKey,
+				},
+				Mode:                CFMTLSIssuerapi.IssuerModeOriginCA,
+				DefaultValidityDays: 90,
+				RequestTimeout:      &metav1.Duration{Duration: 10 * time.Second},
+			},
+		},
+		{
+			name: "default credentials",
+			spec: CFMTLSIssuerapi.IssuerSpec{},
+			want: CFMTLSIssuerapi.IssuerSpec{
+				Mode:                CFMTLSIssuerapi.IssuerModeOriginCA,
+				DefaultValidityDays: 90,
+				RequestTimeout:      &metav1.Duration{Duration: 10 * time.Second},
+			},
+		},
+		{
+			name: "rate limit burst",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				RateLimit: &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60},
+			},
+			want: CFMTLSIssuerapi.IssuerSpec{
+				Mode:                CFMTLSIssuerapi.IssuerModeOriginCA,
+				DefaultValidityDays: 90,
+				RequestTimeout:      &metav1.Duration{Duration: 10 * time.Second},
+				RateLimit:           &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60, Burst: 10},
+			},
+		},
+		{
+			name: "explicit values are kept",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:      "cloudflare",
+				AuthSecretKeys:      CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "zone"},
+				DefaultValidityDays: 30,
+				RequestTimeout:      &metav1.Duration{Duration: time.Minute},
+			},
+			want: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:      "cloudflare",
+				AuthSecretKeys:      CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "zone"},
+				Mode:                CFMTLSIssuerapi.IssuerModeOriginCA,
+				DefaultValidityDays: 30,
+				RequestTimeout:      &metav1.Duration{Duration: time.Minute},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defaultIssuerSpec(&tt.spec)
+			if !reflect.DeepEqual(tt.spec, tt.want) {
+				t.Errorf("defaultIssuerSpec() = %+v, want %+v", tt.spec, tt.want)
+			}
+			// Updates are defaulted again and must not change the spec.
+			updated := *tt.spec.DeepCopy()
+			defaultIssuerSpec(&updated)
+			if !reflect.DeepEqual(updated, tt.spec) {
+				t.Errorf("defaultIssuerSpec() on update = %+v, want %+v", updated, tt.spec)
+			}
+			if errs := validateIssuerSpec(&tt.spec, "", field.NewPath("spec")); len(errs) != 0 {
+				t.Errorf("defaulted spec is invalid: %v", errs)
+			}
+		})
+	}
+}
+
+func TestDefaulters(t *testing.T) {
+	issuer := &CFMTLSIssuerapi.CFMTLSIssuer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cloudflare"},
+		Spec:       CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare"},
+	}
+	if err := (&CFMTLSIssuerCustomDefaulter{}).Default(context.Background(), issuer); err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
+	if err := validateCFMTLSIssuer(issuer); err != nil {
+		t.Errorf("defaulted CFMTLSIssuer is invalid: %v", err)
+	}
+
+	clusterIssuer := &CFMTLSIssuerapi.CFMTLSClusterIssuer{
+		ObjectMeta: metav1.ObjectMeta{Name: "cloudflare"},
+	}
+	if err := (&CFMTLSClusterIssuerCustomDefaulter{}).Default(context.Background(), clusterIssuer); err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
+	if err := validateCFMTLSClusterIssuer(clusterIssuer); err != nil {
+		t.Errorf("defaulted CFMTLSClusterIssuer is invalid: %v", err)
+	}
+
+	for name, spec := range map[string]CFMTLSIssuerapi.IssuerSpec{"CFMTLSIssuer": issuer.Spec, "CFMTLSClusterIssuer": clusterIssuer.Spec} {
+		if spec.Mode != CFMTLSIssuerapi.IssuerModeOriginCA || spec.DefaultValidityDays == 0 || spec.RequestTimeout == nil {
+			t.Errorf("%s spec = %+v, want all defaults set", name, spec)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// secretWarnings returns admission warnings if the auth Secret referenced by
+// spec is missing or lacks the keys the controller reads. These are warnings
+// rather than errors, as the Secret may legitimately be created after the
+// issuer.
+func secretWarnings(ctx context.Context, reader client.Reader, spec *CFMTLSIssuerapi.IssuerSpec, namespace string) admission.Warnings {
+	if reader == nil || spec.AuthSecretName == "" || namespace == "" {
+		return nil
+	}
+
+	key := types.NamespacedName{Namespace: namespace, Name: spec.AuthSecretName}
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, key, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("auth Secret %s does not exist; the issuer will not become Ready until it is created", key)}
+		}
+		return admission.Warnings{fmt.Sprintf("auth Secret %s could not be checked: %v", key, err)}
+	}
+
+	var warnings admission.Warnings
+
+	apiTokenKey := spec.AuthSecretKeys.APIToken
+	if apiTokenKey == "" {
+		apiTokenKey = CFMTLSIssuerapi.DefaultAPITokenSecretKey
+	}
+	if len(secret.Data[apiTokenKey]) == 0 {
+		warnings = append(warnings, fmt.Sprintf("auth Secret %s has no %q key holding the Cloudflare API token", key, apiTokenKey))
+	}
+
+	// The zone ID is only read from the Secret if it is not configured
+	// elsewhere.
+	if spec.ZoneID == "" && spec.ConfigMapRef == nil {
+		zoneIDKey := spec.AuthSecretKeys.ZoneID
+		if zoneIDKey == "" {
+			zoneIDKey = CFMTLSIssuerapi.DefaultZoneIDSecretKey
+		}
+		if len(secret.Data[zoneIDKey]) == 0 {
+			warnings = append(warnings, fmt.Sprintf("auth Secret %s has no %q key holding the Cloudflare zone ID and spec.zoneID is not set", key, zoneIDKey))
+		}
+	}
+
+	return warnings
+}
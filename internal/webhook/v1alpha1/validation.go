@@ -0,0 +1,453 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+// zoneIDRegexp matches the format of Cloudflare zone IDs.
+var zoneIDRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// pinRegexp matches the format of the pinned SHA-256 digests.
+var pinRegexp = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// minCheckInterval is the shortest allowed checkInterval, which keeps
+// periodic health checks well within the Cloudflare API rate limits.
+const minCheckInterval = time.Minute
+
+// validateIssuerSpec validates the IssuerSpec shared by CFMTLSIssuer and
+// CFMTLSClusterIssuer. namespace is the namespace of a CFMTLSIssuer and empty
+// for a CFMTLSClusterIssuer.
+func validateIssuerSpec(spec *CFMTLSIssuerapi.IssuerSpec, namespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.AuthFile != nil {
+		allErrs = append(allErrs, validateAuthFile(spec, namespace, fldPath.Child("authFile"))...)
+	}
+
+	if spec.Vault != nil {
+		allErrs = append(allErrs, validateVault(spec, fldPath.Child("vault"))...)
+	}
+
+	if spec.SecretManager != nil {
+		allErrs = append(allErrs, validateSecretManager(spec, namespace, fldPath.Child("secretManager"))...)
+	}
+
+	// Only cluster issuers may fall back to the default credentials of the
+	// controller.
+	if spec.AuthSecretName == "" {
+		if namespace != "" && spec.AuthFile == nil && spec.Vault == nil && spec.SecretManager == nil {
+			allErrs = append(allErrs, field.Required(fldPath.Child("authSecretName"), "must reference the Secret holding the Cloudflare credentials"))
+		}
+	} else {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.AuthSecretName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("authSecretName"), spec.AuthSecretName, msg))
+		}
+	}
+
+	if spec.ZoneID != "" && !zoneIDRegexp.MatchString(spec.ZoneID) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("zoneID"), spec.ZoneID, "must be a 32 character lowercase hex string"))
+	}
+
+	allErrs = append(allErrs, validateAuthSecretNamespace(spec.AuthSecretNamespace, namespace, fldPath.Child("authSecretNamespace"))...)
+	allErrs = append(allErrs, validateAuthSecretKeys(&spec.AuthSecretKeys, fldPath.Child("authSecretKeys"))...)
+	allErrs = append(allErrs, validateRetry(spec, fldPath)...)
+
+	if spec.RequestTimeout != nil && spec.RequestTimeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("requestTimeout"), spec.RequestTimeout.Duration.String(), "must be positive"))
+	}
+
+	if spec.CheckInterval != nil && spec.CheckInterval.Duration < minCheckInterval {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("checkInterval"), spec.CheckInterval.Duration.String(), fmt.Sprintf("must be at least %s", minCheckInterval)))
+	}
+
+	if spec.RevokeSupersededAfter != nil && spec.RevokeSupersededAfter.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("revokeSupersededAfter"), spec.RevokeSupersededAfter.Duration.String(), "must not be negative"))
+	}
+
+	if spec.TokenRotation != nil {
+		allErrs = append(allErrs, validateTokenRotation(spec, fldPath.Child("tokenRotation"))...)
+	}
+
+	for i, window := range spec.MaintenanceWindows {
+		allErrs = append(allErrs, validateMaintenanceWindow(window, fldPath.Child("maintenanceWindows").Index(i))...)
+	}
+
+	if spec.Proxy != nil {
+		allErrs = append(allErrs, validateProxy(spec.Proxy, fldPath.Child("proxy"))...)
+	}
+
+	for i, pin := range spec.PinnedCertSHA256 {
+		if !pinRegexp.MatchString(pin) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("pinnedCertSHA256").Index(i), pin, "must be a 64 character hex encoded SHA-256 digest"))
+		}
+	}
+
+	if spec.RateLimit != nil {
+		if spec.RateLimit.RequestsPerMinute < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("rateLimit", "requestsPerMinute"), spec.RateLimit.RequestsPerMinute, "must be at least 1"))
+		}
+		if spec.RateLimit.Burst < 1 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("rateLimit", "burst"), spec.RateLimit.Burst, "must be at least 1"))
+		}
+	}
+
+	if spec.ConfigMapRef != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(spec.ConfigMapRef.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("configMapRef", "name"), spec.ConfigMapRef.Name, msg))
+		}
+	}
+
+	allErrs = append(allErrs, validateDomains(spec.AllowedDomains, fldPath.Child("allowedDomains"))...)
+	allErrs = append(allErrs, validateDomains(spec.DeniedDomains, fldPath.Child("deniedDomains"))...)
+
+	if spec.DefaultValidityDays != 0 && (spec.DefaultValidityDays < 1 || spec.DefaultValidityDays > 3650) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("defaultValidityDays"), spec.DefaultValidityDays, "must be between 1 and 3650"))
+	}
+
+	for i, pattern := range spec.SubjectPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("subjectPatterns").Index(i), pattern, err.Error()))
+		}
+	}
+
+	if spec.NamespaceSelector != nil {
+		if namespace != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("namespaceSelector"), "may only be set on CFMTLSClusterIssuer"))
+		} else {
+			allErrs = append(allErrs, metav1validation.ValidateLabelSelector(spec.NamespaceSelector, metav1validation.LabelSelectorValidationOptions{}, fldPath.Child("namespaceSelector"))...)
+		}
+	}
+
+	return allErrs
+}
+
+func validateAuthSecretNamespace(secretNamespace, namespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if secretNamespace == "" {
+		return nil
+	}
+
+	if namespace != "" && secretNamespace != namespace {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may only be set on CFMTLSClusterIssuer"))
+		return allErrs
+	}
+
+	for _, msg := range validation.IsDNS1123Label(secretNamespace) {
+		allErrs = append(allErrs, field.Invalid(fldPath, secretNamespace, msg))
+	}
+
+	return allErrs
+}
+
+func validateAuthSecretKeys(keys *CFMTLSIssuerapi.AuthSecretKeys, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if keys.APIToken != "" {
+		for _, msg := range validation.IsConfigMapKey(keys.APIToken) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("apiToken"), keys.APIToken, msg))
+		}
+	}
+
+	if keys.ZoneID != "" {
+		for _, msg := range validation.IsConfigMapKey(keys.ZoneID) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("zoneID"), keys.ZoneID, msg))
+		}
+	}
+
+	if keys.APIToken != "" && keys.APIToken == keys.ZoneID {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("zoneID"), keys.ZoneID, "must differ from apiToken"))
+	}
+
+	if keys.SecondaryAPIToken != "" {
+		for _, msg := range validation.IsConfigMapKey(keys.SecondaryAPIToken) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("secondaryAPIToken"), keys.SecondaryAPIToken, msg))
+		}
+		if keys.SecondaryAPIToken == keys.APIToken || keys.SecondaryAPIToken == keys.ZoneID {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("secondaryAPIToken"), keys.SecondaryAPIToken, "must differ from apiToken and zoneID"))
+		}
+	}
+
+	if keys.AccessClientID != "" {
+		for _, msg := range validation.IsConfigMapKey(keys.AccessClientID) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("accessClientID"), keys.AccessClientID, msg))
+		}
+	}
+
+	if keys.AccessClientSecret != "" {
+		for _, msg := range validation.IsConfigMapKey(keys.AccessClientSecret) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("accessClientSecret"), keys.AccessClientSecret, msg))
+		}
+		if keys.AccessClientSecret == keys.AccessClientID {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("accessClientSecret"), keys.AccessClientSecret, "must differ from accessClientID"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateRetry(spec *CFMTLSIssuerapi.IssuerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.MaxRetryDuration != nil && spec.MaxRetryDuration.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxRetryDuration"), spec.MaxRetryDuration.Duration.String(), "must be positive"))
+	}
+
+	if spec.InitialBackoff != nil {
+		if spec.InitialBackoff.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("initialBackoff"), spec.InitialBackoff.Duration.String(), "must be positive"))
+		} else if spec.MaxRetryDuration != nil && spec.InitialBackoff.Duration > spec.MaxRetryDuration.Duration {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("initialBackoff"), spec.InitialBackoff.Duration.String(), "must not exceed maxRetryDuration"))
+		}
+	}
+
+	if m := spec.BackoffMultiplier; m != nil && (m.Cmp(resource.MustParse("1")) < 0 || m.Cmp(resource.MustParse("10")) > 0) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("backoffMultiplier"), m.String(), "must be between 1 and 10"))
+	}
+
+	return allErrs
+}
+
+// validateTokenRotation checks that the rotated token is stored in a Secret
+// and is renewed well within its lifetime.
+func validateTokenRotation(spec *CFMTLSIssuerapi.IssuerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.AuthSecretName == "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "requires authSecretName, the rotated token is written back to the Secret"))
+	}
+
+	renewBefore, validity := CFMTLSIssuerapi.DefaultTokenRenewBefore, CFMTLSIssuerapi.DefaultTokenValidity
+	if d := spec.TokenRotation.RenewBefore; d != nil {
+		renewBefore = d.Duration
+		if renewBefore < time.Hour {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("renewBefore"), renewBefore.String(), "must be at least 1h"))
+		}
+	}
+	if d := spec.TokenRotation.Validity; d != nil {
+		validity = d.Duration
+		if validity < 24*time.Hour {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("validity"), validity.String(), "must be at least 24h"))
+		}
+	}
+	if renewBefore >= validity {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("renewBefore"), renewBefore.String(), "must be shorter than validity"))
+	}
+
+	return allErrs
+}
+
+// maxMaintenanceWindowDuration is the longest allowed maintenance window,
+// a window open all week long.
+const maxMaintenanceWindowDuration = 7 * 24 * time.Hour
+
+// validWeekdays are the days a maintenance window may open on.
+var validWeekdays = map[CFMTLSIssuerapi.Weekday]bool{
+	"Monday": true, "Tuesday": true, "Wednesday": true, "Thursday": true, "Friday": true, "Saturday": true, "Sunday": true,
+}
+
+func validateMaintenanceWindow(window CFMTLSIssuerapi.MaintenanceWindow, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, day := range window.Days {
+		if !validWeekdays[day] {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("days").Index(i), day, []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}))
+		}
+	}
+	if _, err := time.Parse("15:04", window.Start); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("start"), window.Start, "must be a time of day as HH:MM"))
+	}
+	if d := window.Duration.Duration; d <= 0 || d > maxMaintenanceWindowDuration {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("duration"), d.String(), "must be positive and at most 168h"))
+	}
+	if window.TimeZone != "" {
+		if _, err := time.LoadLocation(window.TimeZone); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("timeZone"), window.TimeZone, "must be an IANA time zone name"))
+		}
+	}
+
+	return allErrs
+}
+
+// supportedProxySchemes are the schemes of the proxy URLs supported by the
+// transport of the controller.
+var supportedProxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+func validateProxy(proxy *CFMTLSIssuerapi.ProxyConfig, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if u, err := url.Parse(proxy.URL); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("url"), proxy.URL, err.Error()))
+	} else if !supportedProxySchemes[u.Scheme] || u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("url"), proxy.URL, "must be an absolute http, https, socks5 or socks5h URL"))
+	} else if u.User != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("url"), u.Redacted(), "must not contain credentials, use authSecretName"))
+	}
+
+	if proxy.AuthSecretName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(proxy.AuthSecretName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("authSecretName"), proxy.AuthSecretName, msg))
+		}
+	}
+
+	if ref := proxy.CABundleSecretRef; ref != nil {
+		refPath := fldPath.Child("caBundleSecretRef")
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			allErrs = append(allErrs, field.Invalid(refPath.Child("name"), ref.Name, msg))
+		}
+		if ref.Key != "" {
+			for _, msg := range validation.IsConfigMapKey(ref.Key) {
+				allErrs = append(allErrs, field.Invalid(refPath.Child("key"), ref.Key, msg))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateDomains validates a list of domains, each optionally prefixed
+// with "*." to only match subdomains.
+func validateDomains(domains []string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, domain := range domains {
+		for _, msg := range validation.IsDNS1123Subdomain(strings.TrimPrefix(domain, "*.")) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), domain, msg))
+		}
+	}
+
+	return allErrs
+}
+
+// validateAuthFile validates spec.authFile, which is only supported on
+// cluster issuers and replaces the auth Secret.
+func validateAuthFile(spec *CFMTLSIssuerapi.IssuerSpec, namespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if namespace != "" {
+		return append(allErrs, field.Forbidden(fldPath, "is only supported on CFMTLSClusterIssuer"))
+	}
+	if spec.AuthSecretName != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not be set together with authSecretName"))
+	}
+
+	if spec.AuthFile.APITokenPath == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("apiTokenPath"), "must reference the file holding the Cloudflare API token"))
+	} else if !filepath.IsLocal(spec.AuthFile.APITokenPath) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("apiTokenPath"), spec.AuthFile.APITokenPath, "must be a relative path within the credentials directory"))
+	}
+	if spec.AuthFile.ZoneIDPath != "" && !filepath.IsLocal(spec.AuthFile.ZoneIDPath) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("zoneIDPath"), spec.AuthFile.ZoneIDPath, "must be a relative path within the credentials directory"))
+	}
+
+	return allErrs
+}
+
+// validateSecretManager validates spec.secretManager, which is only
+// supported on cluster issuers and replaces the auth Secret.
+func validateSecretManager(spec *CFMTLSIssuerapi.IssuerSpec, namespace string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	manager := spec.SecretManager
+
+	if namespace != "" {
+		return append(allErrs, field.Forbidden(fldPath, "is only supported on CFMTLSClusterIssuer"))
+	}
+	if spec.AuthSecretName != "" || spec.AuthFile != nil || spec.Vault != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not be set together with authSecretName, authFile or vault"))
+	}
+
+	set := 0
+	if manager.AWS != nil {
+		set++
+		if manager.AWS.Region == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("aws", "region"), "must name the region of the secret"))
+		}
+		if manager.AWS.SecretID == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("aws", "secretID"), "must reference the secret"))
+		}
+	}
+	if manager.GCP != nil {
+		set++
+		if manager.GCP.Project == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("gcp", "project"), "must name the project of the secret"))
+		}
+		if manager.GCP.Secret == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("gcp", "secret"), "must reference the secret"))
+		}
+	}
+	if manager.Azure != nil {
+		set++
+		if u, err := url.Parse(manager.Azure.VaultURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("azure", "vaultURL"), manager.Azure.VaultURL, "must be an absolute https URL"))
+		}
+		if manager.Azure.SecretName == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("azure", "secretName"), "must reference the secret"))
+		}
+	}
+	if set != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "exactly one of aws, gcp and azure must be set"))
+	}
+
+	return allErrs
+}
+
+// validateVault validates spec.vault, which replaces the auth Secret.
+func validateVault(spec *CFMTLSIssuerapi.IssuerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	vault := spec.Vault
+
+	if spec.AuthSecretName != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not be set together with authSecretName"))
+	}
+	if spec.AuthFile != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not be set together with authFile"))
+	}
+
+	if u, err := url.Parse(vault.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("server"), vault.Server, "must be an absolute http or https URL"))
+	}
+	if mount, path, ok := strings.Cut(strings.Trim(vault.Path, "/"), "/"); !ok || mount == "" || path == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("path"), vault.Path, "must be of the form <mount>/<path>"))
+	}
+	if vault.Role == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("role"), "must name the Vault role to log in as"))
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(vault.ServiceAccountRef.Name) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("serviceAccountRef", "name"), vault.ServiceAccountRef.Name, msg))
+	}
+	if ref := vault.CABundleSecretRef; ref != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(ref.Name) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("caBundleSecretRef", "name"), ref.Name, msg))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,471 @@
+/*
+Copyright 2025 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	CFMTLSIssuerapi "github.com/krisek/cfmtls-issuer/api/v1alpha1"
+)
+
+func TestValidateIssuerSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      CFMTLSIssuerapi.IssuerSpec
+		namespace string
+		wantErrs  []string
+	}{
+		{
+			name:      "minimal issuer",
+			spec:      CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare"},
+			namespace: "default",
+		},
+		{
+			name:      "missing auth secret name",
+			spec:      CFMTLSIssuerapi.IssuerSpec{},
+			namespace: "default",
+			wantErrs:  []string{"spec.authSecretName"},
+		},
+		{
+			name: "default credentials on cluster issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{},
+		},
+		{
+			name:     "invalid auth secret name",
+			spec:     CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "Not_A_Name"},
+			wantErrs: []string{"spec.authSecretName"},
+		},
+		{
+			name: "secret namespace on cluster issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare", AuthSecretNamespace: "team-a"},
+		},
+		{
+			name:      "secret namespace on namespaced issuer",
+			spec:      CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare", AuthSecretNamespace: "team-a"},
+			namespace: "default",
+			wantErrs:  []string{"spec.authSecretNamespace"},
+		},
+		{
+			name: "zone ID",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare", ZoneID: "023e105f4ecef8ad9ca31a8372d0c353"},
+		},
+		{
+			name:     "malformed zone ID",
+			spec:     CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "cloudflare", ZoneID: "example.com"},
+			wantErrs: []string{"spec.zoneID"},
+		},
+		{
+			name: "conflicting secret keys",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "token"},
+			},
+			wantErrs: []string{"spec.authSecretKeys.zoneID"},
+		},
+		{
+			name: "secondary token key reuses primary key",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", SecondaryAPIToken: "token"},
+			},
+			wantErrs: []string{"spec.authSecretKeys.secondaryAPIToken"},
+		},
+		{
+			name: "access client secret key reuses client ID key",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{AccessClientID: "access", AccessClientSecret: "access"},
+			},
+			wantErrs: []string{"spec.authSecretKeys.accessClientSecret"},
+		},
+		{
+			name: "invalid secret key",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{APIToken: "api token"},
+			},
+			wantErrs: []string{"spec.authSecretKeys.apiToken"},
+		},
+		{
+			name: "retry policy",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:    "cloudflare",
+				MaxRetryDuration:  &metav1.Duration{Duration: time.Hour},
+				InitialBackoff:    &metav1.Duration{Duration: 10 * time.Second},
+				BackoffMultiplier: ptr.To(resource.MustParse("1.5")),
+			},
+		},
+		{
+			name: "backoff multiplier below 1",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:    "cloudflare",
+				BackoffMultiplier: ptr.To(resource.MustParse("0.5")),
+			},
+			wantErrs: []string{"spec.backoffMultiplier"},
+		},
+		{
+			name: "backoff multiplier above 10",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:    "cloudflare",
+				BackoffMultiplier: ptr.To(resource.MustParse("10.5")),
+			},
+			wantErrs: []string{"spec.backoffMultiplier"},
+		},
+		{
+			name: "rate limit",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				RateLimit:      &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60, Burst: 5},
+			},
+		},
+		{
+			name: "rate limit without requests",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				RateLimit:      &CFMTLSIssuerapi.RateLimit{Burst: 5},
+			},
+			wantErrs: []string{"spec.rateLimit.requestsPerMinute"},
+		},
+		{
+			name: "rate limit without burst",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				RateLimit:      &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60},
+			},
+			wantErrs: []string{"spec.rateLimit.burst"},
+		},
+		{
+			name: "negative rate limit burst",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				RateLimit:      &CFMTLSIssuerapi.RateLimit{RequestsPerMinute: 60, Burst: -1},
+			},
+			wantErrs: []string{"spec.rateLimit.burst"},
+		},
+		{
+			name: "initial backoff exceeds max retry duration",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:   "cloudflare",
+				MaxRetryDuration: &metav1.Duration{Duration: time.Minute},
+				InitialBackoff:   &metav1.Duration{Duration: time.Hour},
+			},
+			wantErrs: []string{"spec.initialBackoff"},
+		},
+		{
+			name: "negative max retry duration",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:   "cloudflare",
+				MaxRetryDuration: &metav1.Duration{Duration: -time.Minute},
+			},
+			wantErrs: []string{"spec.maxRetryDuration"},
+		},
+		{
+			name: "token rotation",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				TokenRotation:  &CFMTLSIssuerapi.TokenRotation{RenewBefore: &metav1.Duration{Duration: 72 * time.Hour}},
+			},
+		},
+		{
+			name: "token rotation without auth secret",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthFile:      &CFMTLSIssuerapi.AuthFileSource{APITokenPath: "cloudflare/api-token"},
+				TokenRotation: &CFMTLSIssuerapi.TokenRotation{},
+			},
+			wantErrs: []string{"spec.tokenRotation"},
+		},
+		{
+			name: "token renewed after its validity",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				TokenRotation:  &CFMTLSIssuerapi.TokenRotation{Validity: &metav1.Duration{Duration: 5 * 24 * time.Hour}},
+			},
+			wantErrs: []string{"spec.tokenRotation.renewBefore"},
+		},
+		{
+			name: "proxy with CA bundle",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				Proxy: &CFMTLSIssuerapi.ProxyConfig{
+					URL:               "http://proxy.example.com:3128",
+					CABundleSecretRef: &CFMTLSIssuerapi.SecretKeySelector{Name: "proxy-ca"},
+				},
+			},
+		},
+		{
+			name: "SOCKS5 proxy with credentials",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				Proxy:          &CFMTLSIssuerapi.ProxyConfig{URL: "socks5://bastion.example.com:1080", AuthSecretName: "bastion"},
+			},
+		},
+		{
+			name: "invalid proxy credentials Secret",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				Proxy:          &CFMTLSIssuerapi.ProxyConfig{URL: "socks5://bastion.example.com:1080", AuthSecretName: "Bastion"},
+			},
+			wantErrs: []string{"spec.proxy.authSecretName"},
+		},
+		{
+			name: "relative proxy URL",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				Proxy:          &CFMTLSIssuerapi.ProxyConfig{URL: "proxy.example.com:3128"},
+			},
+			wantErrs: []string{"spec.proxy.url"},
+		},
+		{
+			name: "domain policy",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AllowedDomains: []string{"*.team-a.example.com"},
+				DeniedDomains:  []string{"admin.team-a.example.com"},
+			},
+		},
+		{
+			name: "invalid allowed domain",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				AllowedDomains: []string{"example.com", "Team_A.example.com"},
+			},
+			wantErrs: []string{"spec.allowedDomains[1]"},
+		},
+		{
+			name: "namespace selector on cluster issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:    "cloudflare",
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			},
+		},
+		{
+			name: "namespace selector on namespaced issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:    "cloudflare",
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			},
+			namespace: "default",
+			wantErrs:  []string{"spec.namespaceSelector"},
+		},
+		{
+			name: "invalid subject pattern",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:  "cloudflare",
+				SubjectPatterns: []string{`device-[0-9]+\.example\.com`, "device-("},
+			},
+			wantErrs: []string{"spec.subjectPatterns[1]"},
+		},
+		{
+			name: "invalid pinned certificate digest",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:   "cloudflare",
+				PinnedCertSHA256: []string{"5C8A1F7A3B2D4E6F8091A2B3C4D5E6F708192A3B4C5D6E7F8091A2B3C4D5E6F7", "sha256/abc"},
+			},
+			wantErrs: []string{"spec.pinnedCertSHA256[1]"},
+		},
+		{
+			name: "auth file on cluster issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthFile: &CFMTLSIssuerapi.AuthFileSource{APITokenPath: "cloudflare/api-token"}},
+		},
+		{
+			name:      "auth file on namespaced issuer",
+			spec:      CFMTLSIssuerapi.IssuerSpec{AuthFile: &CFMTLSIssuerapi.AuthFileSource{APITokenPath: "cloudflare/api-token"}},
+			namespace: "default",
+			wantErrs:  []string{"spec.authFile"},
+		},
+		{
+			name:     "auth file outside credentials directory",
+			spec:     CFMTLSIssuerapi.IssuerSpec{AuthFile: &CFMTLSIssuerapi.AuthFileSource{APITokenPath: "../token"}},
+			wantErrs: []string{"spec.authFile.apiTokenPath"},
+		},
+		{
+			name: "vault",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				Vault: &CFMTLSIssuerapi.VaultAuth{
+					Server:            "https://vault.example.com:8200",
+					Path:              "secret/cloudflare",
+					Role:              "cfmtls-issuer",
+					ServiceAccountRef: CFMTLSIssuerapi.ServiceAccountReference{Name: "cfmtls-issuer"},
+				},
+			},
+			namespace: "default",
+		},
+		{
+			name: "vault path without mount",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				Vault: &CFMTLSIssuerapi.VaultAuth{
+					Server:            "https://vault.example.com:8200",
+					Path:              "cloudflare",
+					Role:              "cfmtls-issuer",
+					ServiceAccountRef: CFMTLSIssuerapi.ServiceAccountReference{Name: "cfmtls-issuer"},
+				},
+			},
+			namespace: "default",
+			wantErrs:  []string{"spec.vault.path"},
+		},
+		{
+			name: "aws secrets manager",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				SecretManager: &CFMTLSIssuerapi.SecretManagerAuth{
+					AWS: &CFMTLSIssuerapi.AWSSecretsManager{Region: "eu-west-1", SecretID: "cloudflare"},
+				},
+			},
+		},
+		{
+			name: "secret manager on namespaced issuer",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				SecretManager: &CFMTLSIssuerapi.SecretManagerAuth{
+					GCP: &CFMTLSIssuerapi.GCPSecretManager{Project: "example", Secret: "cloudflare"},
+				},
+			},
+			namespace: "default",
+			wantErrs:  []string{"spec.secretManager"},
+		},
+		{
+			name: "azure key vault without https",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				SecretManager: &CFMTLSIssuerapi.SecretManagerAuth{
+					Azure: &CFMTLSIssuerapi.AzureKeyVault{VaultURL: "http://example.vault.azure.net", SecretName: "cloudflare"},
+				},
+			},
+			wantErrs: []string{"spec.secretManager.azure.vaultURL"},
+		},
+		{
+			name: "check interval too short",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				CheckInterval:  &metav1.Duration{Duration: 10 * time.Second},
+			},
+			wantErrs: []string{"spec.checkInterval"},
+		},
+		{
+			name: "negative superseded revocation grace period",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName:        "cloudflare",
+				RevokeSupersededAfter: &metav1.Duration{Duration: -time.Hour},
+			},
+			wantErrs: []string{"spec.revokeSupersededAfter"},
+		},
+		{
+			name: "maintenance windows",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				MaintenanceWindows: []CFMTLSIssuerapi.MaintenanceWindow{
+					{Days: []CFMTLSIssuerapi.Weekday{"Saturday", "Sunday"}, Start: "02:00", Duration: metav1.Duration{Duration: 4 * time.Hour}, TimeZone: "Europe/Berlin"},
+					{Start: "23:30", Duration: metav1.Duration{Duration: 168 * time.Hour}},
+				},
+			},
+		},
+		{
+			name: "invalid maintenance window",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "cloudflare",
+				MaintenanceWindows: []CFMTLSIssuerapi.MaintenanceWindow{
+					{Start: "02:00", Duration: metav1.Duration{Duration: time.Hour}},
+					{Days: []CFMTLSIssuerapi.Weekday{"Caturday"}, Start: "25:00", Duration: metav1.Duration{Duration: 8 * 24 * time.Hour}, TimeZone: "Mars/Olympus"},
+				},
+			},
+			wantErrs: []string{
+				"spec.maintenanceWindows[1].days[0]",
+				"spec.maintenanceWindows[1].start",
+				"spec.maintenanceWindows[1].duration",
+				"spec.maintenanceWindows[1].timeZone",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateIssuerSpec(&tt.spec, tt.namespace, field.NewPath("spec"))
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tt.wantErrs), len(errs), errs)
+			}
+			for i, err := range errs {
+				if err.Field != tt.wantErrs[i] {
+					t.Errorf("expected error on %q, got %q", tt.wantErrs[i], err.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestSecretWarnings(t *testing.T) {
+	reader := fake.NewClientBuilder().WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "complete"},
+			Data: map[string][]byte{
+				CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("token"),
+				CFMTLSIssuerapi.DefaultZoneIDSecretKey:   []byte("zone"),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "token-only"},
+			Data:       map[string][]byte{CFMTLSIssuerapi.DefaultAPITokenSecretKey: []byte("token")},
+		},
+	).Build()
+
+	tests := []struct {
+		name         string
+		spec         CFMTLSIssuerapi.IssuerSpec
+		wantWarnings int
+	}{
+		{
+			name: "complete secret",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "complete"},
+		},
+		{
+			name:         "missing secret",
+			spec:         CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "missing"},
+			wantWarnings: 1,
+		},
+		{
+			name:         "missing zone ID key",
+			spec:         CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "token-only"},
+			wantWarnings: 1,
+		},
+		{
+			name: "zone ID in spec",
+			spec: CFMTLSIssuerapi.IssuerSpec{AuthSecretName: "token-only", ZoneID: "023e105f4ecef8ad9ca31a8372d0c353"},
+		},
+		{
+			name: "custom keys",
+			spec: CFMTLSIssuerapi.IssuerSpec{
+				AuthSecretName: "complete",
+				AuthSecretKeys: CFMTLSIssuerapi.AuthSecretKeys{APIToken: "token", ZoneID: "zone"},
+			},
+			wantWarnings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := secretWarnings(context.Background(), reader, &tt.spec, "default")
+			if len(warnings) != tt.wantWarnings {
+				t.Fatalf("expected %d warnings, got %d: %v", tt.wantWarnings, len(warnings), warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package approverpolicy evaluates Cloudflare specific rules for
+// CertificateRequests at approval time, as a plugin of approver-policy.
+//
+// The rules are configured in the values of the plugin in a
+// CertificateRequestPolicy:
+//
+//	spec:
+//	  plugins:
+//	    cfmtls:
+//	      values:
+//	        zones: example.com,example.org
+//	        validityDays: 30,90,365
+//	        requestTypes: origin-ecc
+//
+// The package does not depend on approver-policy, so that it can be built
+// into approver-policy releases of any version: the Evaluator and Webhook
+// of the plugin call Evaluate and Validate with the values of Name.
+package approverpolicy
+
+import (
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Name is the name of the plugin in CertificateRequestPolicies.
+const Name = "cfmtls"
+
+// Keys of the plugin values.
+const (
+	// ZonesKey is a comma separated list of the Cloudflare zones that the
+	// DNS names and the common name of a request must be in.
+	ZonesKey = "zones"
+	// ValidityDaysKey is a comma separated list of the validities, in
+	// days, that a request may ask for. Requests without a duration are
+	// given the default validity of the issuer and are not checked.
+	ValidityDaysKey = "validityDays"
+	// RequestTypesKey is a comma separated list of the Cloudflare request
+	// types that a request may be for: origin-rsa for RSA keys and
+	// origin-ecc for ECDSA keys.
+	RequestTypesKey = "requestTypes"
+)
+
+// Cloudflare request types, by the key algorithm of the CSR.
+const (
+	RequestTypeRSA = "origin-rsa"
+	RequestTypeECC = "origin-ecc"
+)
+
+// Rules are the Cloudflare specific rules of a CertificateRequestPolicy.
+// Empty rules allow everything.
+type Rules struct {
+	Zones        []string
+	ValidityDays []int64
+	RequestTypes []string
+}
+
+// Response is the result of the evaluation of a request.
+type Response struct {
+	// Denied is set if the request violates the rules.
+	Denied bool
+	// Message lists the violations of a denied request.
+	Message string
+}
+
+// Validate returns the errors of the plugin values at fldPath, for the
+// validating webhook of CertificateRequestPolicies.
+func Validate(fldPath *field.Path, values map[string]string) field.ErrorList {
+	_, errs := parseRules(fldPath, values)
+	return errs
+}
+
+// ParseRules returns the rules configured by the plugin values.
+func ParseRules(values map[string]string) (Rules, error) {
+	rules, errs := parseRules(field.NewPath("values"), values)
+	return rules, errs.ToAggregate()
+}
+
+func parseRules(fldPath *field.Path, values map[string]string) (Rules, field.ErrorList) {
+	var rules Rules
+	var errs field.ErrorList
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		value, keyPath := values[key], fldPath.Key(key)
+		switch key {
+		case ZonesKey:
+			for _, zone := range splitList(value) {
+				zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+				if msgs := validation.IsDNS1123Subdomain(zone); len(msgs) > 0 {
+					errs = append(errs, field.Invalid(keyPath, zone, strings.Join(msgs, ", ")))
+					continue
+				}
+				rules.Zones = append(rules.Zones, zone)
+			}
+		case ValidityDaysKey:
+			for _, days := range splitList(value) {
+				n, err := strconv.ParseInt(days, 10, 64)
+				if err != nil || n <= 0 {
+					errs = append(errs, field.Invalid(keyPath, days, "must be a positive number of days"))
+					continue
+				}
+				rules.ValidityDays = append(rules.ValidityDays, n)
+			}
+		case RequestTypesKey:
+			for _, requestType := range splitList(value) {
+				if requestType != RequestTypeRSA && requestType != RequestTypeECC {
+					errs = append(errs, field.NotSupported(keyPath, requestType, []string{RequestTypeRSA, RequestTypeECC}))
+					continue
+				}
+				rules.RequestTypes = append(rules.RequestTypes, requestType)
+			}
+		default:
+			errs = append(errs, field.NotSupported(fldPath, key, []string{ZonesKey, ValidityDaysKey, RequestTypesKey}))
+		}
+	}
+	return rules, errs
+}
+
+// splitList returns the non-empty elements of a comma separated list.
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// Evaluate evaluates the request against the rules configured by the
+// plugin values. Invalid values and requests that cannot be decoded are
+// errors, which leave the request unapproved.
+func Evaluate(values map[string]string, cr *cmapi.CertificateRequest) (Response, error) {
+	rules, err := ParseRules(values)
+	if err != nil {
+		return Response{}, err
+	}
+	return rules.Evaluate(cr)
+}
+
+// Evaluate evaluates the request against the rules.
+func (r Rules) Evaluate(cr *cmapi.CertificateRequest) (Response, error) {
+	csr, err := pki.DecodeX509CertificateRequestBytes(cr.Spec.Request)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to decode the CSR of the request: %w", err)
+	}
+
+	var violations []string
+	if len(r.Zones) > 0 {
+		for _, name := range requestedNames(csr) {
+			if !inAnyZone(name, r.Zones) {
+				violations = append(violations, fmt.Sprintf("%q is not in the zones %s", name, strings.Join(r.Zones, ", ")))
+			}
+		}
+	}
+	if len(r.ValidityDays) > 0 && cr.Spec.Duration != nil {
+		// Cloudflare is asked for the whole days of the duration.
+		days := int64(cr.Spec.Duration.Hours() / 24)
+		if !slices.Contains(r.ValidityDays, days) {
+			violations = append(violations, fmt.Sprintf("a validity of %d days is not allowed", days))
+		}
+	}
+	if len(r.RequestTypes) > 0 {
+		requestType := requestTypeOf(csr)
+		if !slices.Contains(r.RequestTypes, requestType) {
+			violations = append(violations, fmt.Sprintf("request type %q is not allowed", requestType))
+		}
+	}
+
+	if len(violations) == 0 {
+		return Response{}, nil
+	}
+	return Response{Denied: true, Message: strings.Join(violations, "; ")}, nil
+}
+
+// requestedNames returns the DNS names and the common name of the CSR.
+func requestedNames(csr *x509.CertificateRequest) []string {
+	names := append([]string(nil), csr.DNSNames...)
+	if csr.Subject.CommonName != "" {
+		names = append(names, csr.Subject.CommonName)
+	}
+	return names
+}
+
+// inAnyZone reports whether name is one of the zones or in one of them.
+func inAnyZone(name string, zones []string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	for _, zone := range zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTypeOf returns the Cloudflare request type of the CSR, or its key
+// algorithm if Cloudflare does not sign such keys.
+func requestTypeOf(csr *x509.CertificateRequest) string {
+	switch csr.PublicKeyAlgorithm {
+	case x509.RSA:
+		return RequestTypeRSA
+	case x509.ECDSA:
+		return RequestTypeECC
+	default:
+		return csr.PublicKeyAlgorithm.String()
+	}
+}
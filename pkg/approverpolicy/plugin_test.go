@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package approverpolicy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func newRequest(t *testing.T, key crypto.Signer, duration time.Duration, commonName string, dnsNames ...string) *cmapi.CertificateRequest {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr := &cmapi.CertificateRequest{Spec: cmapi.CertificateRequestSpec{
+		Request: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+	}}
+	if duration > 0 {
+		cr.Spec.Duration = &metav1.Duration{Duration: duration}
+	}
+	return cr
+}
+
+func TestEvaluate(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const day = 24 * time.Hour
+	values := map[string]string{
+		ZonesKey:        "example.com, Example.ORG.",
+		ValidityDaysKey: "30,90",
+		RequestTypesKey: RequestTypeECC,
+	}
+
+	tests := []struct {
+		name        string
+		values      map[string]string
+		cr          *cmapi.CertificateRequest
+		wantDenied  bool
+		wantMessage string
+	}{
+		{
+			name:   "no rules",
+			values: map[string]string{},
+			cr:     newRequest(t, rsaKey, 5*day, "client.other.net"),
+		},
+		{
+			name:   "allowed",
+			values: values,
+			cr:     newRequest(t, ecKey, 90*day, "client.example.com", "example.org", "*.api.example.com"),
+		},
+		{
+			name:   "default validity",
+			values: values,
+			cr:     newRequest(t, ecKey, 0, "client.example.com"),
+		},
+		{
+			name:        "name outside zones",
+			values:      values,
+			cr:          newRequest(t, ecKey, 30*day, "client.example.com", "client.notexample.com"),
+			wantDenied:  true,
+			wantMessage: `"client.notexample.com" is not in the zones example.com, example.org`,
+		},
+		{
+			name:        "validity not allowed",
+			values:      values,
+			cr:          newRequest(t, ecKey, 365*day, "client.example.com"),
+			wantDenied:  true,
+			wantMessage: "a validity of 365 days is not allowed",
+		},
+		{
+			name:        "all violations",
+			values:      values,
+			cr:          newRequest(t, rsaKey, 7*day, "client.example.net"),
+			wantDenied:  true,
+			wantMessage: `"client.example.net" is not in the zones example.com, example.org; a validity of 7 days is not allowed; request type "origin-rsa" is not allowed`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Evaluate(tt.values, tt.cr)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if got.Denied != tt.wantDenied || got.Message != tt.wantMessage {
+				t.Errorf("Evaluate() = %+v, want denied %v with message %q", got, tt.wantDenied, tt.wantMessage)
+			}
+		})
+	}
+
+	if _, err := Evaluate(values, &cmapi.CertificateRequest{}); err == nil {
+		t.Error("Evaluate() of request without CSR = nil error, want error")
+	}
+	if _, err := Evaluate(map[string]string{"zone": "example.com"}, newRequest(t, ecKey, 0, "client.example.com")); err == nil {
+		t.Error("Evaluate() with invalid values = nil error, want error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fldPath := field.NewPath("spec", "plugins", Name, "values")
+	errs := Validate(fldPath, map[string]string{
+		ZonesKey:        "example.com,not a zone",
+		ValidityDaysKey: "30,0,ninety",
+		RequestTypesKey: "origin-rsa,keyless-certificate",
+		"zone":          "example.com",
+	})
+	want := []string{
+		`spec.plugins.cfmtls.values[requestTypes]: Unsupported value: "keyless-certificate": supported values: "origin-rsa", "origin-ecc"`,
+		`spec.plugins.cfmtls.values[validityDays]: Invalid value: "0": must be a positive number of days`,
+		`spec.plugins.cfmtls.values[validityDays]: Invalid value: "ninety": must be a positive number of days`,
+		`spec.plugins.cfmtls.values: Unsupported value: "zone": supported values: "zones", "validityDays", "requestTypes"`,
+	}
+	if len(errs) != len(want)+1 {
+		t.Fatalf("Validate() = %v, want %d errors", errs, len(want)+1)
+	}
+	for i, w := range want {
+		if got := errs[i].Error(); got != w {
+			t.Errorf("Validate()[%d] = %q, want %q", i, got, w)
+		}
+	}
+	if got := errs[len(want)].Field; got != "spec.plugins.cfmtls.values[zones]" {
+		t.Errorf("Validate()[%d].Field = %q, want the zones", len(want), got)
+	}
+
+	if errs := Validate(fldPath, map[string]string{ZonesKey: "example.com", ValidityDaysKey: "90", RequestTypesKey: "origin-ecc"}); len(errs) != 0 {
+		t.Errorf("Validate() of valid values = %v, want none", errs)
+	}
+}